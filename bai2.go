@@ -0,0 +1,131 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BAI2TotalIncomingMoneyTransfers is the BAI2 summary type code of incoming wires
+	BAI2TotalIncomingMoneyTransfers = "190"
+	// BAI2IncomingMoneyTransfer is the BAI2 detail type code of an incoming domestic wire
+	BAI2IncomingMoneyTransfer = "195"
+	// BAI2InternationalMoneyTransferCredit is the BAI2 detail type code of an incoming wire instructed in another currency
+	BAI2InternationalMoneyTransferCredit = "208"
+)
+
+// WriteBAI2 writes received (incoming) FEDWireMessages as a BAI2 file. A group (02) is written per OutputCycleDate
+// of the OMAD, containing an account (03) per beneficiary account with a summary of the total incoming money
+// transfers and a transaction detail (16) record per wire.
+//
+// Detail records use type code BAI2IncomingMoneyTransfer, or BAI2InternationalMoneyTransferCredit for foreign
+// exchange transfers, with the IMAD as the bank reference, the SenderReference as the customer reference and
+// the originator and OriginatorToBeneficiary as text. Every message must have OutputMessageAccountabilityData,
+// an Amount and a Beneficiary identifier (the account credited).
+func WriteBAI2(w io.Writer, msgs []FEDWireMessage, opts CreditNotificationOptions) error {
+	accounts, err := newCreditNotifications(msgs)
+	if err != nil {
+		return err
+	}
+
+	// split each account's wires by the day they were received
+	groups := make(map[string][]creditNotificationAccount)
+	for _, acct := range accounts {
+		byDate := make(map[string][]creditNotification)
+		for _, cn := range acct.notifications {
+			date := bai2Date(cn.valueDate)
+			byDate[date] = append(byDate[date], cn)
+		}
+		for date, notifications := range byDate {
+			groups[date] = append(groups[date], creditNotificationAccount{account: acct.account, notifications: notifications})
+		}
+	}
+	dates := make([]string, 0, len(groups))
+	for date := range groups {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	created := opts.creationTime()
+	var lines []string
+	lines = append(lines, bai2Record("01", opts.SenderID, opts.ReceiverID, bai2Date(created), created.Format("1504"),
+		opts.MessageID, "", "", "2"))
+
+	var fileTotal int64
+	for _, date := range dates {
+		groupStart := len(lines)
+		lines = append(lines, bai2Record("02", opts.ReceiverID, opts.SenderID, "1", date, "", "USD", "3"))
+
+		var groupTotal int64
+		for _, acct := range groups[date] {
+			accountStart := len(lines)
+			var total int64
+			for _, cn := range acct.notifications {
+				total += cn.cents
+			}
+			lines = append(lines, bai2Record("03", acct.account, "USD", BAI2TotalIncomingMoneyTransfers,
+				strconv.FormatInt(total, 10), strconv.Itoa(len(acct.notifications)), ""))
+			for _, cn := range acct.notifications {
+				lines = append(lines, cn.bai2Detail())
+			}
+			// the account control total is the sum of the 03 and 16 record amounts
+			accountTotal := total * 2
+			lines = append(lines, bai2Record("49", strconv.FormatInt(accountTotal, 10), strconv.Itoa(len(lines)-accountStart+1)))
+			groupTotal += accountTotal
+		}
+		lines = append(lines, bai2Record("98", strconv.FormatInt(groupTotal, 10), strconv.Itoa(len(groups[date])),
+			strconv.Itoa(len(lines)-groupStart+1)))
+		fileTotal += groupTotal
+	}
+	lines = append(lines, bai2Record("99", strconv.FormatInt(fileTotal, 10), strconv.Itoa(len(dates)), strconv.Itoa(len(lines)+1)))
+
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// bai2Detail returns the transaction detail (16) record of the wire
+func (cn creditNotification) bai2Detail() string {
+	typeCode := BAI2IncomingMoneyTransfer
+	if cn.international() {
+		typeCode = BAI2InternationalMoneyTransferCredit
+	}
+	var customerRef string
+	if cn.fwm.SenderReference != nil {
+		customerRef = bai2Field(cn.fwm.SenderReference.SenderReference)
+	}
+
+	var text []string
+	if cn.fwm.Originator != nil && strings.TrimSpace(cn.fwm.Originator.Personal.Name) != "" {
+		text = append(text, "ORIGINATOR "+strings.TrimSpace(cn.fwm.Originator.Personal.Name))
+	}
+	text = append(text, cn.remittanceLines()...)
+
+	fields := []string{"16", typeCode, strconv.FormatInt(cn.cents, 10), "0", bai2Field(cn.imad()), customerRef}
+	if len(text) == 0 {
+		return strings.Join(fields, ",") + ",/"
+	}
+	// the text field runs to the end of the record, so it's not delimited
+	return strings.Join(fields, ",") + "," + strings.Join(text, " ")
+}
+
+// bai2Record joins fields into a record terminated by the BAI2 delimiter
+func bai2Record(fields ...string) string {
+	return strings.Join(fields, ",") + "/"
+}
+
+// bai2Field removes the BAI2 field and record delimiters from s
+func bai2Field(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(",", " ", "/", " ").Replace(s))
+}
+
+// bai2Date formats t as a BAI2 date, YYMMDD
+func bai2Date(t time.Time) string {
+	return t.Format("060102")
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBAI2(t *testing.T) {
+	first := mockCreditNotificationData()
+	first.SenderReference.SenderReference = "REF,ONE/1"
+	second := mockCreditNotificationData()
+	second.Originator = nil
+	second.SenderReference = nil
+	second.Amount.Amount = "000000000100"
+	second.OutputMessageAccountabilityData.OutputSequenceNumber = "000002"
+	third := mockCreditNotificationData()
+	third.Beneficiary.Personal.Identifier = "5678"
+	third.OutputMessageAccountabilityData.OutputCycleDate = "20190503"
+	third.InstructedAmount = mockInstructedAmount()
+	third.InstructedAmount.CurrencyCode = "EUR"
+	third.OriginatorToBeneficiary = mockOriginatorToBeneficiary()
+
+	var buf strings.Builder
+	require.NoError(t, WriteBAI2(&buf, []FEDWireMessage{first, second, third}, mockCreditNotificationOptions()))
+
+	imad := first.InputMessageAccountabilityData
+	ref := imad.InputCycleDate + imad.InputSource + imad.InputSequenceNumber
+	expected := []string{
+		"01,231380104,CUSTOMER1,190502,1300,MSG0001,,,2/",
+		"02,CUSTOMER1,231380104,1,190502,,USD,3/",
+		"03,1234,USD,190,1234667,2,/",
+		"16,195,1234567,0," + ref + ",REF ONE 1,ORIGINATOR Name",
+		"16,195,100,0," + ref + ",,/",
+		"49,2469334,4/",
+		"98,2469334,1,6/",
+		"02,CUSTOMER1,231380104,1,190503,,USD,3/",
+		"03,5678,USD,190,1234567,1,/",
+		"16,208,1234567,0," + ref + ",Sender Reference,ORIGINATOR Name LineOne LineTwo LineThree LineFour",
+		"49,2469134,3/",
+		"98,2469134,1,5/",
+		"99,4938468,2,13/",
+	}
+	require.Equal(t, strings.Join(expected, "\n")+"\n", buf.String())
+}
+
+func TestWriteBAI2Error(t *testing.T) {
+	fwm := mockCreditNotificationData()
+	fwm.OutputMessageAccountabilityData = nil
+
+	var buf strings.Builder
+	err := WriteBAI2(&buf, []FEDWireMessage{fwm}, mockCreditNotificationOptions())
+	require.EqualError(t, err, fieldError("OutputMessageAccountabilityData", ErrFieldRequired).Error())
+	require.Empty(t, buf.String())
+}
@@ -0,0 +1,336 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Camt054Namespace is the ISO 20022 BankToCustomerDebitCreditNotification version written by WriteCamt054
+const Camt054Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.054.001.08"
+
+// WriteCamt054 writes received (incoming) FEDWireMessages as an ISO 20022 camt.054 Bank to Customer
+// Debit Credit Notification. Each beneficiary account becomes a notification (Ntfctn) with a booked
+// credit entry (Ntry) per wire.
+//
+// Every message must have OutputMessageAccountabilityData, an Amount and a Beneficiary identifier (the
+// account credited). The OMAD is reported as the account servicer reference, the IMAD as the clearing
+// system reference and the OutputCycleDate as the value date. The ReceiptTimeStamp, when present, is
+// reported as the booking date time.
+func WriteCamt054(w io.Writer, msgs []FEDWireMessage, opts CreditNotificationOptions) error {
+	accounts, err := newCreditNotifications(msgs)
+	if err != nil {
+		return err
+	}
+	created := opts.creationTime().Format("2006-01-02T15:04:05")
+
+	doc := camtDocument{
+		Xmlns: Camt054Namespace,
+		Notification: camtBkToCstmrDbtCdtNtfctn{
+			GroupHeader: camtGroupHeader{
+				MessageID:    opts.MessageID,
+				CreationTime: created,
+			},
+		},
+	}
+	for i, acct := range accounts {
+		ntfctn := camtNotification{
+			ID:           opts.MessageID + "-" + strconv.Itoa(i+1),
+			CreationTime: created,
+			Account: camtAccount{
+				ID:       camtAccountID{Other: &camtOther{ID: acct.account}},
+				Currency: "USD",
+			},
+		}
+		for _, cn := range acct.notifications {
+			ntfctn.Entries = append(ntfctn.Entries, cn.camtEntry())
+		}
+		doc.Notification.Notifications = append(doc.Notification.Notifications, ntfctn)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func (cn creditNotification) camtEntry() camtEntry {
+	amount := camtAmount{Currency: "USD", Value: formatCents(cn.cents)}
+	entry := camtEntry{
+		Amount:               amount,
+		CreditDebitIndicator: CreditIndicator,
+		Status:               camtCode{Code: "BOOK"},
+		ValueDate:            camtDate{Date: cn.valueDate.Format("2006-01-02")},
+		AccountServicerRef:   cn.omad(),
+		BankTransactionCode:  camtBankTransactionCode{Domain: camtDomain{Code: "PMNT", Family: camtFamily{Code: "RCDT", SubFamilyCode: "DMCT"}}},
+		AdditionalEntryInfo:  "FEDWIRE",
+		EntryDetails:         camtEntryDetails{},
+	}
+	if cn.international() {
+		entry.BankTransactionCode.Domain.Family.SubFamilyCode = "XBCT"
+	}
+	if cn.booked.IsZero() {
+		entry.BookingDate = camtDate{Date: cn.valueDate.Format("2006-01-02")}
+	} else {
+		entry.BookingDate = camtDate{DateTime: cn.booked.Format("2006-01-02T15:04:05")}
+	}
+
+	tx := camtTransactionDetails{
+		References: camtReferences{
+			EndToEndID:        "NOTPROVIDED",
+			ClearingSystemRef: cn.imad(),
+		},
+		Amount:               amount,
+		CreditDebitIndicator: CreditIndicator,
+	}
+	fwm := cn.fwm
+	if fwm.SenderReference != nil && strings.TrimSpace(fwm.SenderReference.SenderReference) != "" {
+		tx.References.EndToEndID = strings.TrimSpace(fwm.SenderReference.SenderReference)
+	}
+	if ia := fwm.InstructedAmount; ia != nil && ia.CurrencyCode != "" {
+		if instructed, decimals, err := parseDecimalAmount(ia.Amount); err == nil {
+			tx.AmountDetails = &camtAmountDetails{
+				InstructedAmount: camtAmountAndCurrency{Amount: camtAmount{Currency: ia.CurrencyCode, Value: instructed.FloatString(decimals)}},
+			}
+		}
+	}
+
+	parties := &camtRelatedParties{}
+	if fwm.Originator != nil {
+		parties.Debtor = &camtPartyChoice{Party: camtParty{Name: fwm.Originator.Personal.Name}}
+		if id := strings.TrimSpace(fwm.Originator.Personal.Identifier); id != "" {
+			parties.DebtorAccount = &camtAccount{ID: camtAccountID{Other: &camtOther{ID: id}}}
+		}
+	}
+	parties.Creditor = &camtPartyChoice{Party: camtParty{Name: fwm.Beneficiary.Personal.Name}}
+	parties.CreditorAccount = &camtAccount{ID: camtAccountID{Other: &camtOther{ID: cn.account}}}
+	tx.RelatedParties = parties
+
+	if sdi := fwm.SenderDepositoryInstitution; sdi != nil {
+		tx.RelatedAgents = &camtRelatedAgents{
+			DebtorAgent: &camtAgent{FinancialInstitution: camtFinancialInstitution{
+				ClearingSystemMember: &camtClearingSystemMember{SystemID: camtCode{Code: "USABA"}, MemberID: sdi.SenderABANumber},
+				Name:                 sdi.SenderShortName,
+			}},
+		}
+	}
+
+	remittance := &camtRemittanceInformation{Unstructured: cn.remittanceLines()}
+	if adv, err := fwm.RemittanceAdvice(); err == nil {
+		for _, doc := range adv.Documents {
+			remittance.Structured = append(remittance.Structured, camtStructuredRemittance(doc))
+		}
+	}
+	if len(remittance.Unstructured) > 0 || len(remittance.Structured) > 0 {
+		tx.RemittanceInformation = remittance
+	}
+
+	entry.EntryDetails.TransactionDetails = []camtTransactionDetails{tx}
+	return entry
+}
+
+func camtStructuredRemittance(doc RemittanceDocument) camtStructured {
+	docType := camtCodeOrProprietary{Code: doc.documentTypeCode()}
+	if docType.Code == ProprietaryDocumentType {
+		docType = camtCodeOrProprietary{Proprietary: doc.ProprietaryDocumentTypeCode}
+	}
+	strd := camtStructured{
+		ReferredDocument: camtReferredDocument{
+			Type:   camtReferredDocumentType{CodeOrProprietary: docType},
+			Number: doc.DocumentIdentificationNumber,
+		},
+		ReferredAmount: camtReferredAmount{
+			Remitted: &camtAmount{Currency: doc.currencyCode(), Value: x12Amount(doc.AmountPaid)},
+		},
+	}
+	if len(doc.Date) == 8 {
+		strd.ReferredDocument.RelatedDate = doc.Date[:4] + "-" + doc.Date[4:6] + "-" + doc.Date[6:]
+	}
+	if doc.GrossAmount != "" {
+		strd.ReferredAmount.DuePayable = &camtAmount{Currency: doc.currencyCode(), Value: x12Amount(doc.GrossAmount)}
+	}
+	if doc.DiscountAmount != "" {
+		strd.ReferredAmount.Discount = &camtAmountAndCurrency{Amount: camtAmount{Currency: doc.currencyCode(), Value: x12Amount(doc.DiscountAmount)}}
+	}
+	return strd
+}
+
+// camt.054.001.08 elements written by WriteCamt054
+
+type camtDocument struct {
+	XMLName      xml.Name                  `xml:"Document"`
+	Xmlns        string                    `xml:"xmlns,attr"`
+	Notification camtBkToCstmrDbtCdtNtfctn `xml:"BkToCstmrDbtCdtNtfctn"`
+}
+
+type camtBkToCstmrDbtCdtNtfctn struct {
+	GroupHeader   camtGroupHeader    `xml:"GrpHdr"`
+	Notifications []camtNotification `xml:"Ntfctn"`
+}
+
+type camtGroupHeader struct {
+	MessageID    string `xml:"MsgId"`
+	CreationTime string `xml:"CreDtTm"`
+}
+
+type camtNotification struct {
+	ID           string      `xml:"Id"`
+	CreationTime string      `xml:"CreDtTm"`
+	Account      camtAccount `xml:"Acct"`
+	Entries      []camtEntry `xml:"Ntry"`
+}
+
+type camtAccount struct {
+	ID       camtAccountID `xml:"Id"`
+	Currency string        `xml:"Ccy,omitempty"`
+}
+
+type camtAccountID struct {
+	Other *camtOther `xml:"Othr,omitempty"`
+}
+
+type camtOther struct {
+	ID string `xml:"Id"`
+}
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtCode struct {
+	Code string `xml:"Cd"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt,omitempty"`
+	DateTime string `xml:"DtTm,omitempty"`
+}
+
+type camtEntry struct {
+	Amount               camtAmount              `xml:"Amt"`
+	CreditDebitIndicator string                  `xml:"CdtDbtInd"`
+	Status               camtCode                `xml:"Sts"`
+	BookingDate          camtDate                `xml:"BookgDt"`
+	ValueDate            camtDate                `xml:"ValDt"`
+	AccountServicerRef   string                  `xml:"AcctSvcrRef"`
+	BankTransactionCode  camtBankTransactionCode `xml:"BkTxCd"`
+	EntryDetails         camtEntryDetails        `xml:"NtryDtls"`
+	AdditionalEntryInfo  string                  `xml:"AddtlNtryInf,omitempty"`
+}
+
+type camtBankTransactionCode struct {
+	Domain camtDomain `xml:"Domn"`
+}
+
+type camtDomain struct {
+	Code   string     `xml:"Cd"`
+	Family camtFamily `xml:"Fmly"`
+}
+
+type camtFamily struct {
+	Code          string `xml:"Cd"`
+	SubFamilyCode string `xml:"SubFmlyCd"`
+}
+
+type camtEntryDetails struct {
+	TransactionDetails []camtTransactionDetails `xml:"TxDtls"`
+}
+
+type camtTransactionDetails struct {
+	References            camtReferences             `xml:"Refs"`
+	Amount                camtAmount                 `xml:"Amt"`
+	CreditDebitIndicator  string                     `xml:"CdtDbtInd"`
+	AmountDetails         *camtAmountDetails         `xml:"AmtDtls,omitempty"`
+	RelatedParties        *camtRelatedParties        `xml:"RltdPties,omitempty"`
+	RelatedAgents         *camtRelatedAgents         `xml:"RltdAgts,omitempty"`
+	RemittanceInformation *camtRemittanceInformation `xml:"RmtInf,omitempty"`
+}
+
+type camtReferences struct {
+	EndToEndID        string `xml:"EndToEndId"`
+	ClearingSystemRef string `xml:"ClrSysRef,omitempty"`
+}
+
+type camtAmountDetails struct {
+	InstructedAmount camtAmountAndCurrency `xml:"InstdAmt"`
+}
+
+type camtAmountAndCurrency struct {
+	Amount camtAmount `xml:"Amt"`
+}
+
+type camtRelatedParties struct {
+	Debtor          *camtPartyChoice `xml:"Dbtr,omitempty"`
+	DebtorAccount   *camtAccount     `xml:"DbtrAcct,omitempty"`
+	Creditor        *camtPartyChoice `xml:"Cdtr,omitempty"`
+	CreditorAccount *camtAccount     `xml:"CdtrAcct,omitempty"`
+}
+
+type camtPartyChoice struct {
+	Party camtParty `xml:"Pty"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm,omitempty"`
+}
+
+type camtRelatedAgents struct {
+	DebtorAgent *camtAgent `xml:"DbtrAgt,omitempty"`
+}
+
+type camtAgent struct {
+	FinancialInstitution camtFinancialInstitution `xml:"FinInstnId"`
+}
+
+type camtFinancialInstitution struct {
+	ClearingSystemMember *camtClearingSystemMember `xml:"ClrSysMmbId,omitempty"`
+	Name                 string                    `xml:"Nm,omitempty"`
+}
+
+type camtClearingSystemMember struct {
+	SystemID camtCode `xml:"ClrSysId"`
+	MemberID string   `xml:"MmbId"`
+}
+
+type camtRemittanceInformation struct {
+	Unstructured []string         `xml:"Ustrd,omitempty"`
+	Structured   []camtStructured `xml:"Strd,omitempty"`
+}
+
+type camtStructured struct {
+	ReferredDocument camtReferredDocument `xml:"RfrdDocInf"`
+	ReferredAmount   camtReferredAmount   `xml:"RfrdDocAmt"`
+}
+
+type camtReferredDocument struct {
+	Type        camtReferredDocumentType `xml:"Tp"`
+	Number      string                   `xml:"Nb,omitempty"`
+	RelatedDate string                   `xml:"RltdDt,omitempty"`
+}
+
+type camtReferredDocumentType struct {
+	CodeOrProprietary camtCodeOrProprietary `xml:"CdOrPrtry"`
+}
+
+type camtCodeOrProprietary struct {
+	Code        string `xml:"Cd,omitempty"`
+	Proprietary string `xml:"Prtry,omitempty"`
+}
+
+type camtReferredAmount struct {
+	DuePayable *camtAmount            `xml:"DuePyblAmt,omitempty"`
+	Discount   *camtAmountAndCurrency `xml:"DscntApldAmt,omitempty"`
+	Remitted   *camtAmount            `xml:"RmtdAmt,omitempty"`
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCamt054(t *testing.T) {
+	fwm := mockCreditNotificationData()
+	fwm.OriginatorToBeneficiary = mockOriginatorToBeneficiary()
+
+	var buf strings.Builder
+	require.NoError(t, WriteCamt054(&buf, []FEDWireMessage{fwm}, mockCreditNotificationOptions()))
+	require.True(t, strings.HasPrefix(buf.String(), xml.Header))
+	require.Contains(t, buf.String(), `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.054.001.08">`)
+
+	var doc camtDocument
+	require.NoError(t, xml.Unmarshal([]byte(buf.String()), &doc))
+	require.Equal(t, "MSG0001", doc.Notification.GroupHeader.MessageID)
+	require.Equal(t, "2019-05-02T13:00:00", doc.Notification.GroupHeader.CreationTime)
+	require.Len(t, doc.Notification.Notifications, 1)
+
+	ntfctn := doc.Notification.Notifications[0]
+	require.Equal(t, "MSG0001-1", ntfctn.ID)
+	require.Equal(t, "1234", ntfctn.Account.ID.Other.ID)
+	require.Len(t, ntfctn.Entries, 1)
+
+	entry := ntfctn.Entries[0]
+	require.Equal(t, camtAmount{Currency: "USD", Value: "12345.67"}, entry.Amount)
+	require.Equal(t, "CRDT", entry.CreditDebitIndicator)
+	require.Equal(t, "BOOK", entry.Status.Code)
+	require.Equal(t, "2019-05-02T12:30:00", entry.BookingDate.DateTime)
+	require.Equal(t, "2019-05-02", entry.ValueDate.Date)
+	require.Equal(t, "20190502Source0800000105021230B123", entry.AccountServicerRef)
+	require.Equal(t, "DMCT", entry.BankTransactionCode.Domain.Family.SubFamilyCode)
+
+	tx := entry.EntryDetails.TransactionDetails[0]
+	require.Equal(t, fwm.SenderReference.SenderReference, tx.References.EndToEndID)
+	imad := fwm.InputMessageAccountabilityData
+	require.Equal(t, imad.InputCycleDate+imad.InputSource+imad.InputSequenceNumber, tx.References.ClearingSystemRef)
+	require.Equal(t, fwm.Originator.Personal.Name, tx.RelatedParties.Debtor.Party.Name)
+	require.Equal(t, "121042882", tx.RelatedAgents.DebtorAgent.FinancialInstitution.ClearingSystemMember.MemberID)
+	require.Equal(t, []string{"LineOne", "LineTwo", "LineThree", "LineFour"}, tx.RemittanceInformation.Unstructured)
+}
+
+func TestWriteCamt054Remittance(t *testing.T) {
+	fwm := mockPaymentAdviceData()
+	fwm.OriginatorToBeneficiary = nil
+	fwm.OutputMessageAccountabilityData = mockOutputMessageAccountabilityData()
+	fwm.InstructedAmount = mockInstructedAmount()
+	fwm.InstructedAmount.CurrencyCode = "EUR"
+	fwm.InstructedAmount.Amount = "10000,00"
+
+	var buf strings.Builder
+	require.NoError(t, WriteCamt054(&buf, []FEDWireMessage{fwm}, mockCreditNotificationOptions()))
+
+	var doc camtDocument
+	require.NoError(t, xml.Unmarshal([]byte(buf.String()), &doc))
+	entry := doc.Notification.Notifications[0].Entries[0]
+	require.Equal(t, "XBCT", entry.BankTransactionCode.Domain.Family.SubFamilyCode)
+	require.Equal(t, "2019-05-02", entry.BookingDate.Date)
+
+	tx := entry.EntryDetails.TransactionDetails[0]
+	require.Equal(t, camtAmount{Currency: "EUR", Value: "10000.00"}, tx.AmountDetails.InstructedAmount.Amount)
+	require.Len(t, tx.RemittanceInformation.Structured, 1)
+	strd := tx.RemittanceInformation.Structured[0]
+	require.Equal(t, CommercialInvoice, strd.ReferredDocument.Type.CodeOrProprietary.Code)
+	require.Equal(t, "INV-1001", strd.ReferredDocument.Number)
+	require.Equal(t, "2020-07-10", strd.ReferredDocument.RelatedDate)
+	require.Equal(t, "1175.00", strd.ReferredAmount.Remitted.Value)
+	require.Equal(t, "25.00", strd.ReferredAmount.Discount.Amount.Value)
+}
+
+func TestWriteCamt054Error(t *testing.T) {
+	var buf strings.Builder
+	require.Equal(t, ErrNoCreditNotifications, WriteCamt054(&buf, nil, mockCreditNotificationOptions()))
+	require.Empty(t, buf.String())
+}
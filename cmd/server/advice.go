@@ -0,0 +1,119 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+func addAdviceRoutes(logger log.Logger, r *mux.Router, repo WireFileRepository, renderer *wire.PaymentAdviceRenderer, opts *fileRoutesOptions) {
+	r.Methods("GET").Path("/files/{fileId}/advice").HandlerFunc(getFileAdvice(logger, repo, renderer, opts))
+}
+
+// readPaymentAdviceRenderer returns a PaymentAdviceRenderer using the templates read from the files
+// in ADVICE_TEXT_TEMPLATE_FILE and ADVICE_HTML_TEMPLATE_FILE, or the default templates when they're unset.
+func readPaymentAdviceRenderer() (*wire.PaymentAdviceRenderer, error) {
+	var opts []wire.PaymentAdviceOptionFunc
+	if path := os.Getenv("ADVICE_TEXT_TEMPLATE_FILE"); path != "" {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading ADVICE_TEXT_TEMPLATE_FILE: %v", err)
+		}
+		opts = append(opts, wire.PaymentAdviceTextTemplate(string(bs)))
+	}
+	if path := os.Getenv("ADVICE_HTML_TEMPLATE_FILE"); path != "" {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading ADVICE_HTML_TEMPLATE_FILE: %v", err)
+		}
+		opts = append(opts, wire.PaymentAdviceHTMLTemplate(string(bs)))
+	}
+	return wire.NewPaymentAdviceRenderer(opts...)
+}
+
+// adviceFormat returns "html" or "text" based on the `format` query param,
+// falling back to the Accept header and then plain text.
+func adviceFormat(r *http.Request) (string, error) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "html", "text":
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			return "html", nil
+		}
+		return "text", nil
+	default:
+		return "", fmt.Errorf("unknown advice format: %s", format)
+	}
+}
+
+func getFileAdvice(logger log.Logger, repo WireFileRepository, renderer *wire.PaymentAdviceRenderer, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		format, err := adviceFormat(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid advice request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid advice request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+		logger.Logf("rendering %s advice", format)
+		file = opts.redact(file, mask)
+
+		var buf strings.Builder
+		if format == "html" {
+			err = renderer.RenderHTML(&buf, file.FEDWireMessage)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		} else {
+			err = renderer.RenderText(&buf, file.FEDWireMessage)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		if err != nil {
+			w.Header().Del("Content-Type")
+			err = logger.LogErrorf("problem rendering advice: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		opts.recordAudit(logger, r, auditRead, fileId, nil, nil, "read "+format+" advice")
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(buf.String()))
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvice_getFileAdvice(t *testing.T) {
+	repo := &testWireFileRepository{
+		file: &wire.File{
+			ID:             base.ID(),
+			FEDWireMessage: mockFEDWireMessage(),
+		},
+	}
+	renderer, err := wire.NewPaymentAdviceRenderer()
+	require.NoError(t, err)
+	router := mux.NewRouter()
+	addAdviceRoutes(log.NewNopLogger(), router, repo, renderer, &fileRoutesOptions{audit: newAuditLog(), redactionPolicy: wire.DefaultRedactionPolicy()})
+
+	t.Run("text advice", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "PAYMENT ADVICE")
+	})
+
+	t.Run("html advice", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/files/foo/advice", nil)
+		req.Header.Set("Accept", "text/html")
+		router.ServeHTTP(w, req)
+		w.Flush()
+
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "<h1>Payment Advice</h1>")
+	})
+
+	t.Run("masked advice", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice", nil))
+		w.Flush()
+		require.Contains(t, w.Body.String(), "Address One")
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice?mask=true", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+		assert.Contains(t, w.Body.String(), "N***")
+		assert.NotContains(t, w.Body.String(), "Address One")
+		require.Equal(t, "Name", repo.file.FEDWireMessage.Originator.Personal.Name)
+	})
+
+	t.Run("invalid mask", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice?mask=maybe", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice?format=pdf", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+
+	t.Run("repo error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		repo.err = errors.New("bad error")
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		repo.file = nil
+		repo.err = nil
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body)
+	})
+}
+
+func TestAdvice_readPaymentAdviceRenderer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "advice.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Paid {{ .Amount }}"), 0600))
+
+	t.Setenv("ADVICE_TEXT_TEMPLATE_FILE", path)
+	renderer, err := readPaymentAdviceRenderer()
+	require.NoError(t, err)
+
+	repo := &testWireFileRepository{
+		file: &wire.File{
+			ID:             base.ID(),
+			FEDWireMessage: mockFEDWireMessage(),
+		},
+	}
+	router := mux.NewRouter()
+	addAdviceRoutes(log.NewNopLogger(), router, repo, renderer, &fileRoutesOptions{audit: newAuditLog(), redactionPolicy: wire.DefaultRedactionPolicy()})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/advice?format=text", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Regexp(t, `^Paid [0-9,]+\.[0-9]{2}$`, w.Body.String())
+
+	t.Setenv("ADVICE_HTML_TEMPLATE_FILE", filepath.Join(dir, "missing.html"))
+	_, err = readPaymentAdviceRenderer()
+	require.Error(t, err)
+}
@@ -0,0 +1,503 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+const (
+	// statusDraft is a file which can be modified, files without an approval are drafts
+	statusDraft = "draft"
+	// statusPendingApproval is a file submitted for approval
+	statusPendingApproval = "pending_approval"
+	// statusApproved is a file approved by a checker, its contents can be released
+	statusApproved = "approved"
+	// statusReleased is an approved file whose contents were released to be sent
+	statusReleased = "released"
+	// statusRejected is a file rejected by a checker
+	statusRejected = "rejected"
+)
+
+var (
+	errNoUserID          = errors.New("no user ID found, set the X-User-ID header")
+	errNotPermitted      = errors.New("user is not permitted")
+	errSelfApproval      = errors.New("file must be approved by someone other than who created or submitted it")
+	errNotApproved       = errors.New("file is not approved")
+	errFileNotDraft      = errors.New("file is not a draft")
+	errStatusTransition  = errors.New("invalid status transition")
+	errUnknownFileStatus = errors.New("unknown file status")
+)
+
+// approvalTransitions are the statuses a file can move to from each status
+var approvalTransitions = map[string][]string{
+	statusDraft:           {statusPendingApproval},
+	statusPendingApproval: {statusApproved, statusRejected},
+	statusApproved:        {statusReleased, statusRejected},
+}
+
+// approvalEvent is a status transition of a file
+type approvalEvent struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	UserID  string    `json:"userID"`
+	Comment string    `json:"comment,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// fileApproval is the status of a file and the history of its transitions
+type fileApproval struct {
+	FileID string `json:"fileID"`
+	Status string `json:"status"`
+	// CreatedBy is the user who created the file
+	CreatedBy string `json:"createdBy,omitempty"`
+	// CreatedAt is when the file was created, zero when it wasn't created through the file routes
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	// SubmittedBy is the user who submitted the file for approval
+	SubmittedBy string          `json:"submittedBy,omitempty"`
+	History     []approvalEvent `json:"history"`
+}
+
+// approvalRepository holds the approvals of files in memory
+type approvalRepository struct {
+	mu        sync.Mutex
+	approvals map[string]*fileApproval
+}
+
+func newApprovalRepository() *approvalRepository {
+	return &approvalRepository{
+		approvals: make(map[string]*fileApproval),
+	}
+}
+
+// getApproval returns a copy of the approval of a file, a draft without history when there's none
+func (r *approvalRepository) getApproval(fileID string) fileApproval {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.approvals[fileID]
+	if !ok {
+		return fileApproval{FileID: fileID, Status: statusDraft, History: []approvalEvent{}}
+	}
+	out := *a
+	out.History = append([]approvalEvent{}, a.History...)
+	return out
+}
+
+// transition moves a file to status to. check is called with the current approval and can refuse the transition.
+func (r *approvalRepository) transition(fileID, to, userID, comment string, check func(fileApproval) error) (fileApproval, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.approvals[fileID]
+	if !ok {
+		a = &fileApproval{FileID: fileID, Status: statusDraft}
+	}
+	if !canTransition(a.Status, to) {
+		return fileApproval{}, fmt.Errorf("%w from %s to %s", errStatusTransition, a.Status, to)
+	}
+	if check != nil {
+		if err := check(*a); err != nil {
+			return fileApproval{}, err
+		}
+	}
+	if to == statusPendingApproval {
+		a.SubmittedBy = userID
+	}
+	a.History = append(a.History, approvalEvent{
+		From:    a.Status,
+		To:      to,
+		UserID:  userID,
+		Comment: comment,
+		Time:    time.Now(),
+	})
+	a.Status = to
+	r.approvals[fileID] = a
+
+	out := *a
+	out.History = append([]approvalEvent{}, a.History...)
+	return out, nil
+}
+
+// created records userID as the creator of a new file
+func (r *approvalRepository) created(fileID, userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.approvals[fileID] = &fileApproval{FileID: fileID, Status: statusDraft, CreatedBy: userID, CreatedAt: time.Now()}
+}
+
+// createdBetween returns the IDs of the files created from start to end, sorted
+func (r *approvalRepository) createdBetween(start, end time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []string
+	for id, a := range r.approvals {
+		if !a.CreatedAt.IsZero() && !a.CreatedAt.Before(start) && !a.CreatedAt.After(end) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// approvedSince returns the IDs of approved and released files which were approved at or after t
+func (r *approvalRepository) approvedSince(t time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []string
+	for id, a := range r.approvals {
+		if a.Status != statusApproved && a.Status != statusReleased {
+			continue
+		}
+		for _, event := range a.History {
+			if event.To == statusApproved && !event.Time.Before(t) {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// revert undoes event, the last transition of a file, when it's still the last. It returns false when the file
+// has moved on since.
+func (r *approvalRepository) revert(fileID string, event approvalEvent) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.approvals[fileID]
+	if !ok || len(a.History) == 0 || a.History[len(a.History)-1] != event {
+		return false
+	}
+	a.History = a.History[:len(a.History)-1]
+	a.Status = event.From
+	return true
+}
+
+func (r *approvalRepository) deleteApproval(fileID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.approvals, fileID)
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range approvalTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalPolicy holds the users permitted to create (submit) files and to approve, reject and release them.
+// Any user is permitted when a set is empty.
+type approvalPolicy struct {
+	makers   map[string]bool
+	checkers map[string]bool
+}
+
+func (p approvalPolicy) canCreate(userID string) bool {
+	return len(p.makers) == 0 || p.makers[userID]
+}
+
+func (p approvalPolicy) canApprove(userID string) bool {
+	return len(p.checkers) == 0 || p.checkers[userID]
+}
+
+// withApprovalPolicy sets the users permitted to create and approve files
+func withApprovalPolicy(policy approvalPolicy) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.approvalPolicy = policy
+	}
+}
+
+// withApprovalRepository uses approvals to hold the status of files, so it can be shared with the stored files metric
+func withApprovalRepository(approvals *approvalRepository) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.approvals = approvals
+	}
+}
+
+// withRequiredApproval only serves the contents of approved files
+func withRequiredApproval() fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.requireApproval = true
+	}
+}
+
+// readApprovalOptions returns the file route options configured by REQUIRE_APPROVAL, APPROVAL_MAKERS
+// and APPROVAL_CHECKERS. Approval is required by default when requests are authenticated. Without
+// authentication the X-User-ID header is set by callers, so anyone could approve their own files and
+// requiring approval is refused.
+func readApprovalOptions(authenticated bool) ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	required := authenticated
+	if v := os.Getenv("REQUIRE_APPROVAL"); v != "" {
+		var err error
+		required, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REQUIRE_APPROVAL: %v", err)
+		}
+	}
+	if required {
+		if !authenticated {
+			return nil, errors.New("REQUIRE_APPROVAL needs authentication, set API_KEYS_FILE, JWT_JWKS_FILE or MTLS_CLIENTS_FILE")
+		}
+		opts = append(opts, withRequiredApproval())
+	}
+	policy := approvalPolicy{
+		makers:   readUserIDs(os.Getenv("APPROVAL_MAKERS")),
+		checkers: readUserIDs(os.Getenv("APPROVAL_CHECKERS")),
+	}
+	opts = append(opts, withApprovalPolicy(policy))
+	return opts, nil
+}
+
+// readUserIDs returns the set of comma separated user IDs
+func readUserIDs(v string) map[string]bool {
+	out := make(map[string]bool)
+	for _, id := range strings.Split(v, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			out[id] = true
+		}
+	}
+	return out
+}
+
+// checkReleasable returns errNotApproved when approval is required and the file isn't approved or released
+func (opts *fileRoutesOptions) checkReleasable(fileID string) error {
+	if !opts.requireApproval {
+		return nil
+	}
+	switch status := opts.approvals.getApproval(fileID).Status; status {
+	case statusApproved, statusReleased:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errNotApproved, status)
+	}
+}
+
+// checkDraft returns errFileNotDraft when the file was submitted for approval and can no longer be modified
+func (opts *fileRoutesOptions) checkDraft(fileID string) error {
+	if status := opts.approvals.getApproval(fileID).Status; status != statusDraft {
+		return fmt.Errorf("%w: %s", errFileNotDraft, status)
+	}
+	return nil
+}
+
+// writeProblem writes err to w as JSON with the status code
+func writeProblem(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// getApproval returns the status and approval history of a file
+func getApproval(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		logger.Log("rendering file approval")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(opts.approvals.getApproval(fileId))
+	}
+}
+
+// transitionRequest is the optional body of a status transition
+type transitionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// transitionFile moves the file to status to on behalf of the user of the request. Files are submitted by makers
+// once valid, checkers other than the submitter approve them and checkers reject or release them.
+func transitionFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions, to string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		userID := moovhttp.GetUserID(r)
+		if userID == "" {
+			moovhttp.Problem(w, logger.LogError(errNoUserID).Err())
+			return
+		}
+
+		var req transitionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			err = logger.LogErrorf("error reading request body: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		permitted := opts.approvalPolicy.canApprove
+		if to == statusPendingApproval {
+			permitted = opts.approvalPolicy.canCreate
+		}
+		if !permitted(userID) {
+			err = logger.LogErrorf("%v to move file to %s", errNotPermitted, to).Err()
+			writeProblem(w, http.StatusForbidden, err)
+			return
+		}
+
+		if to == statusApproved && opts.policies != nil {
+			opts.policies.mu.Lock()
+			defer opts.policies.mu.Unlock()
+
+			if err := opts.checkPolicies(w, r, repo, file); err != nil {
+				logger.LogErrorf("file can't be approved: %v", err)
+				return
+			}
+		}
+
+		var stamped *wire.File
+		var seq *imadSequence
+		approval, err := opts.approvals.transition(fileId, to, userID, req.Comment, func(a fileApproval) error {
+			switch to {
+			case statusPendingApproval:
+				if err := file.Validate(); err != nil {
+					recordValidationFailure(err)
+					return err
+				}
+			case statusApproved:
+				if a.SubmittedBy == userID || a.CreatedBy == userID {
+					return errSelfApproval
+				}
+			case statusReleased:
+				// stamped last so the number is only allocated when the file is released, nothing fails after this
+				var err error
+				stamped, seq, err = opts.imad.stamp(file)
+				if err != nil || stamped == nil {
+					return err
+				}
+				if err := repo.saveFile(stamped); err != nil {
+					opts.imad.void(*seq)
+					return err
+				}
+				return nil
+			}
+			return nil
+		})
+		if errors.Is(err, errSelfApproval) {
+			writeProblem(w, http.StatusForbidden, logger.LogError(err).Err())
+			return
+		}
+		if err != nil {
+			err = logger.LogErrorf("problem moving file to %s: %v", to, err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Logf("file is %s", approval.Status)
+		event := approval.History[len(approval.History)-1]
+		opts.recordAudit(logger, r, auditStatusChanged, fileId, file, file, fmt.Sprintf("%s to %s", event.From, event.To))
+		if stamped != nil {
+			opts.recordStamp(logger, r, file, stamped, seq)
+		}
+		switch approval.Status {
+		case statusApproved:
+			opts.notifyWebhooks(logger, r, eventFileApproved, fileId, nil)
+		case statusRejected:
+			opts.notifyWebhooks(logger, r, eventFileRejected, fileId, nil)
+		case statusReleased:
+			opts.notifyWebhooks(logger, r, eventFileReleased, fileId, nil)
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(approval)
+	}
+}
+
+// recordCreated records the caller of r as the creator of file, who can't approve it, and audits its creation
+func (opts *fileRoutesOptions) recordCreated(logger log.Logger, r *http.Request, file *wire.File, detail string) {
+	if opts.approvals != nil {
+		opts.approvals.created(file.ID, moovhttp.GetUserID(r))
+	}
+	opts.recordAudit(logger, r, auditCreated, file.ID, nil, file, detail)
+}
+
+// readFileStatus returns the status of the `status` query param, or an empty status when it isn't set
+func readFileStatus(r *http.Request) (string, error) {
+	status := strings.ToLower(r.URL.Query().Get("status"))
+	switch status {
+	case "", statusDraft, statusPendingApproval, statusApproved, statusReleased, statusRejected:
+		return status, nil
+	}
+	return "", fmt.Errorf("%w: %s", errUnknownFileStatus, status)
+}
+
+// filterByStatus returns the files which have status, or all files when status is empty
+func (opts *fileRoutesOptions) filterByStatus(files []*wire.File, status string) []*wire.File {
+	if status == "" {
+		return files
+	}
+	out := files[:0]
+	for _, file := range files {
+		if file != nil && opts.approvals.getApproval(file.ID).Status == status {
+			out = append(out, file)
+		}
+	}
+	return out
+}
@@ -0,0 +1,257 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transition posts a status transition of the file on behalf of userID
+func transition(t *testing.T, router *mux.Router, fileID, action, userID string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/files/"+fileID+"/"+action, strings.NewReader(`{"comment": "`+action+`"}`))
+	if userID != "" {
+		req.Header.Set("X-User-ID", userID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func mockApprovalRouter(t *testing.T, opts ...fileRoutesOption) *mux.Router {
+	t.Helper()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, opts...)
+	return router
+}
+
+func TestApprovals(t *testing.T) {
+	policy := approvalPolicy{
+		makers:   readUserIDs("maker"),
+		checkers: readUserIDs("checker, maker"),
+	}
+	router := mockApprovalRouter(t, withApprovalPolicy(policy), withRequiredApproval())
+
+	contents := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/contents", nil))
+		w.Flush()
+		return w.Code
+	}
+	require.Equal(t, http.StatusForbidden, contents())
+
+	// only makers submit and the maker can't approve their own file
+	require.Equal(t, http.StatusForbidden, transition(t, router, "foo", "submit", "checker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusForbidden, transition(t, router, "foo", "approve", "maker").Code)
+	require.Equal(t, http.StatusForbidden, contents())
+
+	w := transition(t, router, "foo", "approve", "checker")
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	require.Equal(t, http.StatusOK, contents())
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "release", "checker").Code)
+	require.Equal(t, http.StatusOK, contents())
+
+	// released files can't move again
+	w = transition(t, router, "foo", "reject", "checker")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errStatusTransition.Error())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/approval", nil))
+	w.Flush()
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var approval fileApproval
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&approval))
+	assert.Equal(t, statusReleased, approval.Status)
+	assert.Equal(t, "maker", approval.SubmittedBy)
+	require.Len(t, approval.History, 3)
+	assert.Equal(t, statusDraft, approval.History[0].From)
+	assert.Equal(t, statusPendingApproval, approval.History[0].To)
+	assert.Equal(t, "submit", approval.History[0].Comment)
+	assert.Equal(t, "checker", approval.History[1].UserID)
+	assert.False(t, approval.History[2].Time.IsZero())
+}
+
+func TestApprovals_creator(t *testing.T) {
+	router := mockApprovalRouter(t)
+	w := testRequest(t, router, "POST", "/files/create", wire.File{FEDWireMessage: mockFEDWireMessage()}, "Content-Type", "application/json", "X-User-ID", "jane")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+	var created wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	// the creator can't approve the file someone else submitted
+	require.Equal(t, http.StatusOK, transition(t, router, created.ID, "submit", "john").Code)
+	w = transition(t, router, created.ID, "approve", "jane")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), errSelfApproval.Error())
+	require.Equal(t, http.StatusForbidden, transition(t, router, created.ID, "approve", "john").Code)
+
+	w = transition(t, router, created.ID, "approve", "jim")
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	var approval fileApproval
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&approval))
+	assert.Equal(t, "jane", approval.CreatedBy)
+	assert.Equal(t, "john", approval.SubmittedBy)
+}
+
+func TestApprovals_createFileReplacing(t *testing.T) {
+	router := mockApprovalRouter(t)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "jane").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "approve", "john").Code)
+
+	// the ID of the request is ignored, the approved file isn't replaced
+	fwm := mockFEDWireMessage()
+	fwm.Amount.Amount = "000009999999"
+	bs, err := json.Marshal(wire.File{ID: "foo", FEDWireMessage: fwm})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/files/create", bytes.NewReader(bs))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+
+	var created wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	require.NotEqual(t, "foo", created.ID)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo", nil))
+	w.Flush()
+	require.Equal(t, http.StatusOK, w.Code)
+	var stored wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stored))
+	require.Equal(t, mockFEDWireMessage().Amount.Amount, stored.FEDWireMessage.Amount.Amount)
+}
+
+func TestApprovals_reject(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "jane").Code)
+
+	// submitted files can't be modified
+	bs, err := json.Marshal(mockFEDWireMessage())
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/files/foo/FEDWireMessage", bytes.NewReader(bs)))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errFileNotDraft.Error())
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "reject", "john").Code)
+	require.Equal(t, http.StatusBadRequest, transition(t, router, "foo", "approve", "john").Code)
+
+	// approval isn't required to serve contents by default
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/contents", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files?status=rejected", nil))
+	w.Flush()
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files?status=draft", nil))
+	w.Flush()
+	assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files?status=lost", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestApprovals_errors(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	w := transition(t, router, "foo", "submit", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errNoUserID.Error())
+
+	assert.Equal(t, http.StatusBadRequest, transition(t, router, "foo", "approve", "jane").Code)
+	assert.Equal(t, http.StatusNotFound, transition(t, router, "missing", "submit", "jane").Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/missing/approval", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// invalid files can't be submitted
+	repo := &testWireFileRepository{file: &wire.File{ID: "foo"}}
+	router = mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+	assert.Equal(t, http.StatusBadRequest, transition(t, router, "foo", "submit", "jane").Code)
+
+	repo.err = errors.New("bad error")
+	assert.Equal(t, http.StatusBadRequest, transition(t, router, "foo", "submit", "jane").Code)
+}
+
+func TestApprovals_readApprovalOptions(t *testing.T) {
+	t.Setenv("REQUIRE_APPROVAL", "true")
+	t.Setenv("APPROVAL_MAKERS", "jane, john")
+	t.Setenv("APPROVAL_CHECKERS", "")
+	opts, err := readApprovalOptions(true)
+	require.NoError(t, err)
+
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	assert.True(t, cfg.requireApproval)
+	assert.True(t, cfg.approvalPolicy.canCreate("john"))
+	assert.False(t, cfg.approvalPolicy.canCreate("adam"))
+	assert.True(t, cfg.approvalPolicy.canApprove("adam"))
+
+	// X-User-ID is set by callers without authentication
+	_, err = readApprovalOptions(false)
+	assert.Error(t, err)
+
+	t.Setenv("REQUIRE_APPROVAL", "always")
+	_, err = readApprovalOptions(true)
+	assert.Error(t, err)
+}
+
+func TestApprovals_readApprovalOptionsDefault(t *testing.T) {
+	t.Setenv("REQUIRE_APPROVAL", "")
+	for authenticated, required := range map[bool]bool{true: true, false: false} {
+		opts, err := readApprovalOptions(authenticated)
+		require.NoError(t, err)
+		cfg := &fileRoutesOptions{}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		assert.Equal(t, required, cfg.requireApproval)
+	}
+
+	t.Setenv("REQUIRE_APPROVAL", "false")
+	opts, err := readApprovalOptions(true)
+	require.NoError(t, err)
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	assert.False(t, cfg.requireApproval)
+}
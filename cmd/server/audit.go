@@ -0,0 +1,385 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+const (
+	auditCreated       = "created"
+	auditRead          = "read"
+	auditListed        = "listed"
+	auditModified      = "modified"
+	auditValidated     = "validated"
+	auditDownloaded    = "downloaded"
+	auditDeleted       = "deleted"
+	auditStatusChanged = "status_changed"
+
+	// template actions aren't of a file, their detail names the template
+	auditTemplateCreated = "template_created"
+	auditTemplateUpdated = "template_updated"
+	auditTemplateDeleted = "template_deleted"
+)
+
+// defaultAuditMaxEntries is the number of audit entries held in memory unless AUDIT_LOG_MAX_ENTRIES is set
+const defaultAuditMaxEntries = 100000
+
+var errAuditChainBroken = errors.New("audit chain is broken")
+
+// auditEntry is an operation on a file. Each entry holds the hash of the entry before it, so changing or removing
+// an entry breaks the chain of every entry after it.
+type auditEntry struct {
+	Sequence  uint64    `json:"sequence"`
+	Time      time.Time `json:"time"`
+	FileID    string    `json:"fileID"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"userID,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+	// BeforeHash and AfterHash are hashes of the file before and after the operation, empty when it didn't exist
+	BeforeHash string `json:"beforeHash,omitempty"`
+	AfterHash  string `json:"afterHash,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	// PrevHash is the Hash of the previous entry, empty for the first entry
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// computeHash returns the SHA-256 of the entry without its Hash
+func (e auditEntry) computeHash() string {
+	e.Hash = ""
+	bs, _ := json.Marshal(e)
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the SHA-256 of the file's JSON, or an empty string for nil files
+func hashFile(file *wire.File) string {
+	if file == nil {
+		return ""
+	}
+	bs, err := json.Marshal(file)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyAuditChain returns errAuditChainBroken at the first entry which is out of sequence, doesn't link to the
+// entry before it or whose hash doesn't match its contents
+func verifyAuditChain(entries []auditEntry) error {
+	return verifyAuditEntries(entries, 0, 0, "")
+}
+
+// verifyAuditEntries verifies the chain of entries from start on, trusting the entries before start. dropped is
+// the number of entries of the chain before entries[0] and prev the hash of the last of them.
+func verifyAuditEntries(entries []auditEntry, start int, dropped uint64, prev string) error {
+	if start > 0 {
+		prev = entries[start-1].Hash
+	}
+	for i := start; i < len(entries); i++ {
+		e := entries[i]
+		if seq := dropped + uint64(i+1); e.Sequence != seq {
+			return fmt.Errorf("%w: entry %d has sequence %d", errAuditChainBroken, seq, e.Sequence)
+		}
+		if e.PrevHash != prev {
+			return fmt.Errorf("%w: entry %d doesn't link to the previous entry", errAuditChainBroken, e.Sequence)
+		}
+		if e.computeHash() != e.Hash {
+			return fmt.Errorf("%w: entry %d was modified", errAuditChainBroken, e.Sequence)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// auditLog is an append-only, hash chained log of file operations. The latest max entries are held in memory
+// and, when w is set, every entry is appended to it as JSON lines.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry
+	// max is the number of entries held in memory, older entries are dropped once verified
+	max int
+	// dropped is the number of entries dropped from the start of the chain and droppedHash the hash of the last
+	dropped     uint64
+	droppedHash string
+	// verified is the number of entries at the start of entries which were verified
+	verified int
+	// broken is the error of the verification which failed, once broken the chain stays broken
+	broken error
+	w      io.Writer
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{max: defaultAuditMaxEntries}
+}
+
+// openAuditLog reads the entries of the JSON lines file at path, verifies their chain and appends new entries
+// to the file. Only the latest max entries are kept in memory.
+func openAuditLog(path string, max int) (*auditLog, error) {
+	fd, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &auditLog{max: max}
+	err = readAuditLines(fd, func(e auditEntry) error {
+		l.entries = append(l.entries, e)
+		if err := l.verifyLocked(); err != nil {
+			return err
+		}
+		l.trim()
+		return nil
+	})
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	l.w = fd
+	return l, nil
+}
+
+func readAuditEntries(r io.Reader) ([]auditEntry, error) {
+	var out []auditEntry
+	err := readAuditLines(r, func(e auditEntry) error {
+		out = append(out, e)
+		return nil
+	})
+	return out, err
+}
+
+// readAuditLines calls fn with each entry of the JSON lines in r
+func readAuditLines(r io.Reader, fn func(auditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("audit entry %d: %v", n, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+		n++
+	}
+	return scanner.Err()
+}
+
+// record links the entry to the end of the chain and appends it
+func (l *auditLog) record(e auditEntry) (auditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Sequence = l.dropped + uint64(len(l.entries)+1)
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.PrevHash = l.droppedHash
+	if n := len(l.entries); n > 0 {
+		e.PrevHash = l.entries[n-1].Hash
+	}
+	e.Hash = e.computeHash()
+
+	if l.w != nil {
+		bs, err := json.Marshal(e)
+		if err != nil {
+			return e, err
+		}
+		if _, err := l.w.Write(append(bs, '\n')); err != nil {
+			return e, err
+		}
+	}
+	l.entries = append(l.entries, e)
+	if len(l.entries) > l.max && l.max > 0 {
+		// entries are verified before they're dropped, a broken chain stays broken once they are
+		l.verifyLocked()
+		l.trim()
+	}
+	return e, nil
+}
+
+// trim drops the oldest entries over max, which must be verified unless the chain is broken. Re-slicing keeps
+// appends amortized, the dropped entries are released once append grows the array.
+func (l *auditLog) trim() {
+	n := len(l.entries) - l.max
+	if l.max <= 0 || n <= 0 || (n > l.verified && l.broken == nil) {
+		return
+	}
+	l.dropped += uint64(n)
+	l.droppedHash = l.entries[n-1].Hash
+	l.entries = l.entries[n:]
+	if l.verified -= n; l.verified < 0 {
+		l.verified = 0
+	}
+}
+
+// getEntries returns a copy of the entries of a file, or every entry when fileID is empty. Entries dropped from
+// memory aren't returned.
+func (l *auditLog) getEntries(fileID string) []auditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := []auditEntry{}
+	for i := range l.entries {
+		if fileID == "" || l.entries[i].FileID == fileID {
+			out = append(out, l.entries[i])
+		}
+	}
+	return out
+}
+
+// verify checks the chain of the entries recorded since the last verification, so each call only hashes
+// the new entries
+func (l *auditLog) verify() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.verifyLocked()
+}
+
+func (l *auditLog) verifyLocked() error {
+	if l.broken != nil {
+		return l.broken
+	}
+	if err := verifyAuditEntries(l.entries, l.verified, l.dropped, l.droppedHash); err != nil {
+		l.broken = err
+		return err
+	}
+	l.verified = len(l.entries)
+	return nil
+}
+
+// withAuditLog records file operations to log
+func withAuditLog(audit *auditLog) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.audit = audit
+	}
+}
+
+// readAuditOptions returns the file route options configured by AUDIT_LOG_FILE and AUDIT_LOG_MAX_ENTRIES
+func readAuditOptions() ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	max := defaultAuditMaxEntries
+	if v := os.Getenv("AUDIT_LOG_MAX_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid AUDIT_LOG_MAX_ENTRIES: %q", v)
+		}
+		max = n
+	}
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		audit, err := openAuditLog(path, max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUDIT_LOG_FILE: %v", err)
+		}
+		opts = append(opts, withAuditLog(audit))
+	} else if max != defaultAuditMaxEntries {
+		audit := newAuditLog()
+		audit.max = max
+		opts = append(opts, withAuditLog(audit))
+	}
+	return opts, nil
+}
+
+// recordAudit appends an operation on a file by the caller of r to the audit log. before and after are the file
+// before and after the operation, either can be nil.
+func (opts *fileRoutesOptions) recordAudit(logger log.Logger, r *http.Request, action, fileID string, before, after *wire.File, detail string) {
+	_, err := opts.audit.record(auditEntry{
+		FileID:     fileID,
+		Action:     action,
+		UserID:     moovhttp.GetUserID(r),
+		RequestID:  moovhttp.GetRequestID(r),
+		BeforeHash: hashFile(before),
+		AfterHash:  hashFile(after),
+		Detail:     detail,
+	})
+	if err != nil {
+		logger.LogErrorf("problem recording %s audit entry: %v", action, err)
+	}
+}
+
+// writeAuditChain sets the X-Audit-Chain-Valid header to if the chain of every entry verifies
+func writeAuditChain(logger log.Logger, w http.ResponseWriter, audit *auditLog) {
+	if err := audit.verify(); err != nil {
+		logger.LogError(err)
+		w.Header().Set("X-Audit-Chain-Valid", "false")
+		return
+	}
+	w.Header().Set("X-Audit-Chain-Valid", "true")
+}
+
+// getFileAudit returns the audit entries of a file, including files which were deleted
+func getFileAudit(logger log.Logger, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		entries := opts.audit.getEntries(fileId)
+		if len(entries) == 0 {
+			logger.Log("no audit entries found")
+			http.NotFound(w, r)
+			return
+		}
+		logger.Logf("found %d audit entries", len(entries))
+
+		writeAuditChain(logger, w, opts.audit)
+		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", len(entries)))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// exportAudit writes every audit entry as JSON lines, in the format of AUDIT_LOG_FILE, so the chain can be
+// verified outside of the server
+func exportAudit(logger log.Logger, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		entries := opts.audit.getEntries("")
+		logger.Logf("exporting %d audit entries", len(entries))
+
+		writeAuditChain(logger, w, opts.audit)
+		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", len(entries)))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for i := range entries {
+			if err := enc.Encode(entries[i]); err != nil {
+				logger.LogErrorf("problem exporting audit entries: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditRequest(router *mux.Router, method, target string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("X-User-ID", "jane")
+	req.Header.Set("X-Request-ID", "req-"+method)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestAudit_fileOperations(t *testing.T) {
+	audit := newAuditLog()
+	router := mux.NewRouter()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	addFileRoutes(log.NewNopLogger(), router, repo, withAuditLog(audit))
+
+	w := createFileJSON(t, router, mockFEDWireMessage())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+
+	fwm := mockFEDWireMessage()
+	fwm.Amount.Amount = "000000000002"
+	bs, err := json.Marshal(fwm)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/"+file.ID, nil).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "POST", "/files/"+file.ID+"/FEDWireMessage", bs).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/"+file.ID+"/validate", nil).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/"+file.ID+"/contents", nil).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "POST", "/files/"+file.ID+"/submit", nil).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "DELETE", "/files/"+file.ID, nil).Code)
+
+	// entries of deleted files are kept
+	w = auditRequest(router, "GET", "/files/"+file.ID+"/audit", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Equal(t, "true", w.Header().Get("X-Audit-Chain-Valid"))
+	assert.Equal(t, "7", w.Header().Get("X-Total-Count"))
+
+	var entries []auditEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	var actions []string
+	for i := range entries {
+		actions = append(actions, entries[i].Action)
+	}
+	assert.Equal(t, []string{
+		auditCreated, auditRead, auditModified, auditValidated, auditDownloaded, auditStatusChanged, auditDeleted,
+	}, actions)
+
+	created, modified, deleted := entries[0], entries[2], entries[6]
+	assert.Empty(t, created.BeforeHash)
+	assert.NotEmpty(t, created.AfterHash)
+	assert.Equal(t, created.AfterHash, modified.BeforeHash)
+	assert.NotEqual(t, modified.BeforeHash, modified.AfterHash)
+	assert.Equal(t, modified.AfterHash, deleted.BeforeHash)
+	assert.Empty(t, deleted.AfterHash)
+	assert.Equal(t, "jane", deleted.UserID)
+	assert.Equal(t, "req-DELETE", deleted.RequestID)
+	assert.Equal(t, "draft to pending_approval", entries[5].Detail)
+	assert.Equal(t, entries[5].Hash, deleted.PrevHash)
+
+	assert.Equal(t, http.StatusNotFound, auditRequest(router, "GET", "/files/missing/audit", nil).Code)
+}
+
+func TestAudit_export(t *testing.T) {
+	audit := newAuditLog()
+	router := mux.NewRouter()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	require.NoError(t, repo.saveFile(&wire.File{ID: "bar", FEDWireMessage: mockFEDWireMessage()}))
+	addFileRoutes(log.NewNopLogger(), router, repo, withAuditLog(audit))
+
+	w := auditRequest(router, "GET", "/files", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = auditRequest(router, "GET", "/audit/export", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "true", w.Header().Get("X-Audit-Chain-Valid"))
+
+	// listing files is a single entry
+	entries, err := readAuditEntries(w.Body)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NoError(t, verifyAuditChain(entries))
+	assert.Equal(t, auditListed, entries[0].Action)
+	assert.Empty(t, entries[0].FileID)
+	assert.Equal(t, "listed 2 files", entries[0].Detail)
+
+	// tampering with entries recorded since the last export breaks the chain, and it stays broken
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/foo", nil).Code)
+	audit.entries[1].UserID = "john"
+	w = auditRequest(router, "GET", "/audit/export", nil)
+	assert.Equal(t, "false", w.Header().Get("X-Audit-Chain-Valid"))
+
+	audit.entries[1].UserID = "jane"
+	w = auditRequest(router, "GET", "/audit/export", nil)
+	assert.Equal(t, "false", w.Header().Get("X-Audit-Chain-Valid"))
+}
+
+func TestAudit_reads(t *testing.T) {
+	audit := newAuditLog()
+	router := mux.NewRouter()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	cfg := addFileRoutes(log.NewNopLogger(), router, repo, withAuditLog(audit))
+	renderer, err := wire.NewPaymentAdviceRenderer()
+	require.NoError(t, err)
+	addAdviceRoutes(log.NewNopLogger(), router, repo, renderer, cfg)
+
+	w := createFileJSON(t, router, mockFEDWireMessage())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+	var original wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&original))
+	w = auditRequest(router, "POST", "/files/"+original.ID+"/resend", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+	var resend wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resend))
+
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/"+original.ID+"/advice", nil).Code)
+	require.Equal(t, http.StatusOK, auditRequest(router, "GET", "/files/"+original.ID+"/duplicates", nil).Code)
+
+	entries := audit.getEntries(original.ID)
+	require.Len(t, entries, 3)
+	assert.Equal(t, auditRead, entries[1].Action)
+	assert.Equal(t, "read text advice", entries[1].Detail)
+	assert.Equal(t, auditRead, entries[2].Action)
+	assert.Equal(t, "read duplicates", entries[2].Detail)
+
+	// the duplicates returned are read too
+	entries = audit.getEntries(resend.ID)
+	require.Len(t, entries, 2)
+	assert.Equal(t, auditRead, entries[1].Action)
+	assert.Equal(t, "read as a duplicate of "+original.ID, entries[1].Detail)
+}
+
+func TestAudit_maxEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path, 2)
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		_, err := audit.record(auditEntry{FileID: id, Action: auditCreated})
+		require.NoError(t, err)
+	}
+	// only the latest entries are held in memory, their chain continues the dropped entries
+	entries := audit.getEntries("")
+	require.Len(t, entries, 2)
+	assert.Equal(t, "d", entries[0].FileID)
+	assert.Equal(t, uint64(4), entries[0].Sequence)
+	require.NoError(t, audit.verify())
+
+	// the file holds every entry and is read back keeping the latest
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	all, err := readAuditEntries(bytes.NewReader(bs))
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+	require.NoError(t, verifyAuditChain(all))
+	assert.Equal(t, all[2].Hash, entries[0].PrevHash)
+
+	audit, err = openAuditLog(path, 3)
+	require.NoError(t, err)
+	require.Len(t, audit.getEntries(""), 3)
+	e, err := audit.record(auditEntry{FileID: "f", Action: auditCreated})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), e.Sequence)
+	assert.Equal(t, all[4].Hash, e.PrevHash)
+	require.NoError(t, audit.verify())
+
+	// dropped entries are still verified on startup
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(bs), `"a"`, `"z"`, 1)), 0600))
+	_, err = openAuditLog(path, 2)
+	assert.True(t, errors.Is(err, errAuditChainBroken))
+
+	t.Setenv("AUDIT_LOG_MAX_ENTRIES", "zero")
+	_, err = readAuditOptions()
+	assert.Error(t, err)
+}
+
+func TestAudit_verifyChain(t *testing.T) {
+	audit := newAuditLog()
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := audit.record(auditEntry{FileID: id, Action: auditCreated})
+		require.NoError(t, err)
+	}
+	require.NoError(t, audit.verify())
+	require.Equal(t, 3, audit.verified)
+
+	// only entries recorded since are verified
+	_, err := audit.record(auditEntry{FileID: "d", Action: auditCreated})
+	require.NoError(t, err)
+	audit.entries[0].Action = auditDeleted
+	require.NoError(t, audit.verify())
+	require.Equal(t, 4, audit.verified)
+	audit.entries[0].Action = auditCreated
+
+	removed := append([]auditEntry{audit.entries[0]}, audit.entries[2:]...)
+	assert.True(t, errors.Is(verifyAuditChain(removed), errAuditChainBroken))
+
+	relinked := audit.getEntries("")
+	relinked[1].PrevHash = "00"
+	relinked[1].Hash = relinked[1].computeHash()
+	assert.True(t, errors.Is(verifyAuditChain(relinked), errAuditChainBroken))
+
+	modified := audit.getEntries("")
+	modified[2].Action = auditDeleted
+	assert.True(t, errors.Is(verifyAuditChain(modified), errAuditChainBroken))
+}
+
+func TestAudit_readAuditOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("AUDIT_LOG_FILE", path)
+
+	opts, err := readAuditOptions()
+	require.NoError(t, err)
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	_, err = cfg.audit.record(auditEntry{FileID: "foo", Action: auditCreated})
+	require.NoError(t, err)
+
+	// entries are read back and new ones continue the chain
+	audit, err := openAuditLog(path, defaultAuditMaxEntries)
+	require.NoError(t, err)
+	require.Len(t, audit.getEntries(""), 1)
+	_, err = audit.record(auditEntry{FileID: "foo", Action: auditDeleted})
+	require.NoError(t, err)
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	entries, err := readAuditEntries(bytes.NewReader(bs))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.NoError(t, verifyAuditChain(entries))
+
+	// a tampered file is refused
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(bs), `"foo"`, `"bar"`, 1)), 0600))
+	_, err = readAuditOptions()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0600))
+	_, err = readAuditOptions()
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+)
+
+const (
+	// roleViewer reads files, every role can view
+	roleViewer = "viewer"
+	// roleCreator creates and modifies files and submits them for approval
+	roleCreator = "creator"
+	// roleApprover approves, rejects and releases files
+	roleApprover = "approver"
+	// roleAdmin is permitted every route
+	roleAdmin = "admin"
+)
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errForbidden       = errors.New("forbidden")
+	errUnknownRole     = errors.New("unknown role")
+)
+
+// principal is the authenticated caller of a request
+type principal struct {
+	ID    string
+	Roles []string
+	// Method is the authentication method, e.g. api-key, jwt or mtls
+	Method string
+}
+
+// hasRole reports if the principal is permitted routes requiring role. Admins are permitted every route and every
+// role can view.
+func (p *principal) hasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role || r == roleAdmin {
+			return true
+		}
+	}
+	return role == roleViewer && len(p.Roles) > 0
+}
+
+// checkRoles returns errUnknownRole for roles which aren't defined
+func checkRoles(roles []string) error {
+	for _, role := range roles {
+		switch role {
+		case roleViewer, roleCreator, roleApprover, roleAdmin:
+		default:
+			return fmt.Errorf("%w: %s", errUnknownRole, role)
+		}
+	}
+	return nil
+}
+
+// authenticator verifies the credentials of a request
+type authenticator interface {
+	// authenticate returns the principal of the credentials r carries, or nil when r carries none of its kind.
+	// An error is returned for invalid credentials.
+	authenticate(r *http.Request) (*principal, error)
+}
+
+type principalContextKey struct{}
+
+// getPrincipal returns the authenticated caller of r, nil when authentication isn't enabled
+func getPrincipal(r *http.Request) *principal {
+	p, _ := r.Context().Value(principalContextKey{}).(*principal)
+	return p
+}
+
+// publicRoutes don't require authentication
+var publicRoutes = map[string]bool{
+	"GET /ping": true,
+}
+
+// routeRoles are the roles of routes which don't follow the method defaults of routeRole
+var routeRoles = map[string]string{
+	"POST /files/{fileId}/approve":                             roleApprover,
+	"POST /files/{fileId}/reject":                              roleApprover,
+	"POST /files/{fileId}/release":                             roleApprover,
+	"GET /audit/export":                                        roleAdmin,
+	"DELETE /files/{fileId}/tags/{tag}":                        roleCreator,
+	"GET /webhooks/dead-letters":                               roleAdmin,
+	"PUT /imad/sequences/{inputSource}/{cycleDate}/{sequence}": roleApprover,
+	"POST /validate":                                           roleViewer,
+	"POST /convert":                                            roleViewer,
+}
+
+// routeRole returns the role required for a route. Reads require viewer, writes creator and deletes admin.
+func routeRole(method, template string) string {
+	if role, ok := routeRoles[method+" "+template]; ok {
+		return role
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return roleViewer
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return roleCreator
+	}
+	return roleAdmin
+}
+
+// authMiddleware authenticates requests with the first authenticator finding credentials and checks the caller
+// has the role of the route. The caller's ID replaces any X-User-ID header so handlers, logs and approvals use
+// the authenticated identity.
+func authMiddleware(logger log.Logger, authenticators ...authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if t, err := route.GetPathTemplate(); err == nil {
+					template = t
+				}
+			}
+			if r.Method == http.MethodOptions || publicRoutes[r.Method+" "+template] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r.Header.Del("X-User")
+			r.Header.Del("X-User-ID")
+			logger := requestLogger(logger, r).Set("route", log.String(r.Method+" "+template))
+
+			var p *principal
+			for _, auth := range authenticators {
+				found, err := auth.authenticate(r)
+				if err != nil {
+					writeProblem(w, http.StatusUnauthorized, logger.LogErrorf("%v: %v", errUnauthenticated, err).Err())
+					return
+				}
+				if found != nil {
+					p = found
+					break
+				}
+			}
+			if p == nil {
+				writeProblem(w, http.StatusUnauthorized, logger.LogError(errUnauthenticated).Err())
+				return
+			}
+			logger = logger.Set("userID", log.String(p.ID)).Set("authMethod", log.String(p.Method))
+
+			if role := routeRole(r.Method, template); !p.hasRole(role) {
+				writeProblem(w, http.StatusForbidden, logger.LogErrorf("%v: requires %s role", errForbidden, role).Err())
+				return
+			}
+
+			r.Header.Set("X-User-ID", p.ID)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, p)))
+		})
+	}
+}
+
+// readAuthenticators returns the authenticators configured by API_KEYS_FILE, JWT_JWKS_FILE and MTLS_CLIENTS_FILE.
+// Authentication is disabled when none are configured.
+func readAuthenticators() ([]authenticator, error) {
+	var out []authenticator
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		auth, err := readAPIKeys(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_KEYS_FILE: %v", err)
+		}
+		out = append(out, auth)
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		auth, err := readJWKS(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_JWKS_FILE: %v", err)
+		}
+		auth.issuer = os.Getenv("JWT_ISSUER")
+		auth.audience = os.Getenv("JWT_AUDIENCE")
+		if claim := os.Getenv("JWT_ROLES_CLAIM"); claim != "" {
+			auth.rolesClaim = claim
+		}
+		out = append(out, auth)
+	}
+	if path := os.Getenv("MTLS_CLIENTS_FILE"); path != "" {
+		// without TLS and a client CA there are no verified client certificates to authenticate
+		if os.Getenv("HTTPS_CLIENT_CA_FILE") == "" {
+			return nil, errors.New("MTLS_CLIENTS_FILE requires HTTPS_CLIENT_CA_FILE")
+		}
+		if os.Getenv("HTTPS_CERT_FILE") == "" || os.Getenv("HTTPS_KEY_FILE") == "" {
+			return nil, errors.New("MTLS_CLIENTS_FILE requires HTTPS_CERT_FILE and HTTPS_KEY_FILE")
+		}
+		auth, err := readMTLSClients(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MTLS_CLIENTS_FILE: %v", err)
+		}
+		out = append(out, auth)
+	}
+	return out, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// apiKey is a static API key of a caller read from API_KEYS_FILE
+type apiKey struct {
+	ID    string   `json:"id"`
+	Key   string   `json:"key"`
+	Roles []string `json:"roles"`
+}
+
+// apiKeyAuthenticator authenticates requests by their X-API-Key header
+type apiKeyAuthenticator struct {
+	keys []apiKey
+}
+
+// readAPIKeys reads a JSON array of API keys from path
+func readAPIKeys(path string) (*apiKeyAuthenticator, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []apiKey
+	if err := json.Unmarshal(bs, &keys); err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].ID == "" || keys[i].Key == "" {
+			return nil, fmt.Errorf("API key %d is missing an id or key", i)
+		}
+		if err := checkRoles(keys[i].Roles); err != nil {
+			return nil, fmt.Errorf("API key %s: %v", keys[i].ID, err)
+		}
+	}
+	return &apiKeyAuthenticator{keys: keys}, nil
+}
+
+func (a *apiKeyAuthenticator) authenticate(r *http.Request) (*principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return nil, nil
+	}
+	// compare against every key so the time taken doesn't reveal which key matched
+	var found *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(a.keys[i].Key), []byte(key)) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	if found == nil {
+		return nil, errInvalidAPIKey
+	}
+	return &principal{ID: found.ID, Roles: found.Roles, Method: "api-key"}, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	auth, err := readAPIKeys(writeAuthFile(t, "keys.json", `[{"id": "jane", "key": "secret", "roles": ["creator"]}]`))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/files", nil)
+	p, err := auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	req.Header.Set("X-API-Key", "secret")
+	p, err = auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "jane", p.ID)
+	assert.Equal(t, []string{roleCreator}, p.Roles)
+
+	req.Header.Set("X-API-Key", "secrets")
+	_, err = auth.authenticate(req)
+	assert.True(t, errors.Is(err, errInvalidAPIKey))
+}
+
+func TestAPIKeys_invalid(t *testing.T) {
+	for _, contents := range []string{
+		`{}`,
+		`[{"id": "jane", "roles": ["viewer"]}]`,
+		`[{"id": "jane", "key": "secret", "roles": ["owner"]}]`,
+	} {
+		_, err := readAPIKeys(writeAuthFile(t, "keys.json", contents))
+		assert.Error(t, err, contents)
+	}
+	_, err := readAPIKeys(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
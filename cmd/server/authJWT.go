@@ -0,0 +1,251 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidJWT = errors.New("invalid JWT")
+	errJWTExpired = errors.New("JWT is expired")
+)
+
+// jwk is a public key of a JSON Web Key Set, only RSA and P-256 EC keys are supported
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// jwtAuthenticator authenticates requests by the bearer JWT of their Authorization header. Tokens are signed
+// with RS256 or ES256 by a key of the JWKS.
+type jwtAuthenticator struct {
+	keys map[string]crypto.PublicKey
+
+	issuer     string
+	audience   string
+	rolesClaim string
+
+	now func() time.Time
+}
+
+// readJWKS reads a JSON Web Key Set from path
+func readJWKS(path string) (*jwtAuthenticator, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return nil, err
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	out := &jwtAuthenticator{
+		keys:       make(map[string]crypto.PublicKey),
+		rolesClaim: "roles",
+		now:        time.Now,
+	}
+	for i := range set.Keys {
+		pub, err := set.Keys[i].publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", set.Keys[i].Kid, err)
+		}
+		out.keys[set.Keys[i].Kid] = pub
+	}
+	return out, nil
+}
+
+func (a *jwtAuthenticator) authenticate(r *http.Request) (*principal, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, nil
+	}
+	claims, err := a.verify(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", errInvalidJWT)
+	}
+	roles, err := readRolesClaim(claims[a.rolesClaim])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s claim: %v", errInvalidJWT, a.rolesClaim, err)
+	}
+	return &principal{ID: sub, Roles: roles, Method: "jwt"}, nil
+}
+
+// verify checks the signature, expiry, issuer and audience of token and returns its claims
+func (a *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", errInvalidJWT)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errInvalidJWT, err)
+	}
+	pub, ok := a.keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", errInvalidJWT, header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", errInvalidJWT, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifyJWTSignature(header.Alg, pub, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidJWT, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", errInvalidJWT, err)
+	}
+	now := a.now().Unix()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp claim", errInvalidJWT)
+	}
+	if now >= int64(exp) {
+		return nil, errJWTExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < int64(nbf) {
+		return nil, fmt.Errorf("%w: not valid yet", errInvalidJWT)
+	}
+	if a.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.issuer {
+			return nil, fmt.Errorf("%w: unexpected issuer %q", errInvalidJWT, iss)
+		}
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", errInvalidJWT)
+	}
+	return claims, nil
+}
+
+func verifyJWTSignature(alg string, pub crypto.PublicKey, digest, sig []byte) error {
+	switch alg {
+	case "RS256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 requires an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig)
+	case "ES256":
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errors.New("invalid ES256 signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid ES256 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported alg %q", alg)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// hasAudience reports if the aud claim, a string or array of strings, contains audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for i := range v {
+			if s, _ := v[i].(string); s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readRolesClaim returns the roles of a claim which is an array of roles or a space separated string
+func readRolesClaim(claim interface{}) ([]string, error) {
+	var roles []string
+	switch v := claim.(type) {
+	case nil:
+	case string:
+		roles = strings.Fields(v)
+	case []interface{}:
+		for i := range v {
+			s, ok := v[i].(string)
+			if !ok {
+				return nil, errors.New("roles must be strings")
+			}
+			roles = append(roles, s)
+		}
+	default:
+		return nil, errors.New("roles must be a string or array")
+	}
+	return roles, checkRoles(roles)
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+// signJWT returns a token of claims signed by key with alg
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	body, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(header) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+func mockJWTAuthenticator(t *testing.T) (*jwtAuthenticator, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		},
+	})
+	require.NoError(t, err)
+	auth, err := readJWKS(writeAuthFile(t, "jwks.json", string(jwks)))
+	require.NoError(t, err)
+	return auth, rsaKey, ecKey
+}
+
+func TestJWT(t *testing.T) {
+	auth, rsaKey, ecKey := mockJWTAuthenticator(t)
+	auth.issuer = "https://idp.example.com"
+	auth.audience = "wire"
+
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":   "jane",
+			"iss":   "https://idp.example.com",
+			"aud":   []string{"wire", "ach"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"creator", "approver"},
+		}
+	}
+	authenticate := func(token string) (*principal, error) {
+		req := httptest.NewRequest("GET", "/files", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return auth.authenticate(req)
+	}
+
+	p, err := authenticate("")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	p, err = authenticate(signJWT(t, "RS256", "rsa", rsaKey, claims()))
+	require.NoError(t, err)
+	assert.Equal(t, "jane", p.ID)
+	assert.Equal(t, []string{roleCreator, roleApprover}, p.Roles)
+	assert.Equal(t, "jwt", p.Method)
+
+	p, err = authenticate(signJWT(t, "ES256", "ec", ecKey, claims()))
+	require.NoError(t, err)
+	assert.Equal(t, "jane", p.ID)
+
+	expired := claims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = authenticate(signJWT(t, "RS256", "rsa", rsaKey, expired))
+	assert.True(t, errors.Is(err, errJWTExpired))
+
+	for name, modify := range map[string]func(map[string]interface{}){
+		"issuer":   func(c map[string]interface{}) { c["iss"] = "https://other.example.com" },
+		"audience": func(c map[string]interface{}) { c["aud"] = "ach" },
+		"nbf":      func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		"no exp":   func(c map[string]interface{}) { delete(c, "exp") },
+		"no sub":   func(c map[string]interface{}) { delete(c, "sub") },
+		"roles":    func(c map[string]interface{}) { c["roles"] = "viewer owner" },
+	} {
+		c := claims()
+		modify(c)
+		_, err = authenticate(signJWT(t, "RS256", "rsa", rsaKey, c))
+		assert.True(t, errors.Is(err, errInvalidJWT), name)
+	}
+
+	// signed by another key, or with a key of the wrong type
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = authenticate(signJWT(t, "RS256", "rsa", other, claims()))
+	assert.True(t, errors.Is(err, errInvalidJWT))
+	_, err = authenticate(signJWT(t, "RS256", "ec", rsaKey, claims()))
+	assert.True(t, errors.Is(err, errInvalidJWT))
+	_, err = authenticate(signJWT(t, "RS256", "unknown", rsaKey, claims()))
+	assert.True(t, errors.Is(err, errInvalidJWT))
+	_, err = authenticate("not.a-token")
+	assert.True(t, errors.Is(err, errInvalidJWT))
+}
+
+func TestJWT_rolesClaim(t *testing.T) {
+	auth, rsaKey, _ := mockJWTAuthenticator(t)
+	auth.rolesClaim = "scope"
+
+	req := httptest.NewRequest("GET", "/files", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, "RS256", "rsa", rsaKey, map[string]interface{}{
+		"sub":   "jane",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "viewer admin",
+	}))
+	p, err := auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{roleViewer, roleAdmin}, p.Roles)
+}
+
+func TestJWT_readJWKS(t *testing.T) {
+	for _, contents := range []string{
+		`[]`,
+		`{"keys": []}`,
+		`{"keys": [{"kid": "a", "kty": "oct"}]}`,
+		`{"keys": [{"kid": "a", "kty": "EC", "crv": "P-384"}]}`,
+		`{"keys": [{"kid": "a", "kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+	} {
+		_, err := readJWKS(writeAuthFile(t, "jwks.json", contents))
+		assert.Error(t, err, contents)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var errUnknownClientCert = errors.New("unknown client certificate")
+
+// mtlsClient is a client certificate common name and its roles read from MTLS_CLIENTS_FILE
+type mtlsClient struct {
+	CommonName string   `json:"commonName"`
+	Roles      []string `json:"roles"`
+}
+
+// mtlsAuthenticator authenticates requests by the verified client certificate of their TLS connection
+type mtlsAuthenticator struct {
+	clients map[string]mtlsClient
+}
+
+// readMTLSClients reads a JSON array of client certificate common names and their roles from path
+func readMTLSClients(path string) (*mtlsAuthenticator, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clients []mtlsClient
+	if err := json.Unmarshal(bs, &clients); err != nil {
+		return nil, err
+	}
+	out := &mtlsAuthenticator{clients: make(map[string]mtlsClient)}
+	for i := range clients {
+		if clients[i].CommonName == "" {
+			return nil, fmt.Errorf("client %d is missing a commonName", i)
+		}
+		if err := checkRoles(clients[i].Roles); err != nil {
+			return nil, fmt.Errorf("client %s: %v", clients[i].CommonName, err)
+		}
+		out.clients[clients[i].CommonName] = clients[i]
+	}
+	return out, nil
+}
+
+func (a *mtlsAuthenticator) authenticate(r *http.Request) (*principal, error) {
+	// VerifiedChains is only set once the certificate was verified against HTTPS_CLIENT_CA_FILE
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	client, ok := a.clients[cn]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownClientCert, cn)
+	}
+	return &principal{ID: client.CommonName, Roles: client.Roles, Method: "mtls"}, nil
+}
+
+// readClientCAs returns the pool of PEM encoded certificates in HTTPS_CLIENT_CA_FILE which client certificates
+// are verified against, or nil when it isn't set
+func readClientCAs() (*x509.CertPool, error) {
+	path := os.Getenv("HTTPS_CLIENT_CA_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTPS_CLIENT_CA_FILE: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return nil, fmt.Errorf("invalid HTTPS_CLIENT_CA_FILE: no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMTLS(t *testing.T) {
+	auth, err := readMTLSClients(writeAuthFile(t, "clients.json", `[{"commonName": "bank.example.com", "roles": ["approver"]}]`))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/files", nil)
+	p, err := auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	cert := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}},
+		}
+	}
+	req.TLS = cert("bank.example.com")
+	p, err = auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "bank.example.com", p.ID)
+	assert.Equal(t, "mtls", p.Method)
+
+	req.TLS = cert("other.example.com")
+	_, err = auth.authenticate(req)
+	assert.True(t, errors.Is(err, errUnknownClientCert))
+
+	// unverified certificates aren't trusted
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "bank.example.com"}}}}
+	p, err = auth.authenticate(req)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	_, err = readMTLSClients(writeAuthFile(t, "clients.json", `[{"roles": ["approver"]}]`))
+	assert.Error(t, err)
+}
+
+func TestMTLS_readClientCAs(t *testing.T) {
+	pool, err := readClientCAs()
+	require.NoError(t, err)
+	assert.Nil(t, pool)
+
+	t.Setenv("HTTPS_CLIENT_CA_FILE", writeAuthFile(t, "ca.pem", "not a certificate"))
+	_, err = readClientCAs()
+	assert.Error(t, err)
+
+	t.Setenv("HTTPS_CLIENT_CA_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	_, err = readClientCAs()
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAuthFile writes contents to a file in a temporary directory and returns its path
+func writeAuthFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func mockAuthRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	keys, err := readAPIKeys(writeAuthFile(t, "keys.json", `[
+  {"id": "viewer", "key": "viewer-key", "roles": ["viewer"]},
+  {"id": "maker", "key": "maker-key", "roles": ["creator"]},
+  {"id": "checker", "key": "checker-key", "roles": ["approver"]},
+  {"id": "root", "key": "admin-key", "roles": ["admin"]}
+]`))
+	require.NoError(t, err)
+
+	router := mockApprovalRouter(t)
+	addPingRoute(router)
+	router.Use(authMiddleware(log.NewNopLogger(), keys))
+	return router
+}
+
+func authRequest(router *mux.Router, method, target, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	// callers can't claim another identity
+	req.Header.Set("X-User-ID", "someone-else")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestAuth_roles(t *testing.T) {
+	router := mockAuthRouter(t)
+
+	assert.Equal(t, http.StatusOK, authRequest(router, "GET", "/ping", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, "GET", "/files", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, "GET", "/files", "wrong-key").Code)
+
+	for _, key := range []string{"viewer-key", "maker-key", "checker-key", "admin-key"} {
+		assert.Equal(t, http.StatusOK, authRequest(router, "GET", "/files/foo", key).Code, key)
+	}
+
+	assert.Equal(t, http.StatusForbidden, authRequest(router, "POST", "/files/foo/submit", "viewer-key").Code)
+	assert.Equal(t, http.StatusForbidden, authRequest(router, "POST", "/files/foo/submit", "checker-key").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, "POST", "/files/foo/submit", "maker-key").Code)
+
+	// approvals use the authenticated identity rather than the X-User-ID header
+	assert.Equal(t, http.StatusForbidden, authRequest(router, "POST", "/files/foo/approve", "maker-key").Code)
+	w := authRequest(router, "POST", "/files/foo/approve", "checker-key")
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Contains(t, w.Body.String(), `"userID":"checker"`)
+
+	assert.Equal(t, http.StatusForbidden, authRequest(router, "DELETE", "/files/foo", "maker-key").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, "DELETE", "/files/foo", "admin-key").Code)
+}
+
+func TestAuth_principal(t *testing.T) {
+	p := &principal{ID: "jane", Roles: []string{roleApprover}}
+	assert.True(t, p.hasRole(roleViewer))
+	assert.True(t, p.hasRole(roleApprover))
+	assert.False(t, p.hasRole(roleCreator))
+	assert.False(t, (&principal{ID: "john"}).hasRole(roleViewer))
+	assert.True(t, (&principal{ID: "root", Roles: []string{roleAdmin}}).hasRole(roleCreator))
+
+	assert.Equal(t, roleViewer, routeRole("GET", "/files"))
+	assert.Equal(t, roleCreator, routeRole("POST", "/files/create"))
+	assert.Equal(t, roleApprover, routeRole("POST", "/files/{fileId}/release"))
+	assert.Equal(t, roleAdmin, routeRole("DELETE", "/files/{fileId}"))
+
+	assert.True(t, errors.Is(checkRoles([]string{"viewer", "owner"}), errUnknownRole))
+}
+
+func TestAuth_readAuthenticators(t *testing.T) {
+	auths, err := readAuthenticators()
+	require.NoError(t, err)
+	assert.Empty(t, auths)
+
+	t.Setenv("API_KEYS_FILE", writeAuthFile(t, "keys.json", `[{"id": "jane", "key": "secret", "roles": ["viewer"]}]`))
+	t.Setenv("MTLS_CLIENTS_FILE", writeAuthFile(t, "clients.json", `[{"commonName": "bank", "roles": ["admin"]}]`))
+	// client certificates are only verified over TLS with a client CA
+	_, err = readAuthenticators()
+	assert.ErrorContains(t, err, "HTTPS_CLIENT_CA_FILE")
+	t.Setenv("HTTPS_CLIENT_CA_FILE", "ca.pem")
+	_, err = readAuthenticators()
+	assert.ErrorContains(t, err, "HTTPS_CERT_FILE")
+	t.Setenv("HTTPS_CERT_FILE", "cert.pem")
+	t.Setenv("HTTPS_KEY_FILE", "key.pem")
+	auths, err = readAuthenticators()
+	require.NoError(t, err)
+	assert.Len(t, auths, 2)
+
+	t.Setenv("JWT_JWKS_FILE", writeAuthFile(t, "jwks.json", `{"keys": []}`))
+	_, err = readAuthenticators()
+	assert.Error(t, err)
+}
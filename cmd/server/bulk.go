@@ -0,0 +1,417 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+// defaultBulkMaxBytes is the largest bulk upload accepted, including the contents of archives once extracted
+const defaultBulkMaxBytes = 100 << 20
+
+var (
+	errBulkTooLarge     = errors.New("bulk upload is too large")
+	errBulkLeadingBytes = errors.New("contents before the first {1500} tag aren't a message")
+)
+
+// messageStart matches the SenderSupplied {1500} tag each Fedwire message starts with
+var messageStart = regexp.MustCompile(`\{1500\}`)
+
+// bulkItem is one message of a bulk upload
+type bulkItem struct {
+	// name is the uploaded file the message was read from, followed by #n when the file has several messages
+	name     string
+	contents []byte
+	isJSON   bool
+	// err is why the item isn't a message, it's reported without being parsed
+	err error
+}
+
+// bulkResult is the outcome of one message of a bulk upload. Stored messages have a FileID, invalid ones the
+// validation error.
+type bulkResult struct {
+	Name   string `json:"name"`
+	FileID string `json:"fileID,omitempty"`
+	// Error is why the message wasn't stored, Field and Tag the field which failed validation
+	Error string `json:"error,omitempty"`
+	Field string `json:"field,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	// Duplicates are the IDs of stored files the message likely duplicates, it's rejected for them when
+	// duplicates are rejected
+	Duplicates []string `json:"duplicates,omitempty"`
+	// Violations are the policy rules the message violates
+	Violations []policyViolation `json:"violations,omitempty"`
+
+	valid bool
+}
+
+// bulkReport is the response of a bulk upload
+type bulkReport struct {
+	Total int `json:"total"`
+	// Valid counts the messages which passed validation, Created those stored
+	Valid   int          `json:"valid"`
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// withBulkUploads processes the messages of bulk uploads with workers goroutines and rejects uploads larger than
+// maxBytes
+func withBulkUploads(workers int, maxBytes int64) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.bulkWorkers = workers
+		opts.bulkMaxBytes = maxBytes
+	}
+}
+
+// readBulkOptions returns the file route options configured by BULK_UPLOAD_WORKERS and BULK_UPLOAD_MAX_BYTES
+func readBulkOptions() ([]fileRoutesOption, error) {
+	workers, maxBytes := runtime.NumCPU(), int64(defaultBulkMaxBytes)
+	if v := os.Getenv("BULK_UPLOAD_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid BULK_UPLOAD_WORKERS: %q", v)
+		}
+		workers = n
+	}
+	if v := os.Getenv("BULK_UPLOAD_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid BULK_UPLOAD_MAX_BYTES: %q", v)
+		}
+		maxBytes = n
+	}
+	return []fileRoutesOption{withBulkUploads(workers, maxBytes)}, nil
+}
+
+// bulkUpload reads many Fedwire files from a multipart upload, a zip, tar or gzipped tar archive, or a body of
+// many messages, validates their messages concurrently and returns a report of each. Valid messages are stored
+// unless validateOnly is true.
+func bulkUpload(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions, validateOnly bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		validateOpts, err := readValidateOpts(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid validate options: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		limit := &bulkLimit{remaining: opts.bulkMaxBytes}
+		r.Body = http.MaxBytesReader(w, r.Body, opts.bulkMaxBytes)
+		items, err := readBulkItems(r, limit)
+		if err != nil {
+			err = logger.LogErrorf("problem reading bulk upload: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Logf("read %d messages from bulk upload", len(items))
+
+		report := opts.processBulk(logger, r, repo, items, validateOpts, validateOnly)
+		logger.Logf("bulk upload of %d messages: %d valid, %d created, %d failed", report.Total, report.Valid, report.Created, report.Failed)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// processBulk validates and stores items with a pool of opts.bulkWorkers goroutines. Stores are serialized so
+// duplicates within the upload are found.
+func (opts *fileRoutesOptions) processBulk(logger log.Logger, r *http.Request, repo WireFileRepository, items []bulkItem, validateOpts *wire.ValidateOpts, validateOnly bool) bulkReport {
+	report := bulkReport{
+		Total:   len(items),
+		Results: make([]bulkResult, len(items)),
+	}
+	workers := opts.bulkWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var storeMu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				item := items[idx]
+				result := &report.Results[idx]
+				result.Name = item.name
+				if item.err != nil {
+					result.Error = item.err.Error()
+					continue
+				}
+
+				file, err := parseFile(bytes.NewReader(item.contents), item.isJSON)
+				if err == nil {
+					err = opts.checkEnvironment(file)
+				}
+				if err == nil {
+					err = validateWith(file, validateOpts)
+				}
+				if err == nil {
+					result.Violations, err = opts.policyViolations(r, repo, file)
+					if err == nil && len(result.Violations) > 0 {
+						err = errPolicyViolation
+					}
+				}
+				if err != nil {
+					recordValidationFailure(err)
+					ve := newValidationError(err)
+					result.Error, result.Field, result.Tag = ve.Error, ve.Field, ve.Tag
+					continue
+				}
+				result.valid = true
+				if validateOnly {
+					continue
+				}
+
+				file.ID = base.ID()
+				storeMu.Lock()
+				result.Duplicates, err = opts.storeBulkFile(repo, file)
+				storeMu.Unlock()
+				if err != nil {
+					result.Error = err.Error()
+					continue
+				}
+				result.FileID = file.ID
+
+				logger := logger.Set("fileID", log.String(file.ID))
+				recordFileCreated(file)
+				opts.recordCreated(logger, r, file, "bulk uploaded "+item.name)
+				opts.notifyCreated(logger, r, file)
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.valid {
+			report.Valid++
+		}
+		if result.FileID != "" {
+			report.Created++
+		}
+	}
+	report.Failed = report.Total - report.Created
+	if validateOnly {
+		report.Failed = report.Total - report.Valid
+	}
+	return report
+}
+
+// storeBulkFile saves a valid file of a bulk upload and returns the IDs of the stored files it likely duplicates.
+// Duplicates aren't saved when duplicates are rejected.
+func (opts *fileRoutesOptions) storeBulkFile(repo WireFileRepository, file *wire.File) ([]string, error) {
+	ids, err := opts.findDuplicateIDs(repo, file)
+	if err != nil {
+		return ids, err
+	}
+	return ids, repo.saveFile(file)
+}
+
+// bulkLimit is how many bytes of a bulk upload are left to read, counting the extracted contents of archives so
+// small archives can't expand without bound
+type bulkLimit struct {
+	remaining int64
+}
+
+func (l *bulkLimit) readAll(r io.Reader) ([]byte, error) {
+	bs, err := io.ReadAll(io.LimitReader(r, l.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bs)) > l.remaining {
+		return nil, errBulkTooLarge
+	}
+	l.remaining -= int64(len(bs))
+	return bs, nil
+}
+
+// readBulkItems returns the messages of a bulk upload. Multipart uploads are read part by part, other bodies are
+// one file or archive.
+func readBulkItems(r *http.Request, limit *bulkLimit) ([]bulkItem, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		bs, err := limit.readAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return expandBulkFile("upload", bs, strings.Contains(r.Header.Get("Content-Type"), "application/json"), limit)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var items []bulkItem
+	for i := 1; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := part.FileName()
+		if name == "" {
+			name = fmt.Sprintf("part-%d", i)
+		}
+		bs, err := limit.readAll(part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		more, err := expandBulkFile(name, bs, strings.HasSuffix(name, ".json"), limit)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, more...)
+	}
+}
+
+// expandBulkFile returns the messages of an uploaded file. Zip, tar and gzipped tar archives are extracted, JSON
+// files are one message and Fedwire text is split into a message at each {1500} tag.
+func expandBulkFile(name string, contents []byte, isJSON bool, limit *bulkLimit) ([]bulkItem, error) {
+	switch {
+	case bytes.HasPrefix(contents, []byte("PK\x03\x04")):
+		return expandZip(name, contents, limit)
+	case bytes.HasPrefix(contents, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		defer gz.Close()
+		return expandTar(name, gz, limit)
+	case len(contents) > 262 && string(contents[257:262]) == "ustar":
+		return expandTar(name, bytes.NewReader(contents), limit)
+	case isJSON:
+		return []bulkItem{{name: name, contents: contents, isJSON: true}}, nil
+	}
+	return splitMessages(name, contents), nil
+}
+
+func expandZip(name string, contents []byte, limit *bulkLimit) ([]bulkItem, error) {
+	zr, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var items []bulkItem
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || skipArchiveEntry(f.Name) {
+			continue
+		}
+		fd, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		bs, err := limit.readAll(fd)
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entryItems(f.Name, bs)...)
+	}
+	return items, nil
+}
+
+func expandTar(name string, r io.Reader, limit *bulkLimit) ([]bulkItem, error) {
+	tr := tar.NewReader(r)
+	var items []bulkItem
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || skipArchiveEntry(hdr.Name) {
+			continue
+		}
+		bs, err := limit.readAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entryItems(hdr.Name, bs)...)
+	}
+}
+
+// entryItems returns the messages of an archive entry, archives within archives aren't extracted
+func entryItems(name string, contents []byte) []bulkItem {
+	if strings.HasSuffix(name, ".json") {
+		return []bulkItem{{name: name, contents: contents, isJSON: true}}
+	}
+	return splitMessages(name, contents)
+}
+
+// skipArchiveEntry is true for hidden files of archives, such as the resource forks macOS adds to zip files
+func skipArchiveEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitMessages returns a message of Fedwire text for each {1500} tag in contents. Files of one message keep their
+// name, the messages of files with several are named name#1, name#2 and so on. Contents before the first of
+// several messages are an item named name with an error.
+func splitMessages(name string, contents []byte) []bulkItem {
+	starts := messageStart.FindAllIndex(contents, -1)
+	if len(starts) <= 1 {
+		if len(bytes.TrimSpace(contents)) == 0 {
+			return nil
+		}
+		return []bulkItem{{name: name, contents: contents}}
+	}
+	var items []bulkItem
+	if leading := contents[:starts[0][0]]; len(bytes.TrimSpace(leading)) > 0 {
+		items = append(items, bulkItem{
+			name:     name,
+			contents: leading,
+			err:      fmt.Errorf("%w: %d bytes", errBulkLeadingBytes, len(leading)),
+		})
+	}
+	for i, start := range starts {
+		end := len(contents)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		items = append(items, bulkItem{
+			name:     fmt.Sprintf("%s#%d", name, i+1),
+			contents: contents[start[0]:end],
+		})
+	}
+	return items
+}
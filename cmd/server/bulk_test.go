@@ -0,0 +1,228 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+const invalidMessage = "{1500}30User Req T \n"
+
+func mockBulkRouter(t *testing.T, opts ...fileRoutesOption) (*mux.Router, *memoryWireFileRepository) {
+	t.Helper()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, opts...)
+	return router, repo
+}
+
+func bulkRequest(t *testing.T, router *mux.Router, path, contentType string, body []byte) bulkReport {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report bulkReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	return report
+}
+
+func TestBulk_multipart(t *testing.T) {
+	router, repo := mockBulkRouter(t, withBulkUploads(4, defaultBulkMaxBytes))
+	transfer := readTestdataTransfer(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, contents := range map[string][]byte{
+		"first.txt":   transfer,
+		"second.txt":  transfer,
+		"invalid.txt": []byte(invalidMessage),
+	} {
+		part, err := mw.CreateFormFile("files", name)
+		require.NoError(t, err)
+		part.Write(contents)
+	}
+	js, err := json.Marshal(wire.File{FEDWireMessage: mockFEDWireMessage()})
+	require.NoError(t, err)
+	part, err := mw.CreateFormFile("files", "third.json")
+	require.NoError(t, err)
+	part.Write(js)
+	require.NoError(t, mw.Close())
+
+	report := bulkRequest(t, router, "/files/bulk", mw.FormDataContentType(), body.Bytes())
+	require.Equal(t, 4, report.Total)
+	require.Equal(t, 3, report.Valid)
+	require.Equal(t, 3, report.Created)
+	require.Equal(t, 1, report.Failed)
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	for _, result := range report.Results {
+		if result.Name == "invalid.txt" {
+			require.NotEmpty(t, result.Error)
+			require.Empty(t, result.FileID)
+		} else {
+			require.Empty(t, result.Error, result.Name)
+			file, err := repo.getFile(result.FileID)
+			require.NoError(t, err)
+			require.NotNil(t, file)
+		}
+	}
+}
+
+func TestBulk_archives(t *testing.T) {
+	transfer := readTestdataTransfer(t)
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, name := range []string{"wires/a.txt", "wires/b.txt", "__MACOSX/wires/._a.txt"} {
+		fd, err := zw.Create(name)
+		require.NoError(t, err)
+		fd.Write(transfer)
+	}
+	require.NoError(t, zw.Close())
+
+	var tarred bytes.Buffer
+	gz := gzip.NewWriter(&tarred)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(transfer)), Typeflag: tar.TypeReg}))
+		tw.Write(transfer)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	router, repo := mockBulkRouter(t)
+	report := bulkRequest(t, router, "/files/bulk", "application/zip", zipped.Bytes())
+	require.Equal(t, 2, report.Created)
+	require.Equal(t, "wires/a.txt", report.Results[0].Name)
+
+	report = bulkRequest(t, router, "/files/bulk", "application/gzip", tarred.Bytes())
+	require.Equal(t, 3, report.Created)
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+}
+
+func TestBulk_messages(t *testing.T) {
+	transfer := readTestdataTransfer(t)
+	body := bytes.Join([][]byte{transfer, transfer, []byte(invalidMessage)}, nil)
+
+	// validating stores nothing
+	router, repo := mockBulkRouter(t)
+	report := bulkRequest(t, router, "/files/bulk/validate", "text/plain", body)
+	require.Equal(t, 3, report.Total)
+	require.Equal(t, 2, report.Valid)
+	require.Equal(t, 0, report.Created)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, []string{"upload#1", "upload#2", "upload#3"}, []string{report.Results[0].Name, report.Results[1].Name, report.Results[2].Name})
+	require.NotEmpty(t, report.Results[2].Error)
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	// duplicates within the upload are rejected
+	router, repo = mockBulkRouter(t, withRejectDuplicates())
+	report = bulkRequest(t, router, "/files/bulk", "text/plain", body)
+	require.Equal(t, 2, report.Valid)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 2, report.Failed)
+
+	files, err = repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	var duplicates []string
+	for _, result := range report.Results {
+		duplicates = append(duplicates, result.Duplicates...)
+	}
+	require.Equal(t, []string{files[0].ID}, duplicates)
+
+	// duplicates are reported when they're stored
+	router, repo = mockBulkRouter(t)
+	report = bulkRequest(t, router, "/files/bulk", "text/plain", body)
+	require.Equal(t, 2, report.Created)
+	require.Empty(t, report.Results[0].Duplicates)
+	require.Equal(t, []string{report.Results[0].FileID}, report.Results[1].Duplicates)
+}
+
+func TestBulk_leadingBytes(t *testing.T) {
+	transfer := readTestdataTransfer(t)
+	body := bytes.Join([][]byte{[]byte("garbage\n"), transfer, []byte(invalidMessage)}, nil)
+
+	router, _ := mockBulkRouter(t)
+	report := bulkRequest(t, router, "/files/bulk", "text/plain", body)
+	require.Equal(t, 3, report.Total)
+	require.Equal(t, 1, report.Created)
+	require.Equal(t, 2, report.Failed)
+	require.Equal(t, "upload", report.Results[0].Name)
+	require.Contains(t, report.Results[0].Error, "before the first {1500} tag")
+	require.Equal(t, "upload#1", report.Results[1].Name)
+	require.NotEmpty(t, report.Results[1].FileID)
+
+	// whitespace isn't reported
+	report = bulkRequest(t, router, "/files/bulk/validate", "text/plain", append([]byte("\n\n"), body[len("garbage\n"):]...))
+	require.Equal(t, 2, report.Total)
+}
+
+func TestBulk_environment(t *testing.T) {
+	// the testdata file is a test message
+	router, _ := mockBulkRouter(t, withEnvironment(wire.EnvironmentProduction))
+	report := bulkRequest(t, router, "/files/bulk", "text/plain", readTestdataTransfer(t))
+	require.Equal(t, 1, report.Failed)
+}
+
+func TestBulk_tooLarge(t *testing.T) {
+	router, _ := mockBulkRouter(t, withBulkUploads(1, 100))
+
+	req := httptest.NewRequest("POST", "/files/bulk", bytes.NewReader(readTestdataTransfer(t)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBulk_readBulkOptions(t *testing.T) {
+	t.Setenv("BULK_UPLOAD_WORKERS", "8")
+	t.Setenv("BULK_UPLOAD_MAX_BYTES", "1024")
+	opts, err := readBulkOptions()
+	require.NoError(t, err)
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	require.Equal(t, 8, cfg.bulkWorkers)
+	require.Equal(t, int64(1024), cfg.bulkMaxBytes)
+
+	for key, value := range map[string]string{
+		"BULK_UPLOAD_WORKERS":   "0",
+		"BULK_UPLOAD_MAX_BYTES": "lots",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := readBulkOptions()
+			require.Error(t, err)
+		})
+	}
+}
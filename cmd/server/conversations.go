@@ -0,0 +1,223 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+const (
+	// conversationOutstanding is a request for credit without a reply
+	conversationOutstanding = "outstanding"
+	// conversationPaid is a request for credit answered with a funds transfer
+	conversationPaid = "paid"
+	// conversationRefused is a request for credit answered with a refusal
+	conversationRefused = "refused"
+)
+
+var errNoIMAD = errors.New("no IMAD found")
+
+// conversationMessage summarizes a FEDWireMessage of a conversation
+type conversationMessage struct {
+	FileID               string `json:"fileID"`
+	IMAD                 string `json:"imad"`
+	TypeSubType          string `json:"typeSubType"`
+	BusinessFunctionCode string `json:"businessFunctionCode"`
+	Amount               string `json:"amount"`
+	SenderABANumber      string `json:"senderABANumber"`
+	ReceiverABANumber    string `json:"receiverABANumber"`
+	SenderReference      string `json:"senderReference,omitempty"`
+	// Error is why a reply does not match its request, such replies don't change the status of the conversation
+	Error string `json:"error,omitempty"`
+}
+
+func newConversationMessage(file *wire.File) conversationMessage {
+	fwm := file.FEDWireMessage
+	msg := conversationMessage{
+		FileID: file.ID,
+		IMAD:   strings.TrimSpace(fwm.InputMessageAccountabilityData.Identifier()),
+	}
+	if fwm.TypeSubType != nil {
+		msg.TypeSubType = fwm.TypeSubType.TypeCode + fwm.TypeSubType.SubTypeCode
+	}
+	if fwm.BusinessFunctionCode != nil {
+		msg.BusinessFunctionCode = fwm.BusinessFunctionCode.BusinessFunctionCode
+	}
+	if fwm.Amount != nil {
+		msg.Amount = fwm.Amount.Amount
+	}
+	if fwm.SenderDepositoryInstitution != nil {
+		msg.SenderABANumber = fwm.SenderDepositoryInstitution.SenderABANumber
+	}
+	if fwm.ReceiverDepositoryInstitution != nil {
+		msg.ReceiverABANumber = fwm.ReceiverDepositoryInstitution.ReceiverABANumber
+	}
+	if fwm.SenderReference != nil {
+		msg.SenderReference = fwm.SenderReference.SenderReference
+	}
+	return msg
+}
+
+// conversation is a request for credit (subtype 31) and the funds transfers (32) and refusals (33) replying to it
+type conversation struct {
+	// IMAD of the request for credit
+	IMAD    string                `json:"imad"`
+	Status  string                `json:"status"`
+	Request conversationMessage   `json:"request"`
+	Replies []conversationMessage `json:"replies"`
+}
+
+// readConversations returns the request for credit conversations held in the repository sorted by IMAD. Replies are
+// linked to their request by PreviousMessageIdentifier.
+func readConversations(repo WireFileRepository) ([]*conversation, error) {
+	files, err := repo.getFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make(map[string]*wire.File)
+	var replies []*wire.File
+	for _, file := range files {
+		fwm := file.FEDWireMessage
+		if fwm.TypeSubType == nil || fwm.InputMessageAccountabilityData == nil {
+			continue
+		}
+		switch fwm.TypeSubType.SubTypeCode {
+		case wire.RequestCredit:
+			requests[strings.TrimSpace(fwm.InputMessageAccountabilityData.Identifier())] = file
+		case wire.FundsTransferRequestCredit, wire.RefusalRequestCredit:
+			if fwm.PreviousMessageIdentifier != nil {
+				replies = append(replies, file)
+			}
+		}
+	}
+
+	conversations := make(map[string]*conversation)
+	for imad, request := range requests {
+		conversations[imad] = &conversation{
+			IMAD:    imad,
+			Status:  conversationOutstanding,
+			Request: newConversationMessage(request),
+			Replies: []conversationMessage{},
+		}
+	}
+	for _, reply := range replies {
+		imad := strings.TrimSpace(reply.FEDWireMessage.PreviousMessageIdentifier.PreviousMessageIdentifier)
+		conv, ok := conversations[imad]
+		if !ok {
+			continue
+		}
+		msg := newConversationMessage(reply)
+		if err := reply.FEDWireMessage.ValidateRequestCreditReply(requests[imad].FEDWireMessage); err != nil {
+			msg.Error = err.Error()
+		} else if reply.FEDWireMessage.TypeSubType.SubTypeCode == wire.FundsTransferRequestCredit {
+			conv.Status = conversationPaid
+		} else if conv.Status == conversationOutstanding {
+			conv.Status = conversationRefused
+		}
+		conv.Replies = append(conv.Replies, msg)
+	}
+
+	out := make([]*conversation, 0, len(conversations))
+	for _, conv := range conversations {
+		sort.Slice(conv.Replies, func(i, j int) bool {
+			return conv.Replies[i].IMAD < conv.Replies[j].IMAD
+		})
+		out = append(out, conv)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].IMAD < out[j].IMAD
+	})
+	return out, nil
+}
+
+func addConversationRoutes(logger log.Logger, r *mux.Router, repo WireFileRepository) {
+	r.Methods("GET").Path("/conversations").HandlerFunc(getConversations(logger, repo))
+	r.Methods("GET").Path("/conversations/{imad}").HandlerFunc(getConversation(logger, repo))
+}
+
+// getConversations lists request for credit conversations, optionally filtered by the `status` query param
+func getConversations(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		status := strings.ToLower(r.URL.Query().Get("status"))
+		switch status {
+		case "", conversationOutstanding, conversationPaid, conversationRefused:
+		default:
+			err := logger.LogErrorf("invalid request: unknown conversation status: %s", status).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		conversations, err := readConversations(repo)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving conversations: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if status != "" {
+			filtered := conversations[:0]
+			for _, conv := range conversations {
+				if conv.Status == status {
+					filtered = append(filtered, conv)
+				}
+			}
+			conversations = filtered
+		}
+		logger.Logf("found %d conversations", len(conversations))
+
+		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", len(conversations)))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(conversations)
+	}
+}
+
+// getConversation returns the request for credit conversation of an IMAD
+func getConversation(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		imad := strings.TrimSpace(mux.Vars(r)["imad"])
+		if imad == "" {
+			moovhttp.Problem(w, errNoIMAD)
+			return
+		}
+		logger = logger.Set("imad", log.String(imad))
+
+		conversations, err := readConversations(repo)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving conversations: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		for _, conv := range conversations {
+			if conv.IMAD == imad {
+				logger.Log("rendering conversation")
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(conv)
+				return
+			}
+		}
+		logger.Log("conversation not found")
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRequestCredit returns a CustomerCorporateDrawdownRequest with the IMAD sequence number
+func mockRequestCredit(sequence string) wire.FEDWireMessage {
+	fwm := mockFEDWireMessage()
+	fwm.TypeSubType.SubTypeCode = wire.RequestCredit
+	fwm.BusinessFunctionCode.BusinessFunctionCode = wire.CustomerCorporateDrawdownRequest
+	fwm.InputMessageAccountabilityData.InputSequenceNumber = sequence
+	fwm.PreviousMessageIdentifier = nil
+
+	debitDD := wire.NewAccountDebitedDrawdown()
+	debitDD.IdentificationCode = wire.DemandDepositAccountNumber
+	debitDD.Identifier = "123456789"
+	debitDD.Name = "debitDD Name"
+	fwm.AccountDebitedDrawdown = debitDD
+
+	creditDD := wire.NewAccountCreditedDrawdown()
+	creditDD.DrawdownCreditAccountNumber = "123456789"
+	fwm.AccountCreditedDrawdown = creditDD
+	return fwm
+}
+
+func TestConversations(t *testing.T) {
+	repo := &memoryWireFileRepository{
+		files: make(map[string]*wire.File),
+	}
+	paid, refused, outstanding := mockRequestCredit("000001"), mockRequestCredit("000002"), mockRequestCredit("000003")
+	require.NoError(t, repo.saveFile(&wire.File{ID: "paid", FEDWireMessage: paid}))
+	require.NoError(t, repo.saveFile(&wire.File{ID: "refused", FEDWireMessage: refused}))
+	require.NoError(t, repo.saveFile(&wire.File{ID: "outstanding", FEDWireMessage: outstanding}))
+	require.NoError(t, repo.saveFile(&wire.File{ID: "transfer", FEDWireMessage: mockFEDWireMessage()}))
+
+	reply := func(id string, build func(wire.FEDWireMessage, time.Time) (wire.FEDWireMessage, error), request wire.FEDWireMessage) {
+		fwm, err := build(request, time.Now())
+		require.NoError(t, err)
+		fwm.InputMessageAccountabilityData.InputSource = "Source09"
+		fwm.InputMessageAccountabilityData.InputSequenceNumber = "000001"
+		require.NoError(t, repo.saveFile(&wire.File{ID: id, FEDWireMessage: fwm}))
+	}
+	reply("payment", wire.NewFundsTransferRequestCredit, paid)
+	reply("refusal", wire.NewRefusalRequestCredit, refused)
+
+	// a reply which doesn't match its request leaves it outstanding
+	fwm, err := wire.NewRefusalRequestCredit(outstanding, time.Now())
+	require.NoError(t, err)
+	fwm.Amount.Amount = "000000000001"
+	require.NoError(t, repo.saveFile(&wire.File{ID: "mismatch", FEDWireMessage: fwm}))
+
+	router := mux.NewRouter()
+	addConversationRoutes(log.NewNopLogger(), router, repo)
+
+	t.Run("list", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations", nil))
+		w.Flush()
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+		assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+
+		var conversations []conversation
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&conversations))
+		require.Len(t, conversations, 3)
+		assert.Equal(t, conversationPaid, conversations[0].Status)
+		assert.Equal(t, "payment", conversations[0].Replies[0].FileID)
+		assert.Equal(t, "1032", conversations[0].Replies[0].TypeSubType)
+		assert.Equal(t, conversationRefused, conversations[1].Status)
+		assert.Equal(t, conversationOutstanding, conversations[2].Status)
+		assert.Contains(t, conversations[2].Replies[0].Error, wire.ErrRequestCreditMismatch.Error())
+	})
+
+	t.Run("outstanding", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations?status=outstanding", nil))
+		w.Flush()
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+
+		var conversations []conversation
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&conversations))
+		require.Len(t, conversations, 1)
+		assert.Equal(t, "outstanding", conversations[0].Request.FileID)
+	})
+
+	t.Run("by IMAD", func(t *testing.T) {
+		imad := refused.InputMessageAccountabilityData.Identifier()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/"+imad, nil))
+		w.Flush()
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+
+		var conv conversation
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&conv))
+		assert.Equal(t, imad, conv.IMAD)
+		assert.Equal(t, conversationRefused, conv.Status)
+		assert.Equal(t, "refusal", conv.Replies[0].FileID)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/20190410Source08999999", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations?status=late", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestConversations_repoError(t *testing.T) {
+	repo := &testWireFileRepository{err: errors.New("bad error")}
+	router := mux.NewRouter()
+	addConversationRoutes(log.NewNopLogger(), router, repo)
+
+	for _, path := range []string{"/conversations", "/conversations/20190410Source08000001"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+// validationError is the response when a file sent to POST /validate or POST /convert is invalid
+type validationError struct {
+	Error string `json:"error"`
+	// Field and Tag are the field which failed and its tag, empty when the error isn't of one field
+	Field string `json:"field,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	// Violations are the policy rules the file violates
+	Violations []policyViolation `json:"violations,omitempty"`
+}
+
+// addConvertRoutes registers the routes which validate and convert files without storing them
+func addConvertRoutes(logger log.Logger, r *mux.Router, opts *fileRoutesOptions) {
+	r.Methods("POST").Path("/validate").HandlerFunc(validateContents(logger, opts))
+	r.Methods("POST").Path("/convert").HandlerFunc(convertContents(logger, opts))
+}
+
+// readRequestFile reads the file in the body of r, JSON when the Content-Type is application/json and Fedwire
+// text otherwise
+func readRequestFile(r *http.Request) (*wire.File, error) {
+	return parseFile(r.Body, strings.Contains(r.Header.Get("Content-Type"), "application/json"))
+}
+
+// parseFile reads a JSON file, or a file of Fedwire text when isJSON is false
+func parseFile(body io.Reader, isJSON bool) (*wire.File, error) {
+	start := time.Now()
+	if isJSON {
+		file := wire.NewFile()
+		err := json.NewDecoder(body).Decode(file)
+		observeParse("json", start)
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %v", err)
+		}
+		return file, nil
+	}
+	file, err := wire.NewReader(body).Read()
+	observeParse("fixed", start)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// validateWith validates file with the default validations and those of validateOpts
+func validateWith(file *wire.File, validateOpts *wire.ValidateOpts) error {
+	if err := file.Create(); err != nil { // Create calls Validate
+		return err
+	}
+	return file.ValidateWith(validateOpts)
+}
+
+// newValidationError returns the validationError of err
+func newValidationError(err error) *validationError {
+	resp := &validationError{Error: err.Error()}
+	var fe *wire.FieldError
+	if errors.As(err, &fe) {
+		resp.Field = fe.FieldName
+		resp.Tag = wire.FieldTag(fe.FieldName)
+	}
+	return resp
+}
+
+// readStatelessValidateOpts returns the validate options of r, which are those of readValidateOpts and an
+// environment of test or production. The environment defaults to the server's.
+func (opts *fileRoutesOptions) readStatelessValidateOpts(r *http.Request) (*wire.ValidateOpts, error) {
+	validateOpts, err := readValidateOpts(r)
+	if err != nil {
+		return nil, err
+	}
+	validateOpts.Environment = opts.environment
+	if v := r.URL.Query().Get("environment"); v != "" {
+		env, err := parseEnvironment(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment: %v", err)
+		}
+		validateOpts.Environment = env
+	}
+	return validateOpts, nil
+}
+
+// checkContents reads and validates the file in the body of r and checks it against the policy rules, limiting
+// it alone as no files are stored. Invalid files are answered with 400 and a validationError, including the
+// rules they violate, nil is returned for them.
+func (opts *fileRoutesOptions) checkContents(logger log.Logger, w http.ResponseWriter, r *http.Request) *wire.File {
+	validateOpts, err := opts.readStatelessValidateOpts(r)
+	if err != nil {
+		moovhttp.Problem(w, logger.LogErrorf("invalid validate options: %v", err).Err())
+		return nil
+	}
+
+	file, err := readRequestFile(r)
+	if err == nil {
+		err = validateWith(file, validateOpts)
+	}
+	violations, perr := opts.policyViolations(r, nil, file)
+	if perr != nil {
+		moovhttp.Problem(w, logger.LogErrorf("problem checking policy rules: %v", perr).Err())
+		return nil
+	}
+	if err == nil && len(violations) > 0 {
+		err = errPolicyViolation
+	}
+	if err != nil {
+		recordValidationFailure(err)
+		logger.Logf("file was invalid: %v", err)
+
+		resp := newValidationError(err)
+		resp.Violations = violations
+		writeJSON(w, http.StatusBadRequest, resp)
+		return nil
+	}
+	return file
+}
+
+// validateContents validates the file in the request body without storing it
+func validateContents(logger log.Logger, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		if file := opts.checkContents(logger, w, r); file == nil {
+			return
+		}
+
+		logger.Log("validated file contents")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(`{"error": null}`)
+	}
+}
+
+// convertContents validates the file in the request body and renders it without storing it. The format query
+// parameter selects json, fixed or variable output, otherwise JSON is rendered when the Accept header asks for it
+// and fixed-width text when it doesn't. Text output follows the newline query parameter as GET
+// /files/{fileId}/contents does.
+func convertContents(logger log.Logger, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "":
+			format = "fixed"
+			if strings.Contains(r.Header.Get("Accept"), "application/json") {
+				format = "json"
+			}
+		case "json", "fixed", "variable":
+		default:
+			moovhttp.Problem(w, logger.LogErrorf("invalid format: %q", format).Err())
+			return
+		}
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		file := opts.checkContents(logger, w, r)
+		if file == nil {
+			return
+		}
+		logger.Logf("converting file contents to %s", format)
+
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(opts.redact(file, mask))
+			return
+		}
+
+		writer, err := GetWriter(w, r)
+		if err != nil {
+			err = logger.LogErrorf("problem getting writer: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		if err := writer.Write(file); err != nil {
+			err = logger.LogErrorf("problem rendering file contents: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func mockConvertRouter(opts ...fileRoutesOption) *mux.Router {
+	cfg := &fileRoutesOptions{redactionPolicy: wire.DefaultRedactionPolicy()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	router := mux.NewRouter()
+	addConvertRoutes(log.NewNopLogger(), router, cfg)
+	return router
+}
+
+func readTestdataTransfer(t *testing.T) []byte {
+	t.Helper()
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	return bs
+}
+
+func convertRequest(t *testing.T, router *mux.Router, path, contentType, accept string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestConvert_validate(t *testing.T) {
+	router := mockConvertRouter()
+
+	w := convertRequest(t, router, "/validate", "text/plain", "", readTestdataTransfer(t))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	bs, err := json.Marshal(wire.File{FEDWireMessage: mockFEDWireMessage()})
+	require.NoError(t, err)
+	w = convertRequest(t, router, "/validate", "application/json", "", bs)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// invalid files name the failing field
+	fwm := mockFEDWireMessage()
+	fwm.Amount = nil
+	bs, err = json.Marshal(wire.File{FEDWireMessage: fwm})
+	require.NoError(t, err)
+	w = convertRequest(t, router, "/validate", "application/json", "", bs)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp validationError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "Amount", resp.Field)
+	require.Equal(t, wire.TagAmount, resp.Tag)
+
+	w = convertRequest(t, router, "/validate", "text/plain", "", []byte("{1500}30User Req T \n"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConvert_validateEnvironment(t *testing.T) {
+	// the testdata file is a test message
+	router := mockConvertRouter(withEnvironment(wire.EnvironmentProduction))
+	w := convertRequest(t, router, "/validate", "text/plain", "", readTestdataTransfer(t))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = convertRequest(t, router, "/validate?environment=test", "text/plain", "", readTestdataTransfer(t))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = convertRequest(t, router, "/validate?environment=staging", "text/plain", "", readTestdataTransfer(t))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConvert_convert(t *testing.T) {
+	router := mockConvertRouter()
+	bs := readTestdataTransfer(t)
+
+	// fixed-width text by default
+	w := convertRequest(t, router, "/convert", "text/plain", "", bs)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	fixed := w.Body.String()
+	require.Contains(t, fixed, "{1510}1000")
+
+	w = convertRequest(t, router, "/convert", "text/plain", "application/json", bs)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+	require.Equal(t, wire.CustomerTransfer, file.FEDWireMessage.BusinessFunctionCode.BusinessFunctionCode)
+
+	w = convertRequest(t, router, "/convert?format=variable&newline=false", "text/plain", "application/json", bs)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotContains(t, w.Body.String(), "\n")
+	require.Contains(t, w.Body.String(), "*")
+
+	// JSON converts back to the same text
+	js, err := json.Marshal(file)
+	require.NoError(t, err)
+	w = convertRequest(t, router, "/convert?format=fixed", "application/json", "", js)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, fixed, w.Body.String())
+
+	w = convertRequest(t, router, "/convert?format=xml", "text/plain", "", bs)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = convertRequest(t, router, "/convert", "text/plain", "", []byte("{1500}30User Req T \n"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConvert_mask(t *testing.T) {
+	router := mockConvertRouter(withMaskedResponses())
+	w := convertRequest(t, router, "/convert?format=json", "text/plain", "", readTestdataTransfer(t))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+	unmasked, err := wire.NewReader(strings.NewReader(string(readTestdataTransfer(t)))).Read()
+	require.NoError(t, err)
+	require.NotEqual(t, unmasked.FEDWireMessage.Beneficiary.Personal.Identifier, file.FEDWireMessage.Beneficiary.Personal.Identifier)
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+var errDuplicateFile = errors.New("file is a likely duplicate")
+
+// defaultDuplicateWindow is how far apart the creation of likely duplicates can be when DUPLICATE_WINDOW isn't set
+const defaultDuplicateWindow = 24 * time.Hour
+
+// withRejectDuplicates rejects creating files which are likely duplicates of a stored file
+func withRejectDuplicates() fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.rejectDuplicates = true
+	}
+}
+
+// withDuplicateWindow sets how far apart the creation of likely duplicates can be
+func withDuplicateWindow(window time.Duration) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.duplicateWindow = window
+	}
+}
+
+// readDuplicateOptions returns the file route options configured by REJECT_DUPLICATE_FILES and DUPLICATE_WINDOW
+func readDuplicateOptions() ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	if v := os.Getenv("REJECT_DUPLICATE_FILES"); v != "" {
+		reject, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REJECT_DUPLICATE_FILES: %v", err)
+		}
+		if reject {
+			opts = append(opts, withRejectDuplicates())
+		}
+	}
+	if v := os.Getenv("DUPLICATE_WINDOW"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid DUPLICATE_WINDOW: %q", v)
+		}
+		opts = append(opts, withDuplicateWindow(window))
+	}
+	return opts, nil
+}
+
+// findDuplicates returns the files in repo, other than file, whose FEDWireMessage has the fingerprint of file's
+// and which were created within duplicateWindow of file. Only the files created in that window are read, a file
+// which isn't stored yet is created now. Resends are intentional and never have duplicates.
+func (opts *fileRoutesOptions) findDuplicates(repo WireFileRepository, file *wire.File) ([]*wire.File, error) {
+	if file.FEDWireMessage.IsResend() || opts.approvals == nil {
+		return nil, nil
+	}
+	created := opts.approvals.getApproval(file.ID).CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	fingerprint := file.FEDWireMessage.Fingerprint()
+
+	var out []*wire.File
+	for _, id := range opts.approvals.createdBetween(created.Add(-opts.duplicateWindow), created.Add(opts.duplicateWindow)) {
+		if id == file.ID {
+			continue
+		}
+		f, err := repo.getFile(id)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil && f.FEDWireMessage.Fingerprint() == fingerprint {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// findDuplicateIDs returns the IDs of the likely duplicates of file, with errDuplicateFile when duplicates are
+// rejected. It's used when files are created without a response to set X-Duplicate-Files on.
+func (opts *fileRoutesOptions) findDuplicateIDs(repo WireFileRepository, file *wire.File) ([]string, error) {
+	duplicates, err := opts.findDuplicates(repo, file)
+	if err != nil || len(duplicates) == 0 {
+		return nil, err
+	}
+	ids := make([]string, len(duplicates))
+	for i := range duplicates {
+		ids[i] = duplicates[i].ID
+	}
+	if opts.rejectDuplicates {
+		return ids, fmt.Errorf("%w of %s", errDuplicateFile, strings.Join(ids, ","))
+	}
+	return ids, nil
+}
+
+// duplicateFilesError is the response when creating a file rejected as a likely duplicate
+type duplicateFilesError struct {
+	Error      string   `json:"error"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// checkDuplicates sets the X-Duplicate-Files header to the IDs of the likely duplicates of file. It responds with
+// 409 Conflict and returns errDuplicateFile when duplicates are rejected.
+func (opts *fileRoutesOptions) checkDuplicates(w http.ResponseWriter, repo WireFileRepository, file *wire.File) error {
+	duplicates, err := opts.findDuplicates(repo, file)
+	if err != nil {
+		moovhttp.Problem(w, err)
+		return err
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	ids := make([]string, len(duplicates))
+	for i := range duplicates {
+		ids[i] = duplicates[i].ID
+	}
+	w.Header().Set("X-Duplicate-Files", strings.Join(ids, ","))
+	if !opts.rejectDuplicates {
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(duplicateFilesError{
+		Error:      errDuplicateFile.Error(),
+		Duplicates: ids,
+	})
+	return errDuplicateFile
+}
+
+// getDuplicates returns the likely duplicates of the file
+func getDuplicates(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		duplicates, err := opts.findDuplicates(repo, file)
+		if err != nil {
+			err = logger.LogErrorf("error finding duplicates: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Logf("found %d duplicates", len(duplicates))
+		opts.recordAudit(logger, r, auditRead, fileId, file, file, "read duplicates")
+		out := make([]*wire.File, len(duplicates))
+		for i := range duplicates {
+			opts.recordAudit(logger, r, auditRead, duplicates[i].ID, duplicates[i], duplicates[i], "read as a duplicate of "+fileId)
+			out[i] = opts.redact(duplicates[i], mask)
+		}
+
+		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", len(out)))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// resendFile saves a copy of the file marked as a resend, for an operator to intentionally send it again
+func resendFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		original, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if original == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		fwm, err := wire.NewResend(original.FEDWireMessage)
+		if err != nil {
+			err = logger.LogErrorf("problem building resend: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		file := wire.NewFile()
+		file.ID = base.ID()
+		file.AddFEDWireMessage(fwm)
+		if err := opts.checkEnvironment(file); err != nil {
+			err = logger.LogErrorf("resend rejected: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, file); err != nil {
+			logger.LogErrorf("resend rejected: %v", err)
+			return
+		}
+		if err := repo.saveFile(file); err != nil {
+			err = logger.LogErrorf("problem saving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Set("resendFileID", log.String(file.ID)).Log("created resend")
+		opts.recordCreated(logger, r, file, "resend of "+fileId)
+		opts.notifyCreated(logger, r, file)
+
+		recordFileCreated(file)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(opts.redact(file, mask))
+	}
+}
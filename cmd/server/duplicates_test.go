@@ -0,0 +1,162 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicates_createFile(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}))
+
+	// a retry of the original with another IMAD
+	retry := mockFEDWireMessage()
+	retry.InputMessageAccountabilityData.InputCycleDate = "20991231"
+	retry.InputMessageAccountabilityData.InputSequenceNumber = "000002"
+
+	t.Run("reported", func(t *testing.T) {
+		router := mux.NewRouter()
+		opts := addFileRoutes(log.NewNopLogger(), router, repo)
+		opts.approvals.created("original", "")
+
+		w := createFileJSON(t, router, retry)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body)
+		assert.Equal(t, "original", w.Header().Get("X-Duplicate-Files"))
+
+		other := mockFEDWireMessage()
+		other.Amount.Amount = "000000000001"
+		w = createFileJSON(t, router, other)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body)
+		assert.Empty(t, w.Header().Get("X-Duplicate-Files"))
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+		require.NoError(t, repo.saveFile(&wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}))
+		router := mux.NewRouter()
+		opts := addFileRoutes(log.NewNopLogger(), router, repo, withRejectDuplicates())
+		opts.approvals.created("original", "")
+
+		w := createFileJSON(t, router, retry)
+		require.Equal(t, http.StatusConflict, w.Code, w.Body)
+
+		var resp duplicateFilesError
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, []string{"original"}, resp.Duplicates)
+
+		files, err := repo.getFiles()
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("outside the window", func(t *testing.T) {
+		repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+		require.NoError(t, repo.saveFile(&wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}))
+		router := mux.NewRouter()
+		opts := addFileRoutes(log.NewNopLogger(), router, repo, withRejectDuplicates(), withDuplicateWindow(time.Hour))
+		opts.approvals.created("original", "")
+		opts.approvals.approvals["original"].CreatedAt = time.Now().Add(-2 * time.Hour)
+
+		w := createFileJSON(t, router, retry)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body)
+		assert.Empty(t, w.Header().Get("X-Duplicate-Files"))
+	})
+}
+
+func TestDuplicates_resendFile(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}))
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withRejectDuplicates())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/files/original/resend", nil))
+	w.Flush()
+	require.Equal(t, http.StatusCreated, w.Code, w.Body)
+
+	var resend wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resend))
+	assert.NotEqual(t, "original", resend.ID)
+	assert.Equal(t, wire.MessageDuplicationResend, resend.FEDWireMessage.SenderSupplied.MessageDuplicationCode)
+
+	// the original lists the resend as a duplicate, the resend has none
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/original/duplicates", nil))
+	w.Flush()
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	var duplicates []*wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&duplicates))
+	assert.Equal(t, resend.ID, duplicates[0].ID)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+resend.ID+"/duplicates", nil))
+	w.Flush()
+	assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/files/missing/resend", nil),
+		httptest.NewRequest("GET", "/files/missing/duplicates", nil),
+	} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		w.Flush()
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDuplicates_repoError(t *testing.T) {
+	repo := &testWireFileRepository{err: errors.New("bad error")}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/files/foo/resend", nil),
+		httptest.NewRequest("GET", "/files/foo/duplicates", nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestDuplicates_readDuplicateOptions(t *testing.T) {
+	t.Setenv("REJECT_DUPLICATE_FILES", "true")
+	opts, err := readDuplicateOptions()
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+
+	t.Setenv("REJECT_DUPLICATE_FILES", "maybe")
+	_, err = readDuplicateOptions()
+	assert.Error(t, err)
+
+	t.Setenv("REJECT_DUPLICATE_FILES", "")
+	t.Setenv("DUPLICATE_WINDOW", "2h")
+	opts, err = readDuplicateOptions()
+	require.NoError(t, err)
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	assert.Equal(t, 2*time.Hour, cfg.duplicateWindow)
+
+	t.Setenv("DUPLICATE_WINDOW", "-1h")
+	_, err = readDuplicateOptions()
+	assert.Error(t, err)
+}
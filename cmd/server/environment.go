@@ -0,0 +1,83 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/moov-io/wire"
+)
+
+var errRewriteToTest = errors.New("REWRITE_PRODUCTION_TO_TEST requires WIRE_ENVIRONMENT=test")
+
+// withEnvironment rejects files whose SenderSupplied TestProductionCode isn't env, wire.EnvironmentTest or
+// wire.EnvironmentProduction
+func withEnvironment(env string) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.environment = env
+	}
+}
+
+// withRewriteToTest rewrites production messages to test before they are checked and stored, so fixtures
+// captured in production can be loaded into a test environment
+func withRewriteToTest() fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.rewriteToTest = true
+	}
+}
+
+// readEnvironmentOptions returns the file route options configured by WIRE_ENVIRONMENT and REWRITE_PRODUCTION_TO_TEST
+func readEnvironmentOptions() ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	env, err := parseEnvironment(os.Getenv("WIRE_ENVIRONMENT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WIRE_ENVIRONMENT: %v", err)
+	}
+	if env != "" {
+		opts = append(opts, withEnvironment(env))
+	}
+	if v := os.Getenv("REWRITE_PRODUCTION_TO_TEST"); v != "" {
+		rewrite, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REWRITE_PRODUCTION_TO_TEST: %v", err)
+		}
+		if rewrite {
+			if env != wire.EnvironmentTest {
+				return nil, errRewriteToTest
+			}
+			opts = append(opts, withRewriteToTest())
+		}
+	}
+	return opts, nil
+}
+
+// parseEnvironment returns the TestProductionCode of an environment named test, production, T or P
+func parseEnvironment(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "":
+		return "", nil
+	case "test", "t":
+		return wire.EnvironmentTest, nil
+	case "production", "p":
+		return wire.EnvironmentProduction, nil
+	}
+	return "", fmt.Errorf("unknown environment %q", v)
+}
+
+// checkEnvironment rewrites a production file to test when configured and then checks its TestProductionCode
+// matches the environment of the server. Every file is accepted when no environment is configured.
+func (opts *fileRoutesOptions) checkEnvironment(file *wire.File) error {
+	if opts.environment == "" || file == nil {
+		return nil
+	}
+	if ss := file.FEDWireMessage.SenderSupplied; opts.rewriteToTest && ss != nil && ss.TestProductionCode == wire.EnvironmentProduction {
+		ss.TestProductionCode = wire.EnvironmentTest
+	}
+	return file.FEDWireMessage.ValidateEnvironment(opts.environment)
+}
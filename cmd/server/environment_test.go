@@ -0,0 +1,131 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createFileJSON posts fwm as a JSON file and returns the response
+func createFileJSON(t *testing.T, router *mux.Router, fwm wire.FEDWireMessage) *httptest.ResponseRecorder {
+	t.Helper()
+	bs, err := json.Marshal(wire.File{FEDWireMessage: fwm})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/files/create", bytes.NewReader(bs))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestEnvironment_createFile(t *testing.T) {
+	production := mockFEDWireMessage()
+	test := mockFEDWireMessage()
+	test.SenderSupplied.TestProductionCode = wire.EnvironmentTest
+
+	t.Run("production", func(t *testing.T) {
+		router := mux.NewRouter()
+		addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)},
+			withEnvironment(wire.EnvironmentProduction))
+
+		assert.Equal(t, http.StatusCreated, createFileJSON(t, router, production).Code)
+
+		w := createFileJSON(t, router, test)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), wire.ErrEnvironmentMismatch.Error())
+	})
+
+	t.Run("test", func(t *testing.T) {
+		router := mux.NewRouter()
+		addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)},
+			withEnvironment(wire.EnvironmentTest))
+
+		assert.Equal(t, http.StatusCreated, createFileJSON(t, router, test).Code)
+		assert.Equal(t, http.StatusBadRequest, createFileJSON(t, router, production).Code)
+	})
+
+	t.Run("rewrite to test", func(t *testing.T) {
+		repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+		router := mux.NewRouter()
+		addFileRoutes(log.NewNopLogger(), router, repo, withEnvironment(wire.EnvironmentTest), withRewriteToTest())
+
+		w := createFileJSON(t, router, production)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body)
+
+		var resp wire.File
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		file, err := repo.getFile(resp.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wire.EnvironmentTest, file.FEDWireMessage.SenderSupplied.TestProductionCode)
+	})
+
+	t.Run("any environment", func(t *testing.T) {
+		router := mux.NewRouter()
+		addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)})
+
+		assert.Equal(t, http.StatusCreated, createFileJSON(t, router, production).Code)
+		assert.Equal(t, http.StatusCreated, createFileJSON(t, router, test).Code)
+	})
+}
+
+func TestEnvironment_validateFile(t *testing.T) {
+	repo := &testWireFileRepository{file: &wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withEnvironment(wire.EnvironmentTest))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/validate", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), wire.ErrEnvironmentMismatch.Error())
+}
+
+func TestEnvironment_addFEDWireMessage(t *testing.T) {
+	repo := &testWireFileRepository{file: &wire.File{ID: "foo"}}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withEnvironment(wire.EnvironmentTest))
+
+	bs, err := json.Marshal(mockFEDWireMessage())
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/files/foo/FEDWireMessage", bytes.NewReader(bs)))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEnvironment_readEnvironmentOptions(t *testing.T) {
+	t.Setenv("WIRE_ENVIRONMENT", "test")
+	t.Setenv("REWRITE_PRODUCTION_TO_TEST", "true")
+	opts, err := readEnvironmentOptions()
+	require.NoError(t, err)
+
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	assert.Equal(t, wire.EnvironmentTest, cfg.environment)
+	assert.True(t, cfg.rewriteToTest)
+
+	t.Setenv("WIRE_ENVIRONMENT", "P")
+	_, err = readEnvironmentOptions()
+	assert.Equal(t, errRewriteToTest, err)
+
+	t.Setenv("REWRITE_PRODUCTION_TO_TEST", "")
+	t.Setenv("WIRE_ENVIRONMENT", "staging")
+	_, err = readEnvironmentOptions()
+	assert.Error(t, err)
+}
@@ -9,42 +9,110 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/go-kit/kit/metrics/prometheus"
 	"github.com/gorilla/mux"
 	"github.com/moov-io/base"
 	moovhttp "github.com/moov-io/base/http"
 	"github.com/moov-io/base/log"
 	"github.com/moov-io/wire"
-	stdprometheus "github.com/prometheus/client_golang/prometheus"
 )
 
 var (
-	filesCreated = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
-		Name: "wire_files_created",
-		Help: "The number of WIRE files created",
-	}, nil) // TODO(adam): add key/value pairs []string{"destination", "origin"}
-
-	filesDeleted = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
-		Name: "wire_files_deleted",
-		Help: "The number of WIRE files deleted",
-	}, nil)
-
 	errNoFileId           = errors.New("no File ID found")
 	errNoFEDWireMessageID = errors.New("no FEDWireMessage ID found")
 )
 
-func addFileRoutes(logger log.Logger, r *mux.Router, repo WireFileRepository) {
-	r.Methods("GET").Path("/files").HandlerFunc(getFiles(logger, repo))
-	r.Methods("POST").Path("/files/create").HandlerFunc(createFile(logger, repo))
-	r.Methods("GET").Path("/files/{fileId}").HandlerFunc(getFile(logger, repo))
-	r.Methods("DELETE").Path("/files/{fileId}").HandlerFunc(deleteFile(logger, repo))
-	r.Methods("GET").Path("/files/{fileId}/contents").HandlerFunc(getFileContents(logger, repo))
-	r.Methods("GET").Path("/files/{fileId}/validate").HandlerFunc(validateFile(logger, repo))
-	r.Methods("POST").Path("/files/{fileId}/FEDWireMessage").HandlerFunc(addFEDWireMessageToFile(logger, repo))
+// fileRoutesOptions are the optional behaviors of the file routes
+type fileRoutesOptions struct {
+	// maskResponses masks every file rendered as JSON
+	maskResponses bool
+	// redactionPolicy is used to mask files
+	redactionPolicy wire.RedactionPolicy
+	// environment is the TestProductionCode files must have, any is accepted when empty
+	environment string
+	// rewriteToTest rewrites production files to test before they are stored
+	rewriteToTest bool
+	// rejectDuplicates rejects creating files which are likely duplicates of a stored file
+	rejectDuplicates bool
+	// duplicateWindow is how far apart the creation of files which are likely duplicates can be
+	duplicateWindow time.Duration
+	// approvals holds the status of files
+	approvals *approvalRepository
+	// approvalPolicy holds the users permitted to create and approve files
+	approvalPolicy approvalPolicy
+	// requireApproval only serves the contents of approved files
+	requireApproval bool
+	// audit records every operation on files
+	audit *auditLog
+	// webhooks notifies endpoints of file events, nil when no webhooks are configured
+	webhooks *webhookNotifier
+	// imad stamps IMAD sequence numbers onto files when they're released, nil when they aren't stamped
+	imad *imadAllocator
+	// idempotency replays the responses of retried requests with an idempotency key
+	idempotency *idempotencyRecorder
+	// bulkWorkers is how many messages of a bulk upload are processed at once
+	bulkWorkers int
+	// bulkMaxBytes is the largest bulk upload accepted
+	bulkMaxBytes int64
+	// policies checks files against policy rules when they're created and approved, nil when there are no rules
+	policies *policyEngine
+	// locks holds the fields of files which the templates they were instantiated from lock
+	locks *fileLocks
+}
+
+type fileRoutesOption func(*fileRoutesOptions)
+
+// addFileRoutes registers the file routes and returns the options they use, so background workers handle files
+// the same way
+func addFileRoutes(logger log.Logger, r *mux.Router, repo WireFileRepository, opts ...fileRoutesOption) *fileRoutesOptions {
+	cfg := &fileRoutesOptions{
+		redactionPolicy: defaultRedactionPolicy(),
+		approvals:       newApprovalRepository(),
+		audit:           newAuditLog(),
+		idempotency:     newIdempotencyRecorder(24 * time.Hour),
+		duplicateWindow: defaultDuplicateWindow,
+		locks:           newFileLocks(),
+		bulkWorkers:     runtime.NumCPU(),
+		bulkMaxBytes:    defaultBulkMaxBytes,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	r.Methods("GET").Path("/files").HandlerFunc(getFiles(logger, repo, cfg))
+	r.Methods("POST").Path("/files/create").HandlerFunc(cfg.idempotency.idempotent(logger, createFile(logger, repo, cfg)))
+	r.Methods("POST").Path("/files/bulk").HandlerFunc(bulkUpload(logger, repo, cfg, false))
+	r.Methods("POST").Path("/files/bulk/validate").HandlerFunc(bulkUpload(logger, repo, cfg, true))
+	r.Methods("GET").Path("/files/{fileId}").HandlerFunc(getFile(logger, repo, cfg))
+	r.Methods("DELETE").Path("/files/{fileId}").HandlerFunc(deleteFile(logger, repo, cfg))
+	r.Methods("GET").Path("/files/{fileId}/contents").HandlerFunc(getFileContents(logger, repo, cfg))
+	r.Methods("GET").Path("/files/{fileId}/validate").HandlerFunc(validateFile(logger, repo, cfg))
+	r.Methods("POST").Path("/files/{fileId}/FEDWireMessage").HandlerFunc(cfg.idempotency.idempotent(logger, addFEDWireMessageToFile(logger, repo, cfg)))
+	r.Methods("PATCH").Path("/files/{fileId}/FEDWireMessage").HandlerFunc(patchFEDWireMessage(logger, repo, cfg))
+	r.Methods("GET").Path("/files/{fileId}/tags/{tag}").HandlerFunc(getTag(logger, repo, cfg))
+	r.Methods("PUT").Path("/files/{fileId}/tags/{tag}").HandlerFunc(putTag(logger, repo, cfg))
+	r.Methods("PATCH").Path("/files/{fileId}/tags/{tag}").HandlerFunc(patchTag(logger, repo, cfg))
+	r.Methods("DELETE").Path("/files/{fileId}/tags/{tag}").HandlerFunc(deleteTag(logger, repo, cfg))
+	r.Methods("POST").Path("/files/{fileId}/reversal").HandlerFunc(createReversal(logger, repo, cfg))
+	r.Methods("GET").Path("/files/{fileId}/reversal/validate").HandlerFunc(validateReversal(logger, repo))
+	r.Methods("GET").Path("/files/{fileId}/duplicates").HandlerFunc(getDuplicates(logger, repo, cfg))
+	r.Methods("POST").Path("/files/{fileId}/resend").HandlerFunc(resendFile(logger, repo, cfg))
+	r.Methods("GET").Path("/files/{fileId}/approval").HandlerFunc(getApproval(logger, repo, cfg))
+	r.Methods("POST").Path("/files/{fileId}/submit").HandlerFunc(transitionFile(logger, repo, cfg, statusPendingApproval))
+	r.Methods("POST").Path("/files/{fileId}/approve").HandlerFunc(transitionFile(logger, repo, cfg, statusApproved))
+	r.Methods("POST").Path("/files/{fileId}/reject").HandlerFunc(transitionFile(logger, repo, cfg, statusRejected))
+	r.Methods("POST").Path("/files/{fileId}/release").HandlerFunc(transitionFile(logger, repo, cfg, statusReleased))
+	r.Methods("GET").Path("/files/{fileId}/audit").HandlerFunc(getFileAudit(logger, cfg))
+	r.Methods("GET").Path("/files/{fileId}/versions/{version}").HandlerFunc(getFileVersion(logger, repo, cfg))
+	r.Methods("GET").Path("/audit/export").HandlerFunc(exportAudit(logger, cfg))
+	r.Methods("GET").Path("/webhooks/dead-letters").HandlerFunc(getDeadLetters(logger, cfg))
+	return cfg
 }
 
 func getFileId(w http.ResponseWriter, r *http.Request) string {
@@ -65,21 +133,38 @@ func getFEDWireMessageID(w http.ResponseWriter, r *http.Request) string {
 	return v
 }
 
-func getFiles(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func getFiles(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		status, err := readFileStatus(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
 		files, err := repo.getFiles() // TODO(adam): implement soft and hard limits
 		if err != nil {
 			err = logger.LogErrorf("error retrieving files: %v", err).Err()
 			moovhttp.Problem(w, err)
 			return
 		}
+		files = opts.filterByStatus(files, status)
 		logger.Logf("found %d files", len(files))
+		opts.recordAudit(logger, r, auditListed, "", nil, nil, fmt.Sprintf("listed %d files", len(files)))
+		for i := range files {
+			files[i] = opts.redact(files[i], mask)
+		}
 
 		w.Header().Set("X-Total-Count", fmt.Sprintf("%d", len(files)))
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -88,66 +173,93 @@ func getFiles(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 	}
 }
 
-func createFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func createFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
 		req := wire.NewFile()
-		req.ID = base.ID()
 
+		start := time.Now()
 		if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
 			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 				err = logger.LogErrorf("error reading request body: %v", err).Err()
 				moovhttp.Problem(w, err)
 				return
 			}
+			observeParse("json", start)
 			if err := req.Validate(); err != nil {
-				err = logger.LogErrorf("file validation failed: %v", err).Err()
-				moovhttp.Problem(w, err)
+				opts.writeInvalidFile(logger, w, r, repo, req, fmt.Errorf("file validation failed: %w", err))
 				return
 			}
 		} else {
 			file, err := wire.NewReader(r.Body).Read()
+			observeParse("fixed", start)
 			if err != nil {
-				err = logger.LogErrorf("error reading file: %v", err).Err()
-				moovhttp.Problem(w, err)
+				opts.writeInvalidFile(logger, w, r, repo, &file, fmt.Errorf("error reading file: %w", err))
 				return
 			}
 			req = &file
 		}
-		if req.ID == "" {
-			req.ID = base.ID()
-		}
+		// the ID is always assigned, a client chosen ID would replace the stored file having it
+		req.ID = base.ID()
 		logger = logger.Set("fileID", log.String(req.ID))
 
+		if err := opts.checkEnvironment(req); err != nil {
+			err = logger.LogErrorf("file rejected: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, req); err != nil {
+			logger.LogErrorf("file rejected: %v", err)
+			return
+		}
+		if err := opts.checkDuplicates(w, repo, req); err != nil {
+			logger.LogErrorf("file rejected: %v", err)
+			return
+		}
+
 		if err := repo.saveFile(req); err != nil {
 			err = logger.LogErrorf("problem saving file: %v", err).Err()
 			moovhttp.Problem(w, err)
 			return
 		}
 		logger.Log("created file")
+		opts.recordCreated(logger, r, req, "")
+		opts.notifyCreated(logger, r, req)
+		if version, err := repo.fileVersion(req.ID); err == nil {
+			writeFileVersion(w, version)
+		}
 
-		// record a metric for files created
-		filesCreated.Add(1) // TODO(adam): add key/value pairs (like in ACH)
+		recordFileCreated(req)
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(req)
+		json.NewEncoder(w).Encode(opts.redact(req, mask))
 	}
 }
 
-func getFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func getFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
 		fileId := getFileId(w, r)
 		if fileId == "" {
 			logger.LogError(errNoFileId)
@@ -155,6 +267,12 @@ func getFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 		}
 		logger = logger.Set("fileID", log.String(fileId))
 
+		version, err := repo.fileVersion(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
 		file, err := repo.getFile(fileId)
 		if err != nil {
 			err = logger.LogErrorf("error retrieving file: %v", err).Err()
@@ -169,17 +287,17 @@ func getFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 		}
 
 		logger.Log("rendering file")
+		opts.recordAudit(logger, r, auditRead, fileId, file, file, "")
+		writeFileVersion(w, version)
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(file)
+		json.NewEncoder(w).Encode(opts.redact(file, mask))
 	}
 }
 
-func deleteFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func deleteFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
@@ -190,14 +308,34 @@ func deleteFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 		}
 		logger = logger.Set("fileID", log.String(fileId))
 
+		version, err := repo.fileVersion(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := checkIfMatch(r, version); err != nil {
+			writeProblem(w, http.StatusPreconditionFailed, logger.LogError(err).Err())
+			return
+		}
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
 		if err := repo.deleteFile(fileId); err != nil {
 			err = logger.LogErrorf("error deleting file: %v", err).Err()
 			moovhttp.Problem(w, err)
 			return
 		}
+		opts.approvals.deleteApproval(fileId)
+		opts.locks.unlock(fileId)
 		logger.Log("deleted file")
+		opts.recordAudit(logger, r, auditDeleted, fileId, file, nil, "")
+		opts.notifyWebhooks(logger, r, eventFileDeleted, fileId, nil)
 
-		filesDeleted.Add(1)
+		recordFileDeleted(file)
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
@@ -205,11 +343,9 @@ func deleteFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 	}
 }
 
-func getFileContents(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func getFileContents(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
@@ -231,6 +367,10 @@ func getFileContents(logger log.Logger, repo WireFileRepository) http.HandlerFun
 			http.NotFound(w, r)
 			return
 		}
+		if err := opts.checkReleasable(fileId); err != nil {
+			writeProblem(w, http.StatusForbidden, logger.LogError(err).Err())
+			return
+		}
 		logger.Log("rendering file contents")
 
 		writer, err := GetWriter(w, r)
@@ -246,15 +386,14 @@ func getFileContents(logger log.Logger, repo WireFileRepository) http.HandlerFun
 			moovhttp.Problem(w, err)
 			return
 		}
+		opts.recordAudit(logger, r, auditDownloaded, fileId, file, file, "")
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func validateFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func validateFile(logger log.Logger, repo WireFileRepository, cfg *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
@@ -278,27 +417,52 @@ func validateFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
 			return
 		}
 
-		if err := file.Create(); err != nil { // Create calls Validate
+		opts, err := readValidateOpts(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid validate options: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		opts.Environment = cfg.environment
+
+		err = file.Create() // Create calls Validate
+		if err == nil {
+			err = file.ValidateWith(opts)
+		}
+		detail := "valid"
+		if err != nil {
+			detail = err.Error()
+		}
+		cfg.recordAudit(logger, r, auditValidated, fileId, file, file, detail)
+		if err != nil {
+			recordValidationFailure(err)
+			cfg.notifyWebhooks(logger, r, eventFileValidationFailed, fileId, err)
 			err = logger.LogErrorf("file was invalid: %v", err).Err()
 			moovhttp.Problem(w, err)
 			return
 		}
 
 		logger.Log("validated file")
+		cfg.notifyWebhooks(logger, r, eventFileValidated, fileId, nil)
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(`{"error": null}`)
 	}
 }
 
-func addFEDWireMessageToFile(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+func addFEDWireMessageToFile(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if requestID := moovhttp.GetRequestID(r); requestID != "" {
-			logger = logger.Set("requestID", log.String(requestID))
-		}
+		logger := requestLogger(logger, r)
 
 		w = wrapResponseWriter(logger, w, r)
 
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
 		var req wire.FEDWireMessage
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			err = logger.LogErrorf("error reading request body: %v", err).Err()
@@ -313,6 +477,12 @@ func addFEDWireMessageToFile(logger log.Logger, repo WireFileRepository) http.Ha
 		}
 		logger = logger.Set("fileID", log.String(fileId))
 
+		version, err := repo.fileVersion(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
 		file, err := repo.getFile(fileId)
 		if err != nil {
 			err = logger.LogErrorf("error retrieving file: %v", err).Err()
@@ -326,18 +496,76 @@ func addFEDWireMessageToFile(logger log.Logger, repo WireFileRepository) http.Ha
 			return
 		}
 
+		if err := opts.checkDraft(fileId); err != nil {
+			err = logger.LogErrorf("file can't be modified: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := checkIfMatch(r, version); err != nil {
+			writeProblem(w, http.StatusPreconditionFailed, logger.LogError(err).Err())
+			return
+		}
+
+		before := *file
 		file.FEDWireMessage = file.AddFEDWireMessage(req)
-		if err := repo.saveFile(file); err != nil {
+		if err := opts.checkLockedFields(fileId, before.FEDWireMessage, file.FEDWireMessage); err != nil {
+			writeProblem(w, http.StatusConflict, logger.LogErrorf("FEDWireMessage rejected: %v", err).Err())
+			return
+		}
+		if err := opts.checkEnvironment(file); err != nil {
+			err = logger.LogErrorf("FEDWireMessage rejected: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, file); err != nil {
+			logger.LogErrorf("FEDWireMessage rejected: %v", err)
+			return
+		}
+		if err := repo.saveFileVersion(file, version); err != nil {
+			if errors.Is(err, errVersionConflict) {
+				writeProblem(w, http.StatusPreconditionFailed, logger.LogError(err).Err())
+				return
+			}
 			err = logger.LogErrorf("error saving file: %v", err).Err()
 			moovhttp.Problem(w, err)
 			return
 		}
 
 		logger.Log("added FEDWireMessage to file")
+		opts.recordAudit(logger, r, auditModified, fileId, &before, file, "added FEDWireMessage")
+		opts.notifyWebhooks(logger, r, eventFileModified, fileId, nil)
+		writeFileVersion(w, version+1)
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(file)
+		json.NewEncoder(w).Encode(opts.redact(file, mask))
+	}
+}
+
+// readValidateOpts returns the ValidateOpts requested with query params
+// query param `checkExchangeRate`=true - we set CheckExchangeRate to `true`
+// query param `exchangeRateTolerance`=0.01 - we set ExchangeRateTolerance
+func readValidateOpts(r *http.Request) (*wire.ValidateOpts, error) {
+	opts := &wire.ValidateOpts{}
+	queryParams := r.URL.Query()
+
+	if v := queryParams.Get("checkExchangeRate"); v != "" {
+		check, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkExchangeRate: %v", err)
+		}
+		opts.CheckExchangeRate = check
+	}
+	if v := queryParams.Get("exchangeRateTolerance"); v != "" {
+		tolerance, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchangeRateTolerance: %v", err)
+		}
+		if math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+			return nil, fmt.Errorf("invalid exchangeRateTolerance: %q isn't a finite number", v)
+		}
+		opts.ExchangeRateTolerance = tolerance
 	}
+	return opts, nil
 }
 
 // GetWriter returns a new Writer based on request param `type` that writes to w.
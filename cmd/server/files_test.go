@@ -378,6 +378,58 @@ func TestFiles_validateFile(t *testing.T) {
 	})
 }
 
+func TestFiles_validateFileExchangeRate(t *testing.T) {
+	f, err := readFile("fedWireMessage-CustomerTransfer.txt")
+	require.NoError(t, err)
+	repo := &testWireFileRepository{file: f}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	t.Run("inconsistent exchange rate", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/files/foo/validate?checkExchangeRate=true", nil)
+
+		router.ServeHTTP(w, req)
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+		assert.Contains(t, w.Body.String(), "implied rate")
+	})
+
+	t.Run("wide tolerance", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/files/foo/validate?checkExchangeRate=true&exchangeRateTolerance=2", nil)
+
+		router.ServeHTTP(w, req)
+		w.Flush()
+
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/files/foo/validate?checkExchangeRate=maybe", nil)
+
+		router.ServeHTTP(w, req)
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+
+	t.Run("non-finite tolerance", func(t *testing.T) {
+		for _, tolerance := range []string{"NaN", "Inf", "-Inf"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/files/foo/validate?checkExchangeRate=true&exchangeRateTolerance="+tolerance, nil)
+
+			router.ServeHTTP(w, req)
+			w.Flush()
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+			assert.Contains(t, w.Body.String(), "finite")
+		}
+	})
+}
+
 func TestFiles_addFEDWireMessageToFile(t *testing.T) {
 	f, err := readFile("fedWireMessage-NoMessage.txt")
 	require.Contains(t, err.Error(), "file validation failed")
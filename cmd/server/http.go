@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/go-kit/kit/metrics/prometheus"
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base"
 	moovhttp "github.com/moov-io/base/http"
 	"github.com/moov-io/base/log"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
@@ -20,11 +22,42 @@ var (
 		Name: "http_response_duration_seconds",
 		Help: "Histogram representing the http response durations",
 	}, []string{"route"})
-
-	//inmemIdempotentRecorder = lru.New()
 )
 
+// requestLogger returns logger with the request ID and the ID of the user calling set
+func requestLogger(logger log.Logger, r *http.Request) log.Logger {
+	if requestID := moovhttp.GetRequestID(r); requestID != "" {
+		logger = logger.Set("requestID", log.String(requestID))
+	}
+	if userID := moovhttp.GetUserID(r); userID != "" {
+		logger = logger.Set("userID", log.String(userID))
+	}
+	return logger
+}
+
+// workerRequest returns a request which audit entries and webhooks of background workers are recorded with,
+// its user is userID and it has a new request ID
+func workerRequest(userID string) *http.Request {
+	r, _ := http.NewRequest("POST", "/", nil)
+	r.Header.Set("X-User-ID", userID)
+	r.Header.Set("X-Request-ID", base.ID())
+	return r
+}
+
 func wrapResponseWriter(logger log.Logger, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
-	route := fmt.Sprintf("%s%s", strings.ToLower(r.Method), strings.Replace(r.URL.Path, "/", "-", -1)) // TODO: filter out random ID's later
-	return moovhttp.Wrap(logger, routeHistogram.With("route", route), w, r)
+	return moovhttp.Wrap(logger, routeHistogram.With("route", routeLabel(r)), w, r)
+}
+
+// routeLabel returns the route of r for metrics, e.g. get-files-{fileId}. The mux path template is used rather
+// than the path so file IDs don't create a label each. Requests without a route are labelled other.
+func routeLabel(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "other"
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "other"
+	}
+	return fmt.Sprintf("%s%s", strings.ToLower(r.Method), strings.Replace(template, "/", "-", -1))
 }
@@ -0,0 +1,250 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+)
+
+var (
+	errIdempotencyKeyReused     = errors.New("idempotency key was used with a different request body")
+	errIdempotencyKeyInProgress = errors.New("a request with the idempotency key is in progress")
+)
+
+// idempotencyMaxKeys is how many idempotency keys are kept by default
+const idempotencyMaxKeys = 10000
+
+// idempotentResponse is the response of a request with an idempotency key, replayed to retries of the request
+type idempotentResponse struct {
+	key string
+	// bodyHash is the SHA-256 of the request's Content-Type and body
+	bodyHash [sha256.Size]byte
+	// done is false while the first request is handled, keys of requests which never finish expire all the same
+	done    bool
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyRecorder holds the responses of requests with an idempotency key until they expire. At most maxKeys
+// are kept, the key closest to expiring is dropped to make room for a new one.
+type idempotencyRecorder struct {
+	ttl     time.Duration
+	maxKeys int
+	now     func() time.Time
+
+	mu        sync.Mutex
+	responses map[string]*list.Element
+	// expiring holds the *idempotentResponse of every key, ordered by when they expire
+	expiring *list.List
+}
+
+func newIdempotencyRecorder(ttl time.Duration) *idempotencyRecorder {
+	return &idempotencyRecorder{
+		ttl:       ttl,
+		maxKeys:   idempotencyMaxKeys,
+		now:       time.Now,
+		responses: make(map[string]*list.Element),
+		expiring:  list.New(),
+	}
+}
+
+// withIdempotencyTTL expires idempotency keys ttl after their first request
+func withIdempotencyTTL(ttl time.Duration) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.idempotency = newIdempotencyRecorder(ttl)
+	}
+}
+
+// withIdempotencyMaxKeys keeps at most n idempotency keys, it's applied after withIdempotencyTTL
+func withIdempotencyMaxKeys(n int) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.idempotency.maxKeys = n
+	}
+}
+
+// readIdempotencyOptions returns the file route options configured by IDEMPOTENCY_KEY_TTL and
+// IDEMPOTENCY_MAX_KEYS
+func readIdempotencyOptions() ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL: %q", v)
+		}
+		opts = append(opts, withIdempotencyTTL(ttl))
+	}
+	if v := os.Getenv("IDEMPOTENCY_MAX_KEYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_MAX_KEYS: %q", v)
+		}
+		opts = append(opts, withIdempotencyMaxKeys(n))
+	}
+	return opts, nil
+}
+
+// idempotencyKey returns the Idempotency-Key header of r, or X-Idempotency-Key which older clients send
+func idempotencyKey(r *http.Request) string {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return key
+	}
+	return r.Header.Get("X-Idempotency-Key")
+}
+
+// idempotent handles requests with an idempotency key once. Retries with the same key and body receive the
+// original response, retries with a different body or while the first request is handled are refused with 409.
+// Keys are scoped to the caller and route. Responses with a 5xx status aren't kept, so those requests can be retried.
+func (rec *idempotencyRecorder) idempotent(logger log.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := idempotencyKey(r)
+		if rec == nil || key == "" {
+			next(w, r)
+			return
+		}
+		logger := requestLogger(logger, r)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w = wrapResponseWriter(logger, w, r)
+			moovhttp.Problem(w, logger.LogErrorf("error reading request body: %v", err).Err())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(append([]byte(r.Header.Get("Content-Type")+"\n"), body...))
+		scoped := moovhttp.GetUserID(r) + "\n" + r.Method + " " + r.URL.Path + "\n" + key
+
+		resp, err := rec.start(scoped, hash)
+		if err != nil {
+			w = wrapResponseWriter(logger, w, r)
+			writeProblem(w, http.StatusConflict, logger.LogError(err).Err())
+			return
+		}
+		if resp != nil {
+			logger.Log("replaying response of idempotency key")
+			w = wrapResponseWriter(logger, w, r)
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+			return
+		}
+
+		// release the key when next panics so retries aren't refused until it expires
+		finished := false
+		defer func() {
+			if !finished {
+				rec.release(scoped)
+			}
+		}()
+		rw := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+		rec.finish(scoped, rw)
+		finished = true
+	}
+}
+
+// start returns the response recorded for key, or nil after reserving key for a new request
+func (rec *idempotencyRecorder) start(key string, bodyHash [sha256.Size]byte) (*idempotentResponse, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	now := rec.now()
+	// keys expire in order, so only the expired ones are looked at
+	for e := rec.expiring.Front(); e != nil && now.After(e.Value.(*idempotentResponse).expires); e = rec.expiring.Front() {
+		rec.remove(e)
+	}
+	if e, ok := rec.responses[key]; ok {
+		resp := e.Value.(*idempotentResponse)
+		if resp.bodyHash != bodyHash {
+			return nil, errIdempotencyKeyReused
+		}
+		if !resp.done {
+			return nil, errIdempotencyKeyInProgress
+		}
+		return resp, nil
+	}
+	for rec.expiring.Len() >= rec.maxKeys {
+		rec.remove(rec.expiring.Front())
+	}
+	resp := &idempotentResponse{key: key, bodyHash: bodyHash, expires: now.Add(rec.ttl)}
+	rec.responses[key] = rec.expiring.PushBack(resp)
+	return nil, nil
+}
+
+// finish records the response of key's request, or releases key when the response is a server error
+func (rec *idempotencyRecorder) finish(key string, rw *recordingResponseWriter) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	e, ok := rec.responses[key]
+	if !ok {
+		return
+	}
+	if rw.status >= http.StatusInternalServerError {
+		rec.remove(e)
+		return
+	}
+	resp := e.Value.(*idempotentResponse)
+	resp.done = true
+	resp.status = rw.status
+	resp.header = rw.Header().Clone()
+	resp.body = rw.body.Bytes()
+	resp.expires = rec.now().Add(rec.ttl)
+	rec.expiring.MoveToBack(e)
+}
+
+// release drops key when its request didn't finish
+func (rec *idempotencyRecorder) release(key string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if e, ok := rec.responses[key]; ok && !e.Value.(*idempotentResponse).done {
+		rec.remove(e)
+	}
+}
+
+func (rec *idempotencyRecorder) remove(e *list.Element) {
+	delete(rec.responses, rec.expiring.Remove(e).(*idempotentResponse).key)
+}
+
+// recordingResponseWriter writes a response and keeps a copy of its status and body
+type recordingResponseWriter struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
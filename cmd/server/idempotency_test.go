@@ -0,0 +1,237 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func idempotentRequest(t *testing.T, router *mux.Router, path, header, key string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	bs, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(bs))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(header, key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestIdempotency_createFile(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	file := wire.File{FEDWireMessage: mockFEDWireMessage()}
+	first := idempotentRequest(t, router, "/files/create", "Idempotency-Key", "key1", file)
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+
+	// retries return the original response without creating another file
+	for _, header := range []string{"Idempotency-Key", "X-Idempotency-Key"} {
+		retry := idempotentRequest(t, router, "/files/create", header, "key1", file)
+		require.Equal(t, http.StatusCreated, retry.Code)
+		require.Equal(t, first.Body.String(), retry.Body.String())
+		require.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+		require.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	}
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// a different body with the same key conflicts
+	other := wire.File{FEDWireMessage: mockFEDWireMessage()}
+	other.FEDWireMessage.Amount.Amount = "000000000100"
+	w := idempotentRequest(t, router, "/files/create", "Idempotency-Key", "key1", other)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	// other keys and requests without a key create files
+	w = idempotentRequest(t, router, "/files/create", "Idempotency-Key", "key2", file)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = idempotentRequest(t, router, "/files/create", "", "", file)
+	require.Equal(t, http.StatusCreated, w.Code)
+	files, err = repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+}
+
+func TestIdempotency_addFEDWireMessage(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo"}))
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	fwm := mockFEDWireMessage()
+	first := idempotentRequest(t, router, "/files/foo/FEDWireMessage", "Idempotency-Key", "key1", fwm)
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+	retry := idempotentRequest(t, router, "/files/foo/FEDWireMessage", "Idempotency-Key", "key1", fwm)
+	require.Equal(t, http.StatusOK, retry.Code)
+	require.Equal(t, first.Header().Get("ETag"), retry.Header().Get("ETag"))
+
+	version, err := repo.fileVersion("foo")
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+}
+
+func TestIdempotency_expires(t *testing.T) {
+	rec := newIdempotencyRecorder(time.Hour)
+	now := time.Now()
+	rec.now = func() time.Time { return now }
+
+	calls := 0
+	handler := rec.idempotent(log.NewNopLogger(), func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	})
+	serve := func(userID string) int {
+		req := httptest.NewRequest("POST", "/files/create", nil)
+		req.Header.Set("Idempotency-Key", "key1")
+		req.Header.Set("X-User-ID", userID)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusCreated, serve("alice"))
+	require.Equal(t, http.StatusCreated, serve("alice"))
+	require.Equal(t, 1, calls)
+
+	// keys are scoped to the caller
+	require.Equal(t, http.StatusCreated, serve("bob"))
+	require.Equal(t, 2, calls)
+
+	now = now.Add(2 * time.Hour)
+	require.Equal(t, http.StatusCreated, serve("alice"))
+	require.Equal(t, 3, calls)
+}
+
+func TestIdempotency_serverErrors(t *testing.T) {
+	rec := newIdempotencyRecorder(time.Hour)
+
+	status := http.StatusInternalServerError
+	handler := rec.idempotent(log.NewNopLogger(), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	serve := func() int {
+		req := httptest.NewRequest("POST", "/files/create", nil)
+		req.Header.Set("Idempotency-Key", "key1")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// server errors aren't kept so the request is retried
+	require.Equal(t, http.StatusInternalServerError, serve())
+	status = http.StatusCreated
+	require.Equal(t, http.StatusCreated, serve())
+	status = http.StatusInternalServerError
+	require.Equal(t, http.StatusCreated, serve())
+}
+
+func TestIdempotency_inProgress(t *testing.T) {
+	rec := newIdempotencyRecorder(time.Hour)
+	var hash [32]byte
+	resp, err := rec.start("key1", hash)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	_, err = rec.start("key1", hash)
+	require.ErrorIs(t, err, errIdempotencyKeyInProgress)
+}
+
+func TestIdempotency_panic(t *testing.T) {
+	rec := newIdempotencyRecorder(time.Hour)
+
+	calls := 0
+	handler := rec.idempotent(log.NewNopLogger(), func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	serve := func() int {
+		req := httptest.NewRequest("POST", "/files/create", nil)
+		req.Header.Set("Idempotency-Key", "key1")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	require.Panics(t, func() { serve() })
+	// the key was released so the retry isn't refused as in progress
+	require.Equal(t, http.StatusCreated, serve())
+	require.Equal(t, 2, calls)
+}
+
+func TestIdempotency_maxKeys(t *testing.T) {
+	rec := newIdempotencyRecorder(time.Hour)
+	rec.maxKeys = 2
+	now := time.Now()
+	rec.now = func() time.Time { return now }
+
+	var hash [32]byte
+	for _, key := range []string{"key1", "key2", "key3"} {
+		_, err := rec.start(key, hash)
+		require.NoError(t, err)
+		now = now.Add(time.Minute)
+	}
+	require.Len(t, rec.responses, 2)
+	require.NotContains(t, rec.responses, "key1")
+
+	// finished keys are the last to expire
+	rec.finish("key2", &recordingResponseWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusCreated})
+	_, err := rec.start("key4", hash)
+	require.NoError(t, err)
+	require.Contains(t, rec.responses, "key2")
+	require.NotContains(t, rec.responses, "key3")
+
+	// expired keys are dropped
+	now = now.Add(2 * time.Hour)
+	_, err = rec.start("key5", hash)
+	require.NoError(t, err)
+	require.Len(t, rec.responses, 1)
+	require.Equal(t, 1, rec.expiring.Len())
+}
+
+func TestIdempotency_readIdempotencyOptions(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "")
+	t.Setenv("IDEMPOTENCY_MAX_KEYS", "")
+	opts, err := readIdempotencyOptions()
+	require.NoError(t, err)
+	require.Empty(t, opts)
+
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "1h")
+	t.Setenv("IDEMPOTENCY_MAX_KEYS", "500")
+	opts, err = readIdempotencyOptions()
+	require.NoError(t, err)
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	require.Equal(t, time.Hour, cfg.idempotency.ttl)
+	require.Equal(t, 500, cfg.idempotency.maxKeys)
+
+	t.Setenv("IDEMPOTENCY_MAX_KEYS", "0")
+	_, err = readIdempotencyOptions()
+	require.Error(t, err)
+
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "tomorrow")
+	_, err = readIdempotencyOptions()
+	require.Error(t, err)
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+const (
+	// imadAllocated is a sequence number handed out which hasn't been used yet
+	imadAllocated = "allocated"
+	// imadUsed is a sequence number stamped onto a released message
+	imadUsed = "used"
+	// imadVoided is a sequence number which will never be used, a gap the Fed can be told about
+	imadVoided = "voided"
+
+	// maxIMADSequence is the largest six digit InputSequenceNumber
+	maxIMADSequence = 999999
+)
+
+var (
+	errIMADSequenceExhausted = errors.New("every IMAD sequence number of the cycle date is allocated")
+	errIMADSequenceNotFound  = errors.New("IMAD sequence number not allocated")
+	errIMADSequenceStatus    = errors.New("invalid IMAD sequence number status")
+	errInvalidInputSource    = errors.New("input source must be 1 to 8 letters or digits")
+	errInvalidCycleDate      = errors.New("cycle date must be CCYYMMDD")
+	errNoInputSource         = errors.New("no input source configured")
+)
+
+var inputSourceRegex = regexp.MustCompile(`^[A-Za-z0-9]{1,8}$`)
+
+// imadSequence is an InputSequenceNumber allocated for an input source on a cycle date
+type imadSequence struct {
+	InputSource string    `json:"inputSource"`
+	CycleDate   string    `json:"cycleDate"`
+	Sequence    int       `json:"sequence"`
+	Status      string    `json:"status"`
+	FileID      string    `json:"fileID,omitempty"`
+	AllocatedAt time.Time `json:"allocatedAt"`
+}
+
+// IMAD returns the InputMessageAccountabilityData of the sequence number
+func (s imadSequence) IMAD() *wire.InputMessageAccountabilityData {
+	imad := wire.NewInputMessageAccountabilityData()
+	imad.InputCycleDate = s.CycleDate
+	imad.InputSource = s.InputSource
+	imad.InputSequenceNumber = fmt.Sprintf("%06d", s.Sequence)
+	return imad
+}
+
+// imadRepository holds the IMAD sequence numbers allocated for each input source and cycle date
+type imadRepository interface {
+	// allocateIMADSequence allocates the number after the last allocated for source on cycleDate, starting at 1.
+	// Numbers are never allocated twice.
+	allocateIMADSequence(source, cycleDate string) (imadSequence, error)
+	// updateIMADSequence marks an allocated number used by fileID or voided
+	updateIMADSequence(source, cycleDate string, sequence int, status, fileID string) (imadSequence, error)
+	// getIMADSequences returns every number allocated for source on cycleDate in order
+	getIMADSequences(source, cycleDate string) ([]imadSequence, error)
+}
+
+// checkIMADTransition returns errIMADSequenceStatus unless an allocated number moves to used or voided
+func checkIMADTransition(from, to string) error {
+	if from != imadAllocated || (to != imadUsed && to != imadVoided) {
+		return fmt.Errorf("%w: %s to %s", errIMADSequenceStatus, from, to)
+	}
+	return nil
+}
+
+// imadAllocator allocates IMAD sequence numbers and stamps them onto files when they're released
+type imadAllocator struct {
+	repo imadRepository
+	// source is the input source stamped onto released files, files aren't stamped when it's empty
+	source string
+	// location is the time zone of cycle dates, the server's when nil
+	location *time.Location
+	// cutoff is the time of day the next cycle date starts, midnight when zero
+	cutoff time.Duration
+	now    func() time.Time
+}
+
+func newIMADAllocator(repo imadRepository, source string) *imadAllocator {
+	return &imadAllocator{
+		repo:   repo,
+		source: source,
+		now:    time.Now,
+	}
+}
+
+// readIMADAllocator returns an allocator stamping files with the input source of IMAD_INPUT_SOURCE. Cycle dates
+// are in the time zone of IMAD_CYCLE_TIMEZONE and start at IMAD_CYCLE_CUTOFF.
+func readIMADAllocator(repo imadRepository) (*imadAllocator, error) {
+	source := os.Getenv("IMAD_INPUT_SOURCE")
+	if source != "" && !inputSourceRegex.MatchString(source) {
+		return nil, fmt.Errorf("invalid IMAD_INPUT_SOURCE: %v", errInvalidInputSource)
+	}
+	a := newIMADAllocator(repo, source)
+	if v := os.Getenv("IMAD_CYCLE_TIMEZONE"); v != "" {
+		location, err := time.LoadLocation(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IMAD_CYCLE_TIMEZONE: %v", err)
+		}
+		a.location = location
+	}
+	if v := os.Getenv("IMAD_CYCLE_CUTOFF"); v != "" {
+		cutoff, err := time.Parse("15:04", v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IMAD_CYCLE_CUTOFF: %q", v)
+		}
+		a.cutoff = time.Duration(cutoff.Hour())*time.Hour + time.Duration(cutoff.Minute())*time.Minute
+	}
+	return a, nil
+}
+
+// cycleDate returns the current cycle date, the next day's once the cutoff has passed. Weekends and holidays
+// aren't skipped.
+func (a *imadAllocator) cycleDate() string {
+	now := a.now()
+	if a.location != nil {
+		now = now.In(a.location)
+	}
+	if a.cutoff > 0 {
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if now.Sub(midnight) >= a.cutoff {
+			now = midnight.AddDate(0, 0, 1)
+		}
+	}
+	return now.Format("20060102")
+}
+
+// stamp allocates a sequence number of the allocator's source on the current cycle date and returns a copy of
+// file with it as the InputMessageAccountabilityData. The copy isn't saved, callers save it once the file is
+// released and void the number when it isn't. Nothing is stamped and the copy is nil when no source is configured.
+func (a *imadAllocator) stamp(file *wire.File) (*wire.File, *imadSequence, error) {
+	if a == nil || a.source == "" {
+		return nil, nil, nil
+	}
+	stamped, err := file.Copy()
+	if err != nil {
+		return nil, nil, err
+	}
+	seq, err := a.repo.allocateIMADSequence(a.source, a.cycleDate())
+	if err != nil {
+		return nil, nil, err
+	}
+	stamped.FEDWireMessage.InputMessageAccountabilityData = seq.IMAD()
+	return stamped, &seq, nil
+}
+
+// use marks a stamped number used by the file it was stamped onto
+func (a *imadAllocator) use(seq *imadSequence, fileID string) error {
+	if seq == nil {
+		return nil
+	}
+	_, err := a.repo.updateIMADSequence(seq.InputSource, seq.CycleDate, seq.Sequence, imadUsed, fileID)
+	return err
+}
+
+// void marks a number which won't be used
+func (a *imadAllocator) void(seq imadSequence) error {
+	_, err := a.repo.updateIMADSequence(seq.InputSource, seq.CycleDate, seq.Sequence, imadVoided, "")
+	return err
+}
+
+// recordStamp marks the number stamped onto a released file used and audits the stamp
+func (opts *fileRoutesOptions) recordStamp(logger log.Logger, r *http.Request, before, stamped *wire.File, seq *imadSequence) {
+	imad := seq.IMAD().Identifier()
+	if err := opts.imad.use(seq, stamped.ID); err != nil {
+		logger.LogErrorf("problem marking IMAD %s used: %v", imad, err)
+	}
+	logger.Logf("stamped IMAD %s", imad)
+	opts.recordAudit(logger, r, auditModified, stamped.ID, before, stamped, "stamped IMAD "+imad)
+}
+
+// withIMADAllocator stamps IMAD sequence numbers from allocator onto files when they're released
+func withIMADAllocator(allocator *imadAllocator) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.imad = allocator
+	}
+}
+
+// imadSequences summarizes the numbers allocated for an input source on a cycle date. Gaps are numbers up to Last
+// which weren't used, either voided or allocated and not used yet.
+type imadSequences struct {
+	InputSource string         `json:"inputSource"`
+	CycleDate   string         `json:"cycleDate"`
+	Last        int            `json:"last"`
+	Used        int            `json:"used"`
+	Gaps        []imadSequence `json:"gaps"`
+}
+
+func addIMADRoutes(logger log.Logger, r *mux.Router, allocator *imadAllocator) {
+	r.Methods("POST").Path("/imad/sequences").HandlerFunc(allocateIMADSequence(logger, allocator))
+	r.Methods("GET").Path("/imad/sequences/{inputSource}/{cycleDate}").HandlerFunc(getIMADSequences(logger, allocator))
+	r.Methods("PUT").Path("/imad/sequences/{inputSource}/{cycleDate}/{sequence}").HandlerFunc(updateIMADSequence(logger, allocator))
+}
+
+// imadSequenceRequest is the body of allocating or updating a sequence number
+type imadSequenceRequest struct {
+	InputSource string `json:"inputSource"`
+	CycleDate   string `json:"cycleDate"`
+	Status      string `json:"status"`
+	FileID      string `json:"fileID"`
+}
+
+// checkIMADKey returns an error when source or cycleDate aren't valid in an IMAD
+func checkIMADKey(source, cycleDate string) error {
+	if !inputSourceRegex.MatchString(source) {
+		return fmt.Errorf("%w: %q", errInvalidInputSource, source)
+	}
+	if _, err := time.Parse("20060102", cycleDate); err != nil {
+		return fmt.Errorf("%w: %q", errInvalidCycleDate, cycleDate)
+	}
+	return nil
+}
+
+// allocateIMADSequence allocates the next sequence number of the requested input source and cycle date, which
+// default to the configured source and today
+func allocateIMADSequence(logger log.Logger, allocator *imadAllocator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		var req imadSequenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			err = logger.LogErrorf("error reading request body: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if req.InputSource == "" {
+			if req.InputSource = allocator.source; req.InputSource == "" {
+				moovhttp.Problem(w, logger.LogError(errNoInputSource).Err())
+				return
+			}
+		}
+		if req.CycleDate == "" {
+			req.CycleDate = allocator.cycleDate()
+		}
+		if err := checkIMADKey(req.InputSource, req.CycleDate); err != nil {
+			moovhttp.Problem(w, logger.LogError(err).Err())
+			return
+		}
+
+		seq, err := allocator.repo.allocateIMADSequence(req.InputSource, req.CycleDate)
+		if err != nil {
+			err = logger.LogErrorf("problem allocating IMAD sequence number: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Logf("allocated IMAD %s", seq.IMAD().Identifier())
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(seq)
+	}
+}
+
+// getIMADSequences returns the last number allocated for an input source and cycle date and its gaps
+func getIMADSequences(logger log.Logger, allocator *imadAllocator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		source, cycleDate := mux.Vars(r)["inputSource"], mux.Vars(r)["cycleDate"]
+		if err := checkIMADKey(source, cycleDate); err != nil {
+			moovhttp.Problem(w, logger.LogError(err).Err())
+			return
+		}
+
+		sequences, err := allocator.repo.getIMADSequences(source, cycleDate)
+		if err != nil {
+			err = logger.LogErrorf("problem reading IMAD sequence numbers: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		out := imadSequences{
+			InputSource: source,
+			CycleDate:   cycleDate,
+			Last:        len(sequences),
+			Gaps:        []imadSequence{},
+		}
+		for _, seq := range sequences {
+			if seq.Status == imadUsed {
+				out.Used++
+			} else {
+				out.Gaps = append(out.Gaps, seq)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// updateIMADSequence marks an allocated sequence number used or voided
+func updateIMADSequence(logger log.Logger, allocator *imadAllocator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		source, cycleDate := mux.Vars(r)["inputSource"], mux.Vars(r)["cycleDate"]
+		if err := checkIMADKey(source, cycleDate); err != nil {
+			moovhttp.Problem(w, logger.LogError(err).Err())
+			return
+		}
+		sequence, err := strconv.Atoi(mux.Vars(r)["sequence"])
+		if err != nil {
+			moovhttp.Problem(w, logger.LogErrorf("invalid IMAD sequence number: %v", err).Err())
+			return
+		}
+
+		var req imadSequenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			err = logger.LogErrorf("error reading request body: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		seq, err := allocator.repo.updateIMADSequence(source, cycleDate, sequence, req.Status, req.FileID)
+		if errors.Is(err, errIMADSequenceNotFound) {
+			logger.Log("IMAD sequence number not found")
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			err = logger.LogErrorf("problem updating IMAD sequence number: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Logf("IMAD %s is %s", seq.IMAD().Identifier(), seq.Status)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(seq)
+	}
+}
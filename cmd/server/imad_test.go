@@ -0,0 +1,209 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// mockIMADAllocator returns an allocator of source on 2026-10-19
+func mockIMADAllocator(repo imadRepository, source string) *imadAllocator {
+	a := newIMADAllocator(repo, source)
+	a.now = func() time.Time {
+		return time.Date(2026, time.October, 19, 14, 30, 0, 0, time.UTC)
+	}
+	return a
+}
+
+func TestIMAD_release(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	audit := newAuditLog()
+	allocator := mockIMADAllocator(repo, "SOURCE01")
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withIMADAllocator(allocator), withAuditLog(audit))
+
+	// files aren't stamped before they're released
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "approve", "checker").Code)
+	sequences, err := repo.getIMADSequences("SOURCE01", "20261019")
+	require.NoError(t, err)
+	require.Empty(t, sequences)
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "release", "checker").Code)
+
+	file, err := repo.getFile("foo")
+	require.NoError(t, err)
+	imad := file.FEDWireMessage.InputMessageAccountabilityData
+	require.Equal(t, "20261019", imad.InputCycleDate)
+	require.Equal(t, "SOURCE01", imad.InputSource)
+	require.Equal(t, "000001", imad.InputSequenceNumber)
+
+	sequences, err = repo.getIMADSequences("SOURCE01", "20261019")
+	require.NoError(t, err)
+	require.Len(t, sequences, 1)
+	require.Equal(t, imadUsed, sequences[0].Status)
+	require.Equal(t, "foo", sequences[0].FileID)
+
+	entries := audit.getEntries("foo")
+	last := entries[len(entries)-1]
+	require.Equal(t, auditModified, last.Action)
+	require.Equal(t, "stamped IMAD 20261019SOURCE01000001", last.Detail)
+}
+
+func TestIMAD_releaseUnconfigured(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	want := mockFEDWireMessage().InputMessageAccountabilityData.Identifier()
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withIMADAllocator(mockIMADAllocator(repo, "")))
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "approve", "checker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "release", "checker").Code)
+
+	file, err := repo.getFile("foo")
+	require.NoError(t, err)
+	require.Equal(t, want, file.FEDWireMessage.InputMessageAccountabilityData.Identifier())
+}
+
+func TestIMAD_outbox(t *testing.T) {
+	ox, repo := mockOutbox(t, "000000010000", "000001234567")
+	ox.opts.imad = mockIMADAllocator(repo, "SOURCE01")
+
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	require.Equal(t, 2, manifest.Count)
+
+	for i, f := range manifest.Files {
+		file, err := repo.getFile(f.FileID)
+		require.NoError(t, err)
+		require.Equal(t, "SOURCE01", file.FEDWireMessage.InputMessageAccountabilityData.InputSource)
+		require.Equal(t, "00000"+string(rune('1'+i)), file.FEDWireMessage.InputMessageAccountabilityData.InputSequenceNumber)
+	}
+	sequences, err := repo.getIMADSequences("SOURCE01", "20261019")
+	require.NoError(t, err)
+	require.Len(t, sequences, 2)
+	for _, seq := range sequences {
+		require.Equal(t, imadUsed, seq.Status)
+	}
+}
+
+func imadRequest(t *testing.T, router *mux.Router, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	w.Flush()
+	return w
+}
+
+func TestIMAD_routes(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	router := mux.NewRouter()
+	addIMADRoutes(log.NewNopLogger(), router, mockIMADAllocator(repo, "SOURCE01"))
+
+	// the configured source and today are the defaults
+	w := imadRequest(t, router, "POST", "/imad/sequences", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var seq imadSequence
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&seq))
+	require.Equal(t, imadSequence{InputSource: "SOURCE01", CycleDate: "20261019", Sequence: 1, Status: imadAllocated, AllocatedAt: seq.AllocatedAt}, seq)
+
+	for i := 0; i < 2; i++ {
+		w = imadRequest(t, router, "POST", "/imad/sequences", `{"inputSource": "SOURCE01", "cycleDate": "20261019"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	w = imadRequest(t, router, "PUT", "/imad/sequences/SOURCE01/20261019/1", `{"status": "used", "fileID": "foo"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = imadRequest(t, router, "PUT", "/imad/sequences/SOURCE01/20261019/2", `{"status": "voided"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = imadRequest(t, router, "PUT", "/imad/sequences/SOURCE01/20261019/2", `{"status": "used"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = imadRequest(t, router, "PUT", "/imad/sequences/SOURCE01/20261019/9", `{"status": "used"}`)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	w = imadRequest(t, router, "GET", "/imad/sequences/SOURCE01/20261019", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var summary imadSequences
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&summary))
+	require.Equal(t, 3, summary.Last)
+	require.Equal(t, 1, summary.Used)
+	require.Len(t, summary.Gaps, 2)
+	require.Equal(t, imadVoided, summary.Gaps[0].Status)
+	require.Equal(t, imadAllocated, summary.Gaps[1].Status)
+
+	// invalid sources and cycle dates
+	w = imadRequest(t, router, "POST", "/imad/sequences", `{"inputSource": "TOO-LONG-SOURCE"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = imadRequest(t, router, "GET", "/imad/sequences/SOURCE01/2026-10-19", "")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// without a configured source the request names it
+	router = mux.NewRouter()
+	addIMADRoutes(log.NewNopLogger(), router, mockIMADAllocator(repo, ""))
+	w = imadRequest(t, router, "POST", "/imad/sequences", "")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIMAD_readIMADAllocator(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+
+	t.Setenv("IMAD_INPUT_SOURCE", "SOURCE01")
+	a, err := readIMADAllocator(repo)
+	require.NoError(t, err)
+	require.Equal(t, "SOURCE01", a.source)
+
+	t.Setenv("IMAD_CYCLE_TIMEZONE", "America/New_York")
+	t.Setenv("IMAD_CYCLE_CUTOFF", "21:00")
+	a, err = readIMADAllocator(repo)
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", a.location.String())
+	require.Equal(t, 21*time.Hour, a.cutoff)
+
+	for key, value := range map[string]string{
+		"IMAD_INPUT_SOURCE":   "not valid",
+		"IMAD_CYCLE_TIMEZONE": "Nowhere/Special",
+		"IMAD_CYCLE_CUTOFF":   "9pm",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := readIMADAllocator(repo)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestIMAD_cycleDate(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	a := mockIMADAllocator(repo, "SOURCE01")
+	require.Equal(t, "20261019", a.cycleDate())
+
+	// 14:30 UTC is 10:30 in New York, before the cutoff
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	a.location = newYork
+	a.cutoff = 21 * time.Hour
+	require.Equal(t, "20261019", a.cycleDate())
+
+	// 02:00 UTC is 22:00 the day before in New York, after the cutoff
+	a.now = func() time.Time {
+		return time.Date(2026, time.October, 20, 2, 0, 0, 0, time.UTC)
+	}
+	require.Equal(t, "20261020", a.cycleDate())
+	a.cutoff = 0
+	require.Equal(t, "20261019", a.cycleDate())
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+// inboxUserID is the user ID audit entries and webhooks record for files ingested from the inbox
+const inboxUserID = "inbox"
+
+// inboxWatcher ingests the files dropped into a directory. Each file is first claimed by moving it to
+// processingDir, so it's ingested once even when it can't be moved after. Valid files are stored and their
+// originals moved to archiveDir, files which can't be read are moved to errorDir alongside a JSON error report.
+type inboxWatcher struct {
+	logger log.Logger
+	repo   WireFileRepository
+	opts   *fileRoutesOptions
+
+	dir      string
+	errorDir string
+	// processingDir is inside dir so claiming a file is a rename within one filesystem
+	processingDir string
+	archiveDir    string
+	// interval is how often the inbox is scanned
+	interval time.Duration
+	// settle is how long a file must be unmodified before it's read, so files still being written are skipped
+	settle time.Duration
+	now    func() time.Time
+}
+
+// inboxErrorReport is written beside a file moved to the error directory
+type inboxErrorReport struct {
+	File  string    `json:"file"`
+	Error string    `json:"error"`
+	Field string    `json:"field,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+func newInboxWatcher(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions, dir string) *inboxWatcher {
+	return &inboxWatcher{
+		logger:        logger.Set("inbox", log.String(dir)),
+		repo:          repo,
+		opts:          opts,
+		dir:           dir,
+		errorDir:      filepath.Join(dir, "error"),
+		processingDir: filepath.Join(dir, "processing"),
+		archiveDir:    filepath.Join(dir, "archive"),
+		interval:      10 * time.Second,
+		settle:        time.Second,
+		now:           time.Now,
+	}
+}
+
+// readInboxWatcher returns the inbox watcher configured by INBOX_DIR, INBOX_ERROR_DIR, INBOX_ARCHIVE_DIR and
+// INBOX_POLL_INTERVAL, or nil when INBOX_DIR isn't set. The directories are created when missing.
+func readInboxWatcher(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) (*inboxWatcher, error) {
+	dir := os.Getenv("INBOX_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	iw := newInboxWatcher(logger, repo, opts, dir)
+	if v := os.Getenv("INBOX_ERROR_DIR"); v != "" {
+		iw.errorDir = v
+	}
+	if v := os.Getenv("INBOX_ARCHIVE_DIR"); v != "" {
+		iw.archiveDir = v
+	}
+	if v := os.Getenv("INBOX_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid INBOX_POLL_INTERVAL: %q", v)
+		}
+		iw.interval = interval
+	}
+	for _, dir := range []string{iw.dir, iw.errorDir, iw.processingDir, iw.archiveDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("problem creating inbox directory: %v", err)
+		}
+	}
+	return iw, nil
+}
+
+// run resumes the files left in processingDir and scans the inbox every interval until stop is closed
+func (iw *inboxWatcher) run(stop <-chan struct{}) {
+	if err := iw.resume(); err != nil {
+		iw.logger.LogErrorf("problem resuming claimed files: %v", err)
+	}
+	iw.logger.Logf("watching inbox every %v", iw.interval)
+
+	ticker := time.NewTicker(iw.interval)
+	defer ticker.Stop()
+	for {
+		if err := iw.scan(); err != nil {
+			iw.logger.LogErrorf("problem scanning inbox: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			iw.logger.Log("stopped watching inbox")
+			return
+		}
+	}
+}
+
+// scan ingests the files in the inbox in name order. Directories, hidden files and files modified within settle
+// are skipped.
+func (iw *inboxWatcher) scan() error {
+	entries, err := os.ReadDir(iw.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		if iw.now().Sub(info.ModTime()) < iw.settle {
+			continue
+		}
+		if err := iw.ingest(entry.Name()); err != nil {
+			iw.logger.Set("file", log.String(entry.Name())).LogErrorf("problem ingesting file: %v", err)
+		}
+	}
+	return nil
+}
+
+// resume ingests the files a previous run claimed but stopped before moving out of processingDir. Stored files
+// are held in memory so none of them were kept, each is ingested again or rejected to the error directory.
+func (iw *inboxWatcher) resume() error {
+	entries, err := os.ReadDir(iw.processingDir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		claimed := entry.Name()
+		name := claimed
+		if _, after, ok := strings.Cut(claimed, "-"); ok {
+			name = after
+		}
+		logger := iw.logger.Set("file", log.String(name))
+		logger.Log("resuming claimed file")
+		if err := iw.process(logger, name, claimed); err != nil {
+			logger.LogErrorf("problem ingesting file: %v", err)
+		}
+	}
+	return nil
+}
+
+// ingest claims a file of the inbox, stores it when valid and moves the original to the archive or error directory
+func (iw *inboxWatcher) ingest(name string) error {
+	logger := iw.logger.Set("file", log.String(name))
+
+	claimed := iw.archiveName(name)
+	if err := os.Rename(filepath.Join(iw.dir, name), filepath.Join(iw.processingDir, claimed)); err != nil {
+		return fmt.Errorf("problem claiming file: %v", err)
+	}
+	return iw.process(logger, name, claimed)
+}
+
+// process stores the file claimed from name when valid and moves it to the archive or error directory
+func (iw *inboxWatcher) process(logger log.Logger, name, claimed string) error {
+	path := filepath.Join(iw.processingDir, claimed)
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	file, err := wire.NewReader(fd).Read()
+	fd.Close()
+	if err == nil {
+		file.ID = base.ID()
+		err = iw.opts.checkEnvironment(&file)
+	}
+	r := workerRequest(inboxUserID)
+	if err == nil {
+		var violations []policyViolation
+		if violations, err = iw.opts.policyViolations(r, iw.repo, &file); err == nil {
+			err = violationsError(violations)
+		}
+	}
+	var duplicates []string
+	if err == nil {
+		duplicates, err = iw.opts.findDuplicateIDs(iw.repo, &file)
+	}
+	if err != nil {
+		recordValidationFailure(err)
+		logger.Logf("file is invalid: %v", err)
+		return iw.reject(name, claimed, err)
+	}
+	logger = logger.Set("fileID", log.String(file.ID))
+
+	if err := iw.repo.saveFile(&file); err != nil {
+		// return the file to the inbox so it's ingested again
+		if rerr := os.Rename(path, filepath.Join(iw.dir, name)); rerr != nil {
+			logger.LogErrorf("problem returning file to the inbox: %v", rerr)
+		}
+		return fmt.Errorf("problem saving file: %v", err)
+	}
+	detail := "ingested " + name
+	if len(duplicates) > 0 {
+		logger.Logf("file is a likely duplicate of %s", strings.Join(duplicates, ","))
+		detail += ", a likely duplicate of " + strings.Join(duplicates, ",")
+	}
+	logger.Log("ingested file")
+
+	recordFileCreated(&file)
+	iw.opts.recordCreated(logger, r, &file, detail)
+	iw.opts.notifyCreated(logger, r, &file)
+
+	if err := os.Rename(path, filepath.Join(iw.archiveDir, claimed)); err != nil {
+		return fmt.Errorf("problem archiving file, it's left in %s: %v", iw.processingDir, err)
+	}
+	return nil
+}
+
+// reject moves a claimed file which couldn't be ingested to the error directory and writes its error report
+func (iw *inboxWatcher) reject(name, claimed string, cause error) error {
+	report := inboxErrorReport{
+		File:  name,
+		Error: cause.Error(),
+		Time:  iw.now(),
+	}
+	var fe *wire.FieldError
+	if errors.As(cause, &fe) {
+		report.Field = fe.FieldName
+	}
+	bs, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(iw.errorDir, claimed+".error.json"), bs, 0600); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(iw.processingDir, claimed), filepath.Join(iw.errorDir, claimed))
+}
+
+// archiveName prefixes name with the time so files dropped again with the same name don't replace earlier ones
+func (iw *inboxWatcher) archiveName(name string) string {
+	return iw.now().UTC().Format("20060102T150405.000000000") + "-" + name
+}
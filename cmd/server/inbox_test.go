@@ -0,0 +1,276 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// mockInbox returns an inbox watcher of a temporary directory which reads files as soon as they're written
+func mockInbox(t *testing.T, opts *fileRoutesOptions) (*inboxWatcher, *memoryWireFileRepository) {
+	t.Helper()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	if opts == nil {
+		opts = &fileRoutesOptions{audit: newAuditLog()}
+	}
+	iw := newInboxWatcher(log.NewNopLogger(), repo, opts, t.TempDir())
+	iw.settle = 0
+	for _, dir := range []string{iw.errorDir, iw.processingDir, iw.archiveDir} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	return iw, repo
+}
+
+// dropTransfer writes the CustomerTransfer testdata file into the inbox as name
+func dropTransfer(t *testing.T, iw *inboxWatcher, name string) {
+	t.Helper()
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, name), bs, 0600))
+}
+
+func readDirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var out []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			out = append(out, entry.Name())
+		}
+	}
+	return out
+}
+
+func TestInbox_ingest(t *testing.T) {
+	audit := newAuditLog()
+	iw, repo := mockInbox(t, &fileRoutesOptions{audit: audit})
+
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, "transfer.txt"), bs, 0600))
+
+	require.NoError(t, iw.scan())
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, wire.CustomerTransfer, files[0].FEDWireMessage.BusinessFunctionCode.BusinessFunctionCode)
+
+	require.Empty(t, readDirNames(t, iw.dir))
+	archived := readDirNames(t, iw.archiveDir)
+	require.Len(t, archived, 1)
+	require.True(t, strings.HasSuffix(archived[0], "-transfer.txt"))
+	require.Empty(t, readDirNames(t, iw.errorDir))
+
+	entries := audit.getEntries(files[0].ID)
+	require.Len(t, entries, 1)
+	require.Equal(t, auditCreated, entries[0].Action)
+	require.Equal(t, inboxUserID, entries[0].UserID)
+	require.Equal(t, "ingested transfer.txt", entries[0].Detail)
+}
+
+func TestInbox_archiveFails(t *testing.T) {
+	iw, repo := mockInbox(t, nil)
+	require.NoError(t, os.Remove(iw.archiveDir))
+	dropTransfer(t, iw, "transfer.txt")
+
+	// the file is claimed before it's saved, so it isn't ingested again when it can't be archived
+	require.Error(t, iw.ingest("transfer.txt"))
+	require.NoError(t, iw.scan())
+	require.NoError(t, iw.scan())
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Empty(t, readDirNames(t, iw.dir))
+	claimed := readDirNames(t, iw.processingDir)
+	require.Len(t, claimed, 1)
+	require.True(t, strings.HasSuffix(claimed[0], "-transfer.txt"))
+}
+
+func TestInbox_duplicates(t *testing.T) {
+	audit := newAuditLog()
+	iw, repo := mockInbox(t, &fileRoutesOptions{audit: audit, approvals: newApprovalRepository(), duplicateWindow: defaultDuplicateWindow})
+	dropTransfer(t, iw, "first.txt")
+	require.NoError(t, iw.scan())
+	dropTransfer(t, iw, "second.txt")
+	require.NoError(t, iw.scan())
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	details := make(map[string]string)
+	for _, file := range files {
+		details[audit.getEntries(file.ID)[0].Detail] = file.ID
+	}
+	first, ok := details["ingested first.txt"]
+	require.True(t, ok)
+	require.Contains(t, details, "ingested second.txt, a likely duplicate of "+first)
+
+	// rejected duplicates are moved to the error directory
+	iw.opts.rejectDuplicates = true
+	dropTransfer(t, iw, "third.txt")
+	require.NoError(t, iw.scan())
+	files, err = repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	require.Len(t, readDirNames(t, iw.errorDir), 2)
+}
+
+func TestInbox_invalid(t *testing.T) {
+	iw, repo := mockInbox(t, nil)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, "invalid.txt"), []byte("{1500}30User Req T \n"), 0600))
+
+	require.NoError(t, iw.scan())
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Empty(t, files)
+	require.Empty(t, readDirNames(t, iw.dir))
+	require.Empty(t, readDirNames(t, iw.archiveDir))
+
+	rejected := readDirNames(t, iw.errorDir)
+	require.Len(t, rejected, 2)
+	var report inboxErrorReport
+	for _, name := range rejected {
+		if strings.HasSuffix(name, ".error.json") {
+			bs, err := os.ReadFile(filepath.Join(iw.errorDir, name))
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(bs, &report))
+		} else {
+			require.True(t, strings.HasSuffix(name, "-invalid.txt"))
+		}
+	}
+	require.Equal(t, "invalid.txt", report.File)
+	require.NotEmpty(t, report.Error)
+}
+
+func TestInbox_environment(t *testing.T) {
+	iw, repo := mockInbox(t, &fileRoutesOptions{audit: newAuditLog(), environment: wire.EnvironmentProduction})
+
+	// the testdata file is a test message
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, "transfer.txt"), bs, 0600))
+
+	require.NoError(t, iw.scan())
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Empty(t, files)
+	require.Len(t, readDirNames(t, iw.errorDir), 2)
+}
+
+func TestInbox_skipped(t *testing.T) {
+	iw, repo := mockInbox(t, nil)
+	iw.settle = time.Hour
+
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, "writing.txt"), bs, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, ".hidden.txt"), bs, 0600))
+
+	// files modified within settle are still being written
+	require.NoError(t, iw.scan())
+	require.ElementsMatch(t, []string{"writing.txt", ".hidden.txt"}, readDirNames(t, iw.dir))
+
+	iw.settle = 0
+	require.NoError(t, iw.scan())
+	require.Equal(t, []string{".hidden.txt"}, readDirNames(t, iw.dir))
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func TestInbox_resume(t *testing.T) {
+	iw, repo := mockInbox(t, nil)
+
+	// files a previous run claimed and left in processing
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.processingDir, "20200101T000000.000000000-transfer.txt"), bs, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(iw.processingDir, "20200101T000000.000000000-invalid.txt"), []byte("not a wire"), 0600))
+
+	require.NoError(t, iw.resume())
+	require.Empty(t, readDirNames(t, iw.processingDir))
+	require.Equal(t, []string{"20200101T000000.000000000-transfer.txt"}, readDirNames(t, iw.archiveDir))
+	require.ElementsMatch(t, []string{
+		"20200101T000000.000000000-invalid.txt", "20200101T000000.000000000-invalid.txt.error.json",
+	}, readDirNames(t, iw.errorDir))
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	var report inboxErrorReport
+	bs, err = os.ReadFile(filepath.Join(iw.errorDir, "20200101T000000.000000000-invalid.txt.error.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(bs, &report))
+	require.Equal(t, "invalid.txt", report.File)
+}
+
+func TestInbox_run(t *testing.T) {
+	iw, repo := mockInbox(t, nil)
+	iw.interval = 10 * time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		iw.run(stop)
+		close(done)
+	}()
+
+	bs, err := os.ReadFile(filepath.Join("..", "..", "test", "testdata", "fedWireMessage-CustomerTransfer.txt"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(iw.dir, "transfer.txt"), bs, 0600))
+
+	require.Eventually(t, func() bool {
+		files, _ := repo.getFiles()
+		return len(files) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(stop)
+	<-done
+}
+
+func TestInbox_readInboxWatcher(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+
+	t.Setenv("INBOX_DIR", "")
+	iw, err := readInboxWatcher(log.NewNopLogger(), repo, &fileRoutesOptions{})
+	require.NoError(t, err)
+	require.Nil(t, iw)
+
+	dir := t.TempDir()
+	t.Setenv("INBOX_DIR", filepath.Join(dir, "inbox"))
+	t.Setenv("INBOX_ERROR_DIR", filepath.Join(dir, "failed"))
+	t.Setenv("INBOX_ARCHIVE_DIR", "")
+	t.Setenv("INBOX_POLL_INTERVAL", "1m")
+	iw, err = readInboxWatcher(log.NewNopLogger(), repo, &fileRoutesOptions{})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, iw.interval)
+	require.Equal(t, filepath.Join(dir, "failed"), iw.errorDir)
+	require.Equal(t, filepath.Join(dir, "inbox", "archive"), iw.archiveDir)
+	for _, dir := range []string{iw.dir, iw.errorDir, iw.archiveDir} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		require.True(t, info.IsDir())
+	}
+
+	t.Setenv("INBOX_POLL_INTERVAL", "often")
+	_, err = readInboxWatcher(log.NewNopLogger(), repo, &fileRoutesOptions{})
+	require.Error(t, err)
+}
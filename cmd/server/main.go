@@ -23,6 +23,7 @@ import (
 	moovhttp "github.com/moov-io/base/http"
 	"github.com/moov-io/base/http/bind"
 	"github.com/moov-io/wire"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 )
 
 var (
@@ -69,29 +70,154 @@ func main() {
 	}()
 	defer adminServer.Shutdown()
 
+	maxVersions, err := readMaxFileVersions()
+	if err != nil {
+		logger.LogErrorf("problem reading storage options: %v", err)
+		os.Exit(1)
+	}
 	repo := &memoryWireFileRepository{
-		files: make(map[string]*wire.File),
+		files:       make(map[string]*wire.File),
+		maxVersions: maxVersions,
 	}
 
 	// Setup business HTTP routes
 	router := mux.NewRouter()
 	moovhttp.AddCORSHandler(router)
 	addPingRoute(router)
-	addFileRoutes(logger, router, repo)
+	authenticators, err := readAuthenticators()
+	if err != nil {
+		logger.LogErrorf("problem reading authentication options: %v", err)
+		os.Exit(1)
+	}
+	if len(authenticators) > 0 {
+		logger.Logf("authenticating requests with %d methods", len(authenticators))
+		router.Use(authMiddleware(logger, authenticators...))
+	}
+	fileRoutesOpts, err := readRedactionOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading redaction options: %v", err)
+		os.Exit(1)
+	}
+	environmentOpts, err := readEnvironmentOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading environment options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, environmentOpts...)
+	duplicateOpts, err := readDuplicateOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading duplicate options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, duplicateOpts...)
+	approvalOpts, err := readApprovalOptions(len(authenticators) > 0)
+	if err != nil {
+		logger.LogErrorf("problem reading approval options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, approvalOpts...)
+	auditOpts, err := readAuditOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading audit options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, auditOpts...)
+	webhookOpts, err := readWebhookOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading webhook options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, webhookOpts...)
+	idempotencyOpts, err := readIdempotencyOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading idempotency options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, idempotencyOpts...)
+	bulkOpts, err := readBulkOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading bulk upload options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, bulkOpts...)
+
+	policyOpts, err := readPolicyOptions()
+	if err != nil {
+		logger.LogErrorf("problem reading policy options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, policyOpts...)
+
+	imadAllocator, err := readIMADAllocator(repo)
+	if err != nil {
+		logger.LogErrorf("problem reading IMAD options: %v", err)
+		os.Exit(1)
+	}
+	fileRoutesOpts = append(fileRoutesOpts, withIMADAllocator(imadAllocator))
+
+	approvals := newApprovalRepository()
+	fileRoutesOpts = append(fileRoutesOpts, withApprovalRepository(approvals))
+	stdprometheus.MustRegister(newStoredFilesCollector(repo, approvals))
+	fileRoutes := addFileRoutes(logger, router, repo, fileRoutesOpts...)
+	if err := fileRoutes.checkDailyLimits(); err != nil {
+		logger.LogErrorf("daily policy limits need REQUIRE_APPROVAL=true: %v", err)
+		os.Exit(1)
+	}
+
+	inbox, err := readInboxWatcher(logger, repo, fileRoutes)
+	if err != nil {
+		logger.LogErrorf("problem reading inbox options: %v", err)
+		os.Exit(1)
+	}
+	outbox, err := readOutboxExporter(logger, repo, fileRoutes)
+	if err != nil {
+		logger.LogErrorf("problem reading outbox options: %v", err)
+		os.Exit(1)
+	}
+	stopWorkers := make(chan struct{})
+	if inbox != nil {
+		go inbox.run(stopWorkers)
+	}
+	if outbox != nil {
+		go outbox.run(stopWorkers)
+	}
+
+	adviceRenderer, err := readPaymentAdviceRenderer()
+	if err != nil {
+		logger.LogErrorf("problem reading advice templates: %v", err)
+		os.Exit(1)
+	}
+	addAdviceRoutes(logger, router, repo, adviceRenderer, fileRoutes)
+	addConversationRoutes(logger, router, repo)
+	addIMADRoutes(logger, router, imadAllocator)
+	addConvertRoutes(logger, router, fileRoutes)
+	addTemplateRoutes(logger, router, repo, newTemplateRepository(), fileRoutes)
 
 	// Start business HTTP server
 	readTimeout, _ := time.ParseDuration("30s")
 	writTimeout, _ := time.ParseDuration("30s")
 	idleTimeout, _ := time.ParseDuration("60s")
 
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify:       false,
+		PreferServerCipherSuites: true,
+		MinVersion:               tls.VersionTLS12,
+	}
+	clientCAs, err := readClientCAs()
+	if err != nil {
+		logger.LogErrorf("problem reading client certificate authorities: %v", err)
+		os.Exit(1)
+	}
+	if clientCAs != nil {
+		// clients without certificates can still authenticate with API keys or JWTs
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
 	serve := &http.Server{
-		Addr:    *httpAddr,
-		Handler: router,
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify:       false,
-			PreferServerCipherSuites: true,
-			MinVersion:               tls.VersionTLS12,
-		},
+		Addr:              *httpAddr,
+		Handler:           router,
+		TLSConfig:         tlsConfig,
 		ReadTimeout:       readTimeout,
 		ReadHeaderTimeout: readTimeout,
 		WriteTimeout:      writTimeout,
@@ -129,7 +255,9 @@ func main() {
 	// Block/Wait for an error
 	if err := <-errs; err != nil {
 		logger.LogError(err)
+		close(stopWorkers)
 		shutdownServer()
+		fileRoutes.webhooks.close()
 	}
 }
 
@@ -0,0 +1,60 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to target and returns the result. Objects are merged
+// recursively, null removes a member and any other value replaces the target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// decodeJSON reads a JSON value from r keeping numbers as json.Number, so they're written back unchanged
+func decodeJSON(r io.Reader) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// toJSONObject returns v, a struct, as a JSON object
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := decodeJSON(bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	out, _ := obj.(map[string]interface{})
+	if out == nil {
+		out = make(map[string]interface{})
+	}
+	return out, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	"github.com/moov-io/wire"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// fileLabelNames label file metrics by the kind of wire, values are read with fileLabels
+var fileLabelNames = []string{"business_function_code", "type_subtype", "environment"}
+
+var (
+	filesCreated = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "wire_files_created",
+		Help: "The number of WIRE files created",
+	}, fileLabelNames)
+
+	filesDeleted = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "wire_files_deleted",
+		Help: "The number of WIRE files deleted",
+	}, fileLabelNames)
+
+	fileAmounts = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Name:    "wire_file_amount_dollars",
+		Help:    "Histogram of the amounts of WIRE files created",
+		Buckets: stdprometheus.ExponentialBuckets(1, 10, 11), // $1 to $10 billion
+	}, fileLabelNames)
+
+	validationFailures = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "wire_validation_failures",
+		Help: "The number of WIRE files failing validation",
+	}, []string{"error", "tag", "field"})
+
+	parseDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Name:    "wire_file_parse_duration_seconds",
+		Help:    "Histogram of the durations of reading WIRE files",
+		Buckets: stdprometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"format"})
+)
+
+// sentinelErrorType is the type of errors created with errors.New
+var sentinelErrorType = reflect.TypeOf(errors.New(""))
+
+// fileLabels returns the values of fileLabelNames for a file, "none" for tags which aren't set
+func fileLabels(file *wire.File) []string {
+	bfc, typeSubType, env := "none", "none", "none"
+	if file != nil {
+		fwm := file.FEDWireMessage
+		if fwm.BusinessFunctionCode != nil {
+			bfc = fwm.BusinessFunctionCode.BusinessFunctionCode
+		}
+		if fwm.TypeSubType != nil {
+			typeSubType = fwm.TypeSubType.TypeCode + fwm.TypeSubType.SubTypeCode
+		}
+		if fwm.SenderSupplied != nil {
+			env = fwm.SenderSupplied.TestProductionCode
+		}
+	}
+	return []string{
+		"business_function_code", bfc,
+		"type_subtype", typeSubType,
+		"environment", env,
+	}
+}
+
+// recordFileCreated counts a created file and observes its amount
+func recordFileCreated(file *wire.File) {
+	labels := fileLabels(file)
+	filesCreated.With(labels...).Add(1)
+	if amount, ok := fileAmount(file); ok {
+		fileAmounts.With(labels...).Observe(amount)
+	}
+}
+
+// recordFileDeleted counts a deleted file
+func recordFileDeleted(file *wire.File) {
+	filesDeleted.With(fileLabels(file)...).Add(1)
+}
+
+// fileAmount returns the Amount of a file in dollars
+func fileAmount(file *wire.File) (float64, bool) {
+	if file == nil || file.FEDWireMessage.Amount == nil {
+		return 0, false
+	}
+	cents, err := strconv.ParseInt(file.FEDWireMessage.Amount.Amount, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(cents) / 100, true
+}
+
+// recordValidationFailure counts a validation error by its type and the tag and field failing validation
+func recordValidationFailure(err error) {
+	if err == nil {
+		return
+	}
+	errType, tag, field := errorType(err), "none", "none"
+	var fe *wire.FieldError
+	if errors.As(err, &fe) {
+		errType, field = errorType(fe.Err), fe.FieldName
+		if t := wire.FieldTag(fe.FieldName); t != "" {
+			tag = t
+		}
+	}
+	validationFailures.With("error", errType, "tag", tag, "field", field).Add(1)
+}
+
+// errorType returns the message of sentinel errors, e.g. ErrFieldRequired, and the Go type of other errors whose
+// messages can contain values. Labels are bounded by the errors this package and wire define.
+func errorType(err error) string {
+	if err == nil {
+		return "none"
+	}
+	if reflect.TypeOf(err) == sentinelErrorType {
+		return err.Error()
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// observeParse records the duration of reading a file in format, json or fixed
+func observeParse(format string, start time.Time) {
+	parseDuration.With("format", format).Observe(time.Since(start).Seconds())
+}
+
+// storedFilesCollector reports the number of stored files by approval status and environment when scraped
+type storedFilesCollector struct {
+	repo      WireFileRepository
+	approvals *approvalRepository
+	desc      *stdprometheus.Desc
+}
+
+func newStoredFilesCollector(repo WireFileRepository, approvals *approvalRepository) *storedFilesCollector {
+	return &storedFilesCollector{
+		repo:      repo,
+		approvals: approvals,
+		desc: stdprometheus.NewDesc(
+			"wire_files_stored",
+			"The number of WIRE files stored",
+			[]string{"status", "environment"}, nil,
+		),
+	}
+}
+
+func (c *storedFilesCollector) Describe(ch chan<- *stdprometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *storedFilesCollector) Collect(ch chan<- stdprometheus.Metric) {
+	files, err := c.repo.getFiles()
+	if err != nil {
+		ch <- stdprometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	counts := make(map[[2]string]int)
+	for _, file := range files {
+		env := fileLabels(file)[5] // environment
+		counts[[2]string{c.approvals.getApproval(file.ID).Status, env}]++
+	}
+	for k, n := range counts {
+		ch <- stdprometheus.MustNewConstMetric(c.desc, stdprometheus.GaugeValue, float64(n), k[0], k[1])
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// metricValue returns the value of a counter or gauge, or the sample count of a histogram, with labels from
+// gatherer. Zero is returned when the metric hasn't been recorded.
+func metricValue(t *testing.T, gatherer stdprometheus.Gatherer, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := gatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if v, ok := labels[pair.GetName()]; ok && v != pair.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue()
+			case m.Gauge != nil:
+				return m.Gauge.GetValue()
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetrics_routeLabel(t *testing.T) {
+	var label string
+	router := mux.NewRouter()
+	router.Methods("GET").Path("/files/{fileId}").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		label = routeLabel(r)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/files/12345", nil))
+	require.Equal(t, "get-files-{fileId}", label)
+
+	require.Equal(t, "other", routeLabel(httptest.NewRequest("GET", "/files/12345", nil)))
+}
+
+func TestMetrics_fileLabels(t *testing.T) {
+	file := &wire.File{FEDWireMessage: mockFEDWireMessage()}
+	require.Equal(t, []string{
+		"business_function_code", wire.CustomerTransfer,
+		"type_subtype", "1000",
+		"environment", wire.EnvironmentProduction,
+	}, fileLabels(file))
+
+	require.Equal(t, []string{
+		"business_function_code", "none",
+		"type_subtype", "none",
+		"environment", "none",
+	}, fileLabels(&wire.File{}))
+
+	amount, ok := fileAmount(file)
+	require.True(t, ok)
+	require.Equal(t, 12345.67, amount)
+
+	_, ok = fileAmount(&wire.File{})
+	require.False(t, ok)
+}
+
+func TestMetrics_errorType(t *testing.T) {
+	require.Equal(t, wire.ErrFieldRequired.Error(), errorType(wire.ErrFieldRequired))
+	require.Equal(t, "*fmt.wrapError", errorType(fmt.Errorf("12345: %w", wire.ErrFieldRequired)))
+	require.Equal(t, "none", errorType(nil))
+}
+
+func TestMetrics_recordValidationFailure(t *testing.T) {
+	labels := map[string]string{"error": wire.ErrFieldRequired.Error(), "tag": wire.TagAmount, "field": "Amount"}
+	before := metricValue(t, stdprometheus.DefaultGatherer, "wire_validation_failures", labels)
+
+	fwm := mockFEDWireMessage()
+	fwm.Amount = nil
+	err := (&wire.File{FEDWireMessage: fwm}).Validate()
+	require.Error(t, err)
+	recordValidationFailure(err)
+
+	require.Equal(t, before+1, metricValue(t, stdprometheus.DefaultGatherer, "wire_validation_failures", labels))
+}
+
+func TestMetrics_createFile(t *testing.T) {
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)})
+
+	fwm := mockFEDWireMessage()
+	labels := map[string]string{
+		"business_function_code": wire.CustomerTransfer,
+		"type_subtype":           "1000",
+		"environment":            wire.EnvironmentProduction,
+	}
+	created := metricValue(t, stdprometheus.DefaultGatherer, "wire_files_created", labels)
+	amounts := metricValue(t, stdprometheus.DefaultGatherer, "wire_file_amount_dollars", labels)
+	parses := metricValue(t, stdprometheus.DefaultGatherer, "wire_file_parse_duration_seconds", map[string]string{"format": "json"})
+
+	require.Equal(t, http.StatusCreated, createFileJSON(t, router, fwm).Code)
+
+	require.Equal(t, created+1, metricValue(t, stdprometheus.DefaultGatherer, "wire_files_created", labels))
+	require.Equal(t, amounts+1, metricValue(t, stdprometheus.DefaultGatherer, "wire_file_amount_dollars", labels))
+	require.Equal(t, parses+1, metricValue(t, stdprometheus.DefaultGatherer, "wire_file_parse_duration_seconds", map[string]string{"format": "json"}))
+}
+
+func TestMetrics_storedFiles(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	require.NoError(t, repo.saveFile(&wire.File{ID: "bar", FEDWireMessage: mockFEDWireMessage()}))
+	approvals := newApprovalRepository()
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withApprovalRepository(approvals))
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+
+	registry := stdprometheus.NewRegistry()
+	require.NoError(t, registry.Register(newStoredFilesCollector(repo, approvals)))
+
+	labels := func(status string) map[string]string {
+		return map[string]string{"status": status, "environment": wire.EnvironmentProduction}
+	}
+	require.Equal(t, 1.0, metricValue(t, registry, "wire_files_stored", labels(statusDraft)))
+	require.Equal(t, 1.0, metricValue(t, registry, "wire_files_stored", labels(statusPendingApproval)))
+	require.Equal(t, 0.0, metricValue(t, registry, "wire_files_stored", labels(statusApproved)))
+}
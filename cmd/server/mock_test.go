@@ -5,9 +5,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
 	"time"
 
 	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
 )
 
 /*func mockServiceInMemory() Storage {
@@ -231,3 +238,31 @@ func mockFEDWireMessage() wire.FEDWireMessage {
 
 	return fwm
 }
+
+// testRequest serves a request to router and returns the response. body is sent as is when it's a string or
+// []byte and as JSON otherwise, headers are pairs of names and values and those with empty values aren't set.
+func testRequest(t *testing.T, router http.Handler, method, target string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		r = bytes.NewReader([]byte(body))
+	case []byte:
+		r = bytes.NewReader(body)
+	default:
+		bs, err := json.Marshal(body)
+		require.NoError(t, err)
+		r = bytes.NewReader(bs)
+	}
+	req := httptest.NewRequest(method, target, r)
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
@@ -0,0 +1,432 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+// outboxUserID is the user ID which releases the files the outbox exports
+const outboxUserID = "outbox"
+
+// outboxSequenceFile holds the last sequence number used in the outbox, it's hidden so transmission jobs skip it
+const outboxSequenceFile = ".sequence.json"
+
+// outboxExporter writes approved files to a directory and releases them. Each export is a batch of message files
+// and a manifest, each written to a temporary file and renamed so readers of the directory never see partial files.
+type outboxExporter struct {
+	logger log.Logger
+	repo   WireFileRepository
+	opts   *fileRoutesOptions
+
+	dir    string
+	format wire.FormatOptions
+	// interval is how often approved files are exported
+	interval time.Duration
+	now      func() time.Time
+
+	// mu serializes exports so sequence numbers are used once
+	mu sync.Mutex
+	// pendingManifest is the manifest of exported files which couldn't be written, it's retried by the next export
+	pendingManifest *outboxPendingManifest
+}
+
+type outboxPendingManifest struct {
+	name     string
+	contents []byte
+}
+
+// outboxSequence is the last sequence number used on a date, sequences restart at 1 each day
+type outboxSequence struct {
+	Date     string `json:"date"`
+	Sequence int    `json:"sequence"`
+}
+
+// outboxManifest describes a batch of exported files
+type outboxManifest struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Count     int       `json:"count"`
+	// TotalAmount is the sum of the Amount {2000} of every file in dollars, e.g. 12345.67
+	TotalAmount string               `json:"totalAmount"`
+	Files       []outboxManifestFile `json:"files"`
+}
+
+type outboxManifestFile struct {
+	Name                 string `json:"name"`
+	FileID               string `json:"fileID"`
+	BusinessFunctionCode string `json:"businessFunctionCode"`
+	Amount               string `json:"amount"`
+	SHA256               string `json:"sha256"`
+}
+
+func newOutboxExporter(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions, dir string) *outboxExporter {
+	return &outboxExporter{
+		logger:   logger.Set("outbox", log.String(dir)),
+		repo:     repo,
+		opts:     opts,
+		dir:      dir,
+		format:   wire.FormatOptions{NewlineCharacter: "\n"},
+		interval: time.Minute,
+		now:      time.Now,
+	}
+}
+
+// readOutboxExporter returns the outbox exporter configured by OUTBOX_DIR, OUTBOX_INTERVAL, OUTBOX_FORMAT and
+// OUTBOX_NEWLINE, or nil when OUTBOX_DIR isn't set. The directory is created when missing.
+func readOutboxExporter(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) (*outboxExporter, error) {
+	dir := os.Getenv("OUTBOX_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	ox := newOutboxExporter(logger, repo, opts, dir)
+	if v := os.Getenv("OUTBOX_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_INTERVAL: %q", v)
+		}
+		ox.interval = interval
+	}
+	switch v := os.Getenv("OUTBOX_FORMAT"); v {
+	case "", "fixed":
+	case "variable":
+		ox.format.VariableLengthFields = true
+	default:
+		return nil, fmt.Errorf("invalid OUTBOX_FORMAT: %q", v)
+	}
+	if v := os.Getenv("OUTBOX_NEWLINE"); v != "" {
+		newline, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OUTBOX_NEWLINE: %q", v)
+		}
+		if !newline {
+			ox.format.NewlineCharacter = ""
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("problem creating outbox directory: %v", err)
+	}
+	return ox, nil
+}
+
+// run exports approved files every interval until stop is closed
+func (ox *outboxExporter) run(stop <-chan struct{}) {
+	ox.logger.Logf("exporting approved files every %v", ox.interval)
+
+	ticker := time.NewTicker(ox.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := ox.export(); err != nil {
+				ox.logger.LogErrorf("problem exporting files: %v", err)
+			}
+		case <-stop:
+			ox.logger.Log("stopped exporting files")
+			return
+		}
+	}
+}
+
+// export writes every approved file to the outbox as one batch and releases them. Files are named
+// <date>-<sequence>-<business function code>.txt in the order they were approved, followed by the batch's
+// manifest-<date>-<first sequence>.json. The manifest is nil when no files were approved.
+//
+// Once a file of the batch is visible it may have been picked up, so it's never removed. When a later file can't
+// be renamed it's returned to approved files, and a manifest which can't be written is retried by the next export.
+func (ox *outboxExporter) export() (*outboxManifest, error) {
+	ox.mu.Lock()
+	defer ox.mu.Unlock()
+
+	if pending := ox.pendingManifest; pending != nil {
+		if err := ox.writeFile(pending.name, pending.contents); err != nil {
+			return nil, fmt.Errorf("problem writing %s: %v", pending.name, err)
+		}
+		ox.logger.Logf("wrote %s", pending.name)
+		ox.pendingManifest = nil
+	}
+
+	files, err := ox.approvedFiles()
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	seq, err := ox.readSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &outboxManifest{CreatedAt: ox.now(), Files: []outboxManifestFile{}}
+	firstSequence := seq.Sequence + 1
+	var temps []string
+	defer func() {
+		for _, temp := range temps {
+			os.Remove(temp) // left behind when the export failed
+		}
+	}()
+	var released []*wire.File
+	var releases []approvalEvent
+	stamps := make(map[string]outboxStamp)
+	for _, file := range files {
+		logger := ox.logger.Set("fileID", log.String(file.ID))
+
+		stamped, number, err := ox.opts.imad.stamp(file)
+		if err != nil {
+			logger.LogErrorf("problem stamping IMAD: %v", err)
+			break
+		}
+		if stamped != nil {
+			stamps[file.ID] = outboxStamp{before: file, seq: number}
+			file = stamped
+		}
+		// void the stamped number when the file isn't exported, it's stamped again next time
+		void := func() {
+			if number != nil {
+				ox.opts.imad.void(*number)
+				delete(stamps, file.ID)
+			}
+		}
+
+		var buf bytes.Buffer
+		w := wire.NewWriter(&buf, wire.VariableLengthFields(ox.format.VariableLengthFields), wire.NewlineCharacter(ox.format.NewlineCharacter))
+		if err := w.Write(file); err != nil {
+			logger.LogErrorf("problem writing file: %v", err)
+			void()
+			continue
+		}
+		temp, err := ox.writeTemp("outbox", buf.Bytes())
+		if err != nil {
+			// export the files already released, the rest are exported next time
+			logger.LogErrorf("problem writing file: %v", err)
+			void()
+			break
+		}
+		// release the file before it's visible so it's exported once, it may have been rejected or released
+		// since it was read. The release is undone when the batch isn't written.
+		approval, err := ox.opts.approvals.transition(file.ID, statusReleased, outboxUserID, "exported to outbox", nil)
+		if err != nil {
+			logger.LogErrorf("problem releasing file: %v", err)
+			os.Remove(temp)
+			void()
+			continue
+		}
+		temps = append(temps, temp)
+
+		seq.Sequence++
+		sum := sha256.Sum256(buf.Bytes())
+		entry := outboxManifestFile{
+			Name:                 fmt.Sprintf("%s-%06d-%s.txt", seq.Date, seq.Sequence, businessFunctionCode(file)),
+			FileID:               file.ID,
+			BusinessFunctionCode: businessFunctionCode(file),
+			SHA256:               hex.EncodeToString(sum[:]),
+		}
+		if file.FEDWireMessage.Amount != nil {
+			entry.Amount = file.FEDWireMessage.Amount.Amount
+		}
+		manifest.Files = append(manifest.Files, entry)
+		released = append(released, file)
+		releases = append(releases, approval.History[len(approval.History)-1])
+	}
+	if len(released) == 0 {
+		return nil, nil
+	}
+
+	// undo returns the files of the batch from index from to approved files so they're exported again next
+	// time. Stamped copies aren't saved until the files are visible.
+	undo := func(from int) {
+		for i := from; i < len(released); i++ {
+			file := released[i]
+			logger := ox.logger.Set("fileID", log.String(file.ID))
+			if !ox.opts.approvals.revert(file.ID, releases[i]) {
+				logger.LogErrorf("problem undoing release, the file changed status")
+			}
+			if stamp, ok := stamps[file.ID]; ok {
+				if err := ox.opts.imad.void(*stamp.seq); err != nil {
+					logger.LogErrorf("problem voiding IMAD: %v", err)
+				}
+			}
+		}
+	}
+
+	// save the sequence first so names are never reused, even when the export fails after this
+	if err := ox.writeSequence(seq); err != nil {
+		undo(0)
+		return nil, err
+	}
+	for i := range temps {
+		if err := os.Rename(temps[i], filepath.Join(ox.dir, manifest.Files[i].Name)); err != nil {
+			if i == 0 {
+				undo(0)
+				return nil, err
+			}
+			ox.logger.LogErrorf("problem renaming %s, it's exported next time: %v", manifest.Files[i].Name, err)
+			for _, temp := range temps[i:] {
+				os.Remove(temp)
+			}
+			undo(i)
+			released, manifest.Files = released[:i], manifest.Files[:i]
+			break
+		}
+	}
+	temps = nil
+
+	var total int64
+	for _, entry := range manifest.Files {
+		cents, _ := strconv.ParseInt(entry.Amount, 10, 64)
+		total += cents
+	}
+	manifest.Count = len(manifest.Files)
+	manifest.TotalAmount = fmt.Sprintf("%d.%02d", total/100, total%100)
+
+	// the files are visible, so a manifest which can't be written is kept and retried rather than undone
+	name := fmt.Sprintf("manifest-%s-%06d.json", seq.Date, firstSequence)
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = ox.writeFile(name, bs)
+	}
+	if err != nil {
+		ox.logger.LogErrorf("problem writing %s, it's retried next export: %v", name, err)
+		ox.pendingManifest = &outboxPendingManifest{name: name, contents: bs}
+	}
+
+	r := workerRequest(outboxUserID)
+	for i, file := range released {
+		logger := ox.logger.Set("fileID", log.String(file.ID))
+		logger.Logf("exported file as %s", manifest.Files[i].Name)
+		ox.opts.recordAudit(logger, r, auditStatusChanged, file.ID, file, file, fmt.Sprintf("%s to %s, exported as %s", statusApproved, statusReleased, manifest.Files[i].Name))
+		if stamp, ok := stamps[file.ID]; ok {
+			// the file was exported with the number, keep it used even when the copy can't be saved
+			if err := ox.repo.saveFile(file); err != nil {
+				logger.LogErrorf("problem saving stamped file: %v", err)
+			}
+			ox.opts.recordStamp(logger, r, stamp.before, file, stamp.seq)
+		}
+		ox.opts.notifyWebhooks(logger, r, eventFileReleased, file.ID, nil)
+	}
+	return manifest, nil
+}
+
+// outboxStamp is the IMAD stamped onto an exported file and the file before it was stamped
+type outboxStamp struct {
+	before *wire.File
+	seq    *imadSequence
+}
+
+// approvedFiles returns the approved files in the order they were approved
+func (ox *outboxExporter) approvedFiles() ([]*wire.File, error) {
+	files, err := ox.repo.getFiles()
+	if err != nil {
+		return nil, err
+	}
+	var out []*wire.File
+	approvedAt := make(map[string]time.Time)
+	for _, file := range files {
+		if a := ox.opts.approvals.getApproval(file.ID); a.Status == statusApproved {
+			out = append(out, file)
+			approvedAt[file.ID] = a.lastApproval().Time
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ti, tj := approvedAt[out[i].ID], approvedAt[out[j].ID]
+		if ti.Equal(tj) {
+			return out[i].ID < out[j].ID
+		}
+		return ti.Before(tj)
+	})
+	return out, nil
+}
+
+// lastApproval returns the event which last approved the file, a zero event when it never was
+func (a fileApproval) lastApproval() approvalEvent {
+	for i := len(a.History) - 1; i >= 0; i-- {
+		if a.History[i].To == statusApproved {
+			return a.History[i]
+		}
+	}
+	return approvalEvent{}
+}
+
+// businessFunctionCode returns the business function code of a file for its outbox name, UNK when it isn't set
+func businessFunctionCode(file *wire.File) string {
+	if bfc := file.FEDWireMessage.BusinessFunctionCode; bfc != nil && bfc.BusinessFunctionCode != "" {
+		return bfc.BusinessFunctionCode
+	}
+	return "UNK"
+}
+
+// readSequence returns the last sequence number used today
+func (ox *outboxExporter) readSequence() (outboxSequence, error) {
+	today := outboxSequence{Date: ox.now().Format("20060102")}
+	bs, err := os.ReadFile(filepath.Join(ox.dir, outboxSequenceFile))
+	if os.IsNotExist(err) {
+		return today, nil
+	}
+	if err != nil {
+		return today, err
+	}
+	var seq outboxSequence
+	if err := json.Unmarshal(bs, &seq); err != nil {
+		return today, fmt.Errorf("invalid %s: %v", outboxSequenceFile, err)
+	}
+	if seq.Date != today.Date {
+		return today, nil
+	}
+	return seq, nil
+}
+
+func (ox *outboxExporter) writeSequence(seq outboxSequence) error {
+	bs, err := json.Marshal(seq)
+	if err != nil {
+		return err
+	}
+	return ox.writeFile(outboxSequenceFile, bs)
+}
+
+// writeTemp writes contents to a hidden temporary file of the outbox and returns its path
+func (ox *outboxExporter) writeTemp(name string, contents []byte) (string, error) {
+	fd, err := os.CreateTemp(ox.dir, "."+name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := fd.Write(contents); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return "", err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return "", err
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(fd.Name())
+		return "", err
+	}
+	return fd.Name(), nil
+}
+
+// writeFile atomically writes contents to name in the outbox
+func (ox *outboxExporter) writeFile(name string, contents []byte) error {
+	temp, err := ox.writeTemp(name, contents)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, filepath.Join(ox.dir, name)); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOutbox returns an outbox exporter of a temporary directory and saves files whose amounts are amounts,
+// each approved in order
+func mockOutbox(t *testing.T, amounts ...string) (*outboxExporter, *memoryWireFileRepository) {
+	t.Helper()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	opts := &fileRoutesOptions{approvals: newApprovalRepository(), audit: newAuditLog()}
+	for i, amount := range amounts {
+		file := &wire.File{ID: "file" + string(rune('a'+i)), FEDWireMessage: mockFEDWireMessage()}
+		file.FEDWireMessage.Amount.Amount = amount
+		require.NoError(t, repo.saveFile(file))
+		approve(t, opts.approvals, file.ID)
+	}
+	ox := newOutboxExporter(log.NewNopLogger(), repo, opts, t.TempDir())
+	ox.now = func() time.Time {
+		return time.Date(2026, time.October, 19, 14, 30, 0, 0, time.UTC)
+	}
+	return ox, repo
+}
+
+func approve(t *testing.T, approvals *approvalRepository, fileID string) {
+	t.Helper()
+	_, err := approvals.transition(fileID, statusPendingApproval, "maker", "", nil)
+	require.NoError(t, err)
+	_, err = approvals.transition(fileID, statusApproved, "checker", "", nil)
+	require.NoError(t, err)
+}
+
+func TestOutbox_export(t *testing.T) {
+	ox, repo := mockOutbox(t, "000000010000", "000001234567")
+
+	// drafts aren't exported
+	require.NoError(t, repo.saveFile(&wire.File{ID: "draft", FEDWireMessage: mockFEDWireMessage()}))
+
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	require.Equal(t, 2, manifest.Count)
+	require.Equal(t, "12445.67", manifest.TotalAmount)
+	require.Equal(t, "20261019-000001-CTR.txt", manifest.Files[0].Name)
+	require.Equal(t, "filea", manifest.Files[0].FileID)
+	require.Equal(t, "20261019-000002-CTR.txt", manifest.Files[1].Name)
+	require.Equal(t, "fileb", manifest.Files[1].FileID)
+
+	for _, f := range manifest.Files {
+		bs, err := os.ReadFile(filepath.Join(ox.dir, f.Name))
+		require.NoError(t, err)
+		sum := sha256.Sum256(bs)
+		require.Equal(t, hex.EncodeToString(sum[:]), f.SHA256)
+
+		file, err := wire.NewReader(strings.NewReader(string(bs))).Read()
+		require.NoError(t, err)
+		require.Equal(t, f.Amount, file.FEDWireMessage.Amount.Amount)
+
+		require.Equal(t, statusReleased, ox.opts.approvals.getApproval(f.FileID).Status)
+	}
+	require.Equal(t, statusDraft, ox.opts.approvals.getApproval("draft").Status)
+
+	bs, err := os.ReadFile(filepath.Join(ox.dir, "manifest-20261019-000001.json"))
+	require.NoError(t, err)
+	var written outboxManifest
+	require.NoError(t, json.Unmarshal(bs, &written))
+	require.Equal(t, manifest.Files, written.Files)
+
+	// released files aren't exported again
+	manifest, err = ox.export()
+	require.NoError(t, err)
+	require.Nil(t, manifest)
+
+	// every file is visible, temporary files were renamed
+	var names []string
+	entries, err := os.ReadDir(ox.dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{
+		outboxSequenceFile, "20261019-000001-CTR.txt", "20261019-000002-CTR.txt", "manifest-20261019-000001.json",
+	}, names)
+
+	audit := ox.opts.audit.getEntries("filea")
+	require.Len(t, audit, 1)
+	require.Equal(t, outboxUserID, audit[0].UserID)
+	require.Contains(t, audit[0].Detail, "20261019-000001-CTR.txt")
+}
+
+func TestOutbox_sequence(t *testing.T) {
+	ox, repo := mockOutbox(t, "000000010000")
+	_, err := ox.export()
+	require.NoError(t, err)
+
+	// sequences continue within a day and restart the next
+	file := &wire.File{ID: "later", FEDWireMessage: mockFEDWireMessage()}
+	require.NoError(t, repo.saveFile(file))
+	approve(t, ox.opts.approvals, file.ID)
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	require.Equal(t, "20261019-000002-CTR.txt", manifest.Files[0].Name)
+
+	ox.now = func() time.Time {
+		return time.Date(2026, time.October, 20, 9, 0, 0, 0, time.UTC)
+	}
+	file = &wire.File{ID: "tomorrow", FEDWireMessage: mockFEDWireMessage()}
+	require.NoError(t, repo.saveFile(file))
+	approve(t, ox.opts.approvals, file.ID)
+	manifest, err = ox.export()
+	require.NoError(t, err)
+	require.Equal(t, "20261020-000001-CTR.txt", manifest.Files[0].Name)
+	require.FileExists(t, filepath.Join(ox.dir, "manifest-20261020-000001.json"))
+}
+
+func TestOutbox_format(t *testing.T) {
+	ox, _ := mockOutbox(t, "000000010000")
+	ox.format = wire.FormatOptions{VariableLengthFields: true, NewlineCharacter: ""}
+
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	bs, err := os.ReadFile(filepath.Join(ox.dir, manifest.Files[0].Name))
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "\n")
+	require.Contains(t, string(bs), "*")
+}
+
+func TestOutbox_renameFails(t *testing.T) {
+	ox, repo := mockOutbox(t, "000000010000", "000001234567")
+	ox.opts.imad = mockIMADAllocator(repo, "SOURCE01")
+	want := mockFEDWireMessage().InputMessageAccountabilityData.Identifier()
+
+	// the first file can't be renamed over a directory, so none are visible
+	blocked := filepath.Join(ox.dir, "20261019-000001-CTR.txt")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "child"), 0755))
+
+	manifest, err := ox.export()
+	require.Error(t, err)
+	require.Nil(t, manifest)
+
+	names, err := os.ReadDir(ox.dir)
+	require.NoError(t, err)
+	for _, name := range names {
+		if name.Name() == filepath.Base(blocked) || name.Name() == outboxSequenceFile {
+			continue
+		}
+		t.Errorf("unexpected outbox file %s", name.Name())
+	}
+	for _, id := range []string{"filea", "fileb"} {
+		require.Equal(t, statusApproved, ox.opts.approvals.getApproval(id).Status)
+		file, err := repo.getFile(id)
+		require.NoError(t, err)
+		require.Equal(t, want, file.FEDWireMessage.InputMessageAccountabilityData.Identifier())
+		require.Empty(t, ox.opts.audit.getEntries(id))
+	}
+	sequences, err := repo.getIMADSequences("SOURCE01", "20261019")
+	require.NoError(t, err)
+	require.Len(t, sequences, 2)
+	for _, seq := range sequences {
+		require.Equal(t, imadVoided, seq.Status)
+	}
+
+	// the files are exported next time
+	require.NoError(t, os.RemoveAll(blocked))
+	manifest, err = ox.export()
+	require.NoError(t, err)
+	require.Equal(t, 2, manifest.Count)
+	require.Equal(t, "20261019-000003-CTR.txt", manifest.Files[0].Name)
+	require.Equal(t, statusReleased, ox.opts.approvals.getApproval("filea").Status)
+}
+
+func TestOutbox_laterRenameFails(t *testing.T) {
+	ox, repo := mockOutbox(t, "000000010000", "000001234567")
+	ox.opts.imad = mockIMADAllocator(repo, "SOURCE01")
+
+	// the second file can't be renamed, the first is visible and may have been picked up so it's kept
+	blocked := filepath.Join(ox.dir, "20261019-000002-CTR.txt")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "child"), 0755))
+
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	require.Equal(t, 1, manifest.Count)
+	require.Equal(t, "100.00", manifest.TotalAmount)
+	require.Equal(t, "filea", manifest.Files[0].FileID)
+	require.FileExists(t, filepath.Join(ox.dir, "20261019-000001-CTR.txt"))
+	require.FileExists(t, filepath.Join(ox.dir, "manifest-20261019-000001.json"))
+	require.Equal(t, statusReleased, ox.opts.approvals.getApproval("filea").Status)
+	require.Equal(t, statusApproved, ox.opts.approvals.getApproval("fileb").Status)
+	for _, name := range readDirNames(t, ox.dir) {
+		require.False(t, strings.HasSuffix(name, ".tmp"), name)
+	}
+
+	// the second file is exported next time
+	require.NoError(t, os.RemoveAll(blocked))
+	manifest, err = ox.export()
+	require.NoError(t, err)
+	require.Equal(t, 1, manifest.Count)
+	require.Equal(t, "fileb", manifest.Files[0].FileID)
+	require.Equal(t, "20261019-000003-CTR.txt", manifest.Files[0].Name)
+}
+
+func TestOutbox_manifestFails(t *testing.T) {
+	ox, _ := mockOutbox(t, "000000010000")
+
+	// the manifest can't be renamed over a directory, the exported file is kept
+	blocked := filepath.Join(ox.dir, "manifest-20261019-000001.json")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "child"), 0755))
+
+	manifest, err := ox.export()
+	require.NoError(t, err)
+	require.Equal(t, 1, manifest.Count)
+	require.FileExists(t, filepath.Join(ox.dir, "20261019-000001-CTR.txt"))
+	require.Equal(t, statusReleased, ox.opts.approvals.getApproval("filea").Status)
+
+	// the manifest is retried before anything else is exported
+	_, err = ox.export()
+	require.Error(t, err)
+
+	require.NoError(t, os.RemoveAll(blocked))
+	manifest, err = ox.export()
+	require.NoError(t, err)
+	require.Nil(t, manifest)
+	bs, err := os.ReadFile(blocked)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "20261019-000001-CTR.txt")
+}
+
+func TestOutbox_readOutboxExporter(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+
+	t.Setenv("OUTBOX_DIR", "")
+	ox, err := readOutboxExporter(log.NewNopLogger(), repo, &fileRoutesOptions{})
+	require.NoError(t, err)
+	require.Nil(t, ox)
+
+	dir := filepath.Join(t.TempDir(), "outbox")
+	t.Setenv("OUTBOX_DIR", dir)
+	t.Setenv("OUTBOX_INTERVAL", "5m")
+	t.Setenv("OUTBOX_FORMAT", "variable")
+	t.Setenv("OUTBOX_NEWLINE", "false")
+	ox, err = readOutboxExporter(log.NewNopLogger(), repo, &fileRoutesOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, ox.interval)
+	require.Equal(t, wire.FormatOptions{VariableLengthFields: true, NewlineCharacter: ""}, ox.format)
+	require.DirExists(t, dir)
+
+	for key, value := range map[string]string{
+		"OUTBOX_INTERVAL": "-1s",
+		"OUTBOX_FORMAT":   "csv",
+		"OUTBOX_NEWLINE":  "crlf",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := readOutboxExporter(log.NewNopLogger(), repo, &fileRoutesOptions{})
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,536 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"gopkg.in/yaml.v3"
+)
+
+// Operators of policy conditions
+const (
+	policyEq         = "eq"
+	policyNe         = "ne"
+	policyIn         = "in"
+	policyNotIn      = "notIn"
+	policyMatches    = "matches"
+	policyNotMatches = "notMatches"
+	policyPresent    = "present"
+	policyAbsent     = "absent"
+	policyGt         = "gt"
+	policyGte        = "gte"
+	policyLt         = "lt"
+	policyLte        = "lte"
+)
+
+// policyPeriodDay sums the amounts of files approved today
+const policyPeriodDay = "day"
+
+// policyCallerID is the field of the user creating or approving the file, e.g. to limit who sends some messages
+const policyCallerID = "caller.id"
+
+var (
+	errPolicyViolation = errors.New("file violates policy rules")
+	errInvalidPolicy   = errors.New("invalid policy rule")
+)
+
+// policyRule is a business policy checked against the fields of FEDWireMessages. Fields are the dot separated
+// paths of the message as JSON, e.g. beneficiary.personal.identifier, where * matches every member of an object.
+// caller.id is the user creating or approving the file.
+type policyRule struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	// When are the conditions a message must meet for the rule to apply, it applies to every message when empty
+	When []policyCondition `yaml:"when" json:"when"`
+	// Require are the conditions the messages the rule applies to must meet
+	Require []policyCondition `yaml:"require" json:"require"`
+	// Limit is the largest amount the messages the rule applies to can send
+	Limit *policyLimit `yaml:"limit" json:"limit"`
+}
+
+// policyCondition compares the values of a field. A condition holds when every value of the field satisfies the
+// operator. Missing and blank fields only satisfy ne, notIn, notMatches and absent.
+type policyCondition struct {
+	Field string `yaml:"field" json:"field"`
+	// Op is eq, ne, in, notIn, matches, notMatches, present, absent, gt, gte, lt or lte. Numbers are compared as
+	// written in the message, so amount.amount is in cents.
+	Op     string   `yaml:"op" json:"op"`
+	Value  string   `yaml:"value" json:"value"`
+	Values []string `yaml:"values" json:"values"`
+
+	regex  *regexp.Regexp
+	number float64
+}
+
+// policyLimit is the largest amount messages can send, alone or summed with the files approved today sharing the
+// values of the Per fields
+type policyLimit struct {
+	// Amount is in dollars, e.g. 250000.00
+	Amount string `yaml:"amount" json:"amount"`
+	// Per are the fields grouping messages under the limit, e.g. beneficiary.personal.identifier
+	Per []string `yaml:"per" json:"per"`
+	// Period is day to sum the files approved today, each message is limited alone when empty
+	Period string `yaml:"period" json:"period"`
+
+	cents int64
+}
+
+// policyRules is the file of POLICY_RULES_FILE
+type policyRules struct {
+	Rules []policyRule `yaml:"rules" json:"rules"`
+}
+
+// policyViolation is a policy rule a message doesn't meet
+type policyViolation struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Field       string `json:"field"`
+	Message     string `json:"message"`
+}
+
+// policyEngine checks messages against policy rules
+type policyEngine struct {
+	rules []policyRule
+	now   func() time.Time
+
+	// mu serializes checking daily limits and approving files, so concurrent approvals can't both fit under a limit
+	mu sync.Mutex
+}
+
+func newPolicyEngine(rules []policyRule) (*policyEngine, error) {
+	names := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%w: rule %d has no name", errInvalidPolicy, i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%w: %s is defined twice", errInvalidPolicy, rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Require) == 0 && rule.Limit == nil {
+			return nil, fmt.Errorf("%w: %s has no require or limit", errInvalidPolicy, rule.Name)
+		}
+		for _, conditions := range [][]policyCondition{rule.When, rule.Require} {
+			for j := range conditions {
+				if err := conditions[j].compile(); err != nil {
+					return nil, fmt.Errorf("%w: %s: %v", errInvalidPolicy, rule.Name, err)
+				}
+			}
+		}
+		if limit := rule.Limit; limit != nil {
+			cents, err := parseDollars(limit.Amount)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: limit %v", errInvalidPolicy, rule.Name, err)
+			}
+			limit.cents = cents
+			if limit.Period != "" && limit.Period != policyPeriodDay {
+				return nil, fmt.Errorf("%w: %s: unknown limit period %q", errInvalidPolicy, rule.Name, limit.Period)
+			}
+			for _, field := range limit.Per {
+				// the approved files summed under a limit aren't checked with the caller who created them
+				if field == policyCallerID {
+					return nil, fmt.Errorf("%w: %s: limits can't be per %s", errInvalidPolicy, rule.Name, policyCallerID)
+				}
+			}
+		}
+	}
+	return &policyEngine{
+		rules: rules,
+		now:   time.Now,
+	}, nil
+}
+
+// readPolicyRules reads the rules of a YAML or JSON file, unknown keys are rejected so typos aren't ignored
+func readPolicyRules(path string) ([]policyRule, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	var rules policyRules
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules.Rules, nil
+}
+
+// readPolicyOptions reads the policy rules of POLICY_RULES_FILE, no rules are checked when it's empty
+func readPolicyOptions() ([]fileRoutesOption, error) {
+	path := os.Getenv("POLICY_RULES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	rules, err := readPolicyRules(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POLICY_RULES_FILE: %w", err)
+	}
+	engine, err := newPolicyEngine(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POLICY_RULES_FILE: %w", err)
+	}
+	return []fileRoutesOption{withPolicyEngine(engine)}, nil
+}
+
+// withPolicyEngine checks files against policy rules when they're created and approved
+func withPolicyEngine(engine *policyEngine) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.policies = engine
+	}
+}
+
+// compile checks the operator and values of c and parses its regex or number
+func (c *policyCondition) compile() error {
+	if c.Field == "" {
+		return errors.New("condition has no field")
+	}
+	var err error
+	switch c.Op {
+	case policyPresent, policyAbsent:
+	case policyEq, policyNe:
+	case policyIn, policyNotIn:
+		if len(c.Values) == 0 {
+			return fmt.Errorf("%s %s has no values", c.Field, c.Op)
+		}
+	case policyMatches, policyNotMatches:
+		c.regex, err = regexp.Compile(c.Value)
+	case policyGt, policyGte, policyLt, policyLte:
+		c.number, err = strconv.ParseFloat(c.Value, 64)
+	default:
+		return fmt.Errorf("%s has unknown op %q", c.Field, c.Op)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", c.Field, c.Op, err)
+	}
+	return nil
+}
+
+// holds reports if every value of the field satisfies c
+func (c *policyCondition) holds(msg map[string]interface{}) bool {
+	values := fieldValues(msg, c.Field)
+	if len(values) == 0 {
+		switch c.Op {
+		case policyNe, policyNotIn, policyNotMatches, policyAbsent:
+			return true
+		}
+		return false
+	}
+	for _, v := range values {
+		if !c.holdsFor(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *policyCondition) holdsFor(v string) bool {
+	switch c.Op {
+	case policyPresent:
+		return true
+	case policyEq:
+		return v == c.Value
+	case policyNe:
+		return v != c.Value
+	case policyIn, policyNotIn:
+		for _, value := range c.Values {
+			if v == value {
+				return c.Op == policyIn
+			}
+		}
+		return c.Op == policyNotIn
+	case policyMatches:
+		return c.regex.MatchString(v)
+	case policyNotMatches:
+		return !c.regex.MatchString(v)
+	case policyGt, policyGte, policyLt, policyLte:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		switch c.Op {
+		case policyGt:
+			return n > c.number
+		case policyGte:
+			return n >= c.number
+		case policyLt:
+			return n < c.number
+		}
+		return n <= c.number
+	}
+	return false
+}
+
+// describe returns what c requires of its field
+func (c *policyCondition) describe() string {
+	switch c.Op {
+	case policyPresent:
+		return "is required"
+	case policyAbsent:
+		return "must be empty"
+	case policyEq:
+		return fmt.Sprintf("must be %q", c.Value)
+	case policyNe:
+		return fmt.Sprintf("must not be %q", c.Value)
+	case policyIn:
+		return "must be one of " + strings.Join(c.Values, ", ")
+	case policyNotIn:
+		return "must not be one of " + strings.Join(c.Values, ", ")
+	case policyMatches:
+		return "must match " + c.Value
+	case policyNotMatches:
+		return "must not match " + c.Value
+	case policyGt:
+		return "must be greater than " + c.Value
+	case policyGte:
+		return "must be at least " + c.Value
+	case policyLt:
+		return "must be less than " + c.Value
+	}
+	return "must be at most " + c.Value
+}
+
+// applies reports if every When condition of the rule holds for msg
+func (rule *policyRule) applies(msg map[string]interface{}) bool {
+	for i := range rule.When {
+		if !rule.When[i].holds(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldValues returns the non-blank scalar values at a dot separated path of msg, where * matches every member
+func fieldValues(v interface{}, path string) []string {
+	if path == "" {
+		switch v := v.(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				return []string{v}
+			}
+		case json.Number:
+			return []string{v.String()}
+		case bool, float64:
+			return []string{fmt.Sprint(v)}
+		}
+		return nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	key, rest, _ := strings.Cut(path, ".")
+	if key != "*" {
+		return fieldValues(obj[key], rest)
+	}
+	var out []string
+	for _, elem := range obj {
+		out = append(out, fieldValues(elem, rest)...)
+	}
+	return out
+}
+
+// messageCents returns the {2000} amount of msg in cents
+func messageCents(msg map[string]interface{}) int64 {
+	values := fieldValues(msg, "amount.amount")
+	if len(values) == 0 {
+		return 0
+	}
+	cents, _ := strconv.ParseInt(values[0], 10, 64)
+	return cents
+}
+
+// groupKey returns the values of the fields of msg, messages with the same key share a limit. The values of a
+// field with * are sorted since objects have no order.
+func groupKey(msg map[string]interface{}, fields []string) string {
+	key := make([]string, len(fields))
+	for i, field := range fields {
+		values := fieldValues(msg, field)
+		sort.Strings(values)
+		key[i] = strings.Join(values, ",")
+	}
+	return strings.Join(key, "|")
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// evaluate returns the rules msg violates. approved are the messages of files approved today, which count
+// towards daily limits.
+func (e *policyEngine) evaluate(msg map[string]interface{}, approved []map[string]interface{}) []policyViolation {
+	if e == nil {
+		return nil
+	}
+	var out []policyViolation
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if !rule.applies(msg) {
+			continue
+		}
+		for j := range rule.Require {
+			cond := &rule.Require[j]
+			if !cond.holds(msg) {
+				out = append(out, policyViolation{
+					Rule:        rule.Name,
+					Description: rule.Description,
+					Field:       cond.Field,
+					Message:     cond.Field + " " + cond.describe(),
+				})
+			}
+		}
+		if rule.Limit == nil {
+			continue
+		}
+		total := messageCents(msg)
+		period := ""
+		if rule.Limit.Period == policyPeriodDay {
+			period = " per day"
+			key := groupKey(msg, rule.Limit.Per)
+			for _, other := range approved {
+				if rule.applies(other) && groupKey(other, rule.Limit.Per) == key {
+					total += messageCents(other)
+				}
+			}
+		}
+		if total > rule.Limit.cents {
+			out = append(out, policyViolation{
+				Rule:        rule.Name,
+				Description: rule.Description,
+				Field:       "amount.amount",
+				Message:     fmt.Sprintf("%s is over the limit of %s%s", formatCents(total), formatCents(rule.Limit.cents), period),
+			})
+		}
+	}
+	return out
+}
+
+// approvedToday returns the messages of the files other than file which were approved today
+func (opts *fileRoutesOptions) approvedToday(repo WireFileRepository, file *wire.File) ([]map[string]interface{}, error) {
+	now := opts.policies.now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var out []map[string]interface{}
+	for _, id := range opts.approvals.approvedSince(midnight) {
+		if id == file.ID {
+			continue
+		}
+		f, err := repo.getFile(id)
+		if err != nil {
+			return nil, err
+		}
+		if f == nil {
+			continue
+		}
+		msg, err := toJSONObject(f.FEDWireMessage)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+// hasDailyLimits reports if a rule limits the files of a day
+func (e *policyEngine) hasDailyLimits() bool {
+	for _, rule := range e.rules {
+		if rule.Limit != nil && rule.Limit.Period == policyPeriodDay {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDailyLimits returns an error when a rule limits the files of a day but approval isn't required. Only
+// approved files count towards daily limits, so without approvals every file would be limited alone.
+func (opts *fileRoutesOptions) checkDailyLimits() error {
+	if opts.policies != nil && opts.policies.hasDailyLimits() && !opts.requireApproval {
+		return errors.New("POLICY_RULES_FILE has limits with period: day, they need REQUIRE_APPROVAL")
+	}
+	return nil
+}
+
+// policyViolations returns the policy rules file violates when r's caller creates or approves it. Daily limits
+// count the files approved today when repo isn't nil, otherwise file is limited alone.
+func (opts *fileRoutesOptions) policyViolations(r *http.Request, repo WireFileRepository, file *wire.File) ([]policyViolation, error) {
+	if opts.policies == nil || file == nil {
+		return nil, nil
+	}
+	msg, err := toJSONObject(file.FEDWireMessage)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		msg["caller"] = map[string]interface{}{"id": moovhttp.GetUserID(r)}
+	}
+	var approved []map[string]interface{}
+	if repo != nil && opts.approvals != nil {
+		if approved, err = opts.approvedToday(repo, file); err != nil {
+			return nil, err
+		}
+	}
+	return opts.policies.evaluate(msg, approved), nil
+}
+
+// checkPolicies responds with 400 Bad Request and the violations, and returns errPolicyViolation, when file
+// violates policy rules
+func (opts *fileRoutesOptions) checkPolicies(w http.ResponseWriter, r *http.Request, repo WireFileRepository, file *wire.File) error {
+	violations, err := opts.policyViolations(r, repo, file)
+	if err != nil {
+		moovhttp.Problem(w, err)
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	writeJSON(w, http.StatusBadRequest, validationError{
+		Error:      errPolicyViolation.Error(),
+		Violations: violations,
+	})
+	return errPolicyViolation
+}
+
+// writeInvalidFile responds with 400 Bad Request, the validation error err of file and the policy rules file
+// violates, so callers see every problem of the file at once
+func (opts *fileRoutesOptions) writeInvalidFile(logger log.Logger, w http.ResponseWriter, r *http.Request, repo WireFileRepository, file *wire.File, err error) {
+	recordValidationFailure(err)
+	logger.LogError(err)
+
+	violations, perr := opts.policyViolations(r, repo, file)
+	if perr != nil {
+		moovhttp.Problem(w, logger.LogErrorf("problem checking policy rules: %v", perr).Err())
+		return
+	}
+	resp := newValidationError(err)
+	resp.Violations = violations
+	writeJSON(w, http.StatusBadRequest, resp)
+}
+
+// violationsError returns errPolicyViolation naming the rules of violations, nil when there are none
+func violationsError(violations []policyViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Rule + ": " + v.Message
+	}
+	return fmt.Errorf("%w: %s", errPolicyViolation, strings.Join(messages, "; "))
+}
@@ -0,0 +1,312 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+const mockPolicyRules = `
+rules:
+  - name: blocked-countries
+    description: Sanctioned countries
+    require:
+      - field: remittanceBeneficiary.remittanceData.countryOfResidence
+        op: notIn
+        values: [KP, IR]
+      - field: '*.remittanceData.country'
+        op: notIn
+        values: [KP, IR]
+      - field: originatorOptionF.*
+        op: notMatches
+        value: '^3/(KP|IR)/'
+  - name: remittance-text
+    when:
+      - field: amount.amount
+        op: gt
+        value: 1000000
+    require:
+      - field: originatorToBeneficiary.lineOne
+        op: present
+  - name: acme-functions
+    when:
+      - field: originator.personal.identifier
+        op: eq
+        value: ACME
+    require:
+      - field: businessFunctionCode.businessFunctionCode
+        op: in
+        values: [CTR]
+  - name: beneficiary-daily-limit
+    limit:
+      amount: "20000.00"
+      per: [beneficiary.personal.identifier]
+      period: day
+`
+
+func mockPolicyEngine(t *testing.T, rules string) *policyEngine {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0600))
+	parsed, err := readPolicyRules(path)
+	require.NoError(t, err)
+	engine, err := newPolicyEngine(parsed)
+	require.NoError(t, err)
+	return engine
+}
+
+func policyRuleNames(violations []policyViolation) []string {
+	var out []string
+	for _, v := range violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestPolicies_evaluate(t *testing.T) {
+	engine := mockPolicyEngine(t, mockPolicyRules)
+	evaluate := func(fwm wire.FEDWireMessage) []policyViolation {
+		msg, err := toJSONObject(fwm)
+		require.NoError(t, err)
+		return engine.evaluate(msg, nil)
+	}
+
+	// the mock has remittance text and is under the limit
+	require.Empty(t, evaluate(mockFEDWireMessage()))
+
+	fwm := mockFEDWireMessage()
+	fwm.RemittanceBeneficiary = &wire.RemittanceBeneficiary{RemittanceData: wire.RemittanceData{CountryOfResidence: "IR"}}
+	require.Equal(t, []string{"blocked-countries"}, policyRuleNames(evaluate(fwm)))
+
+	fwm = mockFEDWireMessage()
+	fwm.RemittanceOriginator = &wire.RemittanceOriginator{RemittanceData: wire.RemittanceData{Country: "KP"}}
+	violations := evaluate(fwm)
+	require.Equal(t, []string{"blocked-countries"}, policyRuleNames(violations))
+	require.Equal(t, "*.remittanceData.country", violations[0].Field)
+
+	fwm = mockFEDWireMessage()
+	fwm.OriginatorOptionF = &wire.OriginatorOptionF{Name: "1/Name", LineOne: "3/KP/PYONGYANG"}
+	violations = evaluate(fwm)
+	require.Equal(t, []string{"blocked-countries"}, policyRuleNames(violations))
+	require.Equal(t, "originatorOptionF.*", violations[0].Field)
+	require.Equal(t, "Sanctioned countries", violations[0].Description)
+
+	fwm = mockFEDWireMessage()
+	fwm.OriginatorToBeneficiary = nil
+	require.Equal(t, []string{"remittance-text"}, policyRuleNames(evaluate(fwm)))
+	fwm.Amount.Amount = "000000100000"
+	require.Empty(t, evaluate(fwm))
+
+	fwm = mockFEDWireMessage()
+	fwm.Originator.Personal.Identifier = "ACME"
+	require.Empty(t, evaluate(fwm))
+	fwm.BusinessFunctionCode.BusinessFunctionCode = wire.BankTransfer
+	violations = evaluate(fwm)
+	require.Equal(t, []string{"acme-functions"}, policyRuleNames(violations))
+	require.Equal(t, "businessFunctionCode.businessFunctionCode must be one of CTR", violations[0].Message)
+
+	fwm = mockFEDWireMessage()
+	fwm.Amount.Amount = "000002000001"
+	violations = evaluate(fwm)
+	require.Equal(t, []string{"beneficiary-daily-limit"}, policyRuleNames(violations))
+	require.Equal(t, "20000.01 is over the limit of 20000.00 per day", violations[0].Message)
+}
+
+func TestPolicies_readPolicyRules(t *testing.T) {
+	// JSON is read as well
+	engine := mockPolicyEngine(t, `{"rules": [{"name": "ctr", "require": [{"field": "businessFunctionCode.businessFunctionCode", "op": "eq", "value": "CTR"}]}]}`)
+	require.Len(t, engine.rules, 1)
+
+	for name, rules := range map[string]string{
+		"unknown key":    `rules: [{name: a, require: [{field: amount.amount, op: present}], limits: {}}]`,
+		"no name":        `rules: [{require: [{field: amount.amount, op: present}]}]`,
+		"duplicate name": `rules: [{name: a, require: [{field: amount.amount, op: present}]}, {name: a, require: [{field: amount.amount, op: present}]}]`,
+		"no checks":      `rules: [{name: a}]`,
+		"unknown op":     `rules: [{name: a, require: [{field: amount.amount, op: exists}]}]`,
+		"invalid regex":  `rules: [{name: a, require: [{field: amount.amount, op: matches, value: "("}]}]`,
+		"no values":      `rules: [{name: a, require: [{field: amount.amount, op: in}]}]`,
+		"invalid number": `rules: [{name: a, require: [{field: amount.amount, op: gt, value: lots}]}]`,
+		"invalid limit":  `rules: [{name: a, limit: {amount: lots}}]`,
+		"invalid period": `rules: [{name: a, limit: {amount: "10.00", period: week}}]`,
+		"per caller":     `rules: [{name: a, limit: {amount: "10.00", per: [caller.id], period: day}}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policies.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(rules), 0600))
+			t.Setenv("POLICY_RULES_FILE", path)
+			_, err := readPolicyOptions()
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPolicies_dailyLimit(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	for _, id := range []string{"foo", "bar"} {
+		require.NoError(t, repo.saveFile(&wire.File{ID: id, FEDWireMessage: mockFEDWireMessage()}))
+	}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withPolicyEngine(mockPolicyEngine(t, mockPolicyRules)))
+
+	// each file sends 12345.67, under the limit of 20000.00 alone
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "approve", "checker").Code)
+
+	require.Equal(t, http.StatusOK, transition(t, router, "bar", "submit", "maker").Code)
+	w := transition(t, router, "bar", "approve", "checker")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp validationError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, errPolicyViolation.Error(), resp.Error)
+	require.Equal(t, []string{"beneficiary-daily-limit"}, policyRuleNames(resp.Violations))
+
+	// creating files counts the approved files too
+	w = createFileJSON(t, router, mockFEDWireMessage())
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	other := mockFEDWireMessage()
+	other.Beneficiary.Personal.Identifier = "5678"
+	w = createFileJSON(t, router, other)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestPolicies_validate(t *testing.T) {
+	router := mockConvertRouter(withPolicyEngine(mockPolicyEngine(t, mockPolicyRules)))
+
+	fwm := mockFEDWireMessage()
+	fwm.OriginatorToBeneficiary = nil
+	bs, err := json.Marshal(wire.File{FEDWireMessage: fwm})
+	require.NoError(t, err)
+	w := convertRequest(t, router, "/validate", "application/json", "", bs)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp validationError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, []string{"remittance-text"}, policyRuleNames(resp.Violations))
+
+	// violations are returned alongside validation errors
+	fwm.Amount = nil
+	fwm.RemittanceBeneficiary = &wire.RemittanceBeneficiary{RemittanceData: wire.RemittanceData{CountryOfResidence: "KP"}}
+	bs, err = json.Marshal(wire.File{FEDWireMessage: fwm})
+	require.NoError(t, err)
+	w = convertRequest(t, router, "/validate", "application/json", "", bs)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	resp = validationError{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "Amount", resp.Field)
+	require.Equal(t, []string{"blocked-countries"}, policyRuleNames(resp.Violations))
+}
+
+// mockCallerRules limits the amounts the intern and the inbox can create files for to $1.00
+const mockCallerRules = `
+rules:
+  - name: small-amounts
+    when:
+      - field: caller.id
+        op: in
+        values: [intern, inbox]
+    require:
+      - field: amount.amount
+        op: lte
+        value: 100
+`
+
+func TestPolicies_caller(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}))
+	cycleDate := mockFEDWireMessage().InputMessageAccountabilityData.InputCycleDate
+	router := mux.NewRouter()
+	opts := addFileRoutes(log.NewNopLogger(), router, repo, withPolicyEngine(mockPolicyEngine(t, mockCallerRules)))
+
+	file := wire.File{FEDWireMessage: mockFEDWireMessage()}
+	w := testRequest(t, router, "POST", "/files/create", file, "Content-Type", "application/json", "X-User-ID", "treasury")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// every way of creating files is checked
+	for name, req := range map[string][2]string{
+		"create":   {"/files/create", "application/json"},
+		"resend":   {"/files/original/resend", ""},
+		"reversal": {"/files/original/reversal?businessDay=" + cycleDate, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, router, "POST", req[0], file, "Content-Type", req[1], "X-User-ID", "intern")
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			var resp validationError
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			require.Equal(t, []string{"small-amounts"}, policyRuleNames(resp.Violations))
+		})
+	}
+
+	// violations are returned alongside validation errors
+	invalid := wire.File{FEDWireMessage: mockFEDWireMessage()}
+	invalid.FEDWireMessage.SenderSupplied = nil
+	w = testRequest(t, router, "POST", "/files/create", invalid, "Content-Type", "application/json", "X-User-ID", "intern")
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	var resp validationError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "SenderSupplied", resp.Field)
+	require.Equal(t, []string{"small-amounts"}, policyRuleNames(resp.Violations))
+
+	// and every way of modifying them
+	for name, req := range map[string][2]string{
+		"add":   {"POST", `{"senderReference": {"senderReference": "Changed"}}`},
+		"patch": {"PATCH", `{"senderReference": {"senderReference": "Changed"}}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, router, req[0], "/files/original/FEDWireMessage", req[1], "Content-Type", "application/json", "X-User-ID", "intern")
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			var resp validationError
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			require.Equal(t, []string{"small-amounts"}, policyRuleNames(resp.Violations))
+		})
+	}
+
+	// files of the inbox are created by the inbox
+	iw, inboxRepo := mockInbox(t, opts)
+	dropTransfer(t, iw, "transfer.txt")
+	require.NoError(t, iw.scan())
+	files, err := inboxRepo.getFiles()
+	require.NoError(t, err)
+	require.Empty(t, files)
+	for _, name := range readDirNames(t, iw.errorDir) {
+		if strings.HasSuffix(name, ".error.json") {
+			bs, err := os.ReadFile(filepath.Join(iw.errorDir, name))
+			require.NoError(t, err)
+			require.Contains(t, string(bs), "small-amounts")
+		}
+	}
+	require.Len(t, readDirNames(t, iw.errorDir), 2)
+}
+
+func TestPolicies_groupKey(t *testing.T) {
+	msg := map[string]interface{}{
+		"originatorOptionF": map[string]interface{}{"name": "1/Name", "lineOne": "2/Street", "lineTwo": "3/US/City"},
+	}
+	for i := 0; i < 20; i++ {
+		require.Equal(t, "1/Name,2/Street,3/US/City", groupKey(msg, []string{"originatorOptionF.*"}))
+	}
+}
+
+func TestPolicies_checkDailyLimits(t *testing.T) {
+	engine := mockPolicyEngine(t, mockPolicyRules)
+	opts := &fileRoutesOptions{policies: engine}
+	require.Error(t, opts.checkDailyLimits())
+
+	opts.requireApproval = true
+	require.NoError(t, opts.checkDailyLimits())
+
+	opts = &fileRoutesOptions{policies: mockPolicyEngine(t, mockCallerRules)}
+	require.NoError(t, opts.checkDailyLimits())
+	require.NoError(t, (&fileRoutesOptions{}).checkDailyLimits())
+}
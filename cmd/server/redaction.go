@@ -0,0 +1,81 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/wire"
+)
+
+// withMaskedResponses masks every file rendered as JSON, regardless of the `mask` query param
+func withMaskedResponses() fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.maskResponses = true
+	}
+}
+
+// withRedactionPolicy sets the policy used to mask files
+func withRedactionPolicy(policy wire.RedactionPolicy) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.redactionPolicy = policy
+	}
+}
+
+// defaultRedactionPolicy returns wire.DefaultRedactionPolicy with a random hash key, so hashed identifiers can't be
+// reversed by brute force. Hashes only correlate within the process unless MASK_HASH_KEY is set.
+func defaultRedactionPolicy() wire.RedactionPolicy {
+	policy := wire.DefaultRedactionPolicy()
+	policy.HashKey = base.ID()
+	return policy
+}
+
+// readRedactionOptions returns the file route options configured by MASK_RESPONSES and MASK_HASH_KEY
+func readRedactionOptions() ([]fileRoutesOption, error) {
+	var opts []fileRoutesOption
+	if v := os.Getenv("MASK_RESPONSES"); v != "" {
+		mask, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MASK_RESPONSES: %v", err)
+		}
+		if mask {
+			opts = append(opts, withMaskedResponses())
+		}
+	}
+	policy := defaultRedactionPolicy()
+	if key := os.Getenv("MASK_HASH_KEY"); key != "" {
+		policy.HashKey = key
+	}
+	opts = append(opts, withRedactionPolicy(policy))
+	return opts, nil
+}
+
+// masking reports if files in the response to r are masked, either because the server masks every
+// response or the `mask` query param was set to true.
+func (opts *fileRoutesOptions) masking(r *http.Request) (bool, error) {
+	if opts.maskResponses {
+		return true, nil
+	}
+	if v := r.URL.Query().Get("mask"); v != "" {
+		mask, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("invalid mask: %v", err)
+		}
+		return mask, nil
+	}
+	return false, nil
+}
+
+// redact returns file masked by the redaction policy when mask is true
+func (opts *fileRoutesOptions) redact(file *wire.File, mask bool) *wire.File {
+	if !mask || file == nil {
+		return file
+	}
+	return file.Redact(opts.redactionPolicy)
+}
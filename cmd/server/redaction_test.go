@@ -0,0 +1,125 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockRedactionRepository() *testWireFileRepository {
+	fwm := mockFEDWireMessage()
+	ben := wire.NewBeneficiary()
+	ben.Personal.IdentificationCode = wire.DemandDepositAccountNumber
+	ben.Personal.Identifier = "123456789"
+	ben.Personal.Name = "Jane Doe"
+	ben.Personal.Address.AddressLineOne = "1 Main St"
+	fwm.Beneficiary = ben
+	return &testWireFileRepository{
+		file: &wire.File{
+			ID:             base.ID(),
+			FEDWireMessage: fwm,
+		},
+	}
+}
+
+func TestRedaction_getFile(t *testing.T) {
+	repo := mockRedactionRepository()
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	t.Run("unmasked", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo", nil))
+		w.Flush()
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+		var file wire.File
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+		assert.Equal(t, "123456789", file.FEDWireMessage.Beneficiary.Personal.Identifier)
+	})
+
+	t.Run("masked", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo?mask=true", nil))
+		w.Flush()
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+		var file wire.File
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+		assert.Equal(t, "*****6789", file.FEDWireMessage.Beneficiary.Personal.Identifier)
+		assert.Equal(t, "J*** D**", file.FEDWireMessage.Beneficiary.Personal.Name)
+		assert.Empty(t, file.FEDWireMessage.Beneficiary.Personal.Address.AddressLineOne)
+
+		// the stored file isn't modified
+		assert.Equal(t, "123456789", repo.file.FEDWireMessage.Beneficiary.Personal.Identifier)
+	})
+
+	t.Run("invalid mask", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo?mask=maybe", nil))
+		w.Flush()
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+}
+
+func TestRedaction_maskResponses(t *testing.T) {
+	repo := mockRedactionRepository()
+	router := mux.NewRouter()
+	policy := wire.DefaultRedactionPolicy()
+	policy.Names = wire.RedactDrop
+	addFileRoutes(log.NewNopLogger(), router, repo, withMaskedResponses(), withRedactionPolicy(policy))
+
+	// the query param can't turn masking off
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files?mask=false", nil))
+	w.Flush()
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	var files []*wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&files))
+	require.Len(t, files, 1)
+	assert.Equal(t, "*****6789", files[0].FEDWireMessage.Beneficiary.Personal.Identifier)
+	assert.Empty(t, files[0].FEDWireMessage.Beneficiary.Personal.Name)
+}
+
+func TestRedaction_readRedactionOptions(t *testing.T) {
+	t.Setenv("MASK_RESPONSES", "true")
+	t.Setenv("MASK_HASH_KEY", "secret")
+
+	options, err := readRedactionOptions()
+	require.NoError(t, err)
+	opts := &fileRoutesOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	assert.True(t, opts.maskResponses)
+	assert.Equal(t, "secret", opts.redactionPolicy.HashKey)
+	assert.Equal(t, wire.RedactLastFour, opts.redactionPolicy.AccountNumbers)
+
+	// without a key each process hashes with a random one
+	t.Setenv("MASK_HASH_KEY", "")
+	options, err = readRedactionOptions()
+	require.NoError(t, err)
+	for _, opt := range options {
+		opt(opts)
+	}
+	assert.NotEmpty(t, opts.redactionPolicy.HashKey)
+	assert.NotEqual(t, defaultRedactionPolicy().HashKey, opts.redactionPolicy.HashKey)
+
+	t.Setenv("MASK_RESPONSES", "sometimes")
+	_, err = readRedactionOptions()
+	require.Error(t, err)
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+var (
+	errNotReversal      = errors.New("FEDWireMessage is not a reversal or request for reversal")
+	errOriginalNotFound = errors.New("original FEDWireMessage not found")
+)
+
+// readReversal returns the reversal builder and business day from the `kind` and `businessDay` query params.
+// kind is "reversal" (the default) or "request" and businessDay (CCYYMMDD) defaults to today.
+func readReversal(r *http.Request) (func(wire.FEDWireMessage, time.Time) (wire.FEDWireMessage, error), time.Time, error) {
+	businessDay := time.Now()
+	if v := r.URL.Query().Get("businessDay"); v != "" {
+		day, err := time.Parse("20060102", v)
+		if err != nil {
+			return nil, businessDay, fmt.Errorf("invalid businessDay: %s", v)
+		}
+		businessDay = day
+	}
+	switch kind := strings.ToLower(r.URL.Query().Get("kind")); kind {
+	case "", "reversal":
+		return wire.NewReversal, businessDay, nil
+	case "request":
+		return wire.NewRequestForReversal, businessDay, nil
+	default:
+		return nil, businessDay, fmt.Errorf("unknown reversal kind: %s", kind)
+	}
+}
+
+// findOriginalFile returns the file holding the FEDWireMessage whose IMAD is the PreviousMessageIdentifier of fwm
+func findOriginalFile(repo WireFileRepository, fwm wire.FEDWireMessage) (*wire.File, error) {
+	if fwm.PreviousMessageIdentifier == nil {
+		return nil, errNotReversal
+	}
+	pmi := strings.TrimSpace(fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+
+	files, err := repo.getFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		imad := file.FEDWireMessage.InputMessageAccountabilityData
+		if imad != nil && strings.TrimSpace(imad.Identifier()) == pmi {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+// createReversal builds a reversal, or request for reversal, of the file's FEDWireMessage and saves it as a new file.
+// The IMAD InputSource and InputSequenceNumber are read from the `inputSource` and `inputSequenceNumber` query params.
+func createReversal(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		build, businessDay, err := readReversal(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid reversal request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		original, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if original == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		fwm, err := build(original.FEDWireMessage, businessDay)
+		if err != nil {
+			err = logger.LogErrorf("problem building reversal: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		fwm.InputMessageAccountabilityData.InputSource = r.URL.Query().Get("inputSource")
+		fwm.InputMessageAccountabilityData.InputSequenceNumber = r.URL.Query().Get("inputSequenceNumber")
+
+		file := wire.NewFile()
+		file.ID = base.ID()
+		file.AddFEDWireMessage(fwm)
+		if err := opts.checkEnvironment(file); err != nil {
+			err = logger.LogErrorf("reversal rejected: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, file); err != nil {
+			logger.LogErrorf("reversal rejected: %v", err)
+			return
+		}
+		if err := repo.saveFile(file); err != nil {
+			err = logger.LogErrorf("problem saving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Set("reversalFileID", log.String(file.ID)).Log("created reversal")
+		opts.recordCreated(logger, r, file, "reversal of "+fileId)
+		opts.notifyCreated(logger, r, file)
+
+		recordFileCreated(file)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(opts.redact(file, mask))
+	}
+}
+
+// validateReversal checks the file's FEDWireMessage is a reversal, or request for reversal, of a FEDWireMessage
+// held in the repository
+func validateReversal(logger log.Logger, repo WireFileRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		original, err := findOriginalFile(repo, file.FEDWireMessage)
+		if err != nil {
+			err = logger.LogErrorf("error finding original file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if original == nil {
+			err = logger.LogErrorf("reversal was invalid: %v", errOriginalNotFound).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger = logger.Set("originalFileID", log.String(original.ID))
+
+		if err := file.FEDWireMessage.ValidateReversalOf(original.FEDWireMessage); err != nil {
+			err = logger.LogErrorf("reversal was invalid: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		logger.Log("validated reversal")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(`{"error": null}`)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReversals(t *testing.T) {
+	repo := &memoryWireFileRepository{
+		files: make(map[string]*wire.File),
+	}
+	original := &wire.File{ID: "original", FEDWireMessage: mockFEDWireMessage()}
+	require.NoError(t, repo.saveFile(original))
+	cycleDate := original.FEDWireMessage.InputMessageAccountabilityData.InputCycleDate
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	createReversal := func(t *testing.T, query string) *wire.File {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/files/original/reversal?"+query, nil))
+		w.Flush()
+		require.Equal(t, http.StatusCreated, w.Code, w.Body)
+
+		var file wire.File
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+		return &file
+	}
+
+	t.Run("reversal", func(t *testing.T) {
+		file := createReversal(t, "businessDay="+cycleDate+"&inputSource=Source09&inputSequenceNumber=000002")
+		fwm := file.FEDWireMessage
+		assert.Equal(t, wire.ReversalTransfer, fwm.TypeSubType.SubTypeCode)
+		assert.Equal(t, cycleDate+"Source09000002", fwm.InputMessageAccountabilityData.Identifier())
+		assert.Equal(t, original.FEDWireMessage.InputMessageAccountabilityData.Identifier(),
+			fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+file.ID+"/reversal/validate", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+	})
+
+	t.Run("request for reversal", func(t *testing.T) {
+		file := createReversal(t, "kind=request")
+		assert.Equal(t, wire.RequestReversal, file.FEDWireMessage.TypeSubType.SubTypeCode)
+		assert.Equal(t, wire.BFCServiceMessage, file.FEDWireMessage.BusinessFunctionCode.BusinessFunctionCode)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+file.ID+"/reversal/validate", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusOK, w.Code, w.Body)
+	})
+
+	t.Run("mismatched reversal", func(t *testing.T) {
+		file := createReversal(t, "")
+		file.FEDWireMessage.Amount.Amount = "000000000001"
+		require.NoError(t, repo.saveFile(file))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+file.ID+"/reversal/validate", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+		assert.Contains(t, w.Body.String(), wire.ErrReversalMismatch.Error())
+	})
+
+	t.Run("original not held", func(t *testing.T) {
+		file := createReversal(t, "")
+		file.FEDWireMessage.PreviousMessageIdentifier.PreviousMessageIdentifier = "20190410Source08999999"
+		require.NoError(t, repo.saveFile(file))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/"+file.ID+"/reversal/validate", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+		assert.Contains(t, w.Body.String(), errOriginalNotFound.Error())
+	})
+
+	t.Run("before the original", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/files/original/reversal?businessDay=20000101", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		for _, query := range []string{"kind=refund", "businessDay=2020-01-01"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/files/original/reversal?"+query, nil))
+			w.Flush()
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/files/missing/reversal", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/files/missing/reversal/validate", nil))
+		w.Flush()
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestReversals_repoError(t *testing.T) {
+	repo := &testWireFileRepository{err: errors.New("bad error")}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/files/foo/reversal", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/files/foo/reversal/validate", nil))
+	w.Flush()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
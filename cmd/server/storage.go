@@ -2,21 +2,50 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/moov-io/wire"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// defaultMaxFileVersions is the number of versions kept of each file unless FILE_MAX_VERSIONS is set
+const defaultMaxFileVersions = 100
+
+var errVersionConflict = errors.New("file was modified by another request")
+
 type WireFileRepository interface {
 	getFiles() ([]*wire.File, error)
 	getFile(fileId string) (*wire.File, error)
+	// getFileVersion returns a saved version of the file, or nil when it doesn't exist. The first version is 1.
+	getFileVersion(fileId string, version int) (*wire.File, error)
+	// fileVersion returns the current version of the file, or 0 when it doesn't exist
+	fileVersion(fileId string) (int, error)
 
 	saveFile(file *wire.File) error
+	// saveFileVersion saves the file if its current version is version, otherwise errVersionConflict is returned
+	saveFileVersion(file *wire.File, version int) error
 	deleteFile(fileId string) error
 }
 
+// memoryWireFileRepository holds the latest maxVersions versions of files in memory, so memory grows with the
+// number of files times their versions. Files are copied when saved and returned, so callers never share tags
+// with the stored files and listing files copies each of them.
 type memoryWireFileRepository struct {
 	mu    sync.Mutex
 	files map[string]*wire.File
+
+	// versions are the kept versions of each file, oldest first
+	versions map[string][]*wire.File
+	// dropped is the number of the oldest versions of each file which were dropped, so version numbers don't change
+	dropped map[string]int
+	// maxVersions is the number of versions kept of each file, every version is kept when it's zero
+	maxVersions int
+
+	// imadSequences are the IMAD sequence numbers allocated for each input source and cycle date, number n is
+	// at index n-1
+	imadSequences map[string][]imadSequence
 }
 
 func (r *memoryWireFileRepository) getFiles() ([]*wire.File, error) {
@@ -25,8 +54,11 @@ func (r *memoryWireFileRepository) getFiles() ([]*wire.File, error) {
 
 	var out []*wire.File
 	for _, v := range r.files {
-		f := *v
-		out = append(out, &f)
+		f, err := v.Copy()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
 	}
 	return out, nil
 }
@@ -37,21 +69,82 @@ func (r *memoryWireFileRepository) getFile(fileId string) (*wire.File, error) {
 
 	for i := range r.files {
 		if r.files[i].ID == fileId {
-			f := *r.files[i]
-			return &f, nil
+			return r.files[i].Copy()
 		}
 	}
 	return nil, nil
 }
 
+func (r *memoryWireFileRepository) getFileVersion(fileId string, version int) (*wire.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.versions[fileId]
+	i := version - 1 - r.dropped[fileId]
+	if i < 0 || i >= len(versions) {
+		return nil, nil
+	}
+	return versions[i].Copy()
+}
+
+func (r *memoryWireFileRepository) fileVersion(fileId string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.currentVersion(fileId), nil
+}
+
+// currentVersion returns the number of versions of a file. Files added to files directly are their first version.
+func (r *memoryWireFileRepository) currentVersion(fileId string) int {
+	if _, ok := r.files[fileId]; !ok {
+		return 0
+	}
+	if n := len(r.versions[fileId]); n > 0 {
+		return r.dropped[fileId] + n
+	}
+	return 1
+}
+
 func (r *memoryWireFileRepository) saveFile(file *wire.File) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	return r.save(file)
+}
+
+func (r *memoryWireFileRepository) saveFileVersion(file *wire.File, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.currentVersion(file.ID) != version {
+		return errVersionConflict
+	}
+	return r.save(file)
+}
+
+func (r *memoryWireFileRepository) save(file *wire.File) error {
 	if file.ID == "" {
 		return errors.New("empty Wire File ID")
 	}
-	r.files[file.ID] = file
+	f, err := file.Copy()
+	if err != nil {
+		return err
+	}
+	if r.versions == nil {
+		r.versions = make(map[string][]*wire.File)
+	}
+	if existing, ok := r.files[file.ID]; ok && len(r.versions[file.ID]) == 0 {
+		r.versions[file.ID] = []*wire.File{existing}
+	}
+	r.files[file.ID] = f
+	r.versions[file.ID] = append(r.versions[file.ID], f)
+	if n := len(r.versions[file.ID]) - r.maxVersions; r.maxVersions > 0 && n > 0 {
+		if r.dropped == nil {
+			r.dropped = make(map[string]int)
+		}
+		r.dropped[file.ID] += n
+		r.versions[file.ID] = append([]*wire.File(nil), r.versions[file.ID][n:]...)
+	}
 	return nil
 }
 
@@ -64,6 +157,74 @@ func (r *memoryWireFileRepository) deleteFile(fileId string) error {
 	}
 
 	delete(r.files, fileId)
+	delete(r.versions, fileId)
+	delete(r.dropped, fileId)
 
 	return nil
 }
+
+// readMaxFileVersions returns the number of versions kept of each file, read from FILE_MAX_VERSIONS
+func readMaxFileVersions() (int, error) {
+	v := os.Getenv("FILE_MAX_VERSIONS")
+	if v == "" {
+		return defaultMaxFileVersions, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid FILE_MAX_VERSIONS: %q", v)
+	}
+	return n, nil
+}
+
+func imadKey(source, cycleDate string) string {
+	return source + "|" + cycleDate
+}
+
+func (r *memoryWireFileRepository) allocateIMADSequence(source, cycleDate string) (imadSequence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.imadSequences == nil {
+		r.imadSequences = make(map[string][]imadSequence)
+	}
+	key := imadKey(source, cycleDate)
+	if len(r.imadSequences[key]) >= maxIMADSequence {
+		return imadSequence{}, errIMADSequenceExhausted
+	}
+	seq := imadSequence{
+		InputSource: source,
+		CycleDate:   cycleDate,
+		Sequence:    len(r.imadSequences[key]) + 1,
+		Status:      imadAllocated,
+		AllocatedAt: time.Now(),
+	}
+	r.imadSequences[key] = append(r.imadSequences[key], seq)
+	return seq, nil
+}
+
+func (r *memoryWireFileRepository) updateIMADSequence(source, cycleDate string, sequence int, status, fileID string) (imadSequence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sequences := r.imadSequences[imadKey(source, cycleDate)]
+	if sequence < 1 || sequence > len(sequences) {
+		return imadSequence{}, errIMADSequenceNotFound
+	}
+	seq := &sequences[sequence-1]
+	if err := checkIMADTransition(seq.Status, status); err != nil {
+		return imadSequence{}, err
+	}
+	seq.Status = status
+	if status == imadUsed {
+		seq.FileID = fileID
+	}
+	return *seq, nil
+}
+
+func (r *memoryWireFileRepository) getIMADSequences(source, cycleDate string) ([]imadSequence, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sequences := r.imadSequences[imadKey(source, cycleDate)]
+	return append([]imadSequence(nil), sequences...), nil
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"testing"
+
 	"github.com/moov-io/base"
 	"github.com/moov-io/wire"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
 type testWireFileRepository struct {
@@ -33,6 +35,24 @@ func (r *testWireFileRepository) saveFile(file *wire.File) error {
 	return r.err
 }
 
+func (r *testWireFileRepository) getFileVersion(fileId string, version int) (*wire.File, error) {
+	if r.err != nil || version != 1 {
+		return nil, r.err
+	}
+	return r.file, nil
+}
+
+func (r *testWireFileRepository) fileVersion(fileId string) (int, error) {
+	if r.err != nil || r.file == nil {
+		return 0, r.err
+	}
+	return 1, nil
+}
+
+func (r *testWireFileRepository) saveFileVersion(file *wire.File, version int) error {
+	return r.saveFile(file)
+}
+
 func (r *testWireFileRepository) deleteFile(fileId string) error {
 	return r.err
 }
@@ -78,3 +98,127 @@ func TestMemoryStorage(t *testing.T) {
 		t.Errorf("files=%#v error=%v", files, err)
 	}
 }
+
+func TestMemoryStorage_versions(t *testing.T) {
+	repo := &memoryWireFileRepository{
+		files: make(map[string]*wire.File),
+	}
+	fwm := mockFEDWireMessage()
+	file := &wire.File{ID: "foo", FEDWireMessage: fwm}
+	require.NoError(t, repo.saveFile(file))
+
+	// saved and returned files don't share tags with the stored file
+	file.FEDWireMessage.Amount.Amount = "000000000001"
+	got, err := repo.getFile("foo")
+	require.NoError(t, err)
+	require.Equal(t, "000001234567", got.FEDWireMessage.Amount.Amount)
+	got.FEDWireMessage.Amount.Amount = "000000000002"
+	got2, err := repo.getFile("foo")
+	require.NoError(t, err)
+	require.Equal(t, "000001234567", got2.FEDWireMessage.Amount.Amount)
+
+	version, err := repo.fileVersion("foo")
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	require.NoError(t, repo.saveFileVersion(got, 1))
+	require.Equal(t, errVersionConflict, repo.saveFileVersion(got, 1))
+
+	v1, err := repo.getFileVersion("foo", 1)
+	require.NoError(t, err)
+	require.Equal(t, "000001234567", v1.FEDWireMessage.Amount.Amount)
+	v2, err := repo.getFileVersion("foo", 2)
+	require.NoError(t, err)
+	require.Equal(t, "000000000002", v2.FEDWireMessage.Amount.Amount)
+	v3, err := repo.getFileVersion("foo", 3)
+	require.NoError(t, err)
+	require.Nil(t, v3)
+
+	require.NoError(t, repo.deleteFile("foo"))
+	version, err = repo.fileVersion("foo")
+	require.NoError(t, err)
+	require.Equal(t, 0, version)
+	v1, err = repo.getFileVersion("foo", 1)
+	require.NoError(t, err)
+	require.Nil(t, v1)
+}
+
+func TestMemoryStorage_maxVersions(t *testing.T) {
+	repo := &memoryWireFileRepository{
+		files:       make(map[string]*wire.File),
+		maxVersions: 2,
+	}
+	file := &wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}
+	for _, amount := range []string{"000000000001", "000000000002", "000000000003"} {
+		file.FEDWireMessage.Amount.Amount = amount
+		require.NoError(t, repo.saveFile(file))
+	}
+	require.Len(t, repo.versions["foo"], 2)
+
+	// version numbers don't change as the oldest versions are dropped
+	version, err := repo.fileVersion("foo")
+	require.NoError(t, err)
+	require.Equal(t, 3, version)
+	v1, err := repo.getFileVersion("foo", 1)
+	require.NoError(t, err)
+	require.Nil(t, v1)
+	v2, err := repo.getFileVersion("foo", 2)
+	require.NoError(t, err)
+	require.Equal(t, "000000000002", v2.FEDWireMessage.Amount.Amount)
+	require.NoError(t, repo.saveFileVersion(v2, 3))
+	require.Equal(t, errVersionConflict, repo.saveFileVersion(v2, 3))
+
+	t.Setenv("FILE_MAX_VERSIONS", "")
+	n, err := readMaxFileVersions()
+	require.NoError(t, err)
+	require.Equal(t, defaultMaxFileVersions, n)
+	t.Setenv("FILE_MAX_VERSIONS", "5")
+	n, err = readMaxFileVersions()
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	t.Setenv("FILE_MAX_VERSIONS", "0")
+	_, err = readMaxFileVersions()
+	require.Error(t, err)
+}
+
+func TestMemoryStorage_imadSequences(t *testing.T) {
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+
+	for i := 1; i <= 3; i++ {
+		seq, err := repo.allocateIMADSequence("SOURCE01", "20261019")
+		require.NoError(t, err)
+		require.Equal(t, i, seq.Sequence)
+		require.Equal(t, imadAllocated, seq.Status)
+	}
+	// sequences are per source and cycle date
+	seq, err := repo.allocateIMADSequence("SOURCE02", "20261019")
+	require.NoError(t, err)
+	require.Equal(t, 1, seq.Sequence)
+	seq, err = repo.allocateIMADSequence("SOURCE01", "20261020")
+	require.NoError(t, err)
+	require.Equal(t, 1, seq.Sequence)
+
+	seq, err = repo.updateIMADSequence("SOURCE01", "20261019", 2, imadUsed, "foo")
+	require.NoError(t, err)
+	require.Equal(t, "foo", seq.FileID)
+	_, err = repo.updateIMADSequence("SOURCE01", "20261019", 3, imadVoided, "")
+	require.NoError(t, err)
+
+	// used and voided numbers are final
+	_, err = repo.updateIMADSequence("SOURCE01", "20261019", 2, imadVoided, "")
+	require.ErrorIs(t, err, errIMADSequenceStatus)
+	_, err = repo.updateIMADSequence("SOURCE01", "20261019", 1, imadAllocated, "")
+	require.ErrorIs(t, err, errIMADSequenceStatus)
+	_, err = repo.updateIMADSequence("SOURCE01", "20261019", 4, imadUsed, "bar")
+	require.ErrorIs(t, err, errIMADSequenceNotFound)
+
+	sequences, err := repo.getIMADSequences("SOURCE01", "20261019")
+	require.NoError(t, err)
+	require.Len(t, sequences, 3)
+	require.Equal(t, []string{imadAllocated, imadUsed, imadVoided}, []string{sequences[0].Status, sequences[1].Status, sequences[2].Status})
+
+	// numbers after the last aren't allocated
+	repo.imadSequences[imadKey("FULL", "20261019")] = make([]imadSequence, maxIMADSequence)
+	_, err = repo.allocateIMADSequence("FULL", "20261019")
+	require.ErrorIs(t, err, errIMADSequenceExhausted)
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+var (
+	errNoTag         = errors.New("no tag found")
+	errNotJSONObject = errors.New("request body must be a JSON object")
+)
+
+// messageUpdate is the response of modifying a file's FEDWireMessage. The file is saved even when it's invalid
+// so it can be corrected one tag at a time.
+type messageUpdate struct {
+	File  *wire.File `json:"file"`
+	Valid bool       `json:"valid"`
+	Error string     `json:"error,omitempty"`
+}
+
+// getTagName returns the JSON field name of the `tag` path param, e.g. beneficiary for 4200
+func getTagName(w http.ResponseWriter, r *http.Request) string {
+	v, ok := mux.Vars(r)["tag"]
+	if !ok || v == "" {
+		moovhttp.Problem(w, errNoTag)
+		return ""
+	}
+	name, err := wire.TagFieldName(v)
+	if err != nil {
+		moovhttp.Problem(w, err)
+		return ""
+	}
+	return name
+}
+
+// getTag returns a tag of the file's FEDWireMessage
+func getTag(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		name := getTagName(w, r)
+		if name == "" {
+			logger.LogError(errNoTag)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId)).Set("tag", log.String(name))
+
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		fields, err := toJSONObject(opts.redact(file, mask).FEDWireMessage)
+		if err != nil {
+			err = logger.LogErrorf("problem reading FEDWireMessage: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		tag, ok := fields[name]
+		if !ok || tag == nil {
+			logger.Log("tag not found")
+			http.NotFound(w, r)
+			return
+		}
+		opts.recordAudit(logger, r, auditRead, fileId, file, file, "read "+name)
+
+		logger.Log("rendering tag")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tag)
+	}
+}
+
+// putTag replaces a tag of the file's FEDWireMessage with the request body
+func putTag(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return updateMessage(logger, repo, opts, func(r *http.Request, name string, fields map[string]interface{}) (string, error) {
+		body, err := decodeJSONObject(r)
+		if err != nil {
+			return "", err
+		}
+		fields[name] = body
+		return "replaced " + name, nil
+	})
+}
+
+// patchTag applies the JSON Merge Patch of the request body to a tag of the file's FEDWireMessage
+func patchTag(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return updateMessage(logger, repo, opts, func(r *http.Request, name string, fields map[string]interface{}) (string, error) {
+		patch, err := decodeJSONObject(r)
+		if err != nil {
+			return "", err
+		}
+		fields[name] = mergePatch(fields[name], patch)
+		return "patched " + name, nil
+	})
+}
+
+// deleteTag removes a tag from the file's FEDWireMessage
+func deleteTag(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return updateMessage(logger, repo, opts, func(r *http.Request, name string, fields map[string]interface{}) (string, error) {
+		delete(fields, name)
+		return "deleted " + name, nil
+	})
+}
+
+// patchFEDWireMessage applies the JSON Merge Patch of the request body to the file's FEDWireMessage
+func patchFEDWireMessage(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return updateMessage(logger, repo, opts, func(r *http.Request, _ string, fields map[string]interface{}) (string, error) {
+		patch, err := decodeJSONObject(r)
+		if err != nil {
+			return "", err
+		}
+		mergePatch(fields, patch) // merges into fields
+		return "patched FEDWireMessage", nil
+	})
+}
+
+// decodeJSONObject reads a JSON object from the request body
+func decodeJSONObject(r *http.Request) (map[string]interface{}, error) {
+	v, err := decodeJSON(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errNotJSONObject
+	}
+	return obj, nil
+}
+
+// updateMessage modifies the JSON fields of a draft file's FEDWireMessage with update, saves the file and
+// responds with it and the result of validating it. update is called with the JSON field name of the `tag` path
+// param, when set, and returns a description of the change for the audit log.
+func updateMessage(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions, update func(r *http.Request, name string, fields map[string]interface{}) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId))
+
+		var name string
+		if _, ok := mux.Vars(r)["tag"]; ok {
+			if name = getTagName(w, r); name == "" {
+				logger.LogError(errNoTag)
+				return
+			}
+			logger = logger.Set("tag", log.String(name))
+		}
+
+		version, err := repo.fileVersion(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		file, err := repo.getFile(fileId)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file not found")
+			http.NotFound(w, r)
+			return
+		}
+		if err := opts.checkDraft(fileId); err != nil {
+			err = logger.LogErrorf("file can't be modified: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := checkIfMatch(r, version); err != nil {
+			writeProblem(w, http.StatusPreconditionFailed, logger.LogError(err).Err())
+			return
+		}
+
+		fields, err := toJSONObject(file.FEDWireMessage)
+		if err != nil {
+			err = logger.LogErrorf("problem reading FEDWireMessage: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		original, err := toJSONObject(file.FEDWireMessage)
+		if err != nil {
+			err = logger.LogErrorf("problem reading FEDWireMessage: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		detail, err := update(r, name, fields)
+		if err != nil {
+			err = logger.LogErrorf("error reading request body: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		bs, err := json.Marshal(fields)
+		if err != nil {
+			err = logger.LogErrorf("problem updating FEDWireMessage: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		var fwm wire.FEDWireMessage
+		if err := json.Unmarshal(bs, &fwm); err != nil {
+			err = logger.LogErrorf("problem updating FEDWireMessage: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		before := *file
+		file.FEDWireMessage = fwm
+		if err := opts.checkLockedFields(fileId, before.FEDWireMessage, fwm); err != nil {
+			writeProblem(w, http.StatusConflict, logger.LogErrorf("FEDWireMessage rejected: %v", err).Err())
+			return
+		}
+		if err := opts.checkEnvironment(file); err != nil {
+			err = logger.LogErrorf("FEDWireMessage rejected: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, file); err != nil {
+			logger.LogErrorf("FEDWireMessage rejected: %v", err)
+			return
+		}
+		if err := repo.saveFileVersion(file, version); err != nil {
+			if errors.Is(err, errVersionConflict) {
+				writeProblem(w, http.StatusPreconditionFailed, logger.LogError(err).Err())
+				return
+			}
+			err = logger.LogErrorf("error saving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger.Log(detail)
+		opts.recordAudit(logger, r, auditModified, fileId, &before, file, detail)
+		opts.notifyWebhooks(logger, r, eventFileModified, fileId, nil)
+
+		resp := messageUpdate{Valid: true}
+		err = validateChangedTags(&file.FEDWireMessage, original, fields)
+		if err != nil {
+			logger.Logf("tag is invalid: %v", err)
+		} else if err = file.ValidateWith(&wire.ValidateOpts{Environment: opts.environment}); err != nil {
+			logger.Logf("file is invalid: %v", err)
+		}
+		if err != nil {
+			recordValidationFailure(err)
+			opts.notifyWebhooks(logger, r, eventFileValidationFailed, fileId, err)
+			resp.Valid = false
+			resp.Error = err.Error()
+		} else {
+			opts.notifyWebhooks(logger, r, eventFileValidated, fileId, nil)
+		}
+		resp.File = opts.redact(file, mask)
+		writeFileVersion(w, version+1)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// validateChangedTags validates the tags whose JSON differs between before and after on their own, which
+// validating the file doesn't do
+func validateChangedTags(fwm *wire.FEDWireMessage, before, after map[string]interface{}) error {
+	var changed []string
+	for k := range after {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	for _, tag := range changed {
+		if err := fwm.ValidateTag(tag); err != nil && !errors.Is(err, wire.ErrUnknownTag) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tagRequest(t *testing.T, router *mux.Router, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func readMessageUpdate(t *testing.T, w *httptest.ResponseRecorder) messageUpdate {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	var resp messageUpdate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	return resp
+}
+
+func TestTags_get(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	for _, tag := range []string{"4200", "{4200}", "beneficiary"} {
+		w := tagRequest(t, router, "GET", "/files/foo/tags/"+tag, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+
+		var ben wire.Beneficiary
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&ben))
+		assert.Equal(t, "1234", ben.Personal.Identifier)
+	}
+
+	w := tagRequest(t, router, "GET", "/files/foo/tags/4200?mask=true", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.NotContains(t, w.Body.String(), "Address One")
+
+	assert.Equal(t, http.StatusNotFound, tagRequest(t, router, "GET", "/files/foo/tags/9000", "").Code)
+	assert.Equal(t, http.StatusNotFound, tagRequest(t, router, "GET", "/files/missing/tags/4200", "").Code)
+	assert.Equal(t, http.StatusBadRequest, tagRequest(t, router, "GET", "/files/foo/tags/4201", "").Code)
+}
+
+func TestTags_update(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	// fix one line of the beneficiary's address
+	resp := readMessageUpdate(t, tagRequest(t, router, "PATCH", "/files/foo/tags/4200", `{"personal": {"address": {"addressLineTwo": "Suite 100"}}}`))
+	assert.True(t, resp.Valid, resp.Error)
+	ben := resp.File.FEDWireMessage.Beneficiary
+	assert.Equal(t, "Address One", ben.Personal.Address.AddressLineOne)
+	assert.Equal(t, "Suite 100", ben.Personal.Address.AddressLineTwo)
+
+	// an invalid amount is saved and reported
+	resp = readMessageUpdate(t, tagRequest(t, router, "PUT", "/files/foo/tags/amount", `{"amount": "12 USD"}`))
+	assert.False(t, resp.Valid)
+	assert.Contains(t, resp.Error, "Amount")
+	resp = readMessageUpdate(t, tagRequest(t, router, "PUT", "/files/foo/tags/amount", `{"amount": "000000001234"}`))
+	assert.True(t, resp.Valid, resp.Error)
+	assert.Equal(t, "000000001234", resp.File.FEDWireMessage.Amount.Amount)
+
+	resp = readMessageUpdate(t, tagRequest(t, router, "DELETE", "/files/foo/tags/3320", ""))
+	assert.True(t, resp.Valid, resp.Error)
+	assert.Nil(t, resp.File.FEDWireMessage.SenderReference)
+
+	resp = readMessageUpdate(t, tagRequest(t, router, "DELETE", "/files/foo/tags/1510", ""))
+	assert.False(t, resp.Valid)
+
+	w := tagRequest(t, router, "GET", "/files/foo/tags/3320", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTags_patchFEDWireMessage(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	resp := readMessageUpdate(t, tagRequest(t, router, "PATCH", "/files/foo/FEDWireMessage", `{
+  "senderReference": null,
+  "beneficiaryReference": {"beneficiaryReference": "Invoice 42"},
+  "amount": {"amount": "000000000099"}
+}`))
+	assert.True(t, resp.Valid, resp.Error)
+	fwm := resp.File.FEDWireMessage
+	assert.Nil(t, fwm.SenderReference)
+	assert.Equal(t, "Invoice 42", fwm.BeneficiaryReference.BeneficiaryReference)
+	assert.Equal(t, "000000000099", fwm.Amount.Amount)
+	assert.Equal(t, "Name", fwm.Beneficiary.Personal.Name)
+}
+
+func TestTags_errors(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	for _, body := range []string{"", "[]", `"beneficiary"`, "{"} {
+		w := tagRequest(t, router, "PUT", "/files/foo/tags/4200", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	w := tagRequest(t, router, "PATCH", "/files/foo/tags/4200", `{"personal": {"name": 42}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, tagRequest(t, router, "DELETE", "/files/foo/tags/id", "").Code)
+	assert.Equal(t, http.StatusNotFound, tagRequest(t, router, "PATCH", "/files/missing/FEDWireMessage", "{}").Code)
+
+	// submitted files can't be modified
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "jane").Code)
+	w = tagRequest(t, router, "DELETE", "/files/foo/tags/3320", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errFileNotDraft.Error())
+
+	// production messages are rejected by test servers
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	router = mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withEnvironment(wire.EnvironmentTest))
+	w = tagRequest(t, router, "PATCH", "/files/foo/tags/1500", `{"testProductionCode": "P"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	repo2 := &testWireFileRepository{err: errors.New("bad error")}
+	router = mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo2)
+	assert.Equal(t, http.StatusBadRequest, tagRequest(t, router, "GET", "/files/foo/tags/4200", "").Code)
+	assert.Equal(t, http.StatusBadRequest, tagRequest(t, router, "DELETE", "/files/foo/tags/4200", "").Code)
+}
@@ -0,0 +1,859 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+// Parameter types of templates
+const (
+	// parameterText is substituted as given
+	parameterText = "text"
+	// parameterAmount is given in dollars, e.g. 1234.56, and substituted as the twelve digits of cents {2000} uses
+	parameterAmount = "amount"
+	// parameterDate is given as YYYYMMDD or YYYY-MM-DD and substituted as YYYYMMDD
+	parameterDate = "date"
+)
+
+var (
+	errNoTemplateID          = errors.New("no template ID found")
+	errTemplateNotFound      = errors.New("template not found")
+	errTemplateExists        = errors.New("a template with this name exists")
+	errNoTemplateName        = errors.New("template name is required")
+	errNoTemplateMessage     = errors.New("template message is required")
+	errInvalidParameter      = errors.New("invalid template parameter")
+	errUnknownParameter      = errors.New("unknown template parameter")
+	errMissingParameter      = errors.New("missing template parameter")
+	errInvalidLockedField    = errors.New("invalid locked field")
+	errLockedField           = errors.New("field is locked by the template")
+	errLockedFieldsChanged   = errors.New("locked fields of a template can't be changed")
+	errUndeclaredPlaceholder = errors.New("placeholder isn't a declared parameter")
+
+	// placeholderRegex matches the ${name} placeholders in the string values of a template message
+	placeholderRegex   = regexp.MustCompile(`\$\{([^}]*)\}`)
+	parameterNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	amountRegex        = regexp.MustCompile(`^(\d{1,10})(?:\.(\d{1,2}))?$`)
+)
+
+// templateParameter is a named value substituted into the placeholders of a template
+type templateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is text, amount or date, text when empty
+	Type string `json:"type,omitempty"`
+	// Default is used when instantiating without a value, the parameter is required when it's empty
+	Default string `json:"default,omitempty"`
+}
+
+// wireTemplate is a partial FEDWireMessage, as JSON, to instantiate files from. String values may hold ${name}
+// placeholders of its parameters.
+type wireTemplate struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Message     map[string]interface{} `json:"message"`
+	Parameters  []templateParameter    `json:"parameters"`
+	// LockedFields are the dot separated JSON paths of message fields which can't be overridden when
+	// instantiating or changed when updating, e.g. beneficiary.personal.identifier
+	LockedFields []string  `json:"lockedFields"`
+	CreatedBy    string    `json:"createdBy,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// templateInstantiation is the body of instantiating a template
+type templateInstantiation struct {
+	// Parameters are the values of the template parameters
+	Parameters map[string]string `json:"parameters"`
+	// Overrides is a JSON merge patch applied to the message after substitution
+	Overrides map[string]interface{} `json:"overrides"`
+}
+
+// templateRepository holds templates in memory
+type templateRepository struct {
+	mu        sync.Mutex
+	templates map[string]*wireTemplate
+}
+
+func newTemplateRepository() *templateRepository {
+	return &templateRepository{
+		templates: make(map[string]*wireTemplate),
+	}
+}
+
+// saveTemplate stores a new template, names are unique
+func (r *templateRepository) saveTemplate(t *wireTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.templates {
+		if strings.EqualFold(existing.Name, t.Name) {
+			return errTemplateExists
+		}
+	}
+	r.templates[t.ID] = t
+	return nil
+}
+
+// getTemplate returns the template of id, nil when there's none. Templates are replaced and never modified, so
+// the returned template can be read without the lock.
+func (r *templateRepository) getTemplate(id string) *wireTemplate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.templates[id]
+}
+
+// getTemplates returns every template ordered by name
+func (r *templateRepository) getTemplates() []*wireTemplate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]*wireTemplate, 0, len(r.templates))
+	for _, t := range r.templates {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// replaceTemplate replaces the template of t.ID. check is called with the stored template and can refuse the
+// update.
+func (r *templateRepository) replaceTemplate(t *wireTemplate, check func(*wireTemplate) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.templates[t.ID]
+	if !ok {
+		return errTemplateNotFound
+	}
+	for _, other := range r.templates {
+		if other.ID != t.ID && strings.EqualFold(other.Name, t.Name) {
+			return errTemplateExists
+		}
+	}
+	if err := check(existing); err != nil {
+		return err
+	}
+	r.templates[t.ID] = t
+	return nil
+}
+
+// deleteTemplate removes the template of id and reports if it existed
+func (r *templateRepository) deleteTemplate(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.templates[id]
+	delete(r.templates, id)
+	return ok
+}
+
+// parameter returns the declared parameter of name
+func (t *wireTemplate) parameter(name string) (templateParameter, bool) {
+	for _, p := range t.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return templateParameter{}, false
+}
+
+// validate checks the parameters are declared once with a known type and valid default, every placeholder is
+// a declared parameter, locked fields are in the message without placeholders and the message decodes as a
+// FEDWireMessage once its parameters are substituted.
+func (t *wireTemplate) validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errNoTemplateName
+	}
+	if len(t.Message) == 0 {
+		return errNoTemplateMessage
+	}
+	samples := make(map[string]string)
+	for _, p := range t.Parameters {
+		if !parameterNameRegex.MatchString(p.Name) {
+			return fmt.Errorf("%w: name %q", errInvalidParameter, p.Name)
+		}
+		if _, ok := samples[p.Name]; ok {
+			return fmt.Errorf("%w: %s is declared twice", errInvalidParameter, p.Name)
+		}
+		sample := p.Default
+		if sample == "" {
+			sample = map[string]string{parameterAmount: "1.00", parameterDate: "20060102"}[p.Type]
+		}
+		value, err := p.format(sample)
+		if err != nil {
+			return err
+		}
+		samples[p.Name] = value
+	}
+	for _, name := range placeholders(t.Message) {
+		if _, ok := samples[name]; !ok {
+			return fmt.Errorf("%w: ${%s}", errUndeclaredPlaceholder, name)
+		}
+	}
+	msg, _ := substitute(t.Message, samples).(map[string]interface{})
+	canonical, err := canonicalMessage(msg)
+	if err != nil {
+		return fmt.Errorf("template message isn't a FEDWireMessage: %v", err)
+	}
+	for _, path := range t.LockedFields {
+		v, ok := lookupPath(t.Message, path)
+		if _, known := lookupPath(canonical, path); !ok || !known {
+			return fmt.Errorf("%w: %s isn't in the message", errInvalidLockedField, path)
+		}
+		if len(placeholders(v)) > 0 {
+			return fmt.Errorf("%w: %s has a placeholder", errInvalidLockedField, path)
+		}
+	}
+	return nil
+}
+
+// format returns value as it's substituted into the message
+func (p templateParameter) format(value string) (string, error) {
+	switch p.Type {
+	case "", parameterText:
+		return value, nil
+	case parameterAmount:
+		cents, err := parseDollars(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be an amount in dollars, e.g. 1234.56, not %q", errInvalidParameter, p.Name, value)
+		}
+		return fmt.Sprintf("%012d", cents), nil
+	case parameterDate:
+		for _, layout := range []string{"20060102", "2006-01-02"} {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date.Format("20060102"), nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s must be a date as YYYYMMDD, not %q", errInvalidParameter, p.Name, value)
+	}
+	return "", fmt.Errorf("%w: %s has unknown type %q", errInvalidParameter, p.Name, p.Type)
+}
+
+// parseDollars returns the cents of an amount in dollars, e.g. 1234.56
+func parseDollars(v string) (int64, error) {
+	m := amountRegex.FindStringSubmatch(v)
+	if m == nil {
+		return 0, fmt.Errorf("invalid amount %q", v)
+	}
+	return strconv.ParseInt(m[1]+(m[2] + "00")[:2], 10, 64)
+}
+
+// values returns the formatted value of every parameter from params and the defaults
+func (t *wireTemplate) values(params map[string]string) (map[string]string, error) {
+	for name := range params {
+		if _, ok := t.parameter(name); !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownParameter, name)
+		}
+	}
+	out := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		value, ok := params[p.Name]
+		if !ok || value == "" {
+			if value = p.Default; value == "" {
+				return nil, fmt.Errorf("%w: %s", errMissingParameter, p.Name)
+			}
+		}
+		formatted, err := p.format(value)
+		if err != nil {
+			return nil, err
+		}
+		out[p.Name] = formatted
+	}
+	return out, nil
+}
+
+// instantiate returns the message of the template with values substituted and overrides merged. An error wrapping
+// errLockedField is returned when the overrides change a locked field.
+func (t *wireTemplate) instantiate(values map[string]string, overrides map[string]interface{}) (map[string]interface{}, error) {
+	msg, _ := substitute(t.Message, values).(map[string]interface{})
+	want, err := canonicalMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		msg, _ = mergePatch(msg, overrides).(map[string]interface{})
+	}
+	got, err := canonicalMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	if path := changedPath(t.LockedFields, want, got); path != "" {
+		return nil, fmt.Errorf("%w: %s", errLockedField, path)
+	}
+	return msg, nil
+}
+
+// checkLockedFields returns errLockedFieldsChanged when next doesn't lock the same fields with the same values
+// as t
+func (t *wireTemplate) checkLockedFields(next *wireTemplate) error {
+	locked := func(fields []string) []string {
+		out := append([]string{}, fields...)
+		sort.Strings(out)
+		return out
+	}
+	if !reflect.DeepEqual(locked(t.LockedFields), locked(next.LockedFields)) {
+		return errLockedFieldsChanged
+	}
+	// placeholders are substituted with empty strings, locked fields have none
+	want, err := canonicalMessage(substitute(t.Message, nil).(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+	got, err := canonicalMessage(substitute(next.Message, nil).(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+	if path := changedPath(t.LockedFields, want, got); path != "" {
+		return fmt.Errorf("%w: %s", errLockedFieldsChanged, path)
+	}
+	return nil
+}
+
+// canonicalMessage returns the JSON object of the FEDWireMessage msg decodes as. Locked fields are compared on it
+// since keys matching a field case-insensitively, or repeated, set the field as much as its own key does.
+func canonicalMessage(msg map[string]interface{}) (map[string]interface{}, error) {
+	fwm, err := toFEDWireMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return toJSONObject(fwm)
+}
+
+// changedPath returns the first of paths whose value differs between before and after, empty when none do
+func changedPath(paths []string, before, after map[string]interface{}) string {
+	for _, path := range paths {
+		want, _ := lookupPath(before, path)
+		got, _ := lookupPath(after, path)
+		if !reflect.DeepEqual(want, got) {
+			return path
+		}
+	}
+	return ""
+}
+
+// fileLocks holds the fields of files instantiated from templates which the templates lock, so they can't be
+// changed once the file is stored either
+type fileLocks struct {
+	mu    sync.Mutex
+	locks map[string][]string
+}
+
+func newFileLocks() *fileLocks {
+	return &fileLocks{
+		locks: make(map[string][]string),
+	}
+}
+
+func (l *fileLocks) lock(fileID string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.locks[fileID] = append([]string{}, paths...)
+}
+
+func (l *fileLocks) getLocks(fileID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.locks[fileID]
+}
+
+func (l *fileLocks) unlock(fileID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.locks, fileID)
+}
+
+// checkLockedFields returns an error wrapping errLockedField when after changes a field of the file which its
+// template locks
+func (opts *fileRoutesOptions) checkLockedFields(fileID string, before, after wire.FEDWireMessage) error {
+	paths := opts.locks.getLocks(fileID)
+	if len(paths) == 0 {
+		return nil
+	}
+	want, err := toJSONObject(before)
+	if err != nil {
+		return err
+	}
+	got, err := toJSONObject(after)
+	if err != nil {
+		return err
+	}
+	if path := changedPath(paths, want, got); path != "" {
+		return fmt.Errorf("%w: %s", errLockedField, path)
+	}
+	return nil
+}
+
+// placeholders returns the names of the placeholders in v
+func placeholders(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for _, m := range placeholderRegex.FindAllStringSubmatch(v, -1) {
+			out = append(out, m[1])
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			out = append(out, placeholders(elem)...)
+		}
+	case []interface{}:
+		for _, elem := range v {
+			out = append(out, placeholders(elem)...)
+		}
+	}
+	return out
+}
+
+// substitute returns a copy of v with the placeholders in its strings replaced by values
+func substitute(v interface{}, values map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return placeholderRegex.ReplaceAllStringFunc(v, func(m string) string {
+			return values[m[2:len(m)-1]]
+		})
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			out[k] = substitute(elem, values)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = substitute(elem, values)
+		}
+		return out
+	}
+	return v
+}
+
+// lookupPath returns the value at a dot separated path of JSON object members
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// toFEDWireMessage decodes a JSON object as a FEDWireMessage
+func toFEDWireMessage(msg map[string]interface{}) (wire.FEDWireMessage, error) {
+	var fwm wire.FEDWireMessage
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return fwm, err
+	}
+	err = json.Unmarshal(bs, &fwm)
+	return fwm, err
+}
+
+// decodeTemplate reads a template from the request body keeping the numbers of its message unchanged
+func decodeTemplate(r *http.Request) (*wireTemplate, error) {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	var t wireTemplate
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+	if t.Parameters == nil {
+		t.Parameters = []templateParameter{}
+	}
+	if t.LockedFields == nil {
+		t.LockedFields = []string{}
+	}
+	return &t, nil
+}
+
+func getTemplateID(w http.ResponseWriter, r *http.Request) string {
+	v, ok := mux.Vars(r)["templateId"]
+	if !ok || v == "" {
+		moovhttp.Problem(w, errNoTemplateID)
+		return ""
+	}
+	return v
+}
+
+// addTemplateRoutes registers the routes of templates. Instantiated files are stored as POST /files/create
+// stores them.
+func addTemplateRoutes(logger log.Logger, r *mux.Router, repo WireFileRepository, templates *templateRepository, opts *fileRoutesOptions) {
+	r.Methods("GET").Path("/templates").HandlerFunc(getTemplates(logger, templates, opts))
+	r.Methods("POST").Path("/templates").HandlerFunc(createTemplate(logger, templates, opts))
+	r.Methods("GET").Path("/templates/{templateId}").HandlerFunc(getTemplate(logger, templates, opts))
+	r.Methods("PUT").Path("/templates/{templateId}").HandlerFunc(updateTemplate(logger, templates, opts))
+	r.Methods("DELETE").Path("/templates/{templateId}").HandlerFunc(deleteTemplate(logger, templates, opts))
+	r.Methods("POST").Path("/templates/{templateId}/instantiate").HandlerFunc(opts.idempotency.idempotent(logger, instantiateTemplate(logger, repo, templates, opts)))
+}
+
+// writeJSON responds with status and v as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// redactTemplate returns a copy of t whose message is masked by the redaction policy when mask is true. Only the
+// values redaction changes are replaced, the message keeps its fields and placeholders.
+func (opts *fileRoutesOptions) redactTemplate(t *wireTemplate, mask bool) (*wireTemplate, error) {
+	if !mask {
+		return t, nil
+	}
+	fwm, err := toFEDWireMessage(t.Message)
+	if err != nil {
+		return nil, err
+	}
+	before, err := toJSONObject(fwm)
+	if err != nil {
+		return nil, err
+	}
+	after, err := toJSONObject(opts.redact(&wire.File{FEDWireMessage: fwm}, true).FEDWireMessage)
+	if err != nil {
+		return nil, err
+	}
+	out := *t
+	out.Message = redactedValues(t.Message, before, after)
+	return &out, nil
+}
+
+// redactedValues returns a copy of msg whose values differing between before and after, a message before and
+// after it was redacted, are taken from after. Values with placeholders are kept.
+func redactedValues(msg, before, after map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(msg))
+	for k, v := range msg {
+		if obj, ok := v.(map[string]interface{}); ok {
+			b, _ := before[k].(map[string]interface{})
+			a, _ := after[k].(map[string]interface{})
+			out[k] = redactedValues(obj, b, a)
+			continue
+		}
+		out[k] = v
+		if len(placeholders(v)) > 0 {
+			continue // placeholders aren't values, keep them
+		}
+		if a, ok := after[k]; ok && !reflect.DeepEqual(before[k], a) {
+			out[k] = a
+		}
+	}
+	return out
+}
+
+// writeTemplate responds with status and t masked when r asks for it
+func (opts *fileRoutesOptions) writeTemplate(logger log.Logger, w http.ResponseWriter, status int, t *wireTemplate, mask bool) {
+	t, err := opts.redactTemplate(t, mask)
+	if err != nil {
+		moovhttp.Problem(w, logger.LogErrorf("problem masking template: %v", err).Err())
+		return
+	}
+	writeJSON(w, status, t)
+}
+
+func getTemplates(logger log.Logger, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		out := templates.getTemplates()
+		for i := range out {
+			if out[i], err = opts.redactTemplate(out[i], mask); err != nil {
+				moovhttp.Problem(w, logger.LogErrorf("problem masking template: %v", err).Err())
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func createTemplate(logger log.Logger, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		t, err := decodeTemplate(r)
+		if err != nil {
+			moovhttp.Problem(w, logger.LogError(err).Err())
+			return
+		}
+		if err := t.validate(); err != nil {
+			moovhttp.Problem(w, logger.LogErrorf("invalid template: %v", err).Err())
+			return
+		}
+		t.ID = base.ID()
+		t.CreatedBy = moovhttp.GetUserID(r)
+		t.CreatedAt = time.Now().UTC()
+		t.UpdatedAt = t.CreatedAt
+		logger = logger.Set("templateID", log.String(t.ID))
+
+		if err := templates.saveTemplate(t); err != nil {
+			writeProblem(w, http.StatusConflict, logger.LogErrorf("problem saving template: %v", err).Err())
+			return
+		}
+		logger.Logf("created template %s", t.Name)
+		opts.recordAudit(logger, r, auditTemplateCreated, "", nil, nil, fmt.Sprintf("template %s (%s)", t.ID, t.Name))
+
+		opts.writeTemplate(logger, w, http.StatusCreated, t, mask)
+	}
+}
+
+func getTemplate(logger log.Logger, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		id := getTemplateID(w, r)
+		if id == "" {
+			logger.LogError(errNoTemplateID)
+			return
+		}
+		t := templates.getTemplate(id)
+		if t == nil {
+			logger.Log("template not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		opts.writeTemplate(logger, w, http.StatusOK, t, mask)
+	}
+}
+
+// updateTemplate replaces a template. Its locked fields and their values can't change, a template locking other
+// fields must be created instead.
+func updateTemplate(logger log.Logger, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		id := getTemplateID(w, r)
+		if id == "" {
+			logger.LogError(errNoTemplateID)
+			return
+		}
+		logger = logger.Set("templateID", log.String(id))
+
+		t, err := decodeTemplate(r)
+		if err != nil {
+			moovhttp.Problem(w, logger.LogError(err).Err())
+			return
+		}
+		if err := t.validate(); err != nil {
+			moovhttp.Problem(w, logger.LogErrorf("invalid template: %v", err).Err())
+			return
+		}
+		t.ID = id
+		t.UpdatedAt = time.Now().UTC()
+
+		err = templates.replaceTemplate(t, func(existing *wireTemplate) error {
+			t.CreatedBy = existing.CreatedBy
+			t.CreatedAt = existing.CreatedAt
+			return existing.checkLockedFields(t)
+		})
+		if errors.Is(err, errTemplateNotFound) {
+			logger.Log("template not found")
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			writeProblem(w, http.StatusConflict, logger.LogErrorf("problem updating template: %v", err).Err())
+			return
+		}
+		logger.Logf("updated template %s", t.Name)
+		opts.recordAudit(logger, r, auditTemplateUpdated, "", nil, nil, fmt.Sprintf("template %s (%s)", t.ID, t.Name))
+
+		opts.writeTemplate(logger, w, http.StatusOK, t, mask)
+	}
+}
+
+func deleteTemplate(logger log.Logger, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		id := getTemplateID(w, r)
+		if id == "" {
+			logger.LogError(errNoTemplateID)
+			return
+		}
+		if !templates.deleteTemplate(id) {
+			logger.Log("template not found")
+			http.NotFound(w, r)
+			return
+		}
+		logger.Set("templateID", log.String(id)).Log("deleted template")
+		opts.recordAudit(logger, r, auditTemplateDeleted, "", nil, nil, "template "+id)
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// instantiateTemplate substitutes the parameter values into a template, applies the overrides and validates the
+// message. The file is stored unless the dryRun query parameter is true, then it's only returned.
+func instantiateTemplate(logger log.Logger, repo WireFileRepository, templates *templateRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		dryRun := false
+		if v := r.URL.Query().Get("dryRun"); v != "" {
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				moovhttp.Problem(w, logger.LogErrorf("invalid dryRun: %v", err).Err())
+				return
+			}
+		}
+		validateOpts, err := readValidateOpts(r)
+		if err != nil {
+			moovhttp.Problem(w, logger.LogErrorf("invalid validate options: %v", err).Err())
+			return
+		}
+
+		id := getTemplateID(w, r)
+		if id == "" {
+			logger.LogError(errNoTemplateID)
+			return
+		}
+		logger = logger.Set("templateID", log.String(id))
+		t := templates.getTemplate(id)
+		if t == nil {
+			logger.Log("template not found")
+			http.NotFound(w, r)
+			return
+		}
+
+		var req templateInstantiation
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			err = logger.LogErrorf("error reading request body: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		values, err := t.values(req.Parameters)
+		if err != nil {
+			moovhttp.Problem(w, logger.LogErrorf("invalid parameters: %v", err).Err())
+			return
+		}
+		msg, err := t.instantiate(values, req.Overrides)
+		if errors.Is(err, errLockedField) {
+			writeProblem(w, http.StatusConflict, logger.LogErrorf("invalid overrides: %v", err).Err())
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, newValidationError(logger.LogErrorf("invalid overrides: %v", err).Err()))
+			return
+		}
+
+		file := wire.NewFile()
+		file.ID = base.ID()
+		if file.FEDWireMessage, err = toFEDWireMessage(msg); err == nil {
+			err = opts.checkEnvironment(file)
+		}
+		if err == nil {
+			err = validateWith(file, validateOpts)
+		}
+		if err != nil {
+			recordValidationFailure(err)
+			logger.Logf("instantiated file was invalid: %v", err)
+			writeJSON(w, http.StatusBadRequest, newValidationError(err))
+			return
+		}
+		if err := opts.checkPolicies(w, r, repo, file); err != nil {
+			logger.LogErrorf("file rejected: %v", err)
+			return
+		}
+		if dryRun {
+			logger.Logf("instantiated template %s", t.Name)
+			writeJSON(w, http.StatusOK, opts.redact(file, mask))
+			return
+		}
+		logger = logger.Set("fileID", log.String(file.ID))
+
+		if err := opts.checkDuplicates(w, repo, file); err != nil {
+			logger.LogErrorf("file rejected: %v", err)
+			return
+		}
+		if err := repo.saveFile(file); err != nil {
+			err = logger.LogErrorf("problem saving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		opts.locks.lock(file.ID, t.LockedFields)
+		logger.Logf("created file from template %s", t.Name)
+		opts.recordCreated(logger, r, file, "instantiated template "+t.Name)
+		opts.notifyCreated(logger, r, file)
+		if version, err := repo.fileVersion(file.ID); err == nil {
+			writeFileVersion(w, version)
+		}
+
+		recordFileCreated(file)
+
+		writeJSON(w, http.StatusCreated, opts.redact(file, mask))
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func mockTemplateRouter(t *testing.T, opts ...fileRoutesOption) (*mux.Router, *memoryWireFileRepository) {
+	t.Helper()
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	router := mux.NewRouter()
+	cfg := addFileRoutes(log.NewNopLogger(), router, repo, opts...)
+	addTemplateRoutes(log.NewNopLogger(), router, repo, newTemplateRepository(), cfg)
+	return router, repo
+}
+
+// mockTemplate is the mock message with placeholders for its amount and sender reference, locking its
+// beneficiary account and receiver ABA
+func mockTemplate(t *testing.T) map[string]interface{} {
+	t.Helper()
+	msg, err := toJSONObject(mockFEDWireMessage())
+	require.NoError(t, err)
+	msg["amount"] = map[string]interface{}{"amount": "${amount}"}
+	msg["senderReference"] = map[string]interface{}{"senderReference": "PAY ${payDate}"}
+
+	return map[string]interface{}{
+		"name":    "Weekly payroll",
+		"message": msg,
+		"parameters": []templateParameter{
+			{Name: "amount", Type: parameterAmount},
+			{Name: "payDate", Type: parameterDate},
+		},
+		"lockedFields": []string{"beneficiary.personal.identifier", "receiverDepositoryInstitution.receiverABANumber"},
+	}
+}
+
+func mockCreateTemplate(t *testing.T, router *mux.Router) wireTemplate {
+	t.Helper()
+	w := testRequest(t, router, "POST", "/templates", mockTemplate(t), "X-User-ID", "treasury")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var tmpl wireTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tmpl))
+	return tmpl
+}
+
+func TestTemplates_crud(t *testing.T) {
+	router, _ := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+	require.NotEmpty(t, tmpl.ID)
+	require.Equal(t, "treasury", tmpl.CreatedBy)
+
+	// names are unique
+	w := testRequest(t, router, "POST", "/templates", mockTemplate(t), "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = testRequest(t, router, "GET", "/templates", nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code)
+	var templates []wireTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&templates))
+	require.Len(t, templates, 1)
+
+	// unlocked fields can change
+	body := mockTemplate(t)
+	body["description"] = "Friday payroll funding"
+	w = testRequest(t, router, "PUT", "/templates/"+tmpl.ID, body, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = testRequest(t, router, "GET", "/templates/"+tmpl.ID, nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code)
+	var updated wireTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	require.Equal(t, "Friday payroll funding", updated.Description)
+	require.Equal(t, tmpl.CreatedAt, updated.CreatedAt)
+
+	// locked fields can't
+	body = mockTemplate(t)
+	body["message"].(map[string]interface{})["receiverDepositoryInstitution"] = map[string]interface{}{"receiverABANumber": "121042882"}
+	w = testRequest(t, router, "PUT", "/templates/"+tmpl.ID, body, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	body = mockTemplate(t)
+	body["lockedFields"] = []string{"beneficiary.personal.identifier"}
+	w = testRequest(t, router, "PUT", "/templates/"+tmpl.ID, body, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = testRequest(t, router, "DELETE", "/templates/"+tmpl.ID, nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = testRequest(t, router, "GET", "/templates/"+tmpl.ID, nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = testRequest(t, router, "PUT", "/templates/"+tmpl.ID, mockTemplate(t), "X-User-ID", "treasury")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTemplates_invalid(t *testing.T) {
+	router, _ := mockTemplateRouter(t)
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"no name": func(body map[string]interface{}) { body["name"] = "" },
+		"undeclared placeholder": func(body map[string]interface{}) {
+			body["parameters"] = []templateParameter{{Name: "amount", Type: parameterAmount}}
+		},
+		"unknown type": func(body map[string]interface{}) {
+			body["parameters"] = []templateParameter{{Name: "amount", Type: "money"}, {Name: "payDate"}}
+		},
+		"invalid default": func(body map[string]interface{}) {
+			body["parameters"] = []templateParameter{{Name: "amount", Type: parameterAmount, Default: "lots"}, {Name: "payDate"}}
+		},
+		"missing locked field": func(body map[string]interface{}) {
+			body["lockedFields"] = []string{"intermediaryFI.financialInstitution.identifier"}
+		},
+		"locked placeholder": func(body map[string]interface{}) {
+			body["lockedFields"] = []string{"amount.amount"}
+		},
+		"not a message": func(body map[string]interface{}) {
+			body["message"] = map[string]interface{}{"amount": "${amount}"}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := mockTemplate(t)
+			change(body)
+			w := testRequest(t, router, "POST", "/templates", body, "X-User-ID", "treasury")
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestTemplates_instantiate(t *testing.T) {
+	router, repo := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+
+	w := testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", templateInstantiation{
+		Parameters: map[string]string{"amount": "52000.5", "payDate": "2026-10-23"},
+	}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+	require.Equal(t, "000005200050", file.FEDWireMessage.Amount.Amount)
+	require.Equal(t, "PAY 20261023", file.FEDWireMessage.SenderReference.SenderReference)
+
+	stored, err := repo.getFile(file.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+
+	// overrides of unlocked fields apply, the file isn't stored on a dry run
+	w = testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate?dryRun=true", templateInstantiation{
+		Parameters: map[string]string{"amount": "10", "payDate": "20261030"},
+		Overrides:  map[string]interface{}{"senderReference": map[string]interface{}{"senderReference": "INTERCO"}},
+	}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+	require.Equal(t, "000000001000", file.FEDWireMessage.Amount.Amount)
+	require.Equal(t, "INTERCO", file.FEDWireMessage.SenderReference.SenderReference)
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// locked fields can't be overridden
+	w = testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", templateInstantiation{
+		Parameters: map[string]string{"amount": "10", "payDate": "20261030"},
+		Overrides:  map[string]interface{}{"beneficiary": map[string]interface{}{"personal": map[string]interface{}{"identifier": "999999"}}},
+	}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	for name, params := range map[string]map[string]string{
+		"missing parameter": {"amount": "10"},
+		"unknown parameter": {"amount": "10", "payDate": "20261030", "memo": "x"},
+		"invalid amount":    {"amount": "10.001", "payDate": "20261030"},
+		"invalid date":      {"amount": "10", "payDate": "10/30/2026"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", templateInstantiation{Parameters: params}, "X-User-ID", "treasury")
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+
+	w = testRequest(t, router, "POST", "/templates/missing/instantiate", templateInstantiation{}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTemplates_lockedFieldKeys(t *testing.T) {
+	router, _ := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+
+	// keys matching a locked field case-insensitively change it all the same
+	body := `{"parameters": {"amount": "10", "payDate": "20261030"},
+		"overrides": {"receiverDepositoryInstitution": {"receiverabaNumber": "999999999"}}}`
+	w := testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", body, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	template := mockTemplate(t)
+	msg := template["message"].(map[string]interface{})
+	msg["receiverDepositoryInstitution"] = map[string]interface{}{"receiverABANumber": "231380104", "receiverabaNumber": "999999999"}
+	w = testRequest(t, router, "PUT", "/templates/"+tmpl.ID, template, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
+
+func TestTemplates_fileLocks(t *testing.T) {
+	router, _ := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+
+	w := testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", templateInstantiation{
+		Parameters: map[string]string{"amount": "10", "payDate": "20261030"},
+	}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+
+	// the fields the template locks can't be changed on the stored file
+	for name, req := range map[string][3]string{
+		"patch message": {"PATCH", "/FEDWireMessage", `{"beneficiary": {"personal": {"identifier": "999999"}}}`},
+		"put tag":       {"PUT", "/tags/3400", `{"receiverabaNumber": "999999999", "receiverShortName": "Other Bank"}`},
+		"patch tag":     {"PATCH", "/tags/4200", `{"personal": {"identifier": "999999"}}`},
+		"delete tag":    {"DELETE", "/tags/4200", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := testRequest(t, router, req[0], "/files/"+file.ID+req[1], req[2])
+			require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+		})
+	}
+	fwm := mockFEDWireMessage()
+	fwm.ReceiverDepositoryInstitution.ReceiverABANumber = "999999999"
+	w = testRequest(t, router, "POST", "/files/"+file.ID+"/FEDWireMessage", fwm)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	// other fields can
+	w = testRequest(t, router, "PATCH", "/files/"+file.ID+"/tags/3320", `{"senderReference": "INTERCO"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestTemplates_instantiateInvalid(t *testing.T) {
+	router, repo := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+
+	// removing the amount fails validation
+	w := testRequest(t, router, "POST", "/templates/"+tmpl.ID+"/instantiate", templateInstantiation{
+		Parameters: map[string]string{"amount": "10", "payDate": "20261030"},
+		Overrides:  map[string]interface{}{"amount": nil},
+	}, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp validationError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Equal(t, "Amount", resp.Field)
+
+	files, err := repo.getFiles()
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestTemplates_masking(t *testing.T) {
+	router, _ := mockTemplateRouter(t)
+	tmpl := mockCreateTemplate(t, router)
+	beneficiary := func(tmpl wireTemplate) interface{} {
+		return tmpl.Message["beneficiary"].(map[string]interface{})["personal"].(map[string]interface{})["identifier"]
+	}
+	unmasked := beneficiary(tmpl)
+
+	w := testRequest(t, router, "GET", "/templates/"+tmpl.ID+"?mask=true", nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var masked wireTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&masked))
+	require.NotEqual(t, unmasked, beneficiary(masked))
+	// placeholders are kept
+	require.Equal(t, "${amount}", masked.Message["amount"].(map[string]interface{})["amount"])
+
+	// the stored template is unchanged
+	w = testRequest(t, router, "GET", "/templates/"+tmpl.ID, nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&masked))
+	require.Equal(t, unmasked, beneficiary(masked))
+
+	w = testRequest(t, router, "GET", "/templates?mask=maybe", nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	router, _ = mockTemplateRouter(t, withMaskedResponses())
+	w = testRequest(t, router, "POST", "/templates", mockTemplate(t), "X-User-ID", "treasury")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&masked))
+	require.NotEqual(t, unmasked, beneficiary(masked))
+
+	w = testRequest(t, router, "GET", "/templates", nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code)
+	var templates []wireTemplate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&templates))
+	require.Len(t, templates, 1)
+	require.NotEqual(t, unmasked, beneficiary(templates[0]))
+
+}
+
+func TestTemplates_audit(t *testing.T) {
+	audit := newAuditLog()
+	router, _ := mockTemplateRouter(t, withAuditLog(audit))
+	tmpl := mockCreateTemplate(t, router)
+
+	body := mockTemplate(t)
+	body["description"] = "Friday payroll funding"
+	w := testRequest(t, router, "PUT", "/templates/"+tmpl.ID, body, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = testRequest(t, router, "DELETE", "/templates/"+tmpl.ID, nil, "X-User-ID", "treasury")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var actions []string
+	for _, e := range audit.getEntries("") {
+		require.Equal(t, "treasury", e.UserID)
+		require.Contains(t, e.Detail, tmpl.ID)
+		actions = append(actions, e.Action)
+	}
+	require.Equal(t, []string{auditTemplateCreated, auditTemplateUpdated, auditTemplateDeleted}, actions)
+	require.NoError(t, audit.verify())
+}
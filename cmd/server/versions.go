@@ -0,0 +1,98 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+)
+
+var (
+	errPreconditionFailed = errors.New("If-Match header doesn't match the file's ETag")
+	errInvalidVersion     = errors.New("invalid file version")
+)
+
+// fileETag returns the ETag of a file version
+func fileETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// writeFileVersion sets the ETag and X-File-Version headers of a file version
+func writeFileVersion(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", fileETag(version))
+	w.Header().Set("X-File-Version", strconv.Itoa(version))
+}
+
+// checkIfMatch returns errPreconditionFailed when the If-Match header is set and none of its ETags are of version.
+// Any existing file matches *.
+func checkIfMatch(r *http.Request, version int) error {
+	v := r.Header.Get("If-Match")
+	if v == "" {
+		return nil
+	}
+	for _, etag := range strings.Split(v, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == fileETag(version) || (etag == "*" && version > 0) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: current ETag is %s", errPreconditionFailed, fileETag(version))
+}
+
+// getFileVersion returns a saved version of the file, read from the `version` path param
+func getFileVersion(logger log.Logger, repo WireFileRepository, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		mask, err := opts.masking(r)
+		if err != nil {
+			err = logger.LogErrorf("invalid request: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+
+		fileId := getFileId(w, r)
+		if fileId == "" {
+			logger.LogError(errNoFileId)
+			return
+		}
+		version, err := strconv.Atoi(mux.Vars(r)["version"])
+		if err != nil || version < 1 {
+			err = logger.LogErrorf("%v: %s", errInvalidVersion, mux.Vars(r)["version"]).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		logger = logger.Set("fileID", log.String(fileId)).Set("version", log.Int(version))
+
+		file, err := repo.getFileVersion(fileId, version)
+		if err != nil {
+			err = logger.LogErrorf("error retrieving file: %v", err).Err()
+			moovhttp.Problem(w, err)
+			return
+		}
+		if file == nil {
+			logger.Log("file version not found")
+			http.NotFound(w, r)
+			return
+		}
+		opts.recordAudit(logger, r, auditRead, fileId, file, file, fmt.Sprintf("read version %d", version))
+
+		logger.Log("rendering file version")
+		writeFileVersion(w, version)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(opts.redact(file, mask))
+	}
+}
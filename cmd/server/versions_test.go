@@ -0,0 +1,119 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func versionRequest(router *mux.Router, method, target, ifMatch string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	w.Flush()
+	return w
+}
+
+func TestVersions(t *testing.T) {
+	router := mockApprovalRouter(t)
+
+	w := versionRequest(router, "GET", "/files/foo", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	assert.Equal(t, "1", w.Header().Get("X-File-Version"))
+
+	fwm := mockFEDWireMessage()
+	fwm.Amount.Amount = "000000000002"
+	bs, err := json.Marshal(fwm)
+	require.NoError(t, err)
+
+	w = versionRequest(router, "POST", "/files/foo/FEDWireMessage", `"1"`, bs)
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// a stale ETag is refused
+	w = versionRequest(router, "PATCH", "/files/foo/tags/2000", `"1"`, []byte(`{"amount": "000000000003"}`))
+	require.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body)
+	assert.Contains(t, w.Body.String(), `current ETag is \"2\"`)
+
+	w = versionRequest(router, "PATCH", "/files/foo/tags/2000", `"3", "2"`, []byte(`{"amount": "000000000003"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body)
+	assert.Equal(t, "3", w.Header().Get("X-File-Version"))
+
+	for version, amount := range map[string]string{"1": "000001234567", "2": "000000000002", "3": "000000000003"} {
+		w = versionRequest(router, "GET", "/files/foo/versions/"+version, "", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body)
+		assert.Equal(t, `"`+version+`"`, w.Header().Get("ETag"))
+
+		var file wire.File
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+		assert.Equal(t, amount, file.FEDWireMessage.Amount.Amount)
+	}
+	assert.Equal(t, http.StatusNotFound, versionRequest(router, "GET", "/files/foo/versions/4", "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, versionRequest(router, "GET", "/files/foo/versions/0", "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, versionRequest(router, "GET", "/files/foo/versions/latest", "", nil).Code)
+
+	assert.Equal(t, http.StatusPreconditionFailed, versionRequest(router, "DELETE", "/files/foo", `"2"`, nil).Code)
+	assert.Equal(t, http.StatusOK, versionRequest(router, "DELETE", "/files/foo", "*", nil).Code)
+	assert.Equal(t, http.StatusNotFound, versionRequest(router, "GET", "/files/foo/versions/1", "", nil).Code)
+}
+
+// conflictRepository is modified by another request between reading and saving a file
+type conflictRepository struct {
+	*memoryWireFileRepository
+}
+
+func (r conflictRepository) saveFileVersion(file *wire.File, version int) error {
+	return errVersionConflict
+}
+
+func TestVersions_conflict(t *testing.T) {
+	repo := conflictRepository{&memoryWireFileRepository{files: make(map[string]*wire.File)}}
+	require.NoError(t, repo.saveFile(&wire.File{ID: "foo", FEDWireMessage: mockFEDWireMessage()}))
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	w := versionRequest(router, "DELETE", "/files/foo/tags/3320", "", nil)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	bs, err := json.Marshal(mockFEDWireMessage())
+	require.NoError(t, err)
+	w = versionRequest(router, "POST", "/files/foo/FEDWireMessage", "", bs)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestVersions_checkIfMatch(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/files/foo", nil)
+	assert.NoError(t, checkIfMatch(req, 0))
+
+	req.Header.Set("If-Match", "*")
+	assert.NoError(t, checkIfMatch(req, 2))
+	assert.True(t, errors.Is(checkIfMatch(req, 0), errPreconditionFailed))
+
+	req.Header.Set("If-Match", `W/"2"`)
+	assert.True(t, errors.Is(checkIfMatch(req, 2), errPreconditionFailed))
+}
+
+func TestVersions_repoError(t *testing.T) {
+	repo := &testWireFileRepository{err: errors.New("bad error")}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo)
+
+	assert.Equal(t, http.StatusBadRequest, versionRequest(router, "GET", "/files/foo/versions/1", "", nil).Code)
+}
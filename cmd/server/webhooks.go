@@ -0,0 +1,492 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+)
+
+const (
+	eventFileCreated          = "file.created"
+	eventFileModified         = "file.modified"
+	eventFileValidated        = "file.validated"
+	eventFileValidationFailed = "file.validation_failed"
+	eventFileApproved         = "file.approved"
+	eventFileRejected         = "file.rejected"
+	eventFileReleased         = "file.released"
+	eventFileDeleted          = "file.deleted"
+	// eventFileAcknowledged is a file created from a message the Fed sent, which carries
+	// OutputMessageAccountabilityData {1120}
+	eventFileAcknowledged = "file.acknowledged"
+)
+
+// webhookEvents are the events webhooks can subscribe to
+var webhookEvents = []string{
+	eventFileCreated, eventFileModified, eventFileValidated, eventFileValidationFailed, eventFileApproved,
+	eventFileRejected, eventFileReleased, eventFileDeleted, eventFileAcknowledged,
+}
+
+const (
+	// webhookQueueSize is the number of deliveries waiting for a worker, events are dead letters once it's full
+	webhookQueueSize = 1000
+	// webhookWorkers is the number of deliveries sent at once
+	webhookWorkers = 4
+	// maxDeadLetters is the number of dead letters kept, the oldest are dropped first
+	maxDeadLetters = 1000
+)
+
+var (
+	errUnknownWebhookEvent = errors.New("unknown webhook event")
+	errWebhookStatus       = errors.New("unexpected webhook response status")
+	errWebhookQueueFull    = errors.New("webhook queue is full")
+	errWebhooksClosed      = errors.New("webhooks are shut down")
+)
+
+// webhookEvent is the JSON body of a webhook request
+type webhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	FileID    string    `json:"fileID"`
+	UserID    string    `json:"userID,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+	// Error is why the file failed validation
+	Error string `json:"error,omitempty"`
+}
+
+// webhookEndpoint is a URL notified of events, read from WEBHOOKS_FILE
+type webhookEndpoint struct {
+	URL string `json:"url"`
+	// Secret signs the requests sent to URL
+	Secret string `json:"secret"`
+	// Events are the events URL is notified of, every event when empty
+	Events []string `json:"events"`
+}
+
+// subscribed reports if the endpoint is notified of eventType
+func (e webhookEndpoint) subscribed(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, event := range e.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deadLetter is an event which couldn't be delivered to an endpoint after every attempt
+type deadLetter struct {
+	URL      string       `json:"url"`
+	Event    webhookEvent `json:"event"`
+	Attempts int          `json:"attempts"`
+	Error    string       `json:"error"`
+	Time     time.Time    `json:"time"`
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of the timestamp and body of a request signed with secret. Receivers
+// compute it over the X-Wire-Timestamp header, a period and the body and compare it to X-Wire-Signature.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDelivery is an event waiting to be sent to an endpoint
+type webhookDelivery struct {
+	logger   log.Logger
+	endpoint webhookEndpoint
+	event    webhookEvent
+	// attempt is the number of the next attempt, starting at 1
+	attempt int
+}
+
+// webhookNotifier delivers events to endpoints in the background from a bounded queue. Failed deliveries are
+// queued again after an exponential backoff and kept as dead letters once every attempt fails, the queue is full
+// or the notifier is closed before their retry.
+type webhookNotifier struct {
+	endpoints   []webhookEndpoint
+	client      *http.Client
+	maxAttempts int
+	// backoff is the delay before the first retry, it doubles for each retry after
+	backoff time.Duration
+
+	queue     chan webhookDelivery
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	workers   sync.WaitGroup
+	// pending counts the deliveries which are queued, being sent or waiting to be retried
+	pending sync.WaitGroup
+
+	mu          sync.Mutex
+	closed      bool
+	deadLetters []deadLetter
+	// retries are the deliveries waiting for their backoff, by the ID of their timer
+	retries   map[int]*webhookRetry
+	nextRetry int
+}
+
+// webhookRetry is a failed delivery waiting for its backoff before being queued again
+type webhookRetry struct {
+	timer    *time.Timer
+	delivery webhookDelivery
+}
+
+func newWebhookNotifier(endpoints []webhookEndpoint) *webhookNotifier {
+	return &webhookNotifier{
+		endpoints:   endpoints,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: 5,
+		backoff:     time.Second,
+		queue:       make(chan webhookDelivery, webhookQueueSize),
+		stop:        make(chan struct{}),
+	}
+}
+
+// notify queues event for every endpoint subscribed to its type. A nil notifier ignores events.
+func (n *webhookNotifier) notify(logger log.Logger, event webhookEvent) {
+	if n == nil {
+		return
+	}
+	n.startOnce.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			n.workers.Add(1)
+			go n.work()
+		}
+	})
+	for _, endpoint := range n.endpoints {
+		if !endpoint.subscribed(event.Type) {
+			continue
+		}
+		d := webhookDelivery{
+			logger:   logger.Set("webhookURL", log.String(endpoint.URL)).Set("event", log.String(event.Type)),
+			endpoint: endpoint,
+			event:    event,
+			attempt:  1,
+		}
+		if err := n.enqueue(d); err != nil {
+			d.logger.LogErrorf("webhook not sent: %v", err)
+			n.addDeadLetter(d, 0, err)
+		}
+	}
+}
+
+// enqueue adds d to the queue without blocking
+func (n *webhookNotifier) enqueue(d webhookDelivery) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return errWebhooksClosed
+	}
+	n.pending.Add(1)
+	select {
+	case n.queue <- d:
+		return nil
+	default:
+		n.pending.Done()
+		return errWebhookQueueFull
+	}
+}
+
+// work sends queued deliveries until the notifier is closed
+func (n *webhookNotifier) work() {
+	defer n.workers.Done()
+	for {
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// deliver makes one attempt to send d, scheduling a retry when it fails and attempts are left
+func (n *webhookNotifier) deliver(d webhookDelivery) {
+	body, err := json.Marshal(d.event)
+	if err != nil {
+		d.logger.LogErrorf("problem encoding webhook event: %v", err)
+		n.pending.Done()
+		return
+	}
+	err = n.send(d.endpoint, d.event, body)
+	if err == nil {
+		d.logger.Log("delivered webhook")
+		n.pending.Done()
+		return
+	}
+	if d.attempt >= n.maxAttempts {
+		d.logger.LogErrorf("webhook failed after %d attempts: %v", d.attempt, err)
+		n.addDeadLetter(d, d.attempt, err)
+		n.pending.Done()
+		return
+	}
+	backoff := n.backoff << (d.attempt - 1)
+	d.logger.Logf("webhook attempt %d failed, retrying in %v: %v", d.attempt, backoff, err)
+	d.attempt++
+	n.retry(d, backoff)
+}
+
+// retry queues d again after backoff. It waits in a timer rather than a worker and stays pending until it's
+// queued or, when the queue is full or the notifier closes first, kept as a dead letter.
+func (n *webhookNotifier) retry(d webhookDelivery, backoff time.Duration) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		n.abandon(d, errWebhooksClosed)
+		return
+	}
+	if n.retries == nil {
+		n.retries = make(map[int]*webhookRetry)
+	}
+	n.nextRetry++
+	id := n.nextRetry
+	// the timer locks mu before reading retries, so it's set before the timer can fire
+	n.retries[id] = &webhookRetry{delivery: d}
+	n.retries[id].timer = time.AfterFunc(backoff, func() {
+		n.mu.Lock()
+		_, ok := n.retries[id]
+		delete(n.retries, id)
+		n.mu.Unlock()
+		if !ok {
+			return // close took it
+		}
+		err := n.enqueue(d)
+		if err != nil {
+			n.abandon(d, err)
+			return
+		}
+		n.pending.Done()
+	})
+	n.mu.Unlock()
+}
+
+// abandon keeps the pending delivery d, whose retry can't be queued, as a dead letter
+func (n *webhookNotifier) abandon(d webhookDelivery, err error) {
+	d.logger.LogErrorf("webhook failed after %d attempts: %v", d.attempt-1, err)
+	n.addDeadLetter(d, d.attempt-1, err)
+	n.pending.Done()
+}
+
+// addDeadLetter keeps d as an event which couldn't be delivered, dropping the oldest dead letter when there are
+// maxDeadLetters
+func (n *webhookNotifier) addDeadLetter(d webhookDelivery, attempts int, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.deadLetters) >= maxDeadLetters {
+		copy(n.deadLetters, n.deadLetters[1:])
+		n.deadLetters = n.deadLetters[:len(n.deadLetters)-1]
+	}
+	n.deadLetters = append(n.deadLetters, deadLetter{
+		URL:      d.endpoint.URL,
+		Event:    d.event,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Time:     time.Now(),
+	})
+}
+
+// send makes one request delivering event
+func (n *webhookNotifier) send(endpoint webhookEndpoint, event webhookEvent, body []byte) error {
+	req, err := http.NewRequest("POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wire-Event", event.Type)
+	req.Header.Set("X-Wire-Event-ID", event.ID)
+	req.Header.Set("X-Wire-Timestamp", timestamp)
+	req.Header.Set("X-Wire-Signature", webhookSignature(endpoint.Secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", errWebhookStatus, resp.Status)
+	}
+	return nil
+}
+
+// wait blocks until every queued delivery, including its retries, finishes
+func (n *webhookNotifier) wait() {
+	if n != nil {
+		n.pending.Wait()
+	}
+}
+
+// close stops accepting events, which become dead letters, and drains the queue before stopping the workers.
+// Deliveries waiting to be retried become dead letters rather than holding up shutdown.
+func (n *webhookNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.closed = true
+	retries := n.retries
+	n.retries = nil
+	n.mu.Unlock()
+
+	for _, r := range retries {
+		r.timer.Stop()
+		n.abandon(r.delivery, errWebhooksClosed)
+	}
+	n.pending.Wait()
+	n.stopOnce.Do(func() {
+		close(n.stop)
+	})
+	n.workers.Wait()
+}
+
+// getDeadLetters returns the events which couldn't be delivered, oldest first
+func (n *webhookNotifier) getDeadLetters() []deadLetter {
+	out := []deadLetter{}
+	if n == nil {
+		return out
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append(out, n.deadLetters...)
+}
+
+// readWebhookEndpoints reads a JSON array of webhook endpoints from path
+func readWebhookEndpoints(path string) ([]webhookEndpoint, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []webhookEndpoint
+	if err := json.Unmarshal(bs, &endpoints); err != nil {
+		return nil, err
+	}
+	for i, endpoint := range endpoints {
+		if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %d has an invalid url: %q", i, endpoint.URL)
+		}
+		if endpoint.Secret == "" {
+			return nil, fmt.Errorf("webhook %s is missing a secret", endpoint.URL)
+		}
+		for _, event := range endpoint.Events {
+			if !isWebhookEvent(event) {
+				return nil, fmt.Errorf("webhook %s: %w: %s", endpoint.URL, errUnknownWebhookEvent, event)
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+func isWebhookEvent(eventType string) bool {
+	for _, event := range webhookEvents {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// withWebhooks notifies endpoints of file events with notifier
+func withWebhooks(notifier *webhookNotifier) fileRoutesOption {
+	return func(opts *fileRoutesOptions) {
+		opts.webhooks = notifier
+	}
+}
+
+// readWebhookOptions returns the file route options configured by WEBHOOKS_FILE, WEBHOOK_MAX_ATTEMPTS
+// and WEBHOOK_BACKOFF
+func readWebhookOptions() ([]fileRoutesOption, error) {
+	path := os.Getenv("WEBHOOKS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	endpoints, err := readWebhookEndpoints(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOKS_FILE: %w", err)
+	}
+	notifier := newWebhookNotifier(endpoints)
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %q", v)
+		}
+		notifier.maxAttempts = attempts
+	}
+	if v := os.Getenv("WEBHOOK_BACKOFF"); v != "" {
+		backoff, err := time.ParseDuration(v)
+		if err != nil || backoff < 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_BACKOFF: %q", v)
+		}
+		notifier.backoff = backoff
+	}
+	return []fileRoutesOption{withWebhooks(notifier)}, nil
+}
+
+// notifyWebhooks sends an event of a file to the webhooks, err is set on validation failures
+func (opts *fileRoutesOptions) notifyWebhooks(logger log.Logger, r *http.Request, eventType, fileID string, err error) {
+	event := webhookEvent{
+		ID:        base.ID(),
+		Type:      eventType,
+		Time:      time.Now(),
+		FileID:    fileID,
+		UserID:    moovhttp.GetUserID(r),
+		RequestID: moovhttp.GetRequestID(r),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	opts.webhooks.notify(logger, event)
+}
+
+// notifyCreated sends the events of a created file, file.created and file.acknowledged for messages from the Fed
+func (opts *fileRoutesOptions) notifyCreated(logger log.Logger, r *http.Request, file *wire.File) {
+	opts.notifyWebhooks(logger, r, eventFileCreated, file.ID, nil)
+	if file.FEDWireMessage.OutputMessageAccountabilityData != nil {
+		opts.notifyWebhooks(logger, r, eventFileAcknowledged, file.ID, nil)
+	}
+}
+
+// getDeadLetters returns the webhook events which couldn't be delivered
+func getDeadLetters(logger log.Logger, opts *fileRoutesOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestLogger(logger, r)
+
+		w = wrapResponseWriter(logger, w, r)
+
+		letters := opts.webhooks.getDeadLetters()
+		logger.Logf("rendering %d dead letters", len(letters))
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(letters)))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(letters)
+	}
+}
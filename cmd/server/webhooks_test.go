@@ -0,0 +1,341 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the events posted to it, responding with the statuses in order and 200 after
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	events   []webhookEvent
+	requests int
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	t.Helper()
+	recv := &webhookReceiver{statuses: statuses}
+	recv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recv.mu.Lock()
+		defer recv.mu.Unlock()
+
+		recv.requests++
+		if len(recv.statuses) > 0 {
+			status := recv.statuses[0]
+			recv.statuses = recv.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, webhookSignature(secret, r.Header.Get("X-Wire-Timestamp"), body), r.Header.Get("X-Wire-Signature"))
+
+		var event webhookEvent
+		assert.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, event.Type, r.Header.Get("X-Wire-Event"))
+		assert.Equal(t, event.ID, r.Header.Get("X-Wire-Event-ID"))
+		recv.events = append(recv.events, event)
+	}))
+	t.Cleanup(recv.Close)
+	return recv
+}
+
+func (recv *webhookReceiver) eventTypes() []string {
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+
+	var out []string
+	for _, event := range recv.events {
+		out = append(out, event.Type)
+	}
+	return out
+}
+
+func TestWebhooks_signature(t *testing.T) {
+	sig := webhookSignature("secret", "1600000000", []byte(`{"id":"1"}`))
+	require.Equal(t, sig, webhookSignature("secret", "1600000000", []byte(`{"id":"1"}`)))
+	require.Len(t, sig, len("sha256=")+64)
+	require.NotEqual(t, sig, webhookSignature("other", "1600000000", []byte(`{"id":"1"}`)))
+	require.NotEqual(t, sig, webhookSignature("secret", "1600000001", []byte(`{"id":"1"}`)))
+}
+
+func TestWebhooks_fileEvents(t *testing.T) {
+	all := newWebhookReceiver(t, "all-secret")
+	deletes := newWebhookReceiver(t, "delete-secret")
+	notifier := newWebhookNotifier([]webhookEndpoint{
+		{URL: all.URL, Secret: "all-secret"},
+		{URL: deletes.URL, Secret: "delete-secret", Events: []string{eventFileDeleted}},
+	})
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)}, withWebhooks(notifier))
+
+	w := createFileJSON(t, router, mockFEDWireMessage())
+	require.Equal(t, http.StatusCreated, w.Code)
+	var file wire.File
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&file))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/files/"+file.ID+"/validate", nil),
+		httptest.NewRequest("DELETE", "/files/"+file.ID, nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	notifier.wait()
+
+	require.ElementsMatch(t, []string{eventFileCreated, eventFileValidated, eventFileDeleted}, all.eventTypes())
+	require.Equal(t, []string{eventFileDeleted}, deletes.eventTypes())
+	require.Equal(t, file.ID, deletes.events[0].FileID)
+}
+
+func TestWebhooks_validationFailed(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret")
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	router := mockApprovalRouter(t, withWebhooks(notifier))
+
+	req := httptest.NewRequest("DELETE", "/files/foo/tags/amount", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	notifier.wait()
+
+	require.ElementsMatch(t, []string{eventFileModified, eventFileValidationFailed}, recv.eventTypes())
+	for _, event := range recv.events {
+		if event.Type == eventFileValidationFailed {
+			require.Contains(t, event.Error, "Amount")
+		}
+	}
+}
+
+func TestWebhooks_approved(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret")
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret", Events: []string{eventFileApproved}}})
+	router := mockApprovalRouter(t, withWebhooks(notifier))
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "approve", "checker").Code)
+	notifier.wait()
+
+	require.Equal(t, []string{eventFileApproved}, recv.eventTypes())
+	require.Equal(t, "checker", recv.events[0].UserID)
+}
+
+func TestWebhooks_rejectedAndReleased(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret")
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret", Events: []string{eventFileRejected, eventFileReleased}}})
+	repo := &memoryWireFileRepository{files: make(map[string]*wire.File)}
+	for _, id := range []string{"foo", "bar"} {
+		require.NoError(t, repo.saveFile(&wire.File{ID: id, FEDWireMessage: mockFEDWireMessage()}))
+	}
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, repo, withWebhooks(notifier))
+
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "foo", "reject", "checker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "bar", "submit", "maker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "bar", "approve", "checker").Code)
+	require.Equal(t, http.StatusOK, transition(t, router, "bar", "release", "checker").Code)
+	notifier.wait()
+
+	require.ElementsMatch(t, []string{eventFileRejected, eventFileReleased}, recv.eventTypes())
+}
+
+func TestWebhooks_acknowledged(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret")
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	opts := &fileRoutesOptions{webhooks: notifier}
+
+	file := &wire.File{ID: "ack", FEDWireMessage: mockFEDWireMessage()}
+	file.FEDWireMessage.OutputMessageAccountabilityData = wire.NewOutputMessageAccountabilityData()
+	opts.notifyCreated(log.NewNopLogger(), httptest.NewRequest("POST", "/files/create", nil), file)
+	notifier.wait()
+
+	require.ElementsMatch(t, []string{eventFileCreated, eventFileAcknowledged}, recv.eventTypes())
+}
+
+func TestWebhooks_retry(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusBadGateway)
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	notifier.backoff = time.Millisecond
+
+	notifier.notify(log.NewNopLogger(), webhookEvent{ID: "1", Type: eventFileCreated, FileID: "foo"})
+	notifier.wait()
+
+	require.Equal(t, 3, recv.requests)
+	require.Equal(t, []string{eventFileCreated}, recv.eventTypes())
+	require.Empty(t, notifier.getDeadLetters())
+}
+
+func TestWebhooks_deadLetters(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusInternalServerError)
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	notifier.maxAttempts = 2
+	notifier.backoff = time.Millisecond
+
+	notifier.notify(log.NewNopLogger(), webhookEvent{ID: "1", Type: eventFileDeleted, FileID: "foo"})
+	notifier.wait()
+	require.Equal(t, 2, recv.requests)
+
+	router := mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)}, withWebhooks(notifier))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/webhooks/dead-letters", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	var letters []deadLetter
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&letters))
+	require.Len(t, letters, 1)
+	require.Equal(t, recv.URL, letters[0].URL)
+	require.Equal(t, "1", letters[0].Event.ID)
+	require.Equal(t, 2, letters[0].Attempts)
+	require.Contains(t, letters[0].Error, "500")
+
+	// without webhooks there are no dead letters
+	router = mux.NewRouter()
+	addFileRoutes(log.NewNopLogger(), router, &memoryWireFileRepository{files: make(map[string]*wire.File)})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/webhooks/dead-letters", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestWebhooks_queueFull(t *testing.T) {
+	// the receiver blocks until released so deliveries stay queued
+	release := make(chan struct{})
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer recv.Close()
+
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	for i := 0; i < webhookWorkers+webhookQueueSize+3; i++ {
+		notifier.notify(log.NewNopLogger(), webhookEvent{ID: "1", Type: eventFileCreated, FileID: "foo"})
+	}
+	close(release)
+	notifier.close()
+
+	letters := notifier.getDeadLetters()
+	require.NotEmpty(t, letters)
+	require.LessOrEqual(t, len(letters), webhookWorkers+3)
+	require.Equal(t, errWebhookQueueFull.Error(), letters[0].Error)
+	require.Zero(t, letters[0].Attempts)
+
+	// events after closing aren't sent
+	notifier.notify(log.NewNopLogger(), webhookEvent{ID: "2", Type: eventFileCreated, FileID: "foo"})
+	letters = notifier.getDeadLetters()
+	require.Equal(t, errWebhooksClosed.Error(), letters[len(letters)-1].Error)
+}
+
+func TestWebhooks_close(t *testing.T) {
+	recv := newWebhookReceiver(t, "secret", http.StatusInternalServerError)
+	notifier := newWebhookNotifier([]webhookEndpoint{{URL: recv.URL, Secret: "secret"}})
+	notifier.backoff = time.Hour
+
+	// queued deliveries finish before close returns, their retries become dead letters without waiting
+	notifier.notify(log.NewNopLogger(), webhookEvent{ID: "1", Type: eventFileCreated, FileID: "foo"})
+	start := time.Now()
+	notifier.close()
+	require.Less(t, time.Since(start), time.Minute)
+	require.Equal(t, 1, recv.requests)
+	require.Empty(t, recv.eventTypes())
+
+	letters := notifier.getDeadLetters()
+	require.Len(t, letters, 1)
+	require.Equal(t, 1, letters[0].Attempts)
+	require.Equal(t, errWebhooksClosed.Error(), letters[0].Error)
+
+	var nilNotifier *webhookNotifier
+	nilNotifier.close()
+}
+
+func TestWebhooks_retryQueueFull(t *testing.T) {
+	notifier := newWebhookNotifier(nil)
+	notifier.queue = make(chan webhookDelivery) // without workers nothing can be queued
+
+	notifier.pending.Add(1)
+	notifier.retry(webhookDelivery{logger: log.NewNopLogger(), event: webhookEvent{ID: "1"}, attempt: 3}, time.Millisecond)
+	notifier.wait()
+
+	letters := notifier.getDeadLetters()
+	require.Len(t, letters, 1)
+	require.Equal(t, 2, letters[0].Attempts)
+	require.Equal(t, errWebhookQueueFull.Error(), letters[0].Error)
+}
+
+func TestWebhooks_maxDeadLetters(t *testing.T) {
+	notifier := newWebhookNotifier(nil)
+	for i := 0; i < maxDeadLetters+2; i++ {
+		notifier.addDeadLetter(webhookDelivery{event: webhookEvent{ID: strconv.Itoa(i)}}, 1, errWebhookStatus)
+	}
+	letters := notifier.getDeadLetters()
+	require.Len(t, letters, maxDeadLetters)
+	require.Equal(t, "2", letters[0].Event.ID)
+	require.Equal(t, strconv.Itoa(maxDeadLetters+1), letters[len(letters)-1].Event.ID)
+}
+
+func TestWebhooks_readWebhookOptions(t *testing.T) {
+	t.Setenv("WEBHOOKS_FILE", writeAuthFile(t, "webhooks.json", `[
+  {"url": "https://ledger.example.com/wire", "secret": "s3cret", "events": ["file.created", "file.approved"]}
+]`))
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_BACKOFF", "250ms")
+	opts, err := readWebhookOptions()
+	require.NoError(t, err)
+
+	cfg := &fileRoutesOptions{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	require.NotNil(t, cfg.webhooks)
+	require.Equal(t, 3, cfg.webhooks.maxAttempts)
+	require.Equal(t, 250*time.Millisecond, cfg.webhooks.backoff)
+	require.True(t, cfg.webhooks.endpoints[0].subscribed(eventFileApproved))
+	require.False(t, cfg.webhooks.endpoints[0].subscribed(eventFileDeleted))
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "0")
+	_, err = readWebhookOptions()
+	require.Error(t, err)
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "")
+
+	for _, contents := range []string{
+		`[{"url": "ftp://ledger.example.com", "secret": "s3cret"}]`,
+		`[{"url": "https://ledger.example.com"}]`,
+		`{}`,
+	} {
+		t.Setenv("WEBHOOKS_FILE", writeAuthFile(t, "webhooks.json", contents))
+		_, err = readWebhookOptions()
+		require.Error(t, err, contents)
+	}
+
+	t.Setenv("WEBHOOKS_FILE", writeAuthFile(t, "webhooks.json", `[{"url": "https://ledger.example.com", "secret": "s", "events": ["file.sent"]}]`))
+	_, err = readWebhookOptions()
+	require.True(t, errors.Is(err, errUnknownWebhookEvent))
+
+	t.Setenv("WEBHOOKS_FILE", "")
+	opts, err = readWebhookOptions()
+	require.NoError(t, err)
+	require.Empty(t, opts)
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCreditNotifications is returned when there are no FEDWireMessages to export
+var ErrNoCreditNotifications = errors.New("no FEDWireMessages to export")
+
+// CreditNotificationOptions are the details of a camt.054 or BAI2 export which aren't part of the FEDWireMessages
+type CreditNotificationOptions struct {
+	// MessageID identifies the export, it's the camt.054 GrpHdr/MsgId and BAI2 file identification number
+	MessageID string `json:"messageID"`
+	// CreationTime of the export, defaults to the current time
+	CreationTime time.Time `json:"creationTime"`
+	// SenderID is the bank sending the report, e.g. its routing number. Used in the BAI2 file and group headers.
+	SenderID string `json:"senderID"`
+	// ReceiverID is the customer receiving the report. Used in the BAI2 file and group headers.
+	ReceiverID string `json:"receiverID"`
+}
+
+func (opts CreditNotificationOptions) creationTime() time.Time {
+	if opts.CreationTime.IsZero() {
+		return time.Now()
+	}
+	return opts.CreationTime
+}
+
+// creditNotification is a received FEDWireMessage ready for export
+type creditNotification struct {
+	fwm FEDWireMessage
+	// account is the beneficiary's account credited
+	account string
+	// cents is the Amount {2000} of the wire
+	cents int64
+	// valueDate is the OutputCycleDate of the OMAD
+	valueDate time.Time
+	// booked is the ReceiptTimeStamp {1110} of the wire, when present
+	booked time.Time
+}
+
+func (cn creditNotification) imad() string {
+	imad := cn.fwm.InputMessageAccountabilityData
+	if imad == nil {
+		return ""
+	}
+	return imad.InputCycleDate + imad.InputSource + imad.InputSequenceNumber
+}
+
+func (cn creditNotification) omad() string {
+	omad := cn.fwm.OutputMessageAccountabilityData
+	return omad.OutputCycleDate + omad.OutputDestinationID + omad.OutputSequenceNumber +
+		omad.OutputDate + omad.OutputTime + omad.OutputFRBApplicationIdentification
+}
+
+// creditNotificationAccount is a beneficiary account and the wires which credited it
+type creditNotificationAccount struct {
+	account       string
+	notifications []creditNotification
+}
+
+// newCreditNotifications checks each message was received (has OutputMessageAccountabilityData) and
+// returns them grouped by beneficiary account, sorted by account and then OMAD.
+func newCreditNotifications(msgs []FEDWireMessage) ([]creditNotificationAccount, error) {
+	if len(msgs) == 0 {
+		return nil, ErrNoCreditNotifications
+	}
+	byAccount := make(map[string][]creditNotification)
+	for i := range msgs {
+		cn, err := newCreditNotification(msgs[i])
+		if err != nil {
+			return nil, err
+		}
+		byAccount[cn.account] = append(byAccount[cn.account], cn)
+	}
+
+	accounts := make([]creditNotificationAccount, 0, len(byAccount))
+	for account, notifications := range byAccount {
+		sort.SliceStable(notifications, func(i, j int) bool {
+			return notifications[i].omad() < notifications[j].omad()
+		})
+		accounts = append(accounts, creditNotificationAccount{account: account, notifications: notifications})
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].account < accounts[j].account
+	})
+	return accounts, nil
+}
+
+func newCreditNotification(fwm FEDWireMessage) (creditNotification, error) {
+	cn := creditNotification{fwm: fwm}
+
+	omad := fwm.OutputMessageAccountabilityData
+	if omad == nil {
+		return cn, fieldError("OutputMessageAccountabilityData", ErrFieldRequired)
+	}
+	valueDate, err := time.Parse("20060102", omad.OutputCycleDate)
+	if err != nil {
+		return cn, fieldError("OutputCycleDate", ErrValidDate, omad.OutputCycleDate)
+	}
+	cn.valueDate = valueDate
+
+	if fwm.Amount == nil {
+		return cn, fieldError("Amount", ErrFieldRequired)
+	}
+	cents, err := strconv.ParseInt(fwm.Amount.Amount, 10, 64)
+	if err != nil || cents < 0 {
+		return cn, fieldError("Amount", ErrNonAmount, fwm.Amount.Amount)
+	}
+	cn.cents = cents
+
+	if fwm.Beneficiary == nil || strings.TrimSpace(fwm.Beneficiary.Personal.Identifier) == "" {
+		return cn, fieldError("Beneficiary.Personal.Identifier", ErrFieldRequired)
+	}
+	cn.account = strings.TrimSpace(fwm.Beneficiary.Personal.Identifier)
+
+	// ReceiptTimeStamp has no year, so take it from the cycle date
+	if rts := fwm.ReceiptTimeStamp; rts != nil && rts.ReceiptDate != "" && rts.ReceiptTime != "" {
+		booked, err := time.Parse("20060102 1504", omad.OutputCycleDate[:4]+rts.ReceiptDate+" "+rts.ReceiptTime)
+		if err == nil {
+			cn.booked = booked
+		}
+	}
+	return cn, nil
+}
+
+// international reports if the wire was a foreign exchange transfer, i.e. it was instructed in another currency
+func (cn creditNotification) international() bool {
+	ia := cn.fwm.InstructedAmount
+	return ia != nil && ia.CurrencyCode != "" && ia.CurrencyCode != "USD"
+}
+
+// remittanceLines returns the OriginatorToBeneficiary {6000} lines of the wire
+func (cn creditNotification) remittanceLines() []string {
+	if obi := cn.fwm.OriginatorToBeneficiary; obi != nil {
+		return nonEmpty(obi.LineOne, obi.LineTwo, obi.LineThree, obi.LineFour)
+	}
+	return nil
+}
+
+// formatCents renders an amount in cents with a decimal period, e.g. 12345.67
+func formatCents(cents int64) string {
+	return strconv.FormatInt(cents/100, 10) + "." + strconv.FormatInt(100+cents%100, 10)[1:]
+}
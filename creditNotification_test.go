@@ -0,0 +1,84 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockCreditNotificationData creates a received CustomerTransfer crediting account 1234
+func mockCreditNotificationData() FEDWireMessage {
+	fwm := mockCustomerTransferData()
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.Originator = mockOriginator()
+	fwm.SenderReference = mockSenderReference()
+	fwm.OutputMessageAccountabilityData = mockOutputMessageAccountabilityData()
+	fwm.ReceiptTimeStamp = mockReceiptTimeStamp()
+	return fwm
+}
+
+func mockCreditNotificationOptions() CreditNotificationOptions {
+	return CreditNotificationOptions{
+		MessageID:    "MSG0001",
+		CreationTime: time.Date(2019, time.May, 2, 13, 0, 0, 0, time.UTC),
+		SenderID:     "231380104",
+		ReceiverID:   "CUSTOMER1",
+	}
+}
+
+func TestNewCreditNotifications(t *testing.T) {
+	first := mockCreditNotificationData()
+	second := mockCreditNotificationData()
+	second.Beneficiary.Personal.Identifier = "0001"
+	third := mockCreditNotificationData()
+	third.OutputMessageAccountabilityData.OutputSequenceNumber = "000000"
+
+	accounts, err := newCreditNotifications([]FEDWireMessage{first, second, third})
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, "0001", accounts[0].account)
+	require.Equal(t, "1234", accounts[1].account)
+	require.Len(t, accounts[1].notifications, 2)
+	require.Equal(t, "000000", accounts[1].notifications[0].fwm.OutputMessageAccountabilityData.OutputSequenceNumber)
+
+	cn := accounts[0].notifications[0]
+	require.Equal(t, int64(1234567), cn.cents)
+	require.Equal(t, time.Date(2019, time.May, 2, 0, 0, 0, 0, time.UTC), cn.valueDate)
+	require.Equal(t, time.Date(2019, time.May, 2, 12, 30, 0, 0, time.UTC), cn.booked)
+	require.Equal(t, "20190502Source0800000105021230B123", cn.omad())
+}
+
+func TestNewCreditNotificationsErrors(t *testing.T) {
+	_, err := newCreditNotifications(nil)
+	require.Equal(t, ErrNoCreditNotifications, err)
+
+	fwm := mockCreditNotificationData()
+	fwm.OutputMessageAccountabilityData = nil
+	_, err = newCreditNotifications([]FEDWireMessage{fwm})
+	require.EqualError(t, err, fieldError("OutputMessageAccountabilityData", ErrFieldRequired).Error())
+
+	fwm = mockCreditNotificationData()
+	fwm.OutputMessageAccountabilityData.OutputCycleDate = "2019"
+	_, err = newCreditNotifications([]FEDWireMessage{fwm})
+	require.EqualError(t, err, fieldError("OutputCycleDate", ErrValidDate, "2019").Error())
+
+	fwm = mockCreditNotificationData()
+	fwm.Amount.Amount = "12.34"
+	_, err = newCreditNotifications([]FEDWireMessage{fwm})
+	require.EqualError(t, err, fieldError("Amount", ErrNonAmount, "12.34").Error())
+
+	fwm = mockCreditNotificationData()
+	fwm.Beneficiary = nil
+	_, err = newCreditNotifications([]FEDWireMessage{fwm})
+	require.EqualError(t, err, fieldError("Beneficiary.Personal.Identifier", ErrFieldRequired).Error())
+}
+
+func TestFormatCents(t *testing.T) {
+	require.Equal(t, "0.05", formatCents(5))
+	require.Equal(t, "12345.67", formatCents(1234567))
+}
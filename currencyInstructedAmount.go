@@ -109,12 +109,27 @@ func (cia *CurrencyInstructedAmount) Validate() error {
 	if err := cia.isAlphanumeric(cia.SwiftFieldTag); err != nil {
 		return fieldError("SwiftFieldTag", err, cia.SwiftFieldTag)
 	}
-	if err := cia.isAmount(cia.Amount); err != nil {
+	code, amount := cia.currencyAmount()
+	if code != "" {
+		if err := cia.isCurrencyCode(code); err != nil {
+			return fieldError("Amount", err, cia.Amount)
+		}
+	}
+	if err := cia.isAmount(amount); err != nil {
 		return fieldError("Amount", err, cia.Amount)
 	}
 	return nil
 }
 
+// currencyAmount splits Amount into the ISO 4217 currency code it may begin with (e.g. USD1500,49)
+// and the remaining amount. code is empty when Amount has no currency code.
+func (cia *CurrencyInstructedAmount) currencyAmount() (code string, amount string) {
+	if len(cia.Amount) >= 3 && strings.IndexFunc(cia.Amount[:3], func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+		return cia.Amount[:3], cia.Amount[3:]
+	}
+	return "", cia.Amount
+}
+
 // SwiftFieldTagField gets a string of the SwiftFieldTag field
 func (cia *CurrencyInstructedAmount) SwiftFieldTagField() string {
 	return cia.alphaField(cia.SwiftFieldTag, 5)
@@ -123,7 +138,11 @@ func (cia *CurrencyInstructedAmount) SwiftFieldTagField() string {
 // ToDo: The spec isn't clear if this is padded with zeros or not, so for now it is
 
 // AmountField gets a string of the AmountTag field
+// When Amount begins with a currency code only the amount following it is zero padded.
 func (cia *CurrencyInstructedAmount) AmountField() string {
+	if code, amount := cia.currencyAmount(); code != "" {
+		return code + cia.numericStringField(amount, 15)
+	}
 	return cia.numericStringField(cia.Amount, 18)
 }
 
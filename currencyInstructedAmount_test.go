@@ -113,3 +113,17 @@ func TestStringCurrencyInstructedAmountOptions(t *testing.T) {
 	require.Equal(t, record.Format(FormatOptions{VariableLengthFields: true}), "{7033}*000000000001500,49")
 	require.Equal(t, record.String(), record.Format(FormatOptions{VariableLengthFields: false}))
 }
+
+// TestCurrencyInstructedAmountCurrencyCode validates a CurrencyInstructedAmount Amount beginning with a currency code
+func TestCurrencyInstructedAmountCurrencyCode(t *testing.T) {
+	cia := mockCurrencyInstructedAmount()
+	cia.Amount = "EUR1500,49"
+
+	require.NoError(t, cia.Validate())
+	require.Equal(t, "EUR000000001500,49", cia.AmountField())
+
+	cia.Amount = "ZZZ1500,49"
+	err := cia.Validate()
+
+	require.EqualError(t, err, fieldError("Amount", ErrNonCurrencyCode, cia.Amount).Error())
+}
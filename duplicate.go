@@ -0,0 +1,61 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Fingerprint returns a canonical fingerprint of the business fields identifying a funds transfer: the Amount,
+// sender and receiver ABA numbers, Beneficiary identifier and SenderReference. Messages with the same fingerprint
+// created close together likely pay the same beneficiary twice, callers compare them within a window of creation
+// dates. The IMAD isn't part of the fingerprint as it's only stamped when a message is released.
+//
+// Amounts are compared without leading zeros, other fields without surrounding spaces and regardless of case.
+func (fwm FEDWireMessage) Fingerprint() string {
+	var amount, beneficiary, reference string
+	if fwm.Amount != nil {
+		amount = strings.TrimLeft(strings.TrimSpace(fwm.Amount.Amount), "0")
+	}
+	if fwm.Beneficiary != nil {
+		beneficiary = fwm.Beneficiary.Personal.Identifier
+	}
+	if fwm.SenderReference != nil {
+		reference = fwm.SenderReference.SenderReference
+	}
+
+	h := sha256.New()
+	for _, v := range []string{amount, fwm.senderABANumber(), fwm.receiverABANumber(), beneficiary, reference} {
+		h.Write([]byte(strings.ToUpper(strings.TrimSpace(v))))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IsResend reports if the MessageDuplicationCode of SenderSupplied marks the message as a resend
+func (fwm FEDWireMessage) IsResend() bool {
+	return fwm.SenderSupplied != nil && fwm.SenderSupplied.MessageDuplicationCode == MessageDuplicationResend
+}
+
+// NewResend returns a copy of original with the MessageDuplicationCode of SenderSupplied set to
+// MessageDuplicationResend, for an operator to intentionally send a message again. The IMAD is kept.
+func NewResend(original FEDWireMessage) (FEDWireMessage, error) {
+	if original.SenderSupplied == nil {
+		return FEDWireMessage{}, fieldError("SenderSupplied", ErrFieldRequired)
+	}
+	bs, err := json.Marshal(original)
+	if err != nil {
+		return FEDWireMessage{}, err
+	}
+	var fwm FEDWireMessage
+	if err := json.Unmarshal(bs, &fwm); err != nil {
+		return FEDWireMessage{}, err
+	}
+	fwm.SenderSupplied.MessageDuplicationCode = MessageDuplicationResend
+	return fwm, nil
+}
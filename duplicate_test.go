@@ -0,0 +1,65 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockDuplicateData returns a CustomerTransfer with a SenderReference
+func mockDuplicateData() FEDWireMessage {
+	fwm := mockReversalOriginal()
+	fwm.SenderReference = mockSenderReference()
+	return fwm
+}
+
+func TestFEDWireMessage_Fingerprint(t *testing.T) {
+	fwm := mockDuplicateData()
+	fingerprint := fwm.Fingerprint()
+	require.Len(t, fingerprint, 64)
+
+	// a retry of the same message has the same fingerprint
+	retry := mockDuplicateData()
+	retry.InputMessageAccountabilityData.InputSequenceNumber = "000002"
+	retry.InputMessageAccountabilityData.InputCycleDate = "20991231"
+	retry.Amount.Amount = strings.TrimLeft(retry.Amount.Amount, "0")
+	retry.SenderReference.SenderReference = " sender reference"
+	require.Equal(t, fingerprint, retry.Fingerprint())
+
+	other := mockDuplicateData()
+	other.Beneficiary.Personal.Identifier = "987654321"
+	require.NotEqual(t, fingerprint, other.Fingerprint())
+
+	other = mockDuplicateData()
+	other.Amount.Amount = "000000000001"
+	require.NotEqual(t, fingerprint, other.Fingerprint())
+
+	require.NotEmpty(t, FEDWireMessage{}.Fingerprint())
+}
+
+func TestNewResend(t *testing.T) {
+	original := mockDuplicateData()
+	require.False(t, original.IsResend())
+
+	fwm, err := NewResend(original)
+	require.NoError(t, err)
+	require.True(t, fwm.IsResend())
+	require.Equal(t, MessageDuplicationResend, fwm.SenderSupplied.MessageDuplicationCode)
+	require.Equal(t, original.InputMessageAccountabilityData.Identifier(), fwm.InputMessageAccountabilityData.Identifier())
+	require.Equal(t, original.Fingerprint(), fwm.Fingerprint())
+
+	// the original is not modified
+	require.Equal(t, MessageDuplicationOriginal, original.SenderSupplied.MessageDuplicationCode)
+
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Validate())
+
+	_, err = NewResend(FEDWireMessage{})
+	require.Error(t, err)
+}
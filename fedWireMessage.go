@@ -136,6 +136,11 @@ type FEDWireMessage struct {
 // verify checks basic WIRE rules. Assumes properly parsed records. Each validation func should
 // check for the expected relationships between fields within a FedWireMessage.
 func (fwm *FEDWireMessage) verify(isIncoming bool) error {
+	return fwm.verifyWithOpts(isIncoming, nil)
+}
+
+// verifyWithOpts checks basic WIRE rules along with the optional checks enabled in opts.
+func (fwm *FEDWireMessage) verifyWithOpts(isIncoming bool, opts *ValidateOpts) error {
 
 	if err := fwm.mandatoryFields(isIncoming); err != nil {
 		return err
@@ -191,6 +196,32 @@ func (fwm *FEDWireMessage) verify(isIncoming bool) error {
 	if err := fwm.isRemittanceValid(); err != nil {
 		return err
 	}
+
+	if opts != nil && opts.CheckExchangeRate {
+		if err := fwm.validateExchangeRateConsistency(opts.ExchangeRateTolerance); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.Environment != "" {
+		if err := fwm.ValidateEnvironment(opts.Environment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateEnvironment checks the TestProductionCode of SenderSupplied is env, EnvironmentTest or EnvironmentProduction,
+// so test messages can't be sent in production and production messages can't be sent in test.
+func (fwm *FEDWireMessage) ValidateEnvironment(env string) error {
+	if env != EnvironmentTest && env != EnvironmentProduction {
+		return fieldError("Environment", ErrTestProductionCode, env)
+	}
+	if fwm.SenderSupplied == nil {
+		return fieldError("SenderSupplied", ErrFieldRequired)
+	}
+	if fwm.SenderSupplied.TestProductionCode != env {
+		return fieldError("TestProductionCode", ErrEnvironmentMismatch, fwm.SenderSupplied.TestProductionCode)
+	}
 	return nil
 }
 
@@ -1462,6 +1493,9 @@ func (fwm *FEDWireMessage) otherTransferInformation() error {
 	if err := fwm.validateExchangeRate(); err != nil {
 		return err
 	}
+	if err := fwm.validateCurrencyAmounts(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package wire
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -1185,3 +1186,32 @@ func TestInvalidAccountCreditedDrawdownForCustomerTransferPlus(t *testing.T) {
 	expected := fieldError("AccountCreditedDrawdown", ErrInvalidProperty, fwm.AccountCreditedDrawdown).Error()
 	require.EqualError(t, err, expected)
 }
+
+// TestFEDWireMessage_ValidateEnvironment validates the TestProductionCode is checked against the environment
+func TestFEDWireMessage_ValidateEnvironment(t *testing.T) {
+	fwm := mockCustomerTransferData()
+	require.NoError(t, fwm.ValidateEnvironment(EnvironmentProduction))
+
+	err := fwm.ValidateEnvironment(EnvironmentTest)
+	require.EqualError(t, err, fieldError("TestProductionCode", ErrEnvironmentMismatch, EnvironmentProduction).Error())
+
+	err = fwm.ValidateEnvironment("X")
+	require.EqualError(t, err, fieldError("Environment", ErrTestProductionCode, "X").Error())
+
+	fwm.SenderSupplied = nil
+	require.EqualError(t, fwm.ValidateEnvironment(EnvironmentTest), fieldError("SenderSupplied", ErrFieldRequired).Error())
+}
+
+// TestFile_ValidateWithEnvironment validates ValidateOpts.Environment
+func TestFile_ValidateWithEnvironment(t *testing.T) {
+	file := NewFile()
+	file.AddFEDWireMessage(mockReversalOriginal())
+	require.NoError(t, file.ValidateWith(&ValidateOpts{Environment: EnvironmentProduction}))
+
+	err := file.ValidateWith(&ValidateOpts{Environment: EnvironmentTest})
+	require.True(t, errors.Is(err, ErrEnvironmentMismatch))
+
+	file.FEDWireMessage.SenderSupplied.TestProductionCode = EnvironmentTest
+	file.SetValidation(&ValidateOpts{Environment: EnvironmentTest})
+	require.NoError(t, file.Validate())
+}
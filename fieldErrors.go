@@ -22,6 +22,10 @@ var (
 	ErrNonAmount = errors.New("is an incorrect amount format")
 	// ErrNonCurrencyCode is returned for an incorrect currency code
 	ErrNonCurrencyCode = errors.New("is not a recognized currency code")
+	// ErrCurrencyPrecision is returned when an amount has more decimal places than its currency allows
+	ErrCurrencyPrecision = errors.New("has more decimal places than the currency allows")
+	// ErrNonFinite is returned when a number, such as ValidateOpts.ExchangeRateTolerance, is NaN or infinite
+	ErrNonFinite = errors.New("is not a finite number")
 	// ErrUpperAlpha is returned when a field is not in uppercase
 	ErrUpperAlpha = errors.New("is not uppercase A-Z or 0-9")
 	// ErrFieldInclusion is returned when a field is mandatory and has a default value
@@ -51,6 +55,8 @@ var (
 	ErrFormatVersion = errors.New("is not 30")
 	// ErrTestProductionCode is returned for an invalid TestProductionCode
 	ErrTestProductionCode = errors.New("is an invalid test production code")
+	// ErrEnvironmentMismatch is returned when a TestProductionCode does not match the environment messages are validated for
+	ErrEnvironmentMismatch = errors.New("does not match the environment")
 	// ErrMessageDuplicationCode is returned for an invalid MessageDuplicationCode
 	ErrMessageDuplicationCode = errors.New("is an invalid message duplication code")
 
@@ -232,3 +238,26 @@ func NewFieldWrongLengthErr(FieldLength, length int) FieldWrongLengthErr {
 func (e FieldWrongLengthErr) Error() string {
 	return e.Message
 }
+
+// ErrExchangeRateMismatch is the error given when InstructedAmount converted with ExchangeRate does not equal Amount
+type ErrExchangeRateMismatch struct {
+	Message      string
+	ExchangeRate string
+	// ImpliedRate is Amount {2000} divided by InstructedAmount {3710}
+	ImpliedRate string
+	Tolerance   float64
+}
+
+// NewErrExchangeRateMismatch creates a new error of the ErrExchangeRateMismatch type
+func NewErrExchangeRateMismatch(exchangeRate, impliedRate string, tolerance float64) ErrExchangeRateMismatch {
+	return ErrExchangeRateMismatch{
+		Message:      fmt.Sprintf("ExchangeRate: %v differs from implied rate %v by more than %v", exchangeRate, impliedRate, tolerance),
+		ExchangeRate: exchangeRate,
+		ImpliedRate:  impliedRate,
+		Tolerance:    tolerance,
+	}
+}
+
+func (e ErrExchangeRateMismatch) Error() string {
+	return e.Message
+}
@@ -16,6 +16,25 @@ type File struct {
 	FEDWireMessage FEDWireMessage `json:"fedWireMessage"`
 
 	isIncoming bool `json:"-"`
+
+	validateOpts *ValidateOpts
+}
+
+// ValidateOpts contains specific overrides from the default set of validations
+// performed on a Wire file. The zero value performs the default validations.
+type ValidateOpts struct {
+	// CheckExchangeRate requires InstructedAmount {3710} multiplied by ExchangeRate {3720}
+	// to equal Amount {2000} within ExchangeRateTolerance.
+	CheckExchangeRate bool `json:"checkExchangeRate"`
+
+	// ExchangeRateTolerance is the relative difference allowed between Amount {2000} and the
+	// converted InstructedAmount {3710}, e.g. 0.01 for 1%. DefaultExchangeRateTolerance is used when zero
+	// and NaN or infinite values fail validation with ErrNonFinite.
+	ExchangeRateTolerance float64 `json:"exchangeRateTolerance"`
+
+	// Environment, EnvironmentTest or EnvironmentProduction, requires the TestProductionCode of
+	// SenderSupplied {1500} to match. Any environment is accepted when empty.
+	Environment string `json:"environment"`
 }
 
 // NewFile constructs a file template
@@ -35,6 +54,26 @@ func (f *File) AddFEDWireMessage(fwm FEDWireMessage) FEDWireMessage {
 	return f.FEDWireMessage
 }
 
+// Copy returns a deep copy of the File which shares no tags with it
+func (f *File) Copy() (*File, error) {
+	bs, err := json.Marshal(f.FEDWireMessage)
+	if err != nil {
+		return nil, err
+	}
+	out := &File{
+		ID:         f.ID,
+		isIncoming: f.isIncoming,
+	}
+	if err := json.Unmarshal(bs, &out.FEDWireMessage); err != nil {
+		return nil, err
+	}
+	if f.validateOpts != nil {
+		opts := *f.validateOpts
+		out.validateOpts = &opts
+	}
+	return out, nil
+}
+
 // Create will tabulate and assemble an WIRE file into a valid state.
 //
 // Create implementations are free to modify computable fields in a file and should
@@ -45,7 +84,21 @@ func (f *File) Create() error {
 
 // Validate will never modify the file.
 func (f *File) Validate() error {
-	if err := f.FEDWireMessage.verify(f.isIncoming); err != nil {
+	return f.ValidateWith(f.validateOpts)
+}
+
+// SetValidation stores ValidateOpts on the File which are to be used in Validate()
+func (f *File) SetValidation(opts *ValidateOpts) {
+	if f == nil {
+		return
+	}
+	f.validateOpts = opts
+}
+
+// ValidateWith performs the same checks as Validate along with any additional checks
+// enabled by opts. Passing nil performs the default validations.
+func (f *File) ValidateWith(opts *ValidateOpts) error {
+	if err := f.FEDWireMessage.verifyWithOpts(f.isIncoming, opts); err != nil {
 		return err
 	}
 	return nil
@@ -27,3 +27,22 @@ func TestFile__FileFromJSON(t *testing.T) {
 	require.Empty(t, file.ID, "id should not have been set")
 	require.NotNil(t, file.FEDWireMessage.FIAdditionalFIToFI, "FIAdditionalFIToFI shouldn't be nil")
 }
+
+func TestFile_Copy(t *testing.T) {
+	file := NewFile()
+	file.ID = "foo"
+	file.AddFEDWireMessage(mockReversalOriginal())
+	file.SetValidation(&ValidateOpts{CheckExchangeRate: true})
+
+	cp, err := file.Copy()
+	require.NoError(t, err)
+	require.Equal(t, "foo", cp.ID)
+	require.Equal(t, file.FEDWireMessage, cp.FEDWireMessage)
+	require.NoError(t, cp.Validate())
+
+	// tags and options aren't shared
+	cp.FEDWireMessage.Amount.Amount = "000000000001"
+	cp.validateOpts.CheckExchangeRate = false
+	require.NotEqual(t, "000000000001", file.FEDWireMessage.Amount.Amount)
+	require.True(t, file.validateOpts.CheckExchangeRate)
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DefaultExchangeRateTolerance is the relative difference allowed between Amount {2000} and
+// InstructedAmount {3710} multiplied by ExchangeRate {3720} when ValidateOpts.ExchangeRateTolerance is zero.
+const DefaultExchangeRateTolerance = 0.005
+
+// ImpliedExchangeRate returns the exchange rate applied by the message when converting
+// InstructedAmount {3710} into Amount {2000}, which is Amount divided by InstructedAmount.
+func (fwm *FEDWireMessage) ImpliedExchangeRate() (float64, error) {
+	rate, err := fwm.impliedExchangeRate()
+	if err != nil {
+		return 0, err
+	}
+	f, _ := rate.Float64()
+	return f, nil
+}
+
+func (fwm *FEDWireMessage) impliedExchangeRate() (*big.Rat, error) {
+	if fwm.Amount == nil {
+		return nil, fieldError("Amount", ErrFieldRequired)
+	}
+	if fwm.InstructedAmount == nil {
+		return nil, fieldError("InstructedAmount", ErrFieldRequired)
+	}
+	if fwm.Amount.Amount == "" || numericRegex.MatchString(fwm.Amount.Amount) {
+		return nil, fieldError("Amount", ErrNonAmount, fwm.Amount.Amount)
+	}
+	amount, _ := new(big.Rat).SetString(fwm.Amount.Amount)
+	amount.Quo(amount, big.NewRat(100, 1)) // Amount has an implied decimal point
+
+	instructed, _, err := parseDecimalAmount(fwm.InstructedAmount.Amount)
+	if err != nil {
+		return nil, fieldError("InstructedAmount.Amount", err, fwm.InstructedAmount.Amount)
+	}
+	if instructed.Sign() == 0 {
+		return nil, fieldError("InstructedAmount.Amount", ErrNonAmount, fwm.InstructedAmount.Amount)
+	}
+	return amount.Quo(amount, instructed), nil
+}
+
+// validateExchangeRateConsistency checks InstructedAmount {3710} multiplied by ExchangeRate {3720}
+// equals Amount {2000}, allowing a relative difference of tolerance.
+func (fwm *FEDWireMessage) validateExchangeRateConsistency(tolerance float64) error {
+	if fwm.ExchangeRate == nil {
+		return nil
+	}
+	if math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+		return fieldError("ExchangeRateTolerance", ErrNonFinite, fmt.Sprint(tolerance))
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultExchangeRateTolerance
+	}
+	implied, err := fwm.impliedExchangeRate()
+	if err != nil {
+		return err
+	}
+	rate, _, err := parseDecimalAmount(fwm.ExchangeRate.ExchangeRate)
+	if err != nil {
+		return fieldError("ExchangeRate", err, fwm.ExchangeRate.ExchangeRate)
+	}
+	if implied.Sign() == 0 {
+		return NewErrExchangeRateMismatch(fwm.ExchangeRate.ExchangeRate, formatExchangeRate(implied), tolerance)
+	}
+
+	// |InstructedAmount * ExchangeRate - Amount| / Amount reduces to |ExchangeRate - implied| / implied
+	diff := new(big.Rat).Sub(rate, implied)
+	diff.Abs(diff).Quo(diff, implied)
+	limit := new(big.Rat).SetFloat64(tolerance)
+	if limit == nil {
+		return fieldError("ExchangeRateTolerance", ErrNonFinite, fmt.Sprint(tolerance))
+	}
+	if diff.Cmp(limit) > 0 {
+		return NewErrExchangeRateMismatch(fwm.ExchangeRate.ExchangeRate, formatExchangeRate(implied), tolerance)
+	}
+	return nil
+}
+
+// validateCurrencyAmounts checks the currency codes of InstructedAmount {3710} and CurrencyInstructedAmount {7033}
+// are recognized and their amounts have no more decimal places than the currency's minor units.
+func (fwm *FEDWireMessage) validateCurrencyAmounts() error {
+	v := &validator{}
+	if ia := fwm.InstructedAmount; ia != nil {
+		if err := v.isCurrencyCode(ia.CurrencyCode); err != nil {
+			return fieldError("InstructedAmount.CurrencyCode", err, ia.CurrencyCode)
+		}
+		if err := v.isCurrencyAmount(ia.CurrencyCode, ia.Amount); err != nil {
+			return fieldError("InstructedAmount.Amount", err, ia.Amount)
+		}
+	}
+	if cia := fwm.CurrencyInstructedAmount; cia != nil {
+		if code, amount := cia.currencyAmount(); code != "" {
+			if err := v.isCurrencyAmount(code, amount); err != nil {
+				return fieldError("CurrencyInstructedAmount.Amount", err, cia.Amount)
+			}
+		}
+	}
+	return nil
+}
+
+// parseDecimalAmount parses an amount using a single decimal comma (or period) marker, such as 1234,56,
+// and returns its value along with the number of decimal places.
+func parseDecimalAmount(s string) (*big.Rat, int, error) {
+	whole, frac := strings.TrimSpace(s), ""
+	if i := strings.IndexAny(whole, ",."); i >= 0 {
+		whole, frac = whole[:i], whole[i+1:]
+	}
+	if whole == "" || numericRegex.MatchString(whole) || numericRegex.MatchString(frac) {
+		return nil, 0, ErrNonAmount
+	}
+	value := whole
+	if frac != "" {
+		value += "." + frac
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, 0, ErrNonAmount
+	}
+	return r, len(frac), nil
+}
+
+// formatExchangeRate renders r like an ExchangeRate {3720} value, e.g. 1,2345
+func formatExchangeRate(r *big.Rat) string {
+	s := strings.TrimRight(r.FloatString(6), "0")
+	s = strings.TrimSuffix(s, ".")
+	return strings.Replace(s, ".", ",", 1)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockForeignExchangeData returns a CustomerTransfer converting EUR 10000,00 into USD 12345.67
+func mockForeignExchangeData() FEDWireMessage {
+	fwm := mockCustomerTransferData()
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.Originator = mockOriginator()
+	fwm.InstructedAmount = mockInstructedAmount()
+	fwm.InstructedAmount.CurrencyCode = "EUR"
+	fwm.InstructedAmount.Amount = "10000,00"
+	fwm.ExchangeRate = mockExchangeRate()
+	fwm.ExchangeRate.ExchangeRate = "1,234567"
+	return fwm
+}
+
+func TestFEDWireMessage_ImpliedExchangeRate(t *testing.T) {
+	fwm := mockForeignExchangeData()
+
+	rate, err := fwm.ImpliedExchangeRate()
+	require.NoError(t, err)
+	require.InDelta(t, 1.234567, rate, 0.0000001)
+
+	fwm.InstructedAmount.Amount = "0,00"
+	_, err = fwm.ImpliedExchangeRate()
+	require.EqualError(t, err, fieldError("InstructedAmount.Amount", ErrNonAmount, "0,00").Error())
+
+	fwm.InstructedAmount = nil
+	_, err = fwm.ImpliedExchangeRate()
+	require.EqualError(t, err, fieldError("InstructedAmount", ErrFieldRequired).Error())
+}
+
+func TestFEDWireMessage_validateExchangeRateConsistency(t *testing.T) {
+	fwm := mockForeignExchangeData()
+	require.NoError(t, fwm.validateExchangeRateConsistency(0))
+
+	// fat-finger the rate
+	fwm.ExchangeRate.ExchangeRate = "12,34567"
+	err := fwm.validateExchangeRateConsistency(0)
+	require.EqualError(t, err, NewErrExchangeRateMismatch("12,34567", "1,234567", DefaultExchangeRateTolerance).Error())
+
+	var mismatch ErrExchangeRateMismatch
+	require.True(t, errors.As(err, &mismatch))
+	require.Equal(t, "1,234567", mismatch.ImpliedRate)
+
+	// a small difference is allowed with a wider tolerance
+	fwm.ExchangeRate.ExchangeRate = "1,25"
+	require.Error(t, fwm.validateExchangeRateConsistency(0))
+	require.NoError(t, fwm.validateExchangeRateConsistency(0.02))
+
+	// non-finite tolerances are rejected rather than compared
+	for _, tolerance := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		err := fwm.validateExchangeRateConsistency(tolerance)
+		require.True(t, errors.Is(err, ErrNonFinite), "tolerance %v: %v", tolerance, err)
+	}
+}
+
+func TestFEDWireMessage_validateCurrencyAmounts(t *testing.T) {
+	fwm := mockForeignExchangeData()
+	require.NoError(t, fwm.validateCurrencyAmounts())
+
+	fwm.InstructedAmount.CurrencyCode = "JPY"
+	err := fwm.validateCurrencyAmounts()
+	require.EqualError(t, err, fieldError("InstructedAmount.Amount", ErrCurrencyPrecision, "10000,00").Error())
+
+	fwm.InstructedAmount.Amount = "10000"
+	require.NoError(t, fwm.validateCurrencyAmounts())
+
+	fwm.InstructedAmount.CurrencyCode = "ZZZ"
+	err = fwm.validateCurrencyAmounts()
+	require.EqualError(t, err, fieldError("InstructedAmount.CurrencyCode", ErrNonCurrencyCode, "ZZZ").Error())
+}
+
+func TestFEDWireMessage_validateCurrencyInstructedAmount(t *testing.T) {
+	fwm := mockForeignExchangeData()
+	fwm.CurrencyInstructedAmount = mockCurrencyInstructedAmount()
+	require.NoError(t, fwm.validateCurrencyAmounts())
+
+	fwm.CurrencyInstructedAmount.Amount = "JPY1500,49"
+	err := fwm.validateCurrencyAmounts()
+	require.EqualError(t, err, fieldError("CurrencyInstructedAmount.Amount", ErrCurrencyPrecision, "JPY1500,49").Error())
+
+	fwm.CurrencyInstructedAmount.Amount = "BHD1500,495"
+	require.NoError(t, fwm.validateCurrencyAmounts())
+}
+
+func TestFile_ValidateWithExchangeRate(t *testing.T) {
+	file := NewFile()
+	fwm := mockForeignExchangeData()
+	fwm.ExchangeRate.ExchangeRate = "12,34567"
+	file.AddFEDWireMessage(fwm)
+
+	// the consistency check is only performed when requested
+	require.NoError(t, file.Validate())
+
+	opts := &ValidateOpts{CheckExchangeRate: true}
+	require.Error(t, file.ValidateWith(opts))
+
+	file.SetValidation(opts)
+	require.Error(t, file.Validate())
+
+	file.SetValidation(&ValidateOpts{CheckExchangeRate: true, ExchangeRateTolerance: 10})
+	require.NoError(t, file.Validate())
+}
+
+func TestParseDecimalAmount(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+		decimals int
+	}{
+		{"1234,56", "1234.56", 2},
+		{"1,2345", "1.2345", 4},
+		{"100", "100", 0},
+		{"0.99", "0.99", 2},
+	}
+	for i := range cases {
+		r, decimals, err := parseDecimalAmount(cases[i].input)
+		require.NoError(t, err)
+		require.Equal(t, cases[i].decimals, decimals)
+		require.Equal(t, cases[i].expected, r.FloatString(cases[i].decimals))
+	}
+
+	for _, input := range []string{"", ",12", "1,2,3", "12a"} {
+		_, _, err := parseDecimalAmount(input)
+		require.ErrorIs(t, err, ErrNonAmount, input)
+	}
+}
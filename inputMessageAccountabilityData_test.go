@@ -108,3 +108,11 @@ func TestInputMessageAccountabilityDataInputCycleDateError(t *testing.T) {
 
 	require.EqualError(t, imad.Validate(), fieldError("InputCycleDate", ErrValidDate, imad.InputCycleDate).Error())
 }
+
+// TestInputMessageAccountabilityDataIdentifier validates the IMAD is written without its tag
+func TestInputMessageAccountabilityDataIdentifier(t *testing.T) {
+	imad := mockInputMessageAccountabilityData()
+	imad.InputCycleDate = "20190410"
+
+	require.Equal(t, "20190410Source08000001", imad.Identifier())
+}
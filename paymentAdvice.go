@@ -0,0 +1,314 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// PaymentAdvice is a customer readable summary of a FEDWireMessage, typically one which was received.
+// It's the data passed to the templates of a PaymentAdviceRenderer.
+type PaymentAdvice struct {
+	// IMAD is the Input Message Accountability Data, e.g. 20200710MMQFMP9F000001
+	IMAD string `json:"imad,omitempty"`
+	// OMAD is the Output Message Accountability Data
+	OMAD string `json:"omad,omitempty"`
+	// Amount of the wire formatted for display, e.g. 12,345.67
+	Amount string `json:"amount"`
+	// CurrencyCode of Amount, always USD for Fedwire funds transfers
+	CurrencyCode string `json:"currencyCode"`
+	// InstructedAmount is the original currency and amount of a foreign exchange transfer, e.g. EUR 10000,00
+	InstructedAmount string `json:"instructedAmount,omitempty"`
+	// ExchangeRate applied to InstructedAmount
+	ExchangeRate string `json:"exchangeRate,omitempty"`
+	// SenderReference is the reference assigned by the sender
+	SenderReference string `json:"senderReference,omitempty"`
+	// Sender is the sending depository institution
+	Sender PaymentAdviceParty `json:"sender"`
+	// Receiver is the receiving depository institution
+	Receiver PaymentAdviceParty `json:"receiver"`
+	// Originator of the wire
+	Originator PaymentAdviceParty `json:"originator"`
+	// OriginatorFI is the originator's financial institution
+	OriginatorFI PaymentAdviceParty `json:"originatorFI"`
+	// Beneficiary of the wire
+	Beneficiary PaymentAdviceParty `json:"beneficiary"`
+	// BeneficiaryFI is the beneficiary's financial institution
+	BeneficiaryFI PaymentAdviceParty `json:"beneficiaryFI"`
+	// OriginatorToBeneficiary is the free text sent from the originator to the beneficiary
+	OriginatorToBeneficiary []string `json:"originatorToBeneficiary,omitempty"`
+	// Remittance detail when the message carries structured remittance or an ANSI X12 820 addenda
+	Remittance *RemittanceAdvice `json:"remittance,omitempty"`
+}
+
+// PaymentAdviceParty is a party or institution of a PaymentAdvice
+type PaymentAdviceParty struct {
+	// Name of the party
+	Name string `json:"name,omitempty"`
+	// Identifier of the party, e.g. account or routing number
+	Identifier string `json:"identifier,omitempty"`
+	// AddressLines of the party
+	AddressLines []string `json:"addressLines,omitempty"`
+}
+
+// NewPaymentAdvice returns the PaymentAdvice of fwm
+func NewPaymentAdvice(fwm FEDWireMessage) *PaymentAdvice {
+	adv := &PaymentAdvice{
+		CurrencyCode: "USD",
+	}
+	if imad := fwm.InputMessageAccountabilityData; imad != nil {
+		adv.IMAD = imad.InputCycleDate + imad.InputSource + imad.InputSequenceNumber
+	}
+	if omad := fwm.OutputMessageAccountabilityData; omad != nil {
+		adv.OMAD = omad.OutputCycleDate + omad.OutputDestinationID + omad.OutputSequenceNumber +
+			omad.OutputDate + omad.OutputTime + omad.OutputFRBApplicationIdentification
+	}
+	if fwm.Amount != nil {
+		adv.Amount = formatPaymentAdviceAmount(fwm.Amount.Amount)
+	}
+	if ia := fwm.InstructedAmount; ia != nil {
+		adv.InstructedAmount = strings.TrimSpace(ia.CurrencyCode + " " + ia.Amount)
+	}
+	if fwm.ExchangeRate != nil {
+		adv.ExchangeRate = fwm.ExchangeRate.ExchangeRate
+	}
+	if fwm.SenderReference != nil {
+		adv.SenderReference = fwm.SenderReference.SenderReference
+	}
+	if sdi := fwm.SenderDepositoryInstitution; sdi != nil {
+		adv.Sender = PaymentAdviceParty{Name: sdi.SenderShortName, Identifier: sdi.SenderABANumber}
+	}
+	if rdi := fwm.ReceiverDepositoryInstitution; rdi != nil {
+		adv.Receiver = PaymentAdviceParty{Name: rdi.ReceiverShortName, Identifier: rdi.ReceiverABANumber}
+	}
+	if fwm.Originator != nil {
+		adv.Originator = personalAdviceParty(fwm.Originator.Personal)
+	}
+	if fwm.OriginatorFI != nil {
+		adv.OriginatorFI = financialInstitutionAdviceParty(fwm.OriginatorFI.FinancialInstitution)
+	}
+	if fwm.Beneficiary != nil {
+		adv.Beneficiary = personalAdviceParty(fwm.Beneficiary.Personal)
+	}
+	if fwm.BeneficiaryFI != nil {
+		adv.BeneficiaryFI = financialInstitutionAdviceParty(fwm.BeneficiaryFI.FinancialInstitution)
+	}
+	if obi := fwm.OriginatorToBeneficiary; obi != nil {
+		adv.OriginatorToBeneficiary = nonEmpty(obi.LineOne, obi.LineTwo, obi.LineThree, obi.LineFour)
+	}
+	if remittance, err := fwm.RemittanceAdvice(); err == nil {
+		adv.Remittance = remittance
+	}
+	return adv
+}
+
+func personalAdviceParty(p Personal) PaymentAdviceParty {
+	return PaymentAdviceParty{
+		Name:         p.Name,
+		Identifier:   p.Identifier,
+		AddressLines: nonEmpty(p.Address.AddressLineOne, p.Address.AddressLineTwo, p.Address.AddressLineThree),
+	}
+}
+
+func financialInstitutionAdviceParty(fi FinancialInstitution) PaymentAdviceParty {
+	return PaymentAdviceParty{
+		Name:         fi.Name,
+		Identifier:   fi.Identifier,
+		AddressLines: nonEmpty(fi.Address.AddressLineOne, fi.Address.AddressLineTwo, fi.Address.AddressLineThree),
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// formatPaymentAdviceAmount renders an Amount {2000} value, which has an implied decimal point, as 12,345.67
+func formatPaymentAdviceAmount(amount string) string {
+	cents, err := strconv.ParseInt(strings.TrimSpace(amount), 10, 64)
+	if err != nil {
+		return amount
+	}
+	dollars := strconv.FormatInt(cents/100, 10)
+	var buf strings.Builder
+	for i := range dollars {
+		if i > 0 && (len(dollars)-i)%3 == 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte(dollars[i])
+	}
+	buf.WriteString("." + strconv.FormatInt(100+cents%100, 10)[1:])
+	return buf.String()
+}
+
+// DefaultPaymentAdviceTextTemplate is the text/template used by PaymentAdviceRenderer.RenderText unless overridden
+const DefaultPaymentAdviceTextTemplate = `PAYMENT ADVICE
+
+Amount:            {{ .Amount }} {{ .CurrencyCode }}
+{{- if .InstructedAmount }}
+Instructed Amount: {{ .InstructedAmount }}{{ if .ExchangeRate }} at {{ .ExchangeRate }}{{ end }}
+{{- end }}
+{{- if .SenderReference }}
+Reference:         {{ .SenderReference }}
+{{- end }}
+IMAD:              {{ .IMAD }}
+{{- if .OMAD }}
+OMAD:              {{ .OMAD }}
+{{- end }}
+
+Originator:        {{ .Originator.Name }}
+{{- if .Originator.Identifier }}
+                   {{ .Originator.Identifier }}
+{{- end }}
+{{- range .Originator.AddressLines }}
+                   {{ . }}
+{{- end }}
+{{- if .OriginatorFI.Name }}
+Originator Bank:   {{ .OriginatorFI.Name }}{{ if .OriginatorFI.Identifier }} ({{ .OriginatorFI.Identifier }}){{ end }}
+{{- end }}
+Sending Bank:      {{ .Sender.Name }} ({{ .Sender.Identifier }})
+
+Beneficiary:       {{ .Beneficiary.Name }}
+{{- if .Beneficiary.Identifier }}
+                   {{ .Beneficiary.Identifier }}
+{{- end }}
+{{- range .Beneficiary.AddressLines }}
+                   {{ . }}
+{{- end }}
+{{- if .BeneficiaryFI.Name }}
+Beneficiary Bank:  {{ .BeneficiaryFI.Name }}{{ if .BeneficiaryFI.Identifier }} ({{ .BeneficiaryFI.Identifier }}){{ end }}
+{{- end }}
+Receiving Bank:    {{ .Receiver.Name }} ({{ .Receiver.Identifier }})
+{{- if .OriginatorToBeneficiary }}
+
+Details:
+{{- range .OriginatorToBeneficiary }}
+  {{ . }}
+{{- end }}
+{{- end }}
+{{- with .Remittance }}
+
+Remittance:
+{{- range .Documents }}
+  {{ .DocumentTypeCode }} {{ .DocumentIdentificationNumber }}{{ if .Date }} dated {{ .Date }}{{ end }}: {{ .AmountPaid }} {{ .CurrencyCode }}
+{{- end }}
+{{- end }}
+`
+
+// DefaultPaymentAdviceHTMLTemplate is the html/template used by PaymentAdviceRenderer.RenderHTML unless overridden
+const DefaultPaymentAdviceHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Payment Advice</title></head>
+<body>
+<h1>Payment Advice</h1>
+<table>
+<tr><th>Amount</th><td>{{ .Amount }} {{ .CurrencyCode }}</td></tr>
+{{- if .InstructedAmount }}
+<tr><th>Instructed Amount</th><td>{{ .InstructedAmount }}{{ if .ExchangeRate }} at {{ .ExchangeRate }}{{ end }}</td></tr>
+{{- end }}
+{{- if .SenderReference }}
+<tr><th>Reference</th><td>{{ .SenderReference }}</td></tr>
+{{- end }}
+<tr><th>IMAD</th><td>{{ .IMAD }}</td></tr>
+{{- if .OMAD }}
+<tr><th>OMAD</th><td>{{ .OMAD }}</td></tr>
+{{- end }}
+</table>
+<h2>Originator</h2>
+<p>{{ .Originator.Name }}{{ if .Originator.Identifier }}<br>{{ .Originator.Identifier }}{{ end }}{{ range .Originator.AddressLines }}<br>{{ . }}{{ end }}</p>
+{{- if .OriginatorFI.Name }}
+<p>Originator Bank: {{ .OriginatorFI.Name }}{{ if .OriginatorFI.Identifier }} ({{ .OriginatorFI.Identifier }}){{ end }}</p>
+{{- end }}
+<p>Sending Bank: {{ .Sender.Name }} ({{ .Sender.Identifier }})</p>
+<h2>Beneficiary</h2>
+<p>{{ .Beneficiary.Name }}{{ if .Beneficiary.Identifier }}<br>{{ .Beneficiary.Identifier }}{{ end }}{{ range .Beneficiary.AddressLines }}<br>{{ . }}{{ end }}</p>
+{{- if .BeneficiaryFI.Name }}
+<p>Beneficiary Bank: {{ .BeneficiaryFI.Name }}{{ if .BeneficiaryFI.Identifier }} ({{ .BeneficiaryFI.Identifier }}){{ end }}</p>
+{{- end }}
+<p>Receiving Bank: {{ .Receiver.Name }} ({{ .Receiver.Identifier }})</p>
+{{- if .OriginatorToBeneficiary }}
+<h2>Details</h2>
+<p>{{ range $i, $line := .OriginatorToBeneficiary }}{{ if $i }}<br>{{ end }}{{ $line }}{{ end }}</p>
+{{- end }}
+{{- with .Remittance }}
+<h2>Remittance</h2>
+<table>
+<tr><th>Type</th><th>Document</th><th>Date</th><th>Amount Paid</th></tr>
+{{- range .Documents }}
+<tr><td>{{ .DocumentTypeCode }}</td><td>{{ .DocumentIdentificationNumber }}</td><td>{{ .Date }}</td><td>{{ .AmountPaid }} {{ .CurrencyCode }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`
+
+// PaymentAdviceRenderer renders FEDWireMessages as plain text or HTML payment advices
+type PaymentAdviceRenderer struct {
+	textTemplate string
+	htmlTemplate string
+
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// PaymentAdviceOptionFunc configures a PaymentAdviceRenderer
+type PaymentAdviceOptionFunc func(*PaymentAdviceRenderer)
+
+// PaymentAdviceTextTemplate overrides the text/template used for plain text advices.
+// The template is executed with a *PaymentAdvice.
+func PaymentAdviceTextTemplate(tmpl string) PaymentAdviceOptionFunc {
+	return func(ar *PaymentAdviceRenderer) {
+		ar.textTemplate = tmpl
+	}
+}
+
+// PaymentAdviceHTMLTemplate overrides the html/template used for HTML advices.
+// The template is executed with a *PaymentAdvice.
+func PaymentAdviceHTMLTemplate(tmpl string) PaymentAdviceOptionFunc {
+	return func(ar *PaymentAdviceRenderer) {
+		ar.htmlTemplate = tmpl
+	}
+}
+
+// NewPaymentAdviceRenderer returns a PaymentAdviceRenderer using the default templates unless overridden by opts.
+// An error is returned if a template can't be parsed.
+func NewPaymentAdviceRenderer(opts ...PaymentAdviceOptionFunc) (*PaymentAdviceRenderer, error) {
+	ar := &PaymentAdviceRenderer{
+		textTemplate: DefaultPaymentAdviceTextTemplate,
+		htmlTemplate: DefaultPaymentAdviceHTMLTemplate,
+	}
+	for _, opt := range opts {
+		opt(ar)
+	}
+
+	var err error
+	if ar.text, err = texttemplate.New("paymentAdvice").Parse(ar.textTemplate); err != nil {
+		return nil, err
+	}
+	if ar.html, err = htmltemplate.New("paymentAdvice").Parse(ar.htmlTemplate); err != nil {
+		return nil, err
+	}
+	return ar, nil
+}
+
+// RenderText writes the plain text advice of fwm to w
+func (ar *PaymentAdviceRenderer) RenderText(w io.Writer, fwm FEDWireMessage) error {
+	return ar.text.Execute(w, NewPaymentAdvice(fwm))
+}
+
+// RenderHTML writes the HTML advice of fwm to w
+func (ar *PaymentAdviceRenderer) RenderHTML(w io.Writer, fwm FEDWireMessage) error {
+	return ar.html.Execute(w, NewPaymentAdvice(fwm))
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockPaymentAdviceData creates a received CustomerTransferPlus with structured remittance
+func mockPaymentAdviceData() FEDWireMessage {
+	fwm := mockCustomerTransferPlusData()
+	fwm.SenderReference = mockSenderReference()
+	fwm.OutputMessageAccountabilityData = mockOutputMessageAccountabilityData()
+	fwm.OriginatorToBeneficiary = mockOriginatorToBeneficiary()
+	if err := fwm.SetRemittanceAdvice(mockRemittanceAdvice()); err != nil {
+		panic(err)
+	}
+	return fwm
+}
+
+func TestNewPaymentAdvice(t *testing.T) {
+	fwm := mockPaymentAdviceData()
+	adv := NewPaymentAdvice(fwm)
+
+	require.Equal(t, "12,345.67", adv.Amount)
+	require.Equal(t, "USD", adv.CurrencyCode)
+	imad := fwm.InputMessageAccountabilityData
+	require.Equal(t, imad.InputCycleDate+imad.InputSource+imad.InputSequenceNumber, adv.IMAD)
+	require.Equal(t, fwm.SenderReference.SenderReference, adv.SenderReference)
+	require.Equal(t, fwm.Originator.Personal.Name, adv.Originator.Name)
+	require.Equal(t, fwm.Beneficiary.Personal.Name, adv.Beneficiary.Name)
+	require.Equal(t, fwm.SenderDepositoryInstitution.SenderABANumber, adv.Sender.Identifier)
+	require.Len(t, adv.OriginatorToBeneficiary, 4)
+	require.NotNil(t, adv.Remittance)
+	require.Equal(t, "INV-1001", adv.Remittance.Documents[0].DocumentIdentificationNumber)
+}
+
+func TestFormatPaymentAdviceAmount(t *testing.T) {
+	require.Equal(t, "0.05", formatPaymentAdviceAmount("000000000005"))
+	require.Equal(t, "999.99", formatPaymentAdviceAmount("000000099999"))
+	require.Equal(t, "1,000.00", formatPaymentAdviceAmount("000000100000"))
+	require.Equal(t, "1,234,567,890.12", formatPaymentAdviceAmount("123456789012"))
+	require.Equal(t, "12a", formatPaymentAdviceAmount("12a"))
+}
+
+func TestPaymentAdviceRenderer(t *testing.T) {
+	fwm := mockPaymentAdviceData()
+	fwm.Beneficiary.Personal.Name = "Smith & <Sons>"
+
+	ar, err := NewPaymentAdviceRenderer()
+	require.NoError(t, err)
+
+	var text strings.Builder
+	require.NoError(t, ar.RenderText(&text, fwm))
+	require.Contains(t, text.String(), "Amount:            12,345.67 USD")
+	require.Contains(t, text.String(), "Beneficiary:       Smith & <Sons>")
+	require.Contains(t, text.String(), "CINV INV-1001 dated 20200710: 1175.00 USD")
+
+	var html strings.Builder
+	require.NoError(t, ar.RenderHTML(&html, fwm))
+	require.Contains(t, html.String(), "<h1>Payment Advice</h1>")
+	require.Contains(t, html.String(), "Smith &amp; &lt;Sons&gt;")
+	require.Contains(t, html.String(), "<td>INV-1001</td>")
+}
+
+func TestPaymentAdviceRendererOverride(t *testing.T) {
+	ar, err := NewPaymentAdviceRenderer(
+		PaymentAdviceTextTemplate("Paid {{ .Amount }} to {{ .Beneficiary.Name }}"),
+		PaymentAdviceHTMLTemplate("<b>{{ .IMAD }}</b>"),
+	)
+	require.NoError(t, err)
+
+	fwm := mockPaymentAdviceData()
+	var text strings.Builder
+	require.NoError(t, ar.RenderText(&text, fwm))
+	require.Equal(t, "Paid 12,345.67 to "+fwm.Beneficiary.Personal.Name, text.String())
+
+	var html strings.Builder
+	require.NoError(t, ar.RenderHTML(&html, fwm))
+	require.Equal(t, "<b>"+NewPaymentAdvice(fwm).IMAD+"</b>", html.String())
+
+	_, err = NewPaymentAdviceRenderer(PaymentAdviceTextTemplate("{{ .Amount"))
+	require.Error(t, err)
+	_, err = NewPaymentAdviceRenderer(PaymentAdviceHTMLTemplate("{{ end }}"))
+	require.Error(t, err)
+}
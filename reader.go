@@ -67,6 +67,14 @@ func NewReader(r io.Reader) *Reader {
 	return reader
 }
 
+// SetValidation stores ValidateOpts on the Reader's File which are used when Read validates the parsed message
+func (r *Reader) SetValidation(opts *ValidateOpts) {
+	if r == nil {
+		return
+	}
+	r.File.SetValidation(opts)
+}
+
 // addCurrentFEDWireMessage creates the current FEDWireMessage for the file being read. A successful
 // current FEDWireMessage will be added to r.File once parsed.
 /*func (r *Reader) addCurrentFEDWireMessage(fwm FEDWireMessage) {
@@ -0,0 +1,220 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactionMode is how a sensitive value is masked
+type RedactionMode string
+
+const (
+	// RedactKeep leaves the value unchanged
+	RedactKeep RedactionMode = "keep"
+	// RedactLastFour replaces all but the last four characters with '*', e.g. ******7890
+	RedactLastFour RedactionMode = "last4"
+	// RedactMask keeps the first character of each word and replaces the rest with '*', e.g. J*** S****
+	RedactMask RedactionMode = "mask"
+	// RedactHash replaces the value with a keyed hash, so equal values can still be correlated
+	RedactHash RedactionMode = "hash"
+	// RedactDrop removes the value
+	RedactDrop RedactionMode = "drop"
+)
+
+// RedactionPolicy describes how each kind of sensitive data in a FEDWireMessage is masked by Redact.
+// An empty RedactionMode is treated as RedactKeep.
+type RedactionPolicy struct {
+	// AccountNumbers are account identifiers of parties, e.g. a Beneficiary with IdentificationCode DemandDepositAccountNumber
+	AccountNumbers RedactionMode `json:"accountNumbers"`
+	// Identifiers are other party identifiers such as passport, tax or national identity numbers
+	Identifiers RedactionMode `json:"identifiers"`
+	// Names of people and organizations
+	Names RedactionMode `json:"names"`
+	// Addresses are postal addresses and contact details (phone numbers, email addresses)
+	Addresses RedactionMode `json:"addresses"`
+	// HashKey is the HMAC key used by RedactHash. Without a key hashes of short values, like account numbers,
+	// can be reversed by brute force.
+	HashKey string `json:"-"`
+}
+
+// DefaultRedactionPolicy keeps the last four characters of account numbers, hashes other identifiers,
+// masks names and drops addresses.
+func DefaultRedactionPolicy() RedactionPolicy {
+	return RedactionPolicy{
+		AccountNumbers: RedactLastFour,
+		Identifiers:    RedactHash,
+		Names:          RedactMask,
+		Addresses:      RedactDrop,
+	}
+}
+
+// Mask returns value masked according to mode
+func (p RedactionPolicy) Mask(mode RedactionMode, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return value
+	}
+	switch mode {
+	case RedactLastFour:
+		n := utf8.RuneCountInString(value)
+		if n <= 4 {
+			return strings.Repeat("*", n)
+		}
+		runes := []rune(value)
+		return strings.Repeat("*", n-4) + string(runes[n-4:])
+	case RedactMask:
+		words := strings.Fields(value)
+		for i, word := range words {
+			runes := []rune(word)
+			words[i] = string(runes[0]) + strings.Repeat("*", len(runes)-1)
+		}
+		return strings.Join(words, " ")
+	case RedactHash:
+		mac := hmac.New(sha256.New, []byte(p.HashKey))
+		mac.Write([]byte(value))
+		return "#" + hex.EncodeToString(mac.Sum(nil))[:16]
+	case RedactDrop:
+		return ""
+	}
+	return value
+}
+
+// Redact returns a copy of the File whose FEDWireMessage is masked according to policy.
+// The File itself is not modified.
+func (f *File) Redact(policy RedactionPolicy) *File {
+	out := *f
+	out.FEDWireMessage = f.FEDWireMessage.Redact(policy)
+	return &out
+}
+
+// Redact returns a copy of the message with names, addresses, account numbers and identifiers masked according
+// to policy. It covers Beneficiary {4200}, Originator {5000}, OriginatorOptionF {5010}, AccountDebitedDrawdown {4400},
+// AccountCreditedDrawdown {5400}, RemittanceOriginator {8300} and RemittanceBeneficiary {8350}.
+// The message itself is not modified.
+func (fwm FEDWireMessage) Redact(policy RedactionPolicy) FEDWireMessage {
+	if fwm.Beneficiary != nil {
+		ben := *fwm.Beneficiary
+		ben.Personal = policy.redactPersonal(ben.Personal)
+		fwm.Beneficiary = &ben
+	}
+	if fwm.Originator != nil {
+		o := *fwm.Originator
+		o.Personal = policy.redactPersonal(o.Personal)
+		fwm.Originator = &o
+	}
+	if fwm.OriginatorOptionF != nil {
+		oof := *fwm.OriginatorOptionF
+		oof.PartyIdentifier = policy.redactPartyIdentifier(oof.PartyIdentifier)
+		oof.Name = policy.redactOptionFLine(oof.Name)
+		oof.LineOne = policy.redactOptionFLine(oof.LineOne)
+		oof.LineTwo = policy.redactOptionFLine(oof.LineTwo)
+		oof.LineThree = policy.redactOptionFLine(oof.LineThree)
+		fwm.OriginatorOptionF = &oof
+	}
+	if fwm.AccountDebitedDrawdown != nil {
+		debitDD := *fwm.AccountDebitedDrawdown
+		debitDD.Identifier = policy.redactIdentifier(debitDD.IdentificationCode, debitDD.Identifier)
+		debitDD.Name = policy.Mask(policy.Names, debitDD.Name)
+		debitDD.Address = policy.redactAddress(debitDD.Address)
+		fwm.AccountDebitedDrawdown = &debitDD
+	}
+	if fwm.AccountCreditedDrawdown != nil {
+		creditDD := *fwm.AccountCreditedDrawdown
+		creditDD.DrawdownCreditAccountNumber = policy.Mask(policy.AccountNumbers, creditDD.DrawdownCreditAccountNumber)
+		fwm.AccountCreditedDrawdown = &creditDD
+	}
+	if fwm.RemittanceOriginator != nil {
+		ro := *fwm.RemittanceOriginator
+		ro.IdentificationNumber = policy.Mask(policy.Identifiers, ro.IdentificationNumber)
+		ro.RemittanceData = policy.redactRemittanceData(ro.RemittanceData)
+		ro.ContactName = policy.Mask(policy.Names, ro.ContactName)
+		ro.ContactPhoneNumber = policy.Mask(policy.Addresses, ro.ContactPhoneNumber)
+		ro.ContactMobileNumber = policy.Mask(policy.Addresses, ro.ContactMobileNumber)
+		ro.ContactFaxNumber = policy.Mask(policy.Addresses, ro.ContactFaxNumber)
+		ro.ContactElectronicAddress = policy.Mask(policy.Addresses, ro.ContactElectronicAddress)
+		ro.ContactOther = policy.Mask(policy.Addresses, ro.ContactOther)
+		fwm.RemittanceOriginator = &ro
+	}
+	if fwm.RemittanceBeneficiary != nil {
+		rb := *fwm.RemittanceBeneficiary
+		rb.IdentificationNumber = policy.Mask(policy.Identifiers, rb.IdentificationNumber)
+		rb.RemittanceData = policy.redactRemittanceData(rb.RemittanceData)
+		fwm.RemittanceBeneficiary = &rb
+	}
+	return fwm
+}
+
+// redactIdentifier masks an identifier as an account number when its IdentificationCode is
+// DemandDepositAccountNumber and as another identifier otherwise
+func (p RedactionPolicy) redactIdentifier(code, identifier string) string {
+	if code == DemandDepositAccountNumber {
+		return p.Mask(p.AccountNumbers, identifier)
+	}
+	return p.Mask(p.Identifiers, identifier)
+}
+
+func (p RedactionPolicy) redactPersonal(personal Personal) Personal {
+	personal.Identifier = p.redactIdentifier(personal.IdentificationCode, personal.Identifier)
+	personal.Name = p.Mask(p.Names, personal.Name)
+	personal.Address = p.redactAddress(personal.Address)
+	return personal
+}
+
+func (p RedactionPolicy) redactAddress(addr Address) Address {
+	return Address{
+		AddressLineOne:   p.Mask(p.Addresses, addr.AddressLineOne),
+		AddressLineTwo:   p.Mask(p.Addresses, addr.AddressLineTwo),
+		AddressLineThree: p.Mask(p.Addresses, addr.AddressLineThree),
+	}
+}
+
+func (p RedactionPolicy) redactRemittanceData(rd RemittanceData) RemittanceData {
+	rd.Name = p.Mask(p.Names, rd.Name)
+	rd.DateBirthPlace = p.Mask(p.Identifiers, rd.DateBirthPlace)
+	for _, field := range []*string{&rd.Department, &rd.SubDepartment, &rd.StreetName, &rd.BuildingNumber,
+		&rd.PostCode, &rd.TownName, &rd.CountrySubDivisionState, &rd.AddressLineOne, &rd.AddressLineTwo,
+		&rd.AddressLineThree, &rd.AddressLineFour, &rd.AddressLineFive, &rd.AddressLineSix, &rd.AddressLineSeven} {
+		*field = p.Mask(p.Addresses, *field)
+	}
+	return rd
+}
+
+// redactPartyIdentifier masks an OriginatorOptionF party identifier, which is either /account or CODE/identifier
+func (p RedactionPolicy) redactPartyIdentifier(partyIdentifier string) string {
+	i := strings.Index(partyIdentifier, "/")
+	if i < 0 {
+		return p.Mask(p.Identifiers, partyIdentifier)
+	}
+	if i == 0 {
+		return "/" + p.Mask(p.AccountNumbers, partyIdentifier[1:])
+	}
+	return partyIdentifier[:i+1] + p.Mask(p.Identifiers, partyIdentifier[i+1:])
+}
+
+// redactOptionFLine masks an OriginatorOptionF line, which is prefixed with a number describing its content:
+// 1/ name, 2/ address, 3/ country and town, 4/ date of birth, 5/ place of birth, 6/ customer identification number,
+// 7/ national identity number and 8/ additional information.
+func (p RedactionPolicy) redactOptionFLine(line string) string {
+	if len(line) < 2 || line[1] != '/' {
+		return p.Mask(p.Names, line)
+	}
+	prefix, value := line[:2], line[2:]
+	switch line[0] {
+	case '1':
+		value = p.Mask(p.Names, value)
+	case '2', '3':
+		value = p.Mask(p.Addresses, value)
+	default:
+		value = p.Mask(p.Identifiers, value)
+	}
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
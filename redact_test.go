@@ -0,0 +1,97 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactionPolicy_Mask(t *testing.T) {
+	p := RedactionPolicy{HashKey: "secret"}
+
+	require.Equal(t, "*****6789", p.Mask(RedactLastFour, "123456789"))
+	require.Equal(t, "***", p.Mask(RedactLastFour, "123"))
+	require.Equal(t, "J*** S****", p.Mask(RedactMask, "John  Smith"))
+	require.Equal(t, "", p.Mask(RedactDrop, "123 Main St"))
+	require.Equal(t, "as is", p.Mask(RedactKeep, "as is"))
+	require.Equal(t, "as is", p.Mask("", "as is"))
+	require.Equal(t, "", p.Mask(RedactLastFour, ""))
+
+	hashed := p.Mask(RedactHash, "123-45-6789")
+	require.Len(t, hashed, 17)
+	require.Equal(t, hashed, p.Mask(RedactHash, "123-45-6789"))
+	require.NotEqual(t, hashed, p.Mask(RedactHash, "123-45-6780"))
+	require.NotEqual(t, hashed, RedactionPolicy{HashKey: "other"}.Mask(RedactHash, "123-45-6789"))
+}
+
+func TestFEDWireMessage_Redact(t *testing.T) {
+	fwm := mockCustomerTransferData()
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.Beneficiary.Personal.IdentificationCode = DemandDepositAccountNumber
+	fwm.Beneficiary.Personal.Identifier = "9876543210"
+	fwm.Originator = mockOriginator()
+	fwm.OriginatorOptionF = mockOriginatorOptionF()
+	fwm.AccountDebitedDrawdown = mockAccountDebitedDrawdown()
+	fwm.AccountCreditedDrawdown = mockAccountCreditedDrawdown()
+	fwm.RemittanceOriginator = mockRemittanceOriginator()
+	fwm.RemittanceBeneficiary = mockRemittanceBeneficiary()
+
+	redacted := fwm.Redact(DefaultRedactionPolicy())
+
+	require.Equal(t, "******3210", redacted.Beneficiary.Personal.Identifier)
+	require.Equal(t, "N***", redacted.Beneficiary.Personal.Name)
+	require.Equal(t, Address{}, redacted.Beneficiary.Personal.Address)
+	require.Regexp(t, `^#[0-9a-f]{16}$`, redacted.Originator.Personal.Identifier)
+
+	require.Regexp(t, `^TXID/#[0-9a-f]{16}$`, redacted.OriginatorOptionF.PartyIdentifier)
+	require.Equal(t, "1/N***", redacted.OriginatorOptionF.Name)
+	require.Equal(t, "1/1***", redacted.OriginatorOptionF.LineOne)
+	require.Equal(t, "", redacted.OriginatorOptionF.LineTwo)
+	require.Regexp(t, `^5/#[0-9a-f]{16}$`, redacted.OriginatorOptionF.LineThree)
+
+	require.Equal(t, "*****6789", redacted.AccountDebitedDrawdown.Identifier)
+	require.Equal(t, "d****** N***", redacted.AccountDebitedDrawdown.Name)
+	require.Equal(t, "*****6789", redacted.AccountCreditedDrawdown.DrawdownCreditAccountNumber)
+
+	require.Regexp(t, `^#[0-9a-f]{16}$`, redacted.RemittanceOriginator.IdentificationNumber)
+	require.Equal(t, "N***", redacted.RemittanceOriginator.RemittanceData.Name)
+	require.Equal(t, "", redacted.RemittanceOriginator.RemittanceData.StreetName)
+	require.Equal(t, "UA", redacted.RemittanceOriginator.RemittanceData.Country)
+	require.Equal(t, "", redacted.RemittanceOriginator.ContactPhoneNumber)
+	require.Equal(t, "C****** N***", redacted.RemittanceOriginator.ContactName)
+	require.Equal(t, "N***", redacted.RemittanceBeneficiary.RemittanceData.Name)
+
+	// the original message is untouched
+	require.Equal(t, "9876543210", fwm.Beneficiary.Personal.Identifier)
+	require.Equal(t, "TXID/123-45-6789", fwm.OriginatorOptionF.PartyIdentifier)
+	require.Equal(t, "123456789", fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber)
+	require.Equal(t, "Street Name", fwm.RemittanceOriginator.RemittanceData.StreetName)
+}
+
+func TestFEDWireMessage_RedactPartyIdentifier(t *testing.T) {
+	p := DefaultRedactionPolicy()
+	require.Equal(t, "/*****6789", p.redactPartyIdentifier("/123456789"))
+	require.Regexp(t, `^#[0-9a-f]{16}$`, p.redactPartyIdentifier("123456789"))
+	require.Equal(t, "", p.redactPartyIdentifier(""))
+}
+
+func TestFile_Redact(t *testing.T) {
+	file := NewFile()
+	fwm := mockCustomerTransferData()
+	fwm.Beneficiary = mockBeneficiary()
+	file.AddFEDWireMessage(fwm)
+
+	redacted := file.Redact(DefaultRedactionPolicy())
+	require.Equal(t, file.ID, redacted.ID)
+	require.Equal(t, "N***", redacted.FEDWireMessage.Beneficiary.Personal.Name)
+	require.Equal(t, "Name", file.FEDWireMessage.Beneficiary.Personal.Name)
+
+	bs, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "Address One")
+}
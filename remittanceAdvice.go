@@ -0,0 +1,410 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxUnstructuredAddendaLength is the longest Addenda Information accepted in UnstructuredAddenda {8200}
+const maxUnstructuredAddendaLength = 9000
+
+var (
+	// ErrNoRemittanceDocuments is returned when a RemittanceAdvice has no documents
+	ErrNoRemittanceDocuments = errors.New("no remittance documents")
+	// ErrNoRemittanceInformation is returned when a FEDWireMessage does not carry remittance information
+	ErrNoRemittanceInformation = errors.New("no structured remittance or ANSI X12 unstructured addenda found")
+	// ErrAddendaTooLong is returned when remittance information does not fit in UnstructuredAddenda {8200}
+	ErrAddendaTooLong = errors.New("remittance information exceeds the unstructured addenda length")
+)
+
+// RemittanceAdvice is the remittance detail of a payment independent of how it is carried
+// in a FEDWireMessage. It's populated by importers (ANSI X12 820, CSV) and read back by exporters.
+type RemittanceAdvice struct {
+	// Originator is the party making the payment (the payer)
+	Originator RemittanceParty `json:"originator"`
+	// Beneficiary is the party receiving the payment (the payee)
+	Beneficiary RemittanceParty `json:"beneficiary"`
+	// Reference is the payment's trace or reference number
+	Reference string `json:"reference,omitempty"`
+	// Documents are the invoices, credit notes, etc. settled by the payment
+	Documents []RemittanceDocument `json:"documents"`
+	// RelatedDocument is a document related to the payment, such as a purchase order. It's only carried by
+	// structured remittance, as SecondaryRemittanceDocument {8700}.
+	RelatedDocument *RemittanceReference `json:"relatedDocument,omitempty"`
+	// FreeText is up to three lines of free text. It's only carried by structured remittance, as
+	// RemittanceFreeText {8750}.
+	FreeText []string `json:"freeText,omitempty"`
+}
+
+// RemittanceReference identifies a document related to a payment
+type RemittanceReference struct {
+	// DocumentTypeCode such as PurchaseOrder
+	DocumentTypeCode string `json:"documentTypeCode"`
+	// ProprietaryDocumentTypeCode is required when DocumentTypeCode is ProprietaryDocumentType
+	ProprietaryDocumentTypeCode string `json:"proprietaryDocumentTypeCode,omitempty"`
+	// DocumentIdentificationNumber of the document
+	DocumentIdentificationNumber string `json:"documentIdentificationNumber"`
+	// Issuer of the document
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// RemittanceParty is the originator or beneficiary of a RemittanceAdvice
+type RemittanceParty struct {
+	// Name of the party
+	Name string `json:"name"`
+	// IdentificationType is OrganizationID or PrivateID
+	IdentificationType string `json:"identificationType,omitempty"`
+	// IdentificationCode such as OICCustomerNumber or OICTaxIdentificationNumber
+	IdentificationCode string `json:"identificationCode,omitempty"`
+	// IdentificationNumber of the party
+	IdentificationNumber string `json:"identificationNumber,omitempty"`
+	// AddressLines of the party
+	AddressLines []string `json:"addressLines,omitempty"`
+	// TownName of the party
+	TownName string `json:"townName,omitempty"`
+	// CountrySubDivisionState of the party
+	CountrySubDivisionState string `json:"countrySubDivisionState,omitempty"`
+	// PostCode of the party
+	PostCode string `json:"postCode,omitempty"`
+	// Country of the party
+	Country string `json:"country,omitempty"`
+}
+
+// RemittanceDocument is a single document (e.g. an invoice) settled by a payment.
+// Amounts use a decimal period marker, e.g. 1234.56
+type RemittanceDocument struct {
+	// DocumentTypeCode such as CommercialInvoice, defaults to CommercialInvoice
+	DocumentTypeCode string `json:"documentTypeCode,omitempty"`
+	// ProprietaryDocumentTypeCode is required when DocumentTypeCode is ProprietaryDocumentType
+	ProprietaryDocumentTypeCode string `json:"proprietaryDocumentTypeCode,omitempty"`
+	// DocumentIdentificationNumber is the invoice number
+	DocumentIdentificationNumber string `json:"documentIdentificationNumber"`
+	// Date of the document CCYYMMDD
+	Date string `json:"date,omitempty"`
+	// CurrencyCode of the amounts, defaults to USD
+	CurrencyCode string `json:"currencyCode,omitempty"`
+	// AmountPaid is the amount of the payment applied to the document
+	AmountPaid string `json:"amountPaid"`
+	// GrossAmount is the total amount of the document
+	GrossAmount string `json:"grossAmount,omitempty"`
+	// DiscountAmount is the negotiated discount taken
+	DiscountAmount string `json:"discountAmount,omitempty"`
+	// AdjustmentReasonCode such as PricingError
+	AdjustmentReasonCode string `json:"adjustmentReasonCode,omitempty"`
+	// AdjustmentCreditDebitIndicator is CreditIndicator or DebitIndicator, defaults to CreditIndicator
+	AdjustmentCreditDebitIndicator string `json:"adjustmentCreditDebitIndicator,omitempty"`
+	// AdjustmentAmount of the adjustment
+	AdjustmentAmount string `json:"adjustmentAmount,omitempty"`
+	// AdjustmentInfo is additional information about the adjustment
+	AdjustmentInfo string `json:"adjustmentInfo,omitempty"`
+}
+
+func (doc RemittanceDocument) documentTypeCode() string {
+	if doc.DocumentTypeCode == "" {
+		return CommercialInvoice
+	}
+	return doc.DocumentTypeCode
+}
+
+func (doc RemittanceDocument) currencyCode() string {
+	if doc.CurrencyCode == "" {
+		return "USD"
+	}
+	return doc.CurrencyCode
+}
+
+// SetRemittanceAdvice populates the remittance information of a CustomerTransferPlus message from adv.
+//
+// The advice is written as structured remittance ({8300} through {8750}) with LocalInstrument
+// RemittanceInformationStructured when it fits: a single document with its date, gross amount and adjustment,
+// a related document, free text and fields no wider than their tags. Otherwise it's written as an ANSI X12 820
+// transaction set into UnstructuredAddenda {8200} with LocalInstrument ANSIX12format. RelatedRemittance {8250}
+// is never written, it's only permitted when remittance is sent separately from the payment.
+// Any remittance information previously on the message is replaced.
+func (fwm *FEDWireMessage) SetRemittanceAdvice(adv *RemittanceAdvice) error {
+	if adv == nil || len(adv.Documents) == 0 {
+		return ErrNoRemittanceDocuments
+	}
+	if fwm.BusinessFunctionCode == nil || fwm.BusinessFunctionCode.BusinessFunctionCode != CustomerTransferPlus {
+		return fieldError("BusinessFunctionCode", ErrLocalInstrumentNotPermitted)
+	}
+
+	fwm.clearRemittance()
+	if fwm.LocalInstrument == nil {
+		fwm.LocalInstrument = NewLocalInstrument()
+	}
+	fwm.LocalInstrument.ProprietaryCode = ""
+	if fwm.setStructuredRemittance(adv) {
+		fwm.LocalInstrument.LocalInstrumentCode = RemittanceInformationStructured
+		return nil
+	}
+
+	var buf strings.Builder
+	if err := WriteX12820(&buf, adv); err != nil {
+		return err
+	}
+	addenda := buf.String()
+	if n := utf8.RuneCountInString(addenda); n > maxUnstructuredAddendaLength {
+		return fieldError("UnstructuredAddenda", ErrAddendaTooLong, n)
+	}
+	fwm.LocalInstrument.LocalInstrumentCode = ANSIX12format
+	fwm.UnstructuredAddenda = NewUnstructuredAddenda()
+	fwm.UnstructuredAddenda.Addenda = addenda
+	fwm.UnstructuredAddenda.AddendaLength = fmt.Sprintf("%04d", utf8.RuneCountInString(addenda))
+	return fwm.UnstructuredAddenda.Validate()
+}
+
+// setStructuredRemittance populates the structured remittance tags from adv and reports if it fits them,
+// otherwise the message is left without remittance tags
+func (fwm *FEDWireMessage) setStructuredRemittance(adv *RemittanceAdvice) bool {
+	if !fitsStructuredRemittance(adv) {
+		return false
+	}
+	doc := adv.Documents[0]
+
+	fwm.RemittanceOriginator = NewRemittanceOriginator()
+	fwm.RemittanceOriginator.IdentificationType = adv.Originator.IdentificationType
+	fwm.RemittanceOriginator.IdentificationCode = adv.Originator.IdentificationCode
+	fwm.RemittanceOriginator.IdentificationNumber = adv.Originator.IdentificationNumber
+	fwm.RemittanceOriginator.RemittanceData = adv.Originator.remittanceData()
+
+	fwm.RemittanceBeneficiary = NewRemittanceBeneficiary()
+	fwm.RemittanceBeneficiary.IdentificationType = adv.Beneficiary.IdentificationType
+	fwm.RemittanceBeneficiary.IdentificationCode = adv.Beneficiary.IdentificationCode
+	fwm.RemittanceBeneficiary.IdentificationNumber = adv.Beneficiary.IdentificationNumber
+	fwm.RemittanceBeneficiary.RemittanceData = adv.Beneficiary.remittanceData()
+
+	fwm.PrimaryRemittanceDocument = NewPrimaryRemittanceDocument()
+	fwm.PrimaryRemittanceDocument.DocumentTypeCode = doc.documentTypeCode()
+	fwm.PrimaryRemittanceDocument.ProprietaryDocumentTypeCode = doc.ProprietaryDocumentTypeCode
+	fwm.PrimaryRemittanceDocument.DocumentIdentificationNumber = doc.DocumentIdentificationNumber
+
+	fwm.ActualAmountPaid = NewActualAmountPaid()
+	fwm.ActualAmountPaid.RemittanceAmount = RemittanceAmount{CurrencyCode: doc.currencyCode(), Amount: doc.AmountPaid}
+	fwm.GrossAmountRemittanceDocument = NewGrossAmountRemittanceDocument()
+	fwm.GrossAmountRemittanceDocument.RemittanceAmount = RemittanceAmount{CurrencyCode: doc.currencyCode(), Amount: doc.GrossAmount}
+	if doc.DiscountAmount != "" {
+		fwm.AmountNegotiatedDiscount = NewAmountNegotiatedDiscount()
+		fwm.AmountNegotiatedDiscount.RemittanceAmount = RemittanceAmount{CurrencyCode: doc.currencyCode(), Amount: doc.DiscountAmount}
+	}
+
+	fwm.Adjustment = NewAdjustment()
+	fwm.Adjustment.AdjustmentReasonCode = doc.AdjustmentReasonCode
+	fwm.Adjustment.CreditDebitIndicator = doc.AdjustmentCreditDebitIndicator
+	if fwm.Adjustment.CreditDebitIndicator == "" {
+		fwm.Adjustment.CreditDebitIndicator = CreditIndicator
+	}
+	fwm.Adjustment.RemittanceAmount = RemittanceAmount{CurrencyCode: doc.currencyCode(), Amount: doc.AdjustmentAmount}
+	fwm.Adjustment.AdditionalInfo = doc.AdjustmentInfo
+
+	fwm.DateRemittanceDocument = NewDateRemittanceDocument()
+	fwm.DateRemittanceDocument.DateRemittanceDocument = doc.Date
+
+	fwm.SecondaryRemittanceDocument = NewSecondaryRemittanceDocument()
+	fwm.SecondaryRemittanceDocument.DocumentTypeCode = adv.RelatedDocument.DocumentTypeCode
+	fwm.SecondaryRemittanceDocument.ProprietaryDocumentTypeCode = adv.RelatedDocument.ProprietaryDocumentTypeCode
+	fwm.SecondaryRemittanceDocument.DocumentIdentificationNumber = adv.RelatedDocument.DocumentIdentificationNumber
+	fwm.SecondaryRemittanceDocument.Issuer = adv.RelatedDocument.Issuer
+
+	fwm.RemittanceFreeText = NewRemittanceFreeText()
+	lines := append(append([]string{}, adv.FreeText...), "", "")
+	fwm.RemittanceFreeText.LineOne, fwm.RemittanceFreeText.LineTwo, fwm.RemittanceFreeText.LineThree = lines[0], lines[1], lines[2]
+
+	tags := []interface{ Validate() error }{
+		fwm.RemittanceOriginator, fwm.RemittanceBeneficiary, fwm.PrimaryRemittanceDocument, fwm.ActualAmountPaid,
+		fwm.GrossAmountRemittanceDocument, fwm.Adjustment, fwm.DateRemittanceDocument,
+		fwm.SecondaryRemittanceDocument, fwm.RemittanceFreeText,
+	}
+	if fwm.AmountNegotiatedDiscount != nil {
+		tags = append(tags, fwm.AmountNegotiatedDiscount)
+	}
+	for _, tag := range tags {
+		if tag.Validate() != nil {
+			fwm.clearRemittance()
+			return false
+		}
+	}
+	return true
+}
+
+// fitsStructuredRemittance reports if adv has the documents and text structured remittance requires and if
+// each field fits the width of its tag
+func fitsStructuredRemittance(adv *RemittanceAdvice) bool {
+	if len(adv.Documents) != 1 || adv.RelatedDocument == nil || len(adv.FreeText) == 0 || len(adv.FreeText) > 3 {
+		return false
+	}
+	doc := adv.Documents[0]
+	if doc.Date == "" || doc.GrossAmount == "" || doc.AdjustmentReasonCode == "" || doc.AdjustmentAmount == "" {
+		return false
+	}
+	for _, p := range []RemittanceParty{adv.Originator, adv.Beneficiary} {
+		if len(p.AddressLines) > 7 || !fitsWidth(p.Name, 140) || !fitsWidth(p.IdentificationNumber, 35) ||
+			!fitsWidth(p.TownName, 35) || !fitsWidth(p.CountrySubDivisionState, 35) || !fitsWidth(p.PostCode, 16) || !fitsWidth(p.Country, 2) {
+			return false
+		}
+		for _, line := range p.AddressLines {
+			if !fitsWidth(line, 70) {
+				return false
+			}
+		}
+	}
+	for _, line := range adv.FreeText {
+		if !fitsWidth(line, 140) {
+			return false
+		}
+	}
+	related := adv.RelatedDocument
+	return fitsWidth(doc.ProprietaryDocumentTypeCode, 35) && fitsWidth(doc.DocumentIdentificationNumber, 35) &&
+		fitsWidth(doc.AmountPaid, 19) && fitsWidth(doc.GrossAmount, 19) && fitsWidth(doc.DiscountAmount, 19) &&
+		fitsWidth(doc.AdjustmentAmount, 19) && fitsWidth(doc.AdjustmentInfo, 140) &&
+		fitsWidth(related.ProprietaryDocumentTypeCode, 35) && fitsWidth(related.DocumentIdentificationNumber, 35) && fitsWidth(related.Issuer, 35)
+}
+
+// fitsWidth reports if s is no longer than width characters
+func fitsWidth(s string, width int) bool {
+	return utf8.RuneCountInString(s) <= width
+}
+
+// remittanceData returns the RemittanceData of structured remittance for p
+func (p RemittanceParty) remittanceData() RemittanceData {
+	rd := RemittanceData{
+		Name:                    p.Name,
+		AddressType:             CompletePostalAddress,
+		TownName:                p.TownName,
+		CountrySubDivisionState: p.CountrySubDivisionState,
+		PostCode:                p.PostCode,
+		Country:                 p.Country,
+	}
+	lines := []*string{&rd.AddressLineOne, &rd.AddressLineTwo, &rd.AddressLineThree, &rd.AddressLineFour,
+		&rd.AddressLineFive, &rd.AddressLineSix, &rd.AddressLineSeven}
+	for i, line := range p.AddressLines {
+		*lines[i] = line
+	}
+	return rd
+}
+
+// RemittanceAdvice returns the remittance information carried in the message, either as structured
+// remittance ({8300} through {8750}) or an ANSI X12 820 transaction set in UnstructuredAddenda {8200}.
+func (fwm *FEDWireMessage) RemittanceAdvice() (*RemittanceAdvice, error) {
+	if fwm.LocalInstrument == nil {
+		return nil, ErrNoRemittanceInformation
+	}
+	switch fwm.LocalInstrument.LocalInstrumentCode {
+	case RemittanceInformationStructured:
+		return fwm.structuredRemittanceAdvice()
+	case ANSIX12format, STP820format:
+		if fwm.UnstructuredAddenda == nil {
+			return nil, fieldError("UnstructuredAddenda", ErrFieldRequired)
+		}
+		return ReadX12820(strings.NewReader(fwm.UnstructuredAddenda.Addenda))
+	}
+	return nil, ErrNoRemittanceInformation
+}
+
+// clearRemittance removes every remittance tag from the message
+func (fwm *FEDWireMessage) clearRemittance() {
+	fwm.UnstructuredAddenda = nil
+	fwm.RelatedRemittance = nil
+	fwm.RemittanceOriginator = nil
+	fwm.RemittanceBeneficiary = nil
+	fwm.PrimaryRemittanceDocument = nil
+	fwm.ActualAmountPaid = nil
+	fwm.GrossAmountRemittanceDocument = nil
+	fwm.AmountNegotiatedDiscount = nil
+	fwm.Adjustment = nil
+	fwm.DateRemittanceDocument = nil
+	fwm.SecondaryRemittanceDocument = nil
+	fwm.RemittanceFreeText = nil
+}
+
+func (fwm *FEDWireMessage) structuredRemittanceAdvice() (*RemittanceAdvice, error) {
+	if fwm.RemittanceOriginator == nil {
+		return nil, fieldError("RemittanceOriginator", ErrFieldRequired)
+	}
+	if fwm.RemittanceBeneficiary == nil {
+		return nil, fieldError("RemittanceBeneficiary", ErrFieldRequired)
+	}
+	if fwm.PrimaryRemittanceDocument == nil {
+		return nil, fieldError("PrimaryRemittanceDocument", ErrFieldRequired)
+	}
+	if fwm.ActualAmountPaid == nil {
+		return nil, fieldError("ActualAmountPaid", ErrFieldRequired)
+	}
+
+	adv := &RemittanceAdvice{
+		Originator: remittanceParty(fwm.RemittanceOriginator.IdentificationType, fwm.RemittanceOriginator.IdentificationCode,
+			fwm.RemittanceOriginator.IdentificationNumber, fwm.RemittanceOriginator.RemittanceData),
+		Beneficiary: remittanceParty(fwm.RemittanceBeneficiary.IdentificationType, fwm.RemittanceBeneficiary.IdentificationCode,
+			fwm.RemittanceBeneficiary.IdentificationNumber, fwm.RemittanceBeneficiary.RemittanceData),
+	}
+	if fwm.SenderReference != nil {
+		adv.Reference = fwm.SenderReference.SenderReference
+	}
+
+	doc := RemittanceDocument{
+		DocumentTypeCode:             fwm.PrimaryRemittanceDocument.DocumentTypeCode,
+		ProprietaryDocumentTypeCode:  fwm.PrimaryRemittanceDocument.ProprietaryDocumentTypeCode,
+		DocumentIdentificationNumber: fwm.PrimaryRemittanceDocument.DocumentIdentificationNumber,
+		CurrencyCode:                 fwm.ActualAmountPaid.RemittanceAmount.CurrencyCode,
+		AmountPaid:                   fwm.ActualAmountPaid.RemittanceAmount.Amount,
+	}
+	if fwm.GrossAmountRemittanceDocument != nil {
+		doc.GrossAmount = fwm.GrossAmountRemittanceDocument.RemittanceAmount.Amount
+	}
+	if fwm.AmountNegotiatedDiscount != nil {
+		doc.DiscountAmount = fwm.AmountNegotiatedDiscount.RemittanceAmount.Amount
+	}
+	if fwm.Adjustment != nil {
+		doc.AdjustmentReasonCode = fwm.Adjustment.AdjustmentReasonCode
+		doc.AdjustmentCreditDebitIndicator = fwm.Adjustment.CreditDebitIndicator
+		doc.AdjustmentAmount = fwm.Adjustment.RemittanceAmount.Amount
+		doc.AdjustmentInfo = fwm.Adjustment.AdditionalInfo
+	}
+	if fwm.DateRemittanceDocument != nil {
+		doc.Date = fwm.DateRemittanceDocument.DateRemittanceDocument
+	}
+	adv.Documents = append(adv.Documents, doc)
+
+	if srd := fwm.SecondaryRemittanceDocument; srd != nil {
+		adv.RelatedDocument = &RemittanceReference{
+			DocumentTypeCode:             srd.DocumentTypeCode,
+			ProprietaryDocumentTypeCode:  srd.ProprietaryDocumentTypeCode,
+			DocumentIdentificationNumber: srd.DocumentIdentificationNumber,
+			Issuer:                       srd.Issuer,
+		}
+	}
+	if fwm.RemittanceFreeText != nil {
+		for _, line := range []string{fwm.RemittanceFreeText.LineOne, fwm.RemittanceFreeText.LineTwo, fwm.RemittanceFreeText.LineThree} {
+			if line != "" {
+				adv.FreeText = append(adv.FreeText, line)
+			}
+		}
+	}
+	return adv, nil
+}
+
+func remittanceParty(idType, idCode, idNumber string, rd RemittanceData) RemittanceParty {
+	p := RemittanceParty{
+		Name:                    rd.Name,
+		IdentificationType:      idType,
+		IdentificationCode:      idCode,
+		IdentificationNumber:    idNumber,
+		TownName:                rd.TownName,
+		CountrySubDivisionState: rd.CountrySubDivisionState,
+		PostCode:                rd.PostCode,
+		Country:                 rd.Country,
+	}
+	for _, line := range []string{rd.AddressLineOne, rd.AddressLineTwo, rd.AddressLineThree, rd.AddressLineFour,
+		rd.AddressLineFive, rd.AddressLineSix, rd.AddressLineSeven} {
+		if line != "" {
+			p.AddressLines = append(p.AddressLines, line)
+		}
+	}
+	return p
+}
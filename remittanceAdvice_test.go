@@ -0,0 +1,221 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockRemittanceAdvice creates a RemittanceAdvice settling a single invoice
+func mockRemittanceAdvice() *RemittanceAdvice {
+	return &RemittanceAdvice{
+		Originator: RemittanceParty{
+			Name:                    "Acme Corporation",
+			IdentificationNumber:    "111333",
+			AddressLines:            []string{"123 Main Street"},
+			TownName:                "Anytown",
+			CountrySubDivisionState: "NY",
+			PostCode:                "12345",
+			Country:                 "US",
+		},
+		Beneficiary: RemittanceParty{
+			Name:                    "Widget Supply",
+			IdentificationNumber:    "222444",
+			AddressLines:            []string{"1 Industrial Way", "Suite 200"},
+			TownName:                "Othertown",
+			CountrySubDivisionState: "CA",
+			PostCode:                "90210",
+			Country:                 "US",
+		},
+		Reference: "PAYREF001",
+		Documents: []RemittanceDocument{
+			{
+				DocumentIdentificationNumber:   "INV-1001",
+				Date:                           "20200710",
+				AmountPaid:                     "1175.00",
+				GrossAmount:                    "1250.00",
+				DiscountAmount:                 "25.00",
+				AdjustmentReasonCode:           PricingError,
+				AdjustmentCreditDebitIndicator: CreditIndicator,
+				AdjustmentAmount:               "50.00",
+			},
+		},
+	}
+}
+
+// mockCustomerTransferPlusData creates a CustomerTransferPlus FEDWireMessage without remittance information
+func mockCustomerTransferPlusData() FEDWireMessage {
+	fwm := mockCustomerTransferData()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = CustomerTransferPlus
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.Originator = mockOriginator()
+	return fwm
+}
+
+// readStructuredRemittance reads the CustomerTransferPlus message carrying structured remittance
+func readStructuredRemittance(t *testing.T) FEDWireMessage {
+	t.Helper()
+	fd, err := os.Open(filepath.Join("test", "testdata", "fedWireMessage-CustomerTransferPlusStructuredRemittance.txt"))
+	require.NoError(t, err)
+	defer fd.Close()
+	file, err := NewReader(fd).Read()
+	require.NoError(t, err)
+	return file.FEDWireMessage
+}
+
+func TestFEDWireMessage_RemittanceAdviceStructured(t *testing.T) {
+	fwm := readStructuredRemittance(t)
+	require.Equal(t, RemittanceInformationStructured, fwm.LocalInstrument.LocalInstrumentCode)
+
+	read, err := fwm.RemittanceAdvice()
+	require.NoError(t, err)
+	require.Equal(t, "Name", read.Originator.Name)
+	require.Equal(t, "111111", read.Originator.IdentificationNumber)
+	require.Equal(t, []string{"Address Line One", "Address Line Two", "Address Line Three", "Address Line Four",
+		"Address Line Five", "Address Line Six", "Address Line Seven"}, read.Beneficiary.AddressLines)
+	require.Equal(t, []RemittanceDocument{{
+		DocumentTypeCode:               AccountsReceivableOpenItem,
+		DocumentIdentificationNumber:   "111111",
+		Date:                           "20190509",
+		CurrencyCode:                   "USD",
+		AmountPaid:                     "1234.56",
+		GrossAmount:                    "1234.56",
+		DiscountAmount:                 "1234.56",
+		AdjustmentReasonCode:           PricingError,
+		AdjustmentCreditDebitIndicator: CreditIndicator,
+		AdjustmentAmount:               "1234.56",
+		AdjustmentInfo:                 "Adjustment Additional Information",
+	}}, read.Documents)
+}
+
+func TestFEDWireMessage_SetRemittanceAdviceSingle(t *testing.T) {
+	fwm := mockCustomerTransferPlusData()
+	adv := mockRemittanceAdvice()
+
+	// a single document is written as ANSI X12 too without the related document and free text structured
+	// remittance requires
+	require.NoError(t, fwm.SetRemittanceAdvice(adv))
+	require.Equal(t, ANSIX12format, fwm.LocalInstrument.LocalInstrumentCode)
+	require.Nil(t, fwm.PrimaryRemittanceDocument)
+
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Validate())
+
+	read, err := fwm.RemittanceAdvice()
+	require.NoError(t, err)
+	require.Len(t, read.Documents, 1)
+	require.Equal(t, "INV-1001", read.Documents[0].DocumentIdentificationNumber)
+	require.Equal(t, "1250.00", read.Documents[0].GrossAmount)
+	require.Equal(t, "20200710", read.Documents[0].Date)
+}
+
+func TestFEDWireMessage_SetRemittanceAdviceStructured(t *testing.T) {
+	structured := readStructuredRemittance(t)
+	adv, err := structured.RemittanceAdvice()
+	require.NoError(t, err)
+	require.Equal(t, &RemittanceReference{DocumentTypeCode: StatementAccount, DocumentIdentificationNumber: "222222", Issuer: "Issuer 2"}, adv.RelatedDocument)
+	require.Equal(t, []string{"Remittance Free Text Line One", "Remittance Free Text Line Two", "Remittance Free Text Line Three"}, adv.FreeText)
+
+	fwm := mockCustomerTransferPlusData()
+	require.NoError(t, fwm.SetRemittanceAdvice(adv))
+	require.Equal(t, RemittanceInformationStructured, fwm.LocalInstrument.LocalInstrumentCode)
+	require.Nil(t, fwm.UnstructuredAddenda)
+	require.Equal(t, structured.PrimaryRemittanceDocument.DocumentIdentificationNumber, fwm.PrimaryRemittanceDocument.DocumentIdentificationNumber)
+	require.Equal(t, structured.ActualAmountPaid.RemittanceAmount, fwm.ActualAmountPaid.RemittanceAmount)
+	require.Equal(t, structured.Adjustment.RemittanceAmount, fwm.Adjustment.RemittanceAmount)
+
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Validate())
+
+	read, err := fwm.RemittanceAdvice()
+	require.NoError(t, err)
+	require.Equal(t, adv.Documents, read.Documents)
+	require.Equal(t, adv.RelatedDocument, read.RelatedDocument)
+	require.Equal(t, adv.FreeText, read.FreeText)
+	require.Equal(t, adv.Beneficiary.AddressLines, read.Beneficiary.AddressLines)
+
+	// a field wider than its tag falls back to ANSI X12
+	adv.Originator.Name = strings.Repeat("A", 141)
+	require.NoError(t, fwm.SetRemittanceAdvice(adv))
+	require.Equal(t, ANSIX12format, fwm.LocalInstrument.LocalInstrumentCode)
+	require.Nil(t, fwm.RemittanceOriginator)
+	require.Nil(t, fwm.RemittanceFreeText)
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Validate())
+}
+
+func TestFEDWireMessage_SetRemittanceAdviceUnstructured(t *testing.T) {
+	fwm := mockCustomerTransferPlusData()
+	adv := mockRemittanceAdvice()
+	adv.Documents = append(adv.Documents, RemittanceDocument{
+		DocumentTypeCode:             CreditNote,
+		DocumentIdentificationNumber: "CN-77",
+		AmountPaid:                   "-100.00",
+	})
+
+	require.NoError(t, fwm.SetRemittanceAdvice(adv))
+	require.Equal(t, ANSIX12format, fwm.LocalInstrument.LocalInstrumentCode)
+	require.Nil(t, fwm.PrimaryRemittanceDocument)
+	require.True(t, strings.HasPrefix(fwm.UnstructuredAddenda.Addenda, "ST*820*0001~"))
+	require.Equal(t, len(fwm.UnstructuredAddenda.Addenda), fwm.UnstructuredAddenda.parseNumField(fwm.UnstructuredAddenda.AddendaLength))
+
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Validate())
+
+	read, err := fwm.RemittanceAdvice()
+	require.NoError(t, err)
+	require.Len(t, read.Documents, 2)
+	require.Equal(t, "CN-77", read.Documents[1].DocumentIdentificationNumber)
+	require.Equal(t, CreditNote, read.Documents[1].DocumentTypeCode)
+}
+
+func TestFEDWireMessage_SetRemittanceAdviceReplaces(t *testing.T) {
+	fwm := readStructuredRemittance(t)
+	require.NoError(t, fwm.SetRemittanceAdvice(mockRemittanceAdvice()))
+	require.Equal(t, ANSIX12format, fwm.LocalInstrument.LocalInstrumentCode)
+	require.NotNil(t, fwm.UnstructuredAddenda)
+	require.Nil(t, fwm.PrimaryRemittanceDocument)
+	require.Nil(t, fwm.SecondaryRemittanceDocument)
+	require.Nil(t, fwm.RemittanceFreeText)
+}
+
+func TestFEDWireMessage_SetRemittanceAdviceErrors(t *testing.T) {
+	fwm := mockCustomerTransferPlusData()
+	require.Equal(t, ErrNoRemittanceDocuments, fwm.SetRemittanceAdvice(&RemittanceAdvice{}))
+
+	adv := mockRemittanceAdvice()
+	adv.Documents[0].AmountPaid = "1O0"
+	require.EqualError(t, fwm.SetRemittanceAdvice(adv), fieldError("AmountPaid", ErrNonAmount, "1O0").Error())
+
+	fwm = mockCustomerTransferData()
+	err := fwm.SetRemittanceAdvice(mockRemittanceAdvice())
+	require.EqualError(t, err, fieldError("BusinessFunctionCode", ErrLocalInstrumentNotPermitted).Error())
+
+	fwm = mockCustomerTransferPlusData()
+	adv = mockRemittanceAdvice()
+	for i := 0; i < 200; i++ {
+		adv.Documents = append(adv.Documents, adv.Documents[0])
+	}
+	require.ErrorIs(t, fwm.SetRemittanceAdvice(adv), ErrAddendaTooLong)
+}
+
+func TestFEDWireMessage_RemittanceAdviceMissing(t *testing.T) {
+	fwm := mockCustomerTransferPlusData()
+	_, err := fwm.RemittanceAdvice()
+	require.Equal(t, ErrNoRemittanceInformation, err)
+
+	fwm.LocalInstrument = NewLocalInstrument()
+	fwm.LocalInstrument.LocalInstrumentCode = ANSIX12format
+	_, err = fwm.RemittanceAdvice()
+	require.EqualError(t, err, fieldError("UnstructuredAddenda", ErrFieldRequired).Error())
+}
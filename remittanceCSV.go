@@ -0,0 +1,154 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrRemittanceCSV is returned when an invoice CSV file can't be read
+var ErrRemittanceCSV = errors.New("invalid remittance CSV")
+
+// remittanceCSVColumns are the columns of an invoice CSV file in the order WriteRemittanceCSV writes them
+var remittanceCSVColumns = []string{
+	"invoice_number",
+	"invoice_date",
+	"document_type",
+	"proprietary_document_type",
+	"currency",
+	"amount_paid",
+	"gross_amount",
+	"discount_amount",
+	"adjustment_reason",
+	"adjustment_indicator",
+	"adjustment_amount",
+	"adjustment_info",
+}
+
+// remittanceCSVDateFormats are the layouts accepted for invoice_date
+var remittanceCSVDateFormats = []string{"20060102", "2006-01-02", "01/02/2006"}
+
+// ReadRemittanceCSV reads invoices from CSV with a header row. Headers are matched case-insensitively
+// and may use spaces or dashes in place of underscores, e.g. "Invoice Number". The invoice_number and
+// amount_paid columns are required; any of the following are optional: invoice_date, document_type,
+// proprietary_document_type, currency, gross_amount, discount_amount, adjustment_reason,
+// adjustment_indicator, adjustment_amount and adjustment_info.
+//
+// invoice_date may be formatted as CCYYMMDD, CCYY-MM-DD or MM/DD/CCYY.
+func ReadRemittanceCSV(r io.Reader) ([]RemittanceDocument, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrRemittanceCSV, err)
+	}
+	columns := make(map[string]int)
+	for i := range header {
+		name := strings.ToLower(strings.TrimSpace(header[i]))
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+		columns[name] = i
+	}
+	for _, name := range []string{"invoice_number", "amount_paid"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing %s column", ErrRemittanceCSV, name)
+		}
+	}
+
+	var docs []RemittanceDocument
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRemittanceCSV, err)
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		doc := RemittanceDocument{
+			DocumentTypeCode:               strings.ToUpper(value("document_type")),
+			ProprietaryDocumentTypeCode:    value("proprietary_document_type"),
+			DocumentIdentificationNumber:   value("invoice_number"),
+			CurrencyCode:                   strings.ToUpper(value("currency")),
+			AmountPaid:                     value("amount_paid"),
+			GrossAmount:                    value("gross_amount"),
+			DiscountAmount:                 value("discount_amount"),
+			AdjustmentReasonCode:           value("adjustment_reason"),
+			AdjustmentCreditDebitIndicator: strings.ToUpper(value("adjustment_indicator")),
+			AdjustmentAmount:               value("adjustment_amount"),
+			AdjustmentInfo:                 value("adjustment_info"),
+		}
+		if doc.DocumentIdentificationNumber == "" {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrRemittanceCSV, line, fieldError("invoice_number", ErrFieldRequired))
+		}
+		if doc.AmountPaid == "" {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrRemittanceCSV, line, fieldError("amount_paid", ErrFieldRequired))
+		}
+		if date := value("invoice_date"); date != "" {
+			if doc.Date, err = parseRemittanceCSVDate(date); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrRemittanceCSV, line, fieldError("invoice_date", err, date))
+			}
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrRemittanceCSV, ErrNoRemittanceDocuments)
+	}
+	return docs, nil
+}
+
+// WriteRemittanceCSV writes docs as CSV with a header row which ReadRemittanceCSV accepts.
+// Dates are written as CCYY-MM-DD.
+func WriteRemittanceCSV(w io.Writer, docs []RemittanceDocument) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(remittanceCSVColumns); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		date := doc.Date
+		if t, err := time.Parse("20060102", doc.Date); err == nil {
+			date = t.Format("2006-01-02")
+		}
+		record := []string{
+			doc.DocumentIdentificationNumber,
+			date,
+			doc.documentTypeCode(),
+			doc.ProprietaryDocumentTypeCode,
+			doc.currencyCode(),
+			doc.AmountPaid,
+			doc.GrossAmount,
+			doc.DiscountAmount,
+			doc.AdjustmentReasonCode,
+			doc.AdjustmentCreditDebitIndicator,
+			doc.AdjustmentAmount,
+			doc.AdjustmentInfo,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseRemittanceCSVDate returns date as CCYYMMDD
+func parseRemittanceCSVDate(date string) (string, error) {
+	for _, layout := range remittanceCSVDateFormats {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format("20060102"), nil
+		}
+	}
+	return "", ErrValidDate
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRemittanceCSV(t *testing.T) {
+	input := "Invoice Number,Invoice Date,Amount Paid,Gross-Amount,Currency\n" +
+		"INV-1001,2020-07-10,1175.00,1250.00,usd\n" +
+		"INV-1002,07/11/2020,400.00,,\n" +
+		"INV-1003,20200712,12.50,,EUR\n"
+
+	docs, err := ReadRemittanceCSV(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+
+	require.Equal(t, "INV-1001", docs[0].DocumentIdentificationNumber)
+	require.Equal(t, "20200710", docs[0].Date)
+	require.Equal(t, "1175.00", docs[0].AmountPaid)
+	require.Equal(t, "1250.00", docs[0].GrossAmount)
+	require.Equal(t, "USD", docs[0].CurrencyCode)
+	require.Equal(t, "20200711", docs[1].Date)
+	require.Equal(t, "", docs[1].CurrencyCode)
+	require.Equal(t, "20200712", docs[2].Date)
+}
+
+func TestReadRemittanceCSVErrors(t *testing.T) {
+	_, err := ReadRemittanceCSV(strings.NewReader(""))
+	require.ErrorIs(t, err, ErrRemittanceCSV)
+
+	_, err = ReadRemittanceCSV(strings.NewReader("invoice_number\nINV-1\n"))
+	require.EqualError(t, err, "invalid remittance CSV: missing amount_paid column")
+
+	_, err = ReadRemittanceCSV(strings.NewReader("invoice_number,amount_paid\n"))
+	require.ErrorIs(t, err, ErrRemittanceCSV)
+
+	_, err = ReadRemittanceCSV(strings.NewReader("invoice_number,amount_paid\n,10.00\n"))
+	require.EqualError(t, err, "invalid remittance CSV: line 2: "+fieldError("invoice_number", ErrFieldRequired).Error())
+
+	_, err = ReadRemittanceCSV(strings.NewReader("invoice_number,amount_paid,invoice_date\nINV-1,10.00,July 10\n"))
+	require.EqualError(t, err, "invalid remittance CSV: line 2: "+fieldError("invoice_date", ErrValidDate, "July 10").Error())
+}
+
+func TestWriteRemittanceCSV(t *testing.T) {
+	docs := mockRemittanceAdvice().Documents
+
+	var buf strings.Builder
+	require.NoError(t, WriteRemittanceCSV(&buf, docs))
+
+	expected := "invoice_number,invoice_date,document_type,proprietary_document_type,currency,amount_paid," +
+		"gross_amount,discount_amount,adjustment_reason,adjustment_indicator,adjustment_amount,adjustment_info\n" +
+		"INV-1001,2020-07-10,CINV,,USD,1175.00,1250.00,25.00,01,CRDT,50.00,\n"
+	require.Equal(t, expected, buf.String())
+
+	read, err := ReadRemittanceCSV(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	docs[0].DocumentTypeCode = CommercialInvoice
+	docs[0].CurrencyCode = "USD"
+	require.Equal(t, docs, read)
+}
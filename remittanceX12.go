@@ -0,0 +1,258 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ErrX12820 is returned when an ANSI X12 820 transaction set can't be read
+var ErrX12820 = errors.New("invalid ANSI X12 820")
+
+// x12DocumentTypes maps RMR01 reference identification qualifiers to Document Type Codes
+var x12DocumentTypes = map[string]string{
+	"IV": CommercialInvoice,
+	"PO": PurchaseOrder,
+	"CM": CreditNote,
+	"DM": DebitNote,
+	"BL": BillLadingShippingNotice,
+	"VV": Voucher,
+	"CT": CommercialContract,
+}
+
+// ReadX12820 reads the remittance detail of an ANSI X12 820 Payment Order/Remittance Advice.
+//
+// The ISA envelope is optional; when present its element separator and segment terminator are used,
+// otherwise '*' and '~' are assumed. Payer (N1*PR) and payee (N1*PE) loops populate the Originator
+// and Beneficiary, and each RMR segment, with its DTM*003 and ADX segments, becomes a RemittanceDocument.
+// RMR01 qualifiers without a matching Document Type Code are read as ProprietaryDocumentType.
+func ReadX12820(r io.Reader) (*RemittanceAdvice, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	elementSep, segmentTerm := "*", "~"
+	if strings.HasPrefix(s, "ISA") && len(s) > 105 {
+		elementSep, segmentTerm = s[3:4], s[105:106]
+	}
+
+	adv := &RemittanceAdvice{}
+	currency := ""
+	var party *RemittanceParty
+	var doc *RemittanceDocument
+	for _, segment := range strings.Split(s, segmentTerm) {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		e := strings.Split(segment, elementSep)
+		switch e[0] {
+		case "TRN":
+			adv.Reference = x12Element(e, 2)
+		case "CUR":
+			currency = x12Element(e, 2)
+		case "N1":
+			switch x12Element(e, 1) {
+			case "PR":
+				party = &adv.Originator
+			case "PE":
+				party = &adv.Beneficiary
+			default:
+				party = nil
+				continue
+			}
+			party.Name = x12Element(e, 2)
+			party.IdentificationNumber = x12Element(e, 4)
+		case "N3":
+			if party != nil {
+				for _, line := range e[1:] {
+					if line != "" {
+						party.AddressLines = append(party.AddressLines, line)
+					}
+				}
+			}
+		case "N4":
+			if party != nil {
+				party.TownName = x12Element(e, 1)
+				party.CountrySubDivisionState = x12Element(e, 2)
+				party.PostCode = x12Element(e, 3)
+				party.Country = x12Element(e, 4)
+			}
+		case "RMR":
+			adv.Documents = append(adv.Documents, RemittanceDocument{
+				DocumentIdentificationNumber: x12Element(e, 2),
+				AmountPaid:                   x12Element(e, 4),
+				GrossAmount:                  x12Element(e, 5),
+				DiscountAmount:               x12Element(e, 6),
+			})
+			doc = &adv.Documents[len(adv.Documents)-1]
+			qualifier := x12Element(e, 1)
+			if code, ok := x12DocumentTypes[qualifier]; ok {
+				doc.DocumentTypeCode = code
+			} else {
+				doc.DocumentTypeCode = ProprietaryDocumentType
+				doc.ProprietaryDocumentTypeCode = qualifier
+			}
+			if doc.DocumentIdentificationNumber == "" || doc.AmountPaid == "" {
+				return nil, fmt.Errorf("%w: RMR segment %d requires a reference and amount paid", ErrX12820, len(adv.Documents))
+			}
+		case "DTM":
+			if doc != nil && x12Element(e, 1) == "003" {
+				doc.Date = x12Element(e, 2)
+			}
+		case "ADX":
+			if doc != nil {
+				amount := x12Element(e, 1)
+				doc.AdjustmentCreditDebitIndicator = DebitIndicator
+				if strings.HasPrefix(amount, "-") {
+					doc.AdjustmentCreditDebitIndicator = CreditIndicator
+				}
+				doc.AdjustmentAmount = strings.TrimPrefix(amount, "-")
+				doc.AdjustmentReasonCode = x12Element(e, 2)
+			}
+		}
+	}
+	if len(adv.Documents) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrX12820, ErrNoRemittanceDocuments)
+	}
+	for i := range adv.Documents {
+		adv.Documents[i].CurrencyCode = currency
+	}
+	return adv, nil
+}
+
+// WriteX12820 writes adv as an ANSI X12 820 transaction set (ST through SE) using '*' element separators
+// and '~' segment terminators. No interchange (ISA) or functional group (GS) envelope is written.
+//
+// Credit adjustments are written as negative ADX01 amounts, matching ReadX12820.
+func WriteX12820(w io.Writer, adv *RemittanceAdvice) error {
+	if adv == nil || len(adv.Documents) == 0 {
+		return ErrNoRemittanceDocuments
+	}
+
+	total := new(big.Rat)
+	for i := range adv.Documents {
+		// credit notes may be written with negative amounts, reducing the total paid
+		paid := adv.Documents[i].AmountPaid
+		amount, _, err := parseDecimalAmount(strings.TrimPrefix(paid, "-"))
+		if err != nil {
+			return fieldError("AmountPaid", err, paid)
+		}
+		if strings.HasPrefix(paid, "-") {
+			amount.Neg(amount)
+		}
+		total.Add(total, amount)
+	}
+
+	var segments [][]string
+	segments = append(segments, []string{"ST", "820", "0001"})
+	segments = append(segments, []string{"BPR", "C", total.FloatString(2), "C", "FWT"})
+	if adv.Reference != "" {
+		segments = append(segments, []string{"TRN", "1", adv.Reference})
+	}
+	segments = append(segments, []string{"CUR", "PR", adv.Documents[0].currencyCode()})
+	segments = append(segments, adv.Originator.x12Segments("PR")...)
+	segments = append(segments, adv.Beneficiary.x12Segments("PE")...)
+	segments = append(segments, []string{"ENT", "1"})
+	for _, doc := range adv.Documents {
+		segments = append(segments, doc.x12Segments()...)
+	}
+	segments = append(segments, []string{"SE", fmt.Sprintf("%d", len(segments)+1), "0001"})
+
+	var buf strings.Builder
+	for _, segment := range segments {
+		for i := range segment {
+			if i > 0 {
+				buf.WriteString("*")
+			}
+			buf.WriteString(x12Value(segment[i]))
+		}
+		buf.WriteString("~")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func (p RemittanceParty) x12Segments(entityID string) [][]string {
+	n1 := []string{"N1", entityID, p.Name}
+	if p.IdentificationNumber != "" {
+		qualifier := "ZZ"
+		if p.IdentificationCode == OICTaxIdentificationNumber {
+			qualifier = "FI"
+		}
+		n1 = append(n1, qualifier, p.IdentificationNumber)
+	}
+	segments := [][]string{n1}
+	for i := 0; i < len(p.AddressLines); i += 2 {
+		n3 := []string{"N3", p.AddressLines[i]}
+		if i+1 < len(p.AddressLines) {
+			n3 = append(n3, p.AddressLines[i+1])
+		}
+		segments = append(segments, n3)
+	}
+	if p.TownName != "" || p.CountrySubDivisionState != "" || p.PostCode != "" || p.Country != "" {
+		segments = append(segments, x12Trim([]string{"N4", p.TownName, p.CountrySubDivisionState, p.PostCode, p.Country}))
+	}
+	return segments
+}
+
+func (doc RemittanceDocument) x12Segments() [][]string {
+	qualifier := "ZZ"
+	for q, code := range x12DocumentTypes {
+		if code == doc.documentTypeCode() {
+			qualifier = q
+		}
+	}
+	if doc.documentTypeCode() == ProprietaryDocumentType && doc.ProprietaryDocumentTypeCode != "" {
+		qualifier = doc.ProprietaryDocumentTypeCode
+	}
+
+	segments := [][]string{
+		x12Trim([]string{"RMR", qualifier, doc.DocumentIdentificationNumber, "",
+			x12Amount(doc.AmountPaid), x12Amount(doc.GrossAmount), x12Amount(doc.DiscountAmount)}),
+	}
+	if doc.Date != "" {
+		segments = append(segments, []string{"DTM", "003", doc.Date})
+	}
+	if doc.AdjustmentAmount != "" {
+		amount := x12Amount(doc.AdjustmentAmount)
+		if doc.AdjustmentCreditDebitIndicator == "" || doc.AdjustmentCreditDebitIndicator == CreditIndicator {
+			amount = "-" + amount
+		}
+		segments = append(segments, []string{"ADX", amount, doc.AdjustmentReasonCode})
+	}
+	return segments
+}
+
+// x12Element returns the element at position i of a segment, or an empty string when it's absent
+func x12Element(elements []string, i int) string {
+	if i < len(elements) {
+		return strings.TrimSpace(elements[i])
+	}
+	return ""
+}
+
+// x12Trim removes trailing empty elements from a segment
+func x12Trim(segment []string) []string {
+	for len(segment) > 1 && segment[len(segment)-1] == "" {
+		segment = segment[:len(segment)-1]
+	}
+	return segment
+}
+
+// x12Value replaces separator characters which would otherwise break the transaction set
+func x12Value(s string) string {
+	return strings.NewReplacer("*", " ", "~", " ").Replace(s)
+}
+
+// x12Amount renders an amount with a decimal period, as X12 expects
+func x12Amount(s string) string {
+	return strings.Replace(s, ",", ".", 1)
+}
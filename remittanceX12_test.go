@@ -0,0 +1,104 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const x12820Sample = "ISA|00|          |00|          |ZZ|ACME           |ZZ|WIDGET         |200710|1200|U|00401|000000001|0|P|>^\n" +
+	"GS|RA|ACME|WIDGET|20200710|1200|1|X|004010^\n" +
+	"ST|820|0001^\n" +
+	"BPR|C|1575.00|C|FWT^\n" +
+	"TRN|1|PAYREF001^\n" +
+	"CUR|PR|USD^\n" +
+	"N1|PR|Acme Corporation|ZZ|111333^\n" +
+	"N3|123 Main Street^\n" +
+	"N4|Anytown|NY|12345|US^\n" +
+	"N1|PE|Widget Supply^\n" +
+	"ENT|1^\n" +
+	"RMR|IV|INV-1001||1175.00|1250.00|25.00^\n" +
+	"DTM|003|20200710^\n" +
+	"ADX|-50.00|01^\n" +
+	"RMR|ZZ1|CONTRACT-9||400.00^\n" +
+	"SE|14|0001^\n" +
+	"GE|1|1^\n" +
+	"IEA|1|000000001^\n"
+
+func TestReadX12820(t *testing.T) {
+	adv, err := ReadX12820(strings.NewReader(x12820Sample))
+	require.NoError(t, err)
+
+	require.Equal(t, "PAYREF001", adv.Reference)
+	require.Equal(t, "Acme Corporation", adv.Originator.Name)
+	require.Equal(t, "111333", adv.Originator.IdentificationNumber)
+	require.Equal(t, []string{"123 Main Street"}, adv.Originator.AddressLines)
+	require.Equal(t, "Anytown", adv.Originator.TownName)
+	require.Equal(t, "Widget Supply", adv.Beneficiary.Name)
+
+	require.Len(t, adv.Documents, 2)
+	inv := adv.Documents[0]
+	require.Equal(t, CommercialInvoice, inv.DocumentTypeCode)
+	require.Equal(t, "INV-1001", inv.DocumentIdentificationNumber)
+	require.Equal(t, "USD", inv.CurrencyCode)
+	require.Equal(t, "1175.00", inv.AmountPaid)
+	require.Equal(t, "1250.00", inv.GrossAmount)
+	require.Equal(t, "25.00", inv.DiscountAmount)
+	require.Equal(t, "20200710", inv.Date)
+	require.Equal(t, PricingError, inv.AdjustmentReasonCode)
+	require.Equal(t, CreditIndicator, inv.AdjustmentCreditDebitIndicator)
+	require.Equal(t, "50.00", inv.AdjustmentAmount)
+
+	require.Equal(t, ProprietaryDocumentType, adv.Documents[1].DocumentTypeCode)
+	require.Equal(t, "ZZ1", adv.Documents[1].ProprietaryDocumentTypeCode)
+}
+
+func TestReadX12820Errors(t *testing.T) {
+	_, err := ReadX12820(strings.NewReader("ST*820*0001~BPR*C*1.00*C*FWT~SE*3*0001~"))
+	require.ErrorIs(t, err, ErrX12820)
+
+	_, err = ReadX12820(strings.NewReader("ST*820*0001~RMR*IV*INV-1~SE*3*0001~"))
+	require.ErrorIs(t, err, ErrX12820)
+}
+
+func TestWriteX12820(t *testing.T) {
+	adv := mockRemittanceAdvice()
+	adv.Originator.IdentificationCode = OICTaxIdentificationNumber
+
+	var buf strings.Builder
+	require.NoError(t, WriteX12820(&buf, adv))
+
+	expected := "ST*820*0001~BPR*C*1175.00*C*FWT~TRN*1*PAYREF001~CUR*PR*USD~" +
+		"N1*PR*Acme Corporation*FI*111333~N3*123 Main Street~N4*Anytown*NY*12345*US~" +
+		"N1*PE*Widget Supply*ZZ*222444~N3*1 Industrial Way*Suite 200~N4*Othertown*CA*90210*US~" +
+		"ENT*1~RMR*IV*INV-1001**1175.00*1250.00*25.00~DTM*003*20200710~ADX*-50.00*01~SE*15*0001~"
+	require.Equal(t, expected, buf.String())
+
+	read, err := ReadX12820(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	require.Equal(t, adv.Documents[0].AdjustmentCreditDebitIndicator, read.Documents[0].AdjustmentCreditDebitIndicator)
+	require.Equal(t, adv.Beneficiary.AddressLines, read.Beneficiary.AddressLines)
+}
+
+func TestWriteX12820Errors(t *testing.T) {
+	var buf strings.Builder
+	require.Equal(t, ErrNoRemittanceDocuments, WriteX12820(&buf, &RemittanceAdvice{}))
+
+	adv := mockRemittanceAdvice()
+	adv.Documents[0].AmountPaid = "ten"
+	require.EqualError(t, WriteX12820(&buf, adv), fieldError("AmountPaid", ErrNonAmount, "ten").Error())
+}
+
+func TestWriteX12820Separators(t *testing.T) {
+	adv := mockRemittanceAdvice()
+	adv.Originator.Name = "Acme*Corp~"
+
+	var buf strings.Builder
+	require.NoError(t, WriteX12820(&buf, adv))
+	require.Contains(t, buf.String(), "N1*PR*Acme Corp *ZZ*111333~")
+}
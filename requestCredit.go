@@ -0,0 +1,243 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotRequestCredit is returned when a reply is built from, or matched against, a message which isn't a
+	// RequestCredit drawdown request
+	ErrNotRequestCredit = errors.New("is not a request for credit")
+	// ErrNotRequestCreditReply is returned when a message isn't a FundsTransferRequestCredit or RefusalRequestCredit
+	ErrNotRequestCreditReply = errors.New("is not a funds transfer or refusal of a request for credit")
+	// ErrRequestCreditMismatch is returned when a reply does not match the request for credit
+	ErrRequestCreditMismatch = errors.New("does not match the request for credit")
+	// ErrRequestCreditCycleDate is returned when a reply is dated before the request for credit
+	ErrRequestCreditCycleDate = errors.New("is before the cycle date of the request for credit")
+)
+
+// NewFundsTransferRequestCredit returns a FundsTransferRequestCredit paying request, a RequestCredit
+// (CustomerCorporateDrawdownRequest or BankDrawDownRequest) we received, to be sent on businessDay.
+//
+// The funds transfer is a DrawdownResponse with the TypeCode and Amount of the request, sent by the receiver of the
+// request back to its sender with its PreviousMessageIdentifier set to the request IMAD. The AccountDebitedDrawdown
+// becomes the Originator. The Beneficiary (or AccountCreditedDrawdown when there's no Beneficiary), BeneficiaryFI,
+// BeneficiaryIntermediaryFI, BeneficiaryReference and OriginatorToBeneficiary are carried over.
+func NewFundsTransferRequestCredit(request FEDWireMessage, businessDay time.Time) (FEDWireMessage, error) {
+	if err := checkRequestCredit(request, businessDay); err != nil {
+		return FEDWireMessage{}, err
+	}
+	fwm := newReplyMessage(request, businessDay, FundsTransferRequestCredit)
+
+	fwm.BusinessFunctionCode = NewBusinessFunctionCode()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = DrawdownResponse
+
+	if debitDD := request.AccountDebitedDrawdown; debitDD != nil {
+		fwm.Originator = NewOriginator()
+		fwm.Originator.Personal = Personal{
+			IdentificationCode: debitDD.IdentificationCode,
+			Identifier:         debitDD.Identifier,
+			Name:               debitDD.Name,
+			Address:            debitDD.Address,
+		}
+	}
+	switch {
+	case request.Beneficiary != nil:
+		ben := *request.Beneficiary
+		fwm.Beneficiary = &ben
+	case request.AccountCreditedDrawdown != nil:
+		// a bank drawdown credits the requesting bank
+		fwm.Beneficiary = NewBeneficiary()
+		fwm.Beneficiary.Personal.IdentificationCode = FEDRoutingNumber
+		fwm.Beneficiary.Personal.Identifier = request.AccountCreditedDrawdown.DrawdownCreditAccountNumber
+		if request.SenderDepositoryInstitution != nil {
+			fwm.Beneficiary.Personal.Name = request.SenderDepositoryInstitution.SenderShortName
+		}
+	}
+	if request.BeneficiaryFI != nil {
+		bfi := *request.BeneficiaryFI
+		fwm.BeneficiaryFI = &bfi
+	}
+	if request.BeneficiaryIntermediaryFI != nil && request.BeneficiaryFI != nil {
+		bifi := *request.BeneficiaryIntermediaryFI
+		fwm.BeneficiaryIntermediaryFI = &bifi
+	}
+	fwm.carryReferences(request)
+	return fwm, nil
+}
+
+// NewRefusalRequestCredit returns a RefusalRequestCredit declining request, a RequestCredit
+// (CustomerCorporateDrawdownRequest or BankDrawDownRequest) we received, to be sent on businessDay.
+//
+// The refusal has the TypeCode, business function code and Amount of the request and is sent by the receiver of
+// the request back to its sender with its PreviousMessageIdentifier set to the request IMAD. The Beneficiary,
+// BeneficiaryFI, AccountDebitedDrawdown, AccountCreditedDrawdown and BeneficiaryReference are carried over.
+func NewRefusalRequestCredit(request FEDWireMessage, businessDay time.Time) (FEDWireMessage, error) {
+	if err := checkRequestCredit(request, businessDay); err != nil {
+		return FEDWireMessage{}, err
+	}
+	fwm := newReplyMessage(request, businessDay, RefusalRequestCredit)
+
+	fwm.BusinessFunctionCode = NewBusinessFunctionCode()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = request.BusinessFunctionCode.BusinessFunctionCode
+
+	if request.Beneficiary != nil {
+		ben := *request.Beneficiary
+		fwm.Beneficiary = &ben
+	}
+	if request.BeneficiaryFI != nil {
+		bfi := *request.BeneficiaryFI
+		fwm.BeneficiaryFI = &bfi
+	}
+	if request.AccountDebitedDrawdown != nil {
+		debitDD := *request.AccountDebitedDrawdown
+		fwm.AccountDebitedDrawdown = &debitDD
+	}
+	if request.AccountCreditedDrawdown != nil {
+		creditDD := *request.AccountCreditedDrawdown
+		fwm.AccountCreditedDrawdown = &creditDD
+	}
+	fwm.carryReferences(request)
+	return fwm, nil
+}
+
+// ValidateRequestCreditReply checks the message is a FundsTransferRequestCredit or RefusalRequestCredit replying
+// to request. The PreviousMessageIdentifier must be the request IMAD, the TypeCode and Amount must be the same,
+// the message must be sent by the receiver of the request to its sender and the business function code must be
+// DrawdownResponse for a funds transfer or the request's for a refusal.
+func (fwm FEDWireMessage) ValidateRequestCreditReply(request FEDWireMessage) error {
+	if fwm.TypeSubType == nil {
+		return fieldError("TypeSubType", ErrFieldRequired)
+	}
+	if fwm.BusinessFunctionCode == nil {
+		return fieldError("BusinessFunctionCode", ErrFieldRequired)
+	}
+	bfc := fwm.BusinessFunctionCode.BusinessFunctionCode
+	switch fwm.TypeSubType.SubTypeCode {
+	case FundsTransferRequestCredit:
+		if bfc != DrawdownResponse {
+			return fieldError("BusinessFunctionCode", ErrRequestCreditMismatch, bfc)
+		}
+	case RefusalRequestCredit:
+		if request.BusinessFunctionCode != nil && bfc != request.BusinessFunctionCode.BusinessFunctionCode {
+			return fieldError("BusinessFunctionCode", ErrRequestCreditMismatch, bfc)
+		}
+	default:
+		return fieldError("SubTypeCode", ErrNotRequestCreditReply, fwm.TypeSubType.SubTypeCode)
+	}
+
+	businessDay, err := fwm.replyBusinessDay()
+	if err != nil {
+		return err
+	}
+	if err := checkRequestCredit(request, businessDay); err != nil {
+		return err
+	}
+	if fwm.TypeSubType.TypeCode != request.TypeSubType.TypeCode {
+		return fieldError("TypeCode", ErrRequestCreditMismatch, fwm.TypeSubType.TypeCode)
+	}
+	return fwm.checkReplyTo(request)
+}
+
+// checkRequestCredit checks request is a drawdown request which can be answered on businessDay
+func checkRequestCredit(request FEDWireMessage, businessDay time.Time) error {
+	if request.TypeSubType == nil {
+		return fieldError("TypeSubType", ErrFieldRequired)
+	}
+	if request.TypeSubType.SubTypeCode != RequestCredit {
+		return fieldError("SubTypeCode", ErrNotRequestCredit, request.TypeSubType.SubTypeCode)
+	}
+	if request.BusinessFunctionCode == nil {
+		return fieldError("BusinessFunctionCode", ErrFieldRequired)
+	}
+	switch request.BusinessFunctionCode.BusinessFunctionCode {
+	case CustomerCorporateDrawdownRequest, BankDrawDownRequest:
+	default:
+		return fieldError("BusinessFunctionCode", ErrNotRequestCredit, request.BusinessFunctionCode.BusinessFunctionCode)
+	}
+	if request.InputMessageAccountabilityData == nil {
+		return fieldError("InputMessageAccountabilityData", ErrFieldRequired)
+	}
+	cycleDate := request.InputMessageAccountabilityData.InputCycleDate
+	if _, err := time.Parse("20060102", cycleDate); err != nil {
+		return fieldError("InputCycleDate", ErrValidDate, cycleDate)
+	}
+	// CCYYMMDD sorts chronologically
+	if day := businessDay.Format("20060102"); day < cycleDate {
+		return fieldError("InputCycleDate", ErrRequestCreditCycleDate, day)
+	}
+	return nil
+}
+
+// newReplyMessage returns the tags of a reply to request, which link to it as a reversal links to the message it
+// reverses, sent by the receiver of request back to its sender. Like newReversalMessage it only dates the IMAD.
+func newReplyMessage(request FEDWireMessage, businessDay time.Time, subTypeCode string) FEDWireMessage {
+	fwm := newReversalMessage(request, businessDay, request.TypeSubType.TypeCode, subTypeCode)
+	if request.ReceiverDepositoryInstitution != nil {
+		fwm.SenderDepositoryInstitution = NewSenderDepositoryInstitution()
+		fwm.SenderDepositoryInstitution.SenderABANumber = request.ReceiverDepositoryInstitution.ReceiverABANumber
+		fwm.SenderDepositoryInstitution.SenderShortName = request.ReceiverDepositoryInstitution.ReceiverShortName
+	}
+	if request.SenderDepositoryInstitution != nil {
+		fwm.ReceiverDepositoryInstitution = NewReceiverDepositoryInstitution()
+		fwm.ReceiverDepositoryInstitution.ReceiverABANumber = request.SenderDepositoryInstitution.SenderABANumber
+		fwm.ReceiverDepositoryInstitution.ReceiverShortName = request.SenderDepositoryInstitution.SenderShortName
+	}
+	return fwm
+}
+
+// replyBusinessDay returns the InputCycleDate of the reply
+func (fwm FEDWireMessage) replyBusinessDay() (time.Time, error) {
+	if fwm.InputMessageAccountabilityData == nil {
+		return time.Time{}, fieldError("InputMessageAccountabilityData", ErrFieldRequired)
+	}
+	day, err := time.Parse("20060102", fwm.InputMessageAccountabilityData.InputCycleDate)
+	if err != nil {
+		return day, fieldError("InputCycleDate", ErrValidDate, fwm.InputMessageAccountabilityData.InputCycleDate)
+	}
+	return day, nil
+}
+
+// checkReplyTo checks the PreviousMessageIdentifier is the request IMAD, the Amount is the same and the reply is
+// sent by the receiver of request back to its sender
+func (fwm FEDWireMessage) checkReplyTo(request FEDWireMessage) error {
+	if fwm.PreviousMessageIdentifier == nil {
+		return fieldError("PreviousMessageIdentifier", ErrFieldRequired)
+	}
+	pmi := strings.TrimSpace(fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+	if pmi != strings.TrimSpace(request.InputMessageAccountabilityData.Identifier()) {
+		return fieldError("PreviousMessageIdentifier", ErrRequestCreditMismatch, pmi)
+	}
+	if fwm.Amount == nil {
+		return fieldError("Amount", ErrFieldRequired)
+	}
+	if request.Amount == nil || strings.TrimLeft(fwm.Amount.Amount, "0") != strings.TrimLeft(request.Amount.Amount, "0") {
+		return fieldError("Amount", ErrRequestCreditMismatch, fwm.Amount.Amount)
+	}
+	if sender := fwm.senderABANumber(); sender != request.receiverABANumber() {
+		return fieldError("SenderABANumber", ErrRequestCreditMismatch, sender)
+	}
+	if receiver := fwm.receiverABANumber(); receiver != request.senderABANumber() {
+		return fieldError("ReceiverABANumber", ErrRequestCreditMismatch, receiver)
+	}
+	return nil
+}
+
+// carryReferences copies the BeneficiaryReference of request, and its OriginatorToBeneficiary when the
+// message has the Originator it requires
+func (fwm *FEDWireMessage) carryReferences(request FEDWireMessage) {
+	if request.BeneficiaryReference != nil {
+		br := *request.BeneficiaryReference
+		fwm.BeneficiaryReference = &br
+	}
+	if request.OriginatorToBeneficiary != nil && fwm.Originator != nil && fwm.Beneficiary != nil {
+		ob := *request.OriginatorToBeneficiary
+		fwm.OriginatorToBeneficiary = &ob
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockRequestCreditData returns a CustomerCorporateDrawdownRequest
+func mockRequestCreditData() FEDWireMessage {
+	fwm := mockCustomerTransferData()
+	fwm.TypeSubType.SubTypeCode = RequestCredit
+	fwm.BusinessFunctionCode.BusinessFunctionCode = CustomerCorporateDrawdownRequest
+	fwm.BusinessFunctionCode.TransactionTypeCode = ""
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.BeneficiaryFI = mockBeneficiaryFI()
+	fwm.BeneficiaryReference = mockBeneficiaryReference()
+	fwm.AccountDebitedDrawdown = mockAccountDebitedDrawdown()
+	fwm.AccountCreditedDrawdown = mockAccountCreditedDrawdown()
+	return fwm
+}
+
+// requestCycleDate returns the InputCycleDate of fwm as a time
+func requestCycleDate(t *testing.T, fwm FEDWireMessage) time.Time {
+	t.Helper()
+	day, err := time.Parse("20060102", fwm.InputMessageAccountabilityData.InputCycleDate)
+	require.NoError(t, err)
+	return day
+}
+
+// requireValidReply assigns the IMAD of a built reply and validates it in a File
+func requireValidReply(t *testing.T, fwm FEDWireMessage) {
+	t.Helper()
+	fwm.InputMessageAccountabilityData.InputSource = "Source08"
+	fwm.InputMessageAccountabilityData.InputSequenceNumber = "000002"
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Create())
+	require.NoError(t, file.Validate())
+}
+
+func TestMockRequestCreditData(t *testing.T) {
+	file := NewFile()
+	file.AddFEDWireMessage(mockRequestCreditData())
+	require.NoError(t, file.Create())
+	require.NoError(t, file.Validate())
+}
+
+func TestNewFundsTransferRequestCredit(t *testing.T) {
+	request := mockRequestCreditData()
+	request.Originator = mockOriginator()
+	request.OriginatorToBeneficiary = mockOriginatorToBeneficiary()
+	day := requestCycleDate(t, request).AddDate(0, 0, 1)
+
+	fwm, err := NewFundsTransferRequestCredit(request, day)
+	require.NoError(t, err)
+	require.Equal(t, FundsTransfer, fwm.TypeSubType.TypeCode)
+	require.Equal(t, FundsTransferRequestCredit, fwm.TypeSubType.SubTypeCode)
+	require.Equal(t, DrawdownResponse, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, request.InputMessageAccountabilityData.Identifier(), fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+	require.Equal(t, request.Amount.Amount, fwm.Amount.Amount)
+
+	// the receiver of the request pays its sender, debiting the drawdown account
+	require.Equal(t, request.ReceiverDepositoryInstitution.ReceiverABANumber, fwm.SenderDepositoryInstitution.SenderABANumber)
+	require.Equal(t, request.SenderDepositoryInstitution.SenderABANumber, fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+	require.Equal(t, request.AccountDebitedDrawdown.Identifier, fwm.Originator.Personal.Identifier)
+	require.Equal(t, request.AccountDebitedDrawdown.Name, fwm.Originator.Personal.Name)
+	require.Equal(t, request.Beneficiary.Personal, fwm.Beneficiary.Personal)
+	require.Equal(t, request.BeneficiaryFI.FinancialInstitution, fwm.BeneficiaryFI.FinancialInstitution)
+	require.Equal(t, "Reference", fwm.BeneficiaryReference.BeneficiaryReference)
+	require.Equal(t, "LineOne", fwm.OriginatorToBeneficiary.LineOne)
+	require.Nil(t, fwm.AccountDebitedDrawdown)
+
+	requireValidReply(t, fwm)
+	require.NoError(t, fwm.ValidateRequestCreditReply(request))
+}
+
+func TestNewFundsTransferRequestCredit_BankDrawdown(t *testing.T) {
+	request := mockRequestCreditData()
+	request.TypeSubType.TypeCode = SettlementTransfer
+	request.BusinessFunctionCode.BusinessFunctionCode = BankDrawDownRequest
+	request.Beneficiary = nil
+	request.BeneficiaryFI = nil
+
+	fwm, err := NewFundsTransferRequestCredit(request, requestCycleDate(t, request))
+	require.NoError(t, err)
+	require.Equal(t, SettlementTransfer, fwm.TypeSubType.TypeCode)
+	require.Equal(t, FEDRoutingNumber, fwm.Beneficiary.Personal.IdentificationCode)
+	require.Equal(t, "123456789", fwm.Beneficiary.Personal.Identifier)
+	require.Equal(t, request.SenderDepositoryInstitution.SenderShortName, fwm.Beneficiary.Personal.Name)
+
+	requireValidReply(t, fwm)
+	require.NoError(t, fwm.ValidateRequestCreditReply(request))
+}
+
+func TestNewRefusalRequestCredit(t *testing.T) {
+	request := mockRequestCreditData()
+
+	fwm, err := NewRefusalRequestCredit(request, requestCycleDate(t, request))
+	require.NoError(t, err)
+	require.Equal(t, RefusalRequestCredit, fwm.TypeSubType.SubTypeCode)
+	require.Equal(t, CustomerCorporateDrawdownRequest, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, request.Amount.Amount, fwm.Amount.Amount)
+	require.Equal(t, request.ReceiverDepositoryInstitution.ReceiverABANumber, fwm.SenderDepositoryInstitution.SenderABANumber)
+	require.Equal(t, request.AccountDebitedDrawdown.Identifier, fwm.AccountDebitedDrawdown.Identifier)
+	require.Equal(t, request.AccountCreditedDrawdown.DrawdownCreditAccountNumber, fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber)
+	require.Equal(t, "Reference", fwm.BeneficiaryReference.BeneficiaryReference)
+
+	requireValidReply(t, fwm)
+	require.NoError(t, fwm.ValidateRequestCreditReply(request))
+}
+
+func TestRequestCredit_Errors(t *testing.T) {
+	request := mockRequestCreditData()
+	_, err := NewFundsTransferRequestCredit(request, requestCycleDate(t, request).AddDate(0, 0, -1))
+	require.True(t, errors.Is(err, ErrRequestCreditCycleDate))
+
+	_, err = NewRefusalRequestCredit(mockCustomerTransferData(), requestCycleDate(t, request))
+	require.True(t, errors.Is(err, ErrNotRequestCredit))
+
+	request.BusinessFunctionCode.BusinessFunctionCode = BFCServiceMessage
+	_, err = NewFundsTransferRequestCredit(request, requestCycleDate(t, request))
+	require.True(t, errors.Is(err, ErrNotRequestCredit))
+}
+
+func TestFEDWireMessage_ValidateRequestCreditReply(t *testing.T) {
+	request := mockRequestCreditData()
+	day := requestCycleDate(t, request)
+
+	funds := func() FEDWireMessage {
+		fwm, err := NewFundsTransferRequestCredit(request, day)
+		require.NoError(t, err)
+		return fwm
+	}
+
+	err := request.ValidateRequestCreditReply(request)
+	require.True(t, errors.Is(err, ErrNotRequestCreditReply))
+
+	fwm := funds()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = CustomerTransfer
+	require.EqualError(t, fwm.ValidateRequestCreditReply(request),
+		fieldError("BusinessFunctionCode", ErrRequestCreditMismatch, CustomerTransfer).Error())
+
+	fwm = funds()
+	fwm.TypeSubType.TypeCode = SettlementTransfer
+	require.EqualError(t, fwm.ValidateRequestCreditReply(request),
+		fieldError("TypeCode", ErrRequestCreditMismatch, SettlementTransfer).Error())
+
+	fwm = funds()
+	fwm.Amount = mockAmount()
+	fwm.Amount.Amount = "000000000001"
+	require.True(t, errors.Is(fwm.ValidateRequestCreditReply(request), ErrRequestCreditMismatch))
+
+	fwm = funds()
+	fwm.PreviousMessageIdentifier.PreviousMessageIdentifier = "20190410Source08999999"
+	require.True(t, errors.Is(fwm.ValidateRequestCreditReply(request), ErrRequestCreditMismatch))
+
+	fwm = funds()
+	fwm.ReceiverDepositoryInstitution = mockReceiverDepositoryInstitution()
+	require.EqualError(t, fwm.ValidateRequestCreditReply(request),
+		fieldError("ReceiverABANumber", ErrRequestCreditMismatch, request.ReceiverDepositoryInstitution.ReceiverABANumber).Error())
+
+	refusal, err := NewRefusalRequestCredit(request, day)
+	require.NoError(t, err)
+	refusal.BusinessFunctionCode.BusinessFunctionCode = BankDrawDownRequest
+	require.True(t, errors.Is(refusal.ValidateRequestCreditReply(request), ErrRequestCreditMismatch))
+}
@@ -0,0 +1,369 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotReversible is returned when a reversal is built from, or matched against, a message which isn't
+	// a basic value funds transfer that can be reversed
+	ErrNotReversible = errors.New("is not a reversible funds transfer")
+	// ErrNotReversal is returned when a message isn't a reversal or request for reversal
+	ErrNotReversal = errors.New("is not a reversal or request for reversal")
+	// ErrReversalCycleDate is returned when a reversal is dated before the original message
+	ErrReversalCycleDate = errors.New("is before the cycle date of the original message")
+	// ErrReversalMismatch is returned when a reversal or request for reversal does not match the original message
+	ErrReversalMismatch = errors.New("does not match the original message")
+)
+
+// reversibleBusinessFunctionCodes are the business function codes which permit ReversalTransfer and ReversalPriorDayTransfer
+var reversibleBusinessFunctionCodes = map[string]bool{
+	BankTransfer:           true,
+	CustomerTransfer:       true,
+	CustomerTransferPlus:   true,
+	CheckSameDaySettlement: true,
+	DepositSendersAccount:  true,
+	FEDFundsReturned:       true,
+	FEDFundsSold:           true,
+}
+
+// NewRequestForReversal returns a non-value request for reversal of original, a funds transfer we sent, to be
+// sent on businessDay. It's a RequestReversal when businessDay is the InputCycleDate of the original and a
+// RequestReversalPriorDayTransfer when it's later.
+//
+// The request is sent by the original sender to the original receiver for the same Amount, with its
+// PreviousMessageIdentifier set to the original IMAD. A CustomerTransferPlus is reversed with a CustomerTransferPlus
+// request and any other business function code with a BFCServiceMessage. The parties of the original are kept,
+// except those a service message does not permit along with their financial institution.
+func NewRequestForReversal(original FEDWireMessage, businessDay time.Time) (FEDWireMessage, error) {
+	subTypeCode, err := reversalSubTypeCode(original, businessDay, RequestReversal, RequestReversalPriorDayTransfer)
+	if err != nil {
+		return FEDWireMessage{}, err
+	}
+	fwm := newReversalMessage(original, businessDay, FundsTransfer, subTypeCode)
+
+	fwm.BusinessFunctionCode = NewBusinessFunctionCode()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = BFCServiceMessage
+	if original.BusinessFunctionCode.BusinessFunctionCode == CustomerTransferPlus {
+		fwm.BusinessFunctionCode.BusinessFunctionCode = CustomerTransferPlus
+	}
+
+	if original.SenderDepositoryInstitution != nil {
+		sdi := *original.SenderDepositoryInstitution
+		fwm.SenderDepositoryInstitution = &sdi
+	}
+	if original.ReceiverDepositoryInstitution != nil {
+		rdi := *original.ReceiverDepositoryInstitution
+		fwm.ReceiverDepositoryInstitution = &rdi
+	}
+
+	// a service message does not permit SWIFTBICORBEIANDAccountNumber parties or OriginatorOptionF
+	svc := fwm.BusinessFunctionCode.BusinessFunctionCode == BFCServiceMessage
+	if original.Originator != nil && !(svc && original.Originator.Personal.IdentificationCode == SWIFTBICORBEIANDAccountNumber) {
+		o := *original.Originator
+		fwm.Originator = &o
+	}
+	if original.OriginatorOptionF != nil && !svc {
+		oof := *original.OriginatorOptionF
+		fwm.OriginatorOptionF = &oof
+	}
+	if original.Beneficiary != nil && !(svc && original.Beneficiary.Personal.IdentificationCode == SWIFTBICORBEIANDAccountNumber) {
+		ben := *original.Beneficiary
+		fwm.Beneficiary = &ben
+	}
+	// financial institutions require their party
+	if original.OriginatorFI != nil && (fwm.Originator != nil || fwm.OriginatorOptionF != nil) {
+		ofi := *original.OriginatorFI
+		fwm.OriginatorFI = &ofi
+	}
+	if original.BeneficiaryFI != nil && fwm.Beneficiary != nil {
+		bfi := *original.BeneficiaryFI
+		fwm.BeneficiaryFI = &bfi
+	}
+	return fwm, nil
+}
+
+// NewReversal returns a value reversal of original, a funds transfer we received, to be sent on businessDay.
+// It's a ReversalTransfer when businessDay is the InputCycleDate of the original and a ReversalPriorDayTransfer
+// when it's later. To answer a request for reversal build the reversal from the funds transfer it identifies.
+//
+// The reversal is sent by the original receiver back to the original sender for the same Amount and business
+// function code, with its PreviousMessageIdentifier set to the original IMAD. The Originator and Beneficiary, and
+// OriginatorFI and BeneficiaryFI, are swapped. An OriginatorOptionF becomes the Beneficiary, and the Beneficiary
+// becomes an OriginatorOptionF when a CustomerTransferPlus requires one.
+func NewReversal(original FEDWireMessage, businessDay time.Time) (FEDWireMessage, error) {
+	subTypeCode, err := reversalSubTypeCode(original, businessDay, ReversalTransfer, ReversalPriorDayTransfer)
+	if err != nil {
+		return FEDWireMessage{}, err
+	}
+	typeCode := FundsTransfer
+	if original.TypeSubType.TypeCode == SettlementTransfer {
+		typeCode = SettlementTransfer
+	}
+	fwm := newReversalMessage(original, businessDay, typeCode, subTypeCode)
+
+	fwm.BusinessFunctionCode = NewBusinessFunctionCode()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = original.BusinessFunctionCode.BusinessFunctionCode
+
+	if original.ReceiverDepositoryInstitution != nil {
+		fwm.SenderDepositoryInstitution = NewSenderDepositoryInstitution()
+		fwm.SenderDepositoryInstitution.SenderABANumber = original.ReceiverDepositoryInstitution.ReceiverABANumber
+		fwm.SenderDepositoryInstitution.SenderShortName = original.ReceiverDepositoryInstitution.ReceiverShortName
+	}
+	if original.SenderDepositoryInstitution != nil {
+		fwm.ReceiverDepositoryInstitution = NewReceiverDepositoryInstitution()
+		fwm.ReceiverDepositoryInstitution.ReceiverABANumber = original.SenderDepositoryInstitution.SenderABANumber
+		fwm.ReceiverDepositoryInstitution.ReceiverShortName = original.SenderDepositoryInstitution.SenderShortName
+	}
+
+	// a CustomerTransferPlus with an OriginatorFI requires an OriginatorOptionF
+	switch {
+	case original.Beneficiary == nil:
+	case fwm.BusinessFunctionCode.BusinessFunctionCode == CustomerTransferPlus && original.BeneficiaryFI != nil:
+		fwm.OriginatorOptionF = personalOptionF(original.Beneficiary.Personal)
+	default:
+		fwm.Originator = NewOriginator()
+		fwm.Originator.Personal = original.Beneficiary.Personal
+	}
+	switch {
+	case original.Originator != nil:
+		fwm.Beneficiary = NewBeneficiary()
+		fwm.Beneficiary.Personal = original.Originator.Personal
+	case original.OriginatorOptionF != nil:
+		fwm.Beneficiary = NewBeneficiary()
+		fwm.Beneficiary.Personal = optionFPersonal(original.OriginatorOptionF)
+	}
+	if original.BeneficiaryFI != nil {
+		fwm.OriginatorFI = NewOriginatorFI()
+		fwm.OriginatorFI.FinancialInstitution = original.BeneficiaryFI.FinancialInstitution
+	}
+	if original.OriginatorFI != nil {
+		fwm.BeneficiaryFI = NewBeneficiaryFI()
+		fwm.BeneficiaryFI.FinancialInstitution = original.OriginatorFI.FinancialInstitution
+	}
+	return fwm, nil
+}
+
+// ValidateReversalOf checks the message is a reversal or request for reversal of original. The
+// PreviousMessageIdentifier must be the original IMAD, the SubTypeCode must agree with the InputCycleDate
+// (same day or prior day), the Amount must be the same and the depository institutions must be the
+// same for a request for reversal and swapped for a reversal.
+func (fwm FEDWireMessage) ValidateReversalOf(original FEDWireMessage) error {
+	if fwm.TypeSubType == nil {
+		return fieldError("TypeSubType", ErrFieldRequired)
+	}
+	var sameDay, priorDay string
+	switch fwm.TypeSubType.SubTypeCode {
+	case RequestReversal, RequestReversalPriorDayTransfer:
+		sameDay, priorDay = RequestReversal, RequestReversalPriorDayTransfer
+	case ReversalTransfer, ReversalPriorDayTransfer:
+		sameDay, priorDay = ReversalTransfer, ReversalPriorDayTransfer
+	default:
+		return fieldError("SubTypeCode", ErrNotReversal, fwm.TypeSubType.SubTypeCode)
+	}
+	if fwm.InputMessageAccountabilityData == nil {
+		return fieldError("InputMessageAccountabilityData", ErrFieldRequired)
+	}
+	businessDay, err := time.Parse("20060102", fwm.InputMessageAccountabilityData.InputCycleDate)
+	if err != nil {
+		return fieldError("InputCycleDate", ErrValidDate, fwm.InputMessageAccountabilityData.InputCycleDate)
+	}
+	subTypeCode, err := reversalSubTypeCode(original, businessDay, sameDay, priorDay)
+	if err != nil {
+		return err
+	}
+	if fwm.TypeSubType.SubTypeCode != subTypeCode {
+		return fieldError("SubTypeCode", ErrReversalMismatch, fwm.TypeSubType.SubTypeCode)
+	}
+
+	if fwm.PreviousMessageIdentifier == nil {
+		return fieldError("PreviousMessageIdentifier", ErrFieldRequired)
+	}
+	pmi := strings.TrimSpace(fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+	if pmi != strings.TrimSpace(original.InputMessageAccountabilityData.Identifier()) {
+		return fieldError("PreviousMessageIdentifier", ErrReversalMismatch, pmi)
+	}
+
+	if fwm.Amount == nil {
+		return fieldError("Amount", ErrFieldRequired)
+	}
+	if original.Amount == nil || strings.TrimLeft(fwm.Amount.Amount, "0") != strings.TrimLeft(original.Amount.Amount, "0") {
+		return fieldError("Amount", ErrReversalMismatch, fwm.Amount.Amount)
+	}
+
+	if fwm.BusinessFunctionCode == nil {
+		return fieldError("BusinessFunctionCode", ErrFieldRequired)
+	}
+	bfc := fwm.BusinessFunctionCode.BusinessFunctionCode
+	sender, receiver := fwm.senderABANumber(), fwm.receiverABANumber()
+	if sameDay == RequestReversal {
+		if bfc != BFCServiceMessage && bfc != CustomerTransferPlus {
+			return fieldError("BusinessFunctionCode", ErrReversalMismatch, bfc)
+		}
+		if sender != original.senderABANumber() {
+			return fieldError("SenderABANumber", ErrReversalMismatch, sender)
+		}
+		if receiver != original.receiverABANumber() {
+			return fieldError("ReceiverABANumber", ErrReversalMismatch, receiver)
+		}
+		return nil
+	}
+	if bfc != original.BusinessFunctionCode.BusinessFunctionCode {
+		return fieldError("BusinessFunctionCode", ErrReversalMismatch, bfc)
+	}
+	if sender != original.receiverABANumber() {
+		return fieldError("SenderABANumber", ErrReversalMismatch, sender)
+	}
+	if receiver != original.senderABANumber() {
+		return fieldError("ReceiverABANumber", ErrReversalMismatch, receiver)
+	}
+	return nil
+}
+
+// reversalSubTypeCode checks original can be reversed and returns sameDay when businessDay is the InputCycleDate
+// of original, or priorDay when businessDay is later
+func reversalSubTypeCode(original FEDWireMessage, businessDay time.Time, sameDay, priorDay string) (string, error) {
+	if original.TypeSubType == nil {
+		return "", fieldError("TypeSubType", ErrFieldRequired)
+	}
+	if original.TypeSubType.SubTypeCode != BasicFundsTransfer {
+		return "", fieldError("SubTypeCode", ErrNotReversible, original.TypeSubType.SubTypeCode)
+	}
+	if original.BusinessFunctionCode == nil {
+		return "", fieldError("BusinessFunctionCode", ErrFieldRequired)
+	}
+	if !reversibleBusinessFunctionCodes[original.BusinessFunctionCode.BusinessFunctionCode] {
+		return "", fieldError("BusinessFunctionCode", ErrNotReversible, original.BusinessFunctionCode.BusinessFunctionCode)
+	}
+	if original.InputMessageAccountabilityData == nil {
+		return "", fieldError("InputMessageAccountabilityData", ErrFieldRequired)
+	}
+	cycleDate := original.InputMessageAccountabilityData.InputCycleDate
+	if _, err := time.Parse("20060102", cycleDate); err != nil {
+		return "", fieldError("InputCycleDate", ErrValidDate, cycleDate)
+	}
+
+	// CCYYMMDD sorts chronologically
+	switch day := businessDay.Format("20060102"); {
+	case day < cycleDate:
+		return "", fieldError("InputCycleDate", ErrReversalCycleDate, day)
+	case day == cycleDate:
+		return sameDay, nil
+	default:
+		return priorDay, nil
+	}
+}
+
+// newReversalMessage returns the tags shared by reversals and requests for reversal of original. The InputCycleDate
+// of the returned IMAD is businessDay, callers must assign its InputSource and InputSequenceNumber.
+func newReversalMessage(original FEDWireMessage, businessDay time.Time, typeCode, subTypeCode string) FEDWireMessage {
+	var fwm FEDWireMessage
+
+	fwm.SenderSupplied = NewSenderSupplied()
+	if original.SenderSupplied != nil {
+		ss := *original.SenderSupplied
+		ss.MessageDuplicationCode = MessageDuplicationOriginal
+		fwm.SenderSupplied = &ss
+	}
+	fwm.TypeSubType = NewTypeSubType()
+	fwm.TypeSubType.TypeCode = typeCode
+	fwm.TypeSubType.SubTypeCode = subTypeCode
+
+	fwm.InputMessageAccountabilityData = NewInputMessageAccountabilityData()
+	fwm.InputMessageAccountabilityData.InputCycleDate = businessDay.Format("20060102")
+
+	if original.Amount != nil {
+		amt := *original.Amount
+		fwm.Amount = &amt
+	}
+	fwm.PreviousMessageIdentifier = NewPreviousMessageIdentifier()
+	fwm.PreviousMessageIdentifier.PreviousMessageIdentifier = original.InputMessageAccountabilityData.Identifier()
+	return fwm
+}
+
+func (fwm FEDWireMessage) senderABANumber() string {
+	if fwm.SenderDepositoryInstitution == nil {
+		return ""
+	}
+	return strings.TrimSpace(fwm.SenderDepositoryInstitution.SenderABANumber)
+}
+
+func (fwm FEDWireMessage) receiverABANumber() string {
+	if fwm.ReceiverDepositoryInstitution == nil {
+		return ""
+	}
+	return strings.TrimSpace(fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+}
+
+// optionFIdentificationCodes maps OriginatorOptionF party identifier codes to Personal identification codes
+var optionFIdentificationCodes = map[string]string{
+	PartyIdentifierAlienRegistrationNumber:      AlienRegistrationNumber,
+	PartyIdentifierPassportNumber:               PassportNumber,
+	PartyIdentifierDriversLicenseNumber:         DriversLicenseNumber,
+	PartyIdentifierTaxIdentificationNumber:      TaxIdentificationNumber,
+	PartyIdentifierCustomerIdentificationNumber: OtherIdentification,
+}
+
+// optionFPersonal converts an OriginatorOptionF into a Personal. Accounts (/123456) become a
+// DemandDepositAccountNumber and other party identifiers (CODE/identifier) their Personal identification
+// code or OtherIdentification. The name and the address (2/) and country and town (3/) lines are kept.
+func optionFPersonal(oof *OriginatorOptionF) Personal {
+	var personal Personal
+	if i := strings.Index(oof.PartyIdentifier, "/"); i == 0 {
+		personal.IdentificationCode = DemandDepositAccountNumber
+		personal.Identifier = oof.PartyIdentifier[1:]
+	} else if i > 0 {
+		personal.IdentificationCode = OtherIdentification
+		if code, ok := optionFIdentificationCodes[oof.PartyIdentifier[:i]]; ok {
+			personal.IdentificationCode = code
+		}
+		personal.Identifier = oof.PartyIdentifier[i+1:]
+	}
+	personal.Name = strings.TrimPrefix(oof.Name, OptionFName+"/")
+
+	var lines []string
+	for _, line := range []string{oof.LineOne, oof.LineTwo, oof.LineThree} {
+		if strings.HasPrefix(line, OptionFAddress+"/") || strings.HasPrefix(line, OptionFCountryTown+"/") {
+			lines = append(lines, line[2:])
+		}
+	}
+	for i, field := range []*string{&personal.Address.AddressLineOne, &personal.Address.AddressLineTwo, &personal.Address.AddressLineThree} {
+		if i < len(lines) {
+			*field = lines[i]
+		}
+	}
+	return personal
+}
+
+// personalOptionF converts a Personal into an OriginatorOptionF, the reverse of optionFPersonal. Identification
+// codes without an OriginatorOptionF party identifier code, such as DemandDepositAccountNumber, become an
+// account (/123456) and address lines become address (2/) lines.
+func personalOptionF(personal Personal) *OriginatorOptionF {
+	oof := NewOriginatorOptionF()
+	oof.PartyIdentifier = "/" + personal.Identifier
+	for code, identificationCode := range optionFIdentificationCodes {
+		if identificationCode == personal.IdentificationCode {
+			oof.PartyIdentifier = code + "/" + personal.Identifier
+		}
+	}
+	oof.Name = OptionFName + "/" + personal.Name
+
+	var lines []string
+	for _, line := range []string{personal.Address.AddressLineOne, personal.Address.AddressLineTwo, personal.Address.AddressLineThree} {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, OptionFAddress+"/"+line)
+		}
+	}
+	for i, field := range []*string{&oof.LineOne, &oof.LineTwo, &oof.LineThree} {
+		if i < len(lines) {
+			*field = lines[i]
+		}
+	}
+	return oof
+}
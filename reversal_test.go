@@ -0,0 +1,273 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockReversalOriginal returns a CustomerTransfer with parties and financial institutions on both sides
+func mockReversalOriginal() FEDWireMessage {
+	fwm := mockCustomerTransferData()
+	fwm.Beneficiary = mockBeneficiary()
+	fwm.Originator = mockOriginator()
+	fwm.OriginatorFI = mockOriginatorFI()
+	fwm.BeneficiaryFI = mockBeneficiaryFI()
+	return fwm
+}
+
+// reversalCycleDate returns the InputCycleDate of fwm as a time
+func reversalCycleDate(t *testing.T, fwm FEDWireMessage) time.Time {
+	t.Helper()
+	day, err := time.Parse("20060102", fwm.InputMessageAccountabilityData.InputCycleDate)
+	require.NoError(t, err)
+	return day
+}
+
+// requireValidReversal assigns the IMAD of a built reversal and validates it in a File
+func requireValidReversal(t *testing.T, fwm FEDWireMessage) {
+	t.Helper()
+	fwm.InputMessageAccountabilityData.InputSource = "Source08"
+	fwm.InputMessageAccountabilityData.InputSequenceNumber = "000002"
+	file := NewFile()
+	file.AddFEDWireMessage(fwm)
+	require.NoError(t, file.Create())
+	require.NoError(t, file.Validate())
+}
+
+func TestNewReversal(t *testing.T) {
+	original := mockReversalOriginal()
+	day := reversalCycleDate(t, original)
+
+	fwm, err := NewReversal(original, day)
+	require.NoError(t, err)
+	require.Equal(t, FundsTransfer, fwm.TypeSubType.TypeCode)
+	require.Equal(t, ReversalTransfer, fwm.TypeSubType.SubTypeCode)
+	require.Equal(t, CustomerTransfer, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, original.InputMessageAccountabilityData.Identifier(), fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+	require.Equal(t, original.Amount.Amount, fwm.Amount.Amount)
+
+	// the original receiver sends the reversal back to the original sender
+	require.Equal(t, original.ReceiverDepositoryInstitution.ReceiverABANumber, fwm.SenderDepositoryInstitution.SenderABANumber)
+	require.Equal(t, original.SenderDepositoryInstitution.SenderABANumber, fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+	require.Equal(t, original.Beneficiary.Personal, fwm.Originator.Personal)
+	require.Equal(t, original.Originator.Personal, fwm.Beneficiary.Personal)
+	require.Equal(t, original.BeneficiaryFI.FinancialInstitution, fwm.OriginatorFI.FinancialInstitution)
+	require.Equal(t, original.OriginatorFI.FinancialInstitution, fwm.BeneficiaryFI.FinancialInstitution)
+
+	requireValidReversal(t, fwm)
+	require.NoError(t, fwm.ValidateReversalOf(original))
+}
+
+func TestNewReversal_PriorDay(t *testing.T) {
+	original := mockReversalOriginal()
+	day := reversalCycleDate(t, original).AddDate(0, 0, 3)
+
+	fwm, err := NewReversal(original, day)
+	require.NoError(t, err)
+	require.Equal(t, ReversalPriorDayTransfer, fwm.TypeSubType.SubTypeCode)
+	require.Equal(t, day.Format("20060102"), fwm.InputMessageAccountabilityData.InputCycleDate)
+
+	requireValidReversal(t, fwm)
+	require.NoError(t, fwm.ValidateReversalOf(original))
+}
+
+func TestNewReversal_OriginatorOptionF(t *testing.T) {
+	original := mockReversalOriginal()
+	original.BusinessFunctionCode.BusinessFunctionCode = CustomerTransferPlus
+	original.BusinessFunctionCode.TransactionTypeCode = ""
+	original.Originator = nil
+	original.OriginatorOptionF = mockOriginatorOptionF()
+
+	fwm, err := NewReversal(original, reversalCycleDate(t, original))
+	require.NoError(t, err)
+	require.Equal(t, CustomerTransferPlus, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, TaxIdentificationNumber, fwm.Beneficiary.Personal.IdentificationCode)
+	require.Equal(t, "123-45-6789", fwm.Beneficiary.Personal.Identifier)
+	require.Equal(t, "Name", fwm.Beneficiary.Personal.Name)
+	require.Equal(t, "1000 Colonial Farm Rd", fwm.Beneficiary.Personal.Address.AddressLineOne)
+	require.Empty(t, fwm.Beneficiary.Personal.Address.AddressLineTwo)
+
+	// with an OriginatorFI the original beneficiary becomes an OriginatorOptionF
+	require.Nil(t, fwm.Originator)
+	require.Equal(t, "DRLC/1234", fwm.OriginatorOptionF.PartyIdentifier)
+	require.Equal(t, "1/Name", fwm.OriginatorOptionF.Name)
+	require.Equal(t, "2/Address One", fwm.OriginatorOptionF.LineOne)
+	require.Equal(t, "2/Address Three", fwm.OriginatorOptionF.LineThree)
+
+	requireValidReversal(t, fwm)
+}
+
+func TestNewReversal_SettlementTransfer(t *testing.T) {
+	original := mockCustomerTransferData()
+	original.TypeSubType.TypeCode = SettlementTransfer
+	original.BusinessFunctionCode.BusinessFunctionCode = FEDFundsSold
+	original.BusinessFunctionCode.TransactionTypeCode = ""
+
+	fwm, err := NewReversal(original, reversalCycleDate(t, original))
+	require.NoError(t, err)
+	require.Equal(t, SettlementTransfer, fwm.TypeSubType.TypeCode)
+	require.Equal(t, FEDFundsSold, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Nil(t, fwm.Originator)
+	require.Nil(t, fwm.Beneficiary)
+
+	requireValidReversal(t, fwm)
+}
+
+func TestNewReversal_Errors(t *testing.T) {
+	original := mockReversalOriginal()
+	_, err := NewReversal(original, reversalCycleDate(t, original).AddDate(0, 0, -1))
+	require.True(t, errors.Is(err, ErrReversalCycleDate))
+
+	original.TypeSubType.SubTypeCode = ReversalTransfer
+	_, err = NewReversal(original, time.Now())
+	require.True(t, errors.Is(err, ErrNotReversible))
+
+	original = mockReversalOriginal()
+	original.BusinessFunctionCode.BusinessFunctionCode = BankDrawDownRequest
+	_, err = NewReversal(original, time.Now())
+	require.True(t, errors.Is(err, ErrNotReversible))
+
+	original = mockReversalOriginal()
+	original.InputMessageAccountabilityData.InputCycleDate = "2020"
+	_, err = NewReversal(original, time.Now())
+	require.True(t, errors.Is(err, ErrValidDate))
+}
+
+func TestNewRequestForReversal(t *testing.T) {
+	original := mockReversalOriginal()
+	original.Beneficiary.Personal.IdentificationCode = SWIFTBICORBEIANDAccountNumber
+	day := reversalCycleDate(t, original)
+
+	fwm, err := NewRequestForReversal(original, day)
+	require.NoError(t, err)
+	require.Equal(t, FundsTransfer, fwm.TypeSubType.TypeCode)
+	require.Equal(t, RequestReversal, fwm.TypeSubType.SubTypeCode)
+	require.Equal(t, BFCServiceMessage, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, original.InputMessageAccountabilityData.Identifier(), fwm.PreviousMessageIdentifier.PreviousMessageIdentifier)
+
+	// the original sender asks the original receiver to reverse the transfer
+	require.Equal(t, original.SenderDepositoryInstitution.SenderABANumber, fwm.SenderDepositoryInstitution.SenderABANumber)
+	require.Equal(t, original.ReceiverDepositoryInstitution.ReceiverABANumber, fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+	require.Equal(t, original.Originator.Personal, fwm.Originator.Personal)
+	require.Nil(t, fwm.Beneficiary) // not permitted in a service message
+
+	requireValidReversal(t, fwm)
+	require.NoError(t, fwm.ValidateReversalOf(original))
+
+	fwm, err = NewRequestForReversal(original, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, RequestReversalPriorDayTransfer, fwm.TypeSubType.SubTypeCode)
+	requireValidReversal(t, fwm)
+}
+
+func TestNewRequestForReversal_CustomerTransferPlus(t *testing.T) {
+	original := mockCustomerTransferPlusData()
+	original.BusinessFunctionCode.TransactionTypeCode = ""
+	original.Originator = nil
+	original.OriginatorOptionF = mockOriginatorOptionF()
+
+	fwm, err := NewRequestForReversal(original, reversalCycleDate(t, original))
+	require.NoError(t, err)
+	require.Equal(t, CustomerTransferPlus, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	require.Equal(t, original.OriginatorOptionF.PartyIdentifier, fwm.OriginatorOptionF.PartyIdentifier)
+	require.Equal(t, original.Beneficiary.Personal, fwm.Beneficiary.Personal)
+
+	requireValidReversal(t, fwm)
+	require.NoError(t, fwm.ValidateReversalOf(original))
+}
+
+func TestFEDWireMessage_ValidateReversalOf(t *testing.T) {
+	original := mockReversalOriginal()
+	day := reversalCycleDate(t, original)
+
+	reversal := func() FEDWireMessage {
+		fwm, err := NewReversal(original, day)
+		require.NoError(t, err)
+		return fwm
+	}
+
+	require.NoError(t, reversal().ValidateReversalOf(original))
+
+	err := original.ValidateReversalOf(original)
+	require.True(t, errors.Is(err, ErrNotReversal))
+
+	fwm := reversal()
+	fwm.TypeSubType.SubTypeCode = ReversalPriorDayTransfer
+	require.EqualError(t, fwm.ValidateReversalOf(original), fieldError("SubTypeCode", ErrReversalMismatch, ReversalPriorDayTransfer).Error())
+
+	fwm = reversal()
+	fwm.PreviousMessageIdentifier.PreviousMessageIdentifier = "20190410Source08000009"
+	require.True(t, errors.Is(fwm.ValidateReversalOf(original), ErrReversalMismatch))
+
+	fwm = reversal()
+	fwm.PreviousMessageIdentifier = nil
+	require.True(t, errors.Is(fwm.ValidateReversalOf(original), ErrFieldRequired))
+
+	fwm = reversal()
+	fwm.Amount = mockAmount()
+	fwm.Amount.Amount = "000000000001"
+	require.EqualError(t, fwm.ValidateReversalOf(original), fieldError("Amount", ErrReversalMismatch, "000000000001").Error())
+
+	fwm = reversal()
+	fwm.BusinessFunctionCode.BusinessFunctionCode = BankTransfer
+	require.True(t, errors.Is(fwm.ValidateReversalOf(original), ErrReversalMismatch))
+
+	// a reversal comes from the original receiver
+	fwm = reversal()
+	fwm.SenderDepositoryInstitution = mockSenderDepositoryInstitution()
+	require.EqualError(t, fwm.ValidateReversalOf(original),
+		fieldError("SenderABANumber", ErrReversalMismatch, original.SenderDepositoryInstitution.SenderABANumber).Error())
+
+	// a request for reversal comes from the original sender
+	req, err := NewRequestForReversal(original, day)
+	require.NoError(t, err)
+	req.ReceiverDepositoryInstitution = mockReceiverDepositoryInstitution()
+	req.ReceiverDepositoryInstitution.ReceiverABANumber = original.SenderDepositoryInstitution.SenderABANumber
+	require.True(t, errors.Is(req.ValidateReversalOf(original), ErrReversalMismatch))
+}
+
+func TestOptionFPersonal(t *testing.T) {
+	oof := NewOriginatorOptionF()
+	oof.PartyIdentifier = "/123456789"
+	oof.Name = "1/JOHN SMITH"
+	oof.LineOne = "2/123 MAIN STREET"
+	oof.LineTwo = "3/US/NEW YORK, NY 10000"
+	oof.LineThree = "7/111-22-3456"
+
+	personal := optionFPersonal(oof)
+	require.Equal(t, DemandDepositAccountNumber, personal.IdentificationCode)
+	require.Equal(t, "123456789", personal.Identifier)
+	require.Equal(t, "JOHN SMITH", personal.Name)
+	require.Equal(t, "123 MAIN STREET", personal.Address.AddressLineOne)
+	require.Equal(t, "US/NEW YORK, NY 10000", personal.Address.AddressLineTwo)
+	require.Empty(t, personal.Address.AddressLineThree)
+
+	oof.PartyIdentifier = "SOSE/123-456-789"
+	personal = optionFPersonal(oof)
+	require.Equal(t, OtherIdentification, personal.IdentificationCode)
+	require.Equal(t, "123-456-789", personal.Identifier)
+}
+
+func TestPersonalOptionF(t *testing.T) {
+	personal := mockBeneficiary().Personal
+	personal.IdentificationCode = DemandDepositAccountNumber
+	personal.Address.AddressLineTwo = ""
+
+	oof := personalOptionF(personal)
+	require.Equal(t, "/1234", oof.PartyIdentifier)
+	require.Equal(t, "1/Name", oof.Name)
+	require.Equal(t, "2/Address One", oof.LineOne)
+	require.Equal(t, "2/Address Three", oof.LineTwo)
+	require.Empty(t, oof.LineThree)
+	require.NoError(t, oof.Validate())
+
+	personal.IdentificationCode = OtherIdentification
+	require.Equal(t, "CUST/1234", personalOptionF(personal).PartyIdentifier)
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// ErrUnknownTag is returned for tags which aren't a field of FEDWireMessage
+var ErrUnknownTag = errors.New("unknown tag")
+
+// tagFields are the JSON field names of FEDWireMessage's tags
+var tagFields = map[string]string{
+	TagMessageDisposition:              "messageDisposition",
+	TagReceiptTimeStamp:                "receiptTimeStamp",
+	TagOutputMessageAccountabilityData: "outputMessageAccountabilityData",
+	TagErrorWire:                       "errorWire",
+	TagSenderSupplied:                  "senderSupplied",
+	TagTypeSubType:                     "typeSubType",
+	TagInputMessageAccountabilityData:  "inputMessageAccountabilityData",
+	TagAmount:                          "amount",
+	TagSenderDepositoryInstitution:     "senderDepositoryInstitution",
+	TagReceiverDepositoryInstitution:   "receiverDepositoryInstitution",
+	TagBusinessFunctionCode:            "businessFunctionCode",
+	TagSenderReference:                 "senderReference",
+	TagPreviousMessageIdentifier:       "previousMessageIdentifier",
+	TagLocalInstrument:                 "localInstrument",
+	TagPaymentNotification:             "paymentNotification",
+	TagCharges:                         "charges",
+	TagInstructedAmount:                "instructedAmount",
+	TagExchangeRate:                    "exchangeRate",
+	TagBeneficiaryIntermediaryFI:       "beneficiaryIntermediaryFI",
+	TagBeneficiaryFI:                   "beneficiaryFI",
+	TagBeneficiary:                     "beneficiary",
+	TagBeneficiaryReference:            "beneficiaryReference",
+	TagAccountDebitedDrawdown:          "accountDebitedDrawdown",
+	TagOriginator:                      "originator",
+	TagOriginatorOptionF:               "originatorOptionF",
+	TagOriginatorFI:                    "originatorFI",
+	TagInstructingFI:                   "instructingFI",
+	TagAccountCreditedDrawdown:         "accountCreditedDrawdown",
+	TagOriginatorToBeneficiary:         "originatorToBeneficiary",
+	TagFIReceiverFI:                    "fiReceiverFI",
+	TagFIDrawdownDebitAccountAdvice:    "fiDrawdownDebitAccountAdvice",
+	TagFIIntermediaryFI:                "fiIntermediaryFI",
+	TagFIIntermediaryFIAdvice:          "fiIntermediaryFIAdvice",
+	TagFIBeneficiaryFI:                 "fiBeneficiaryFI",
+	TagFIBeneficiaryFIAdvice:           "fiBeneficiaryFIAdvice",
+	TagFIBeneficiary:                   "fiBeneficiary",
+	TagFIBeneficiaryAdvice:             "fiBeneficiaryAdvice",
+	TagFIPaymentMethodToBeneficiary:    "fiPaymentMethodToBeneficiary",
+	TagFIAdditionalFIToFI:              "fiAdditionalFiToFi",
+	TagCurrencyInstructedAmount:        "currencyInstructedAmount",
+	TagOrderingCustomer:                "orderingCustomer",
+	TagOrderingInstitution:             "orderingInstitution",
+	TagIntermediaryInstitution:         "intermediaryInstitution",
+	TagInstitutionAccount:              "institutionAccount",
+	TagBeneficiaryCustomer:             "beneficiaryCustomer",
+	TagRemittance:                      "remittance",
+	TagSenderToReceiver:                "senderToReceiver",
+	TagUnstructuredAddenda:             "unstructuredAddenda",
+	TagRelatedRemittance:               "relatedRemittance",
+	TagRemittanceOriginator:            "remittanceOriginator",
+	TagRemittanceBeneficiary:           "remittanceBeneficiary",
+	TagPrimaryRemittanceDocument:       "primaryRemittanceDocument",
+	TagActualAmountPaid:                "actualAmountPaid",
+	TagGrossAmountRemittanceDocument:   "grossAmountRemittanceDocument",
+	TagAmountNegotiatedDiscount:        "amountNegotiatedDiscount",
+	TagAdjustment:                      "adjustment",
+	TagDateRemittanceDocument:          "dateRemittanceDocument",
+	TagSecondaryRemittanceDocument:     "secondaryRemittanceDocument",
+	TagRemittanceFreeText:              "remittanceFreeText",
+	TagServiceMessage:                  "serviceMessage",
+}
+
+// TagFieldName returns the JSON field name of a FEDWireMessage tag, e.g. "beneficiary" for {4200}. The tag can
+// be given with or without braces, or as its JSON field name.
+func TagFieldName(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if !strings.HasPrefix(tag, "{") {
+		if name, ok := tagFields["{"+tag+"}"]; ok {
+			return name, nil
+		}
+	}
+	if name, ok := tagFields[tag]; ok {
+		return name, nil
+	}
+	for _, name := range tagFields {
+		if strings.EqualFold(name, tag) {
+			return name, nil
+		}
+	}
+	return "", fieldError("Tag", ErrUnknownTag, tag)
+}
+
+// ValidateTag validates a tag of the FEDWireMessage on its own, as the Reader does when parsing it. Validate only
+// checks the tags relate to each other correctly. Tags which aren't set are valid.
+func (fwm *FEDWireMessage) ValidateTag(tag string) error {
+	name, err := TagFieldName(tag)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(fwm).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0] != name {
+			continue
+		}
+		field := v.Field(i)
+		if field.IsNil() {
+			return nil
+		}
+		if validator, ok := field.Interface().(interface{ Validate() error }); ok {
+			return validator.Validate()
+		}
+	}
+	return nil
+}
+
+// FieldTag returns the tag of a FEDWireMessage field, e.g. {4200} for "Beneficiary" or "beneficiary", or an empty
+// string when the field isn't a tag. FieldError's FieldName is the field of the tag failing validation.
+func FieldTag(field string) string {
+	for tag, name := range tagFields {
+		if strings.EqualFold(name, field) {
+			return tag
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagFieldName(t *testing.T) {
+	for _, tag := range []string{"{4200}", "4200", " 4200 ", "beneficiary", "Beneficiary"} {
+		name, err := TagFieldName(tag)
+		require.NoError(t, err, tag)
+		require.Equal(t, "beneficiary", name)
+	}
+	for _, tag := range []string{"", "{4201}", "42", "beneficiaries", "id"} {
+		_, err := TagFieldName(tag)
+		require.True(t, errors.Is(err, ErrUnknownTag), tag)
+	}
+}
+
+func TestFieldTag(t *testing.T) {
+	require.Equal(t, TagBeneficiary, FieldTag("Beneficiary"))
+	require.Equal(t, TagAmount, FieldTag("amount"))
+	require.Equal(t, "", FieldTag("Tag"))
+	require.Equal(t, "", FieldTag(""))
+}
+
+func TestTagFieldName_fields(t *testing.T) {
+	// every pointer field of FEDWireMessage is a tag
+	typ := reflect.TypeOf(FEDWireMessage{})
+	var fields int
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Type.Kind() != reflect.Ptr {
+			continue
+		}
+		fields++
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		found, err := TagFieldName(name)
+		require.NoError(t, err, field.Name)
+		require.Equal(t, name, found)
+	}
+	require.Equal(t, len(tagFields), fields)
+}
+
+func TestFEDWireMessage_ValidateTag(t *testing.T) {
+	fwm := mockCustomerTransferData()
+	fwm.Amount = mockAmount()
+	require.NoError(t, fwm.ValidateTag("2000"))
+
+	fwm.Amount.Amount = "X,"
+	require.Error(t, fwm.ValidateTag("amount"))
+	require.Contains(t, fwm.ValidateTag("{2000}").Error(), "Amount")
+
+	fwm.Beneficiary = nil
+	require.NoError(t, fwm.ValidateTag("beneficiary"))
+
+	require.True(t, errors.Is(fwm.ValidateTag("4201"), ErrUnknownTag))
+}
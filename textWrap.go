@@ -0,0 +1,238 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrTextOverflow is returned when text does not fit in the lines of a tag
+	ErrTextOverflow = errors.New("does not fit in the lines of the tag")
+	// ErrTextDelimiter is returned when text contains the * delimiter of variable length fields
+	ErrTextDelimiter = errors.New("contains the * variable length field delimiter")
+)
+
+// textLineWidths are the lengths of the free text lines of multi-line tags
+var textLineWidths = map[string][]int{
+	TagOriginatorToBeneficiary: {35, 35, 35, 35},
+	TagFIReceiverFI:            {30, 33, 33, 33, 33, 33},
+	TagFIIntermediaryFI:        {30, 33, 33, 33, 33, 33},
+	TagFIBeneficiaryFI:         {30, 33, 33, 33, 33, 33},
+	TagFIBeneficiary:           {30, 33, 33, 33, 33, 33},
+	TagFIAdditionalFIToFI:      {35, 35, 35, 35, 35, 35},
+	TagOrderingCustomer:        {35, 35, 35, 35, 35},
+	TagOrderingInstitution:     {35, 35, 35, 35, 35},
+	TagIntermediaryInstitution: {35, 35, 35, 35, 35},
+	TagInstitutionAccount:      {35, 35, 35, 35, 35},
+	TagBeneficiaryCustomer:     {35, 35, 35, 35, 35},
+	TagRemittance:              {35, 35, 35, 35},
+	TagSenderToReceiver:        {35, 35, 35, 35, 35, 35},
+	TagRemittanceFreeText:      {140, 140, 140},
+	TagServiceMessage:          {35, 35, 35, 35, 35, 35, 35, 35, 35, 35, 35, 35},
+}
+
+// addressLineWidths are the lengths of the lines of an Address
+var addressLineWidths = []int{35, 35, 35}
+
+// TextLineWidths returns the lengths of the free text lines of tag, or nil when tag has none
+func TextLineWidths(tag string) []int {
+	widths := textLineWidths[tag]
+	if widths == nil {
+		return nil
+	}
+	return append([]int(nil), widths...)
+}
+
+// WrapText wraps s on word boundaries into len(widths) lines, line i holding at most widths[i] characters.
+// Runs of spaces are collapsed, a newline in s starts a new line and words longer than a line are split.
+//
+// Lines are never padded, so they are written with a * delimiter when FormatOptions.VariableLengthFields is set,
+// which is why s can't contain one. When s does not fit the returned lines hold what does, and the error is a
+// FieldError wrapping ErrTextOverflow with the rest of the text as its Value.
+func WrapText(s string, widths ...int) ([]string, error) {
+	lines := make([]string, len(widths))
+	if strings.Contains(s, "*") {
+		return lines, fieldError("Text", ErrTextDelimiter, s)
+	}
+
+	var words [][]string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		if fields := strings.Fields(paragraph); len(fields) > 0 {
+			words = append(words, fields)
+		}
+	}
+
+	line := 0
+	for p, paragraph := range words {
+		if p > 0 && line < len(widths) && lines[line] != "" {
+			line++
+		}
+		for w, word := range paragraph {
+			for word != "" {
+				if line >= len(widths) {
+					return lines, fieldError("Text", ErrTextOverflow, overflowText(word, paragraph[w+1:], words[p+1:]))
+				}
+				current, width := lines[line], widths[line]
+				switch {
+				case current == "" && utf8.RuneCountInString(word) > width:
+					// a word longer than the line is split
+					head, tail := splitRunes(word, width)
+					lines[line], word = head, tail
+					line++
+				case current == "":
+					lines[line], word = word, ""
+				case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+					lines[line], word = current+" "+word, ""
+				default:
+					line++
+				}
+			}
+		}
+	}
+	return lines, nil
+}
+
+// WrapTagText wraps s into the free text lines of tag, see WrapText
+func WrapTagText(tag, s string) ([]string, error) {
+	widths := textLineWidths[tag]
+	if widths == nil {
+		return nil, fieldError("tag", ErrValidTagForType, tag)
+	}
+	return WrapText(s, widths...)
+}
+
+// JoinText joins the lines of a multi-line tag back into a single string for display. Surrounding spaces are
+// trimmed and empty lines skipped.
+func JoinText(lines ...string) string {
+	var parts []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// overflowText rebuilds the text which did not fit from the current word and the words after it
+func overflowText(word string, rest []string, paragraphs [][]string) string {
+	out := strings.Join(append([]string{word}, rest...), " ")
+	for _, paragraph := range paragraphs {
+		out += "\n" + strings.Join(paragraph, " ")
+	}
+	return out
+}
+
+// splitRunes splits s after n runes
+func splitRunes(s string, n int) (string, string) {
+	i := 0
+	for idx := range s {
+		if i == n {
+			return s[:idx], s[idx:]
+		}
+		i++
+	}
+	return s, ""
+}
+
+// SetText wraps s into LineOne through LineFour
+func (ob *OriginatorToBeneficiary) SetText(s string) error {
+	lines, err := WrapTagText(TagOriginatorToBeneficiary, s)
+	ob.LineOne, ob.LineTwo, ob.LineThree, ob.LineFour = lines[0], lines[1], lines[2], lines[3]
+	return err
+}
+
+// Text returns LineOne through LineFour joined into a single string
+func (ob *OriginatorToBeneficiary) Text() string {
+	return JoinText(ob.LineOne, ob.LineTwo, ob.LineThree, ob.LineFour)
+}
+
+// SetText wraps s into LineOne through LineSix, LineOne being shorter as it is in tags {6100} through {6400}
+func (fifi *FIToFI) SetText(s string) error {
+	lines, err := WrapTagText(TagFIReceiverFI, s)
+	fifi.LineOne, fifi.LineTwo, fifi.LineThree = lines[0], lines[1], lines[2]
+	fifi.LineFour, fifi.LineFive, fifi.LineSix = lines[3], lines[4], lines[5]
+	return err
+}
+
+// Text returns LineOne through LineSix joined into a single string
+func (fifi *FIToFI) Text() string {
+	return JoinText(fifi.LineOne, fifi.LineTwo, fifi.LineThree, fifi.LineFour, fifi.LineFive, fifi.LineSix)
+}
+
+// SetText wraps s into LineOne through LineSix
+func (afifi *AdditionalFIToFI) SetText(s string) error {
+	lines, err := WrapTagText(TagFIAdditionalFIToFI, s)
+	afifi.LineOne, afifi.LineTwo, afifi.LineThree = lines[0], lines[1], lines[2]
+	afifi.LineFour, afifi.LineFive, afifi.LineSix = lines[3], lines[4], lines[5]
+	return err
+}
+
+// Text returns LineOne through LineSix joined into a single string
+func (afifi *AdditionalFIToFI) Text() string {
+	return JoinText(afifi.LineOne, afifi.LineTwo, afifi.LineThree, afifi.LineFour, afifi.LineFive, afifi.LineSix)
+}
+
+// SetText wraps s into AddressLineOne through AddressLineThree
+func (a *Address) SetText(s string) error {
+	lines, err := WrapText(s, addressLineWidths...)
+	a.AddressLineOne, a.AddressLineTwo, a.AddressLineThree = lines[0], lines[1], lines[2]
+	return err
+}
+
+// Text returns AddressLineOne through AddressLineThree joined into a single string
+func (a *Address) Text() string {
+	return JoinText(a.AddressLineOne, a.AddressLineTwo, a.AddressLineThree)
+}
+
+// SetText wraps s into the SWIFT lines tag has, four for {7070} Remittance, six for {7072} SenderToReceiver and five
+// for the other cover payment tags. The SwiftFieldTag is left as is.
+func (cp *CoverPayment) SetText(tag, s string) error {
+	switch tag {
+	case TagOrderingCustomer, TagOrderingInstitution, TagIntermediaryInstitution, TagInstitutionAccount,
+		TagBeneficiaryCustomer, TagRemittance, TagSenderToReceiver:
+	default:
+		return fieldError("tag", ErrValidTagForType, tag)
+	}
+	lines, err := WrapTagText(tag, s)
+	lines = append(lines, make([]string, 6-len(lines))...)
+	cp.SwiftLineOne, cp.SwiftLineTwo, cp.SwiftLineThree = lines[0], lines[1], lines[2]
+	cp.SwiftLineFour, cp.SwiftLineFive, cp.SwiftLineSix = lines[3], lines[4], lines[5]
+	return err
+}
+
+// Text returns SwiftLineOne through SwiftLineSix joined into a single string
+func (cp *CoverPayment) Text() string {
+	return JoinText(cp.SwiftLineOne, cp.SwiftLineTwo, cp.SwiftLineThree, cp.SwiftLineFour, cp.SwiftLineFive, cp.SwiftLineSix)
+}
+
+// SetText wraps s into LineOne through LineThree
+func (rft *RemittanceFreeText) SetText(s string) error {
+	lines, err := WrapTagText(TagRemittanceFreeText, s)
+	rft.LineOne, rft.LineTwo, rft.LineThree = lines[0], lines[1], lines[2]
+	return err
+}
+
+// Text returns LineOne through LineThree joined into a single string
+func (rft *RemittanceFreeText) Text() string {
+	return JoinText(rft.LineOne, rft.LineTwo, rft.LineThree)
+}
+
+// SetText wraps s into LineOne through LineTwelve
+func (sm *ServiceMessage) SetText(s string) error {
+	lines, err := WrapTagText(TagServiceMessage, s)
+	sm.LineOne, sm.LineTwo, sm.LineThree, sm.LineFour = lines[0], lines[1], lines[2], lines[3]
+	sm.LineFive, sm.LineSix, sm.LineSeven, sm.LineEight = lines[4], lines[5], lines[6], lines[7]
+	sm.LineNine, sm.LineTen, sm.LineEleven, sm.LineTwelve = lines[8], lines[9], lines[10], lines[11]
+	return err
+}
+
+// Text returns LineOne through LineTwelve joined into a single string
+func (sm *ServiceMessage) Text() string {
+	return JoinText(sm.LineOne, sm.LineTwo, sm.LineThree, sm.LineFour, sm.LineFive, sm.LineSix,
+		sm.LineSeven, sm.LineEight, sm.LineNine, sm.LineTen, sm.LineEleven, sm.LineTwelve)
+}
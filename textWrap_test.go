@@ -0,0 +1,125 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapText(t *testing.T) {
+	lines, err := WrapText("The quick  brown fox jumps over the lazy dog", 10, 10, 10, 10, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"The quick", "brown fox", "jumps over", "the lazy", "dog"}, lines)
+
+	// a newline starts a new line
+	lines, err = WrapText("Invoice 123\nPaid in full", 35, 35, 35)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Invoice 123", "Paid in full", ""}, lines)
+
+	// words longer than a line are split
+	lines, err = WrapText("ABCDEFGHIJKL MN", 5, 5, 5, 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ABCDE", "FGHIJ", "KL MN", ""}, lines)
+
+	lines, err = WrapText("", 35, 35)
+	require.NoError(t, err)
+	require.Equal(t, []string{"", ""}, lines)
+}
+
+func TestWrapText_Overflow(t *testing.T) {
+	lines, err := WrapText("one two three four\nfive", 7, 7)
+	require.True(t, errors.Is(err, ErrTextOverflow))
+	require.Equal(t, []string{"one two", "three"}, lines)
+
+	var fe *FieldError
+	require.True(t, errors.As(err, &fe))
+	require.Equal(t, "four\nfive", fe.Value)
+}
+
+func TestWrapText_Delimiter(t *testing.T) {
+	_, err := WrapText("a * b", 35)
+	require.True(t, errors.Is(err, ErrTextDelimiter))
+}
+
+func TestWrapTagText(t *testing.T) {
+	lines, err := WrapTagText(TagFIReceiverFI, strings.Repeat("x", 30+33))
+	require.NoError(t, err)
+	require.Len(t, lines, 6)
+	require.Equal(t, strings.Repeat("x", 30), lines[0])
+	require.Equal(t, strings.Repeat("x", 33), lines[1])
+
+	_, err = WrapTagText(TagAmount, "text")
+	require.True(t, errors.Is(err, ErrValidTagForType))
+	require.Nil(t, TextLineWidths(TagAmount))
+	require.Len(t, TextLineWidths(TagServiceMessage), 12)
+}
+
+func TestJoinText(t *testing.T) {
+	require.Equal(t, "Invoice 123 Paid in full", JoinText(" Invoice 123 ", "", "Paid in full"))
+	require.Equal(t, "", JoinText())
+}
+
+func TestOriginatorToBeneficiary_SetText(t *testing.T) {
+	text := "Payment for invoices 1001, 1002 and 1003 issued in March, thank you for your business"
+	ob := NewOriginatorToBeneficiary()
+	require.NoError(t, ob.SetText(text))
+	require.Equal(t, "Payment for invoices 1001, 1002 and", ob.LineOne)
+	require.Equal(t, text, ob.Text())
+	require.NoError(t, ob.Validate())
+
+	// the lines are written and read back with variable length fields
+	ob2 := NewOriginatorToBeneficiary()
+	require.NoError(t, ob2.Parse(ob.Format(FormatOptions{VariableLengthFields: true})))
+	require.Equal(t, text, ob2.Text())
+
+	require.True(t, errors.Is(ob.SetText(strings.Repeat("word ", 40)), ErrTextOverflow))
+}
+
+func TestCoverPayment_SetText(t *testing.T) {
+	text := strings.TrimSpace(strings.Repeat("lorem ipsum ", 18))
+
+	cp := CoverPayment{}
+	require.NoError(t, cp.SetText(TagSenderToReceiver, text))
+	require.NotEmpty(t, cp.SwiftLineSix)
+	require.Equal(t, text, cp.Text())
+
+	cp = CoverPayment{}
+	err := cp.SetText(TagRemittance, text)
+	require.True(t, errors.Is(err, ErrTextOverflow))
+	require.Empty(t, cp.SwiftLineFive)
+
+	require.True(t, errors.Is(cp.SetText(TagOriginatorToBeneficiary, text), ErrValidTagForType))
+}
+
+func TestMultiLineTags_SetText(t *testing.T) {
+	text := "Beneficiary bank requires the account title and full address of the beneficiary"
+
+	fifi := FIToFI{}
+	require.NoError(t, fifi.SetText(text))
+	require.LessOrEqual(t, len(fifi.LineOne), 30)
+	require.Equal(t, text, fifi.Text())
+
+	afifi := AdditionalFIToFI{}
+	require.NoError(t, afifi.SetText(text))
+	require.Equal(t, text, afifi.Text())
+
+	sm := NewServiceMessage()
+	require.NoError(t, sm.SetText(text))
+	require.Equal(t, text, sm.Text())
+
+	rft := NewRemittanceFreeText()
+	require.NoError(t, rft.SetText(text))
+	require.Equal(t, text, rft.LineOne)
+	require.Equal(t, text, rft.Text())
+
+	addr := Address{}
+	require.NoError(t, addr.SetText("1000 Colonial Farm Rd\nSuite 3\nPottstown PA 19464"))
+	require.Equal(t, "Suite 3", addr.AddressLineTwo)
+	require.Equal(t, "1000 Colonial Farm Rd Suite 3 Pottstown PA 19464", addr.Text())
+}
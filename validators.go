@@ -348,6 +348,23 @@ func (v *validator) isCurrencyCode(code string) error {
 	return nil
 }
 
+// isCurrencyAmount checks the decimal places of amount do not exceed the minor units of the currency code
+func (v *validator) isCurrencyAmount(code string, amount string) error {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return ErrNonCurrencyCode
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	_, decimals, err := parseDecimalAmount(amount)
+	if err != nil {
+		return err
+	}
+	if decimals > scale {
+		return ErrCurrencyPrecision
+	}
+	return nil
+}
+
 // isCentury validates a 2 digit century 20-29
 func (v *validator) isCentury(s string) error {
 	if s < "20" || s > "29" {